@@ -0,0 +1,418 @@
+package lckbx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const accountMagic = "lckbx account bundle\n"
+
+// accountHeader is stored, as a single line of JSON, after the accountMagic
+// at the start of an account bundle. The UserName is needed, along with the
+// password, to derive the key that opens the bundle. The whole line is used
+// as associated data when encrypting the accountRecords.
+type accountHeader struct {
+	UserName string
+	Deriver  string
+	Crypter  string
+}
+
+// accountRecords holds a user's records exactly as they are stored in the
+// database. The User is encrypted with the AuthKey, the Keyset with the
+// Keyset CryptKey, and the Metadata, Items, Attachments, and Revisions with
+// keys from the Keyset.
+type accountRecords struct {
+	UserId      UserToken
+	AuthToken   AuthToken
+	User        []byte
+	KeysetId    KeysetToken
+	Keyset      []byte
+	MetadataId  MetadataToken
+	Metadata    []byte
+	Items       map[string][]byte
+	Attachments map[string][]byte `json:",omitempty"`
+	Revisions   map[string][]byte `json:",omitempty"`
+	RecoveryId  AuthToken
+	Recovery    []byte
+}
+
+// Export Account
+//  1. Copy the user's User, Keyset, Metadata, Items, Attachments, Revisions,
+//     and recovery record from the store without decrypting them.
+//  2. Encrypt the records with the Keyset CryptKey, using the header as
+//     associated data.
+//  3. Write the header and the encrypted records.
+//
+// The bundle can only be opened with the user's password and can be loaded
+// into another Store with LockedBox.ImportAccount.
+func (u *UnlockedBox) ExportAccount(w io.Writer) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// 1.  Copy the user's records from the store.
+	records := accountRecords{
+		UserId:      u.user.UserId,
+		AuthToken:   u.authToken,
+		KeysetId:    u.user.KeysetId,
+		MetadataId:  u.user.MetadataId,
+		RecoveryId:  u.user.RecoveryId,
+		Items:       make(map[string][]byte),
+		Attachments: make(map[string][]byte),
+		Revisions:   make(map[string][]byte),
+	}
+
+	err := u.store.View(func(r recorder) error {
+		var err error
+
+		records.User, err = r.GetUser(u.authToken)
+		if err != nil {
+			return err
+		}
+
+		records.Keyset, err = r.GetKeyset(u.user.KeysetId)
+		if err != nil {
+			return err
+		}
+
+		records.Metadata, err = r.GetMetadata(u.user.MetadataId)
+		if err != nil {
+			return err
+		}
+
+		for _, imd := range u.metadata.GetItems() {
+			item, err := r.GetItem(imd.ItemId)
+			if err != nil {
+				return err
+			}
+
+			records.Items[imd.ItemId.String()] = item
+
+			for _, amd := range imd.Attachments {
+				att, err := r.GetAttachment(amd.AttachmentId)
+				if err != nil {
+					return err
+				}
+
+				records.Attachments[amd.AttachmentId.String()] = att
+			}
+
+			for _, rmd := range imd.Revisions {
+				rev, err := r.GetRevision(rmd.RevisionId)
+				if err != nil {
+					return err
+				}
+
+				records.Revisions[rmd.RevisionId.String()] = rev
+			}
+		}
+
+		if u.user.RecoveryId != (AuthToken{}) {
+			records.Recovery, err = r.GetRecovery(u.user.RecoveryId)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportAccount: %v", err)
+	}
+
+	// 2.  Encrypt the records with the Keyset CryptKey.
+	header, err := json.Marshal(accountHeader{
+		UserName: u.user.UserName,
+		Deriver:  u.version.String(),
+		Crypter:  xChaChaCrypterVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportAccount: %v", err)
+	}
+
+	plaintext, err := json.Marshal(records)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportAccount: %v", err)
+	}
+
+	u.crypt.ChangeKey(u.keysetKey[:])
+	encrypted, err := u.crypt.Encrypt(plaintext, header)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportAccount: %v", err)
+	}
+
+	// 3.  Write the header and the encrypted records.
+	var out bytes.Buffer
+	out.WriteString(accountMagic)
+	out.Write(header)
+	out.WriteString("\n")
+	out.Write(encrypted)
+
+	_, err = w.Write(out.Bytes())
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportAccount: %v", err)
+	}
+
+	return nil
+}
+
+// readAccountBundle reads the header and the encrypted records from an
+// account bundle.
+func readAccountBundle(rd io.Reader) (accountHeader, []byte, []byte, error) {
+	var h accountHeader
+
+	r := bufio.NewReader(rd)
+
+	magic := make([]byte, len(accountMagic))
+	_, err := io.ReadFull(r, magic)
+	if err != nil || string(magic) != accountMagic {
+		return h, nil, nil, fmt.Errorf("not an account bundle")
+	}
+
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return h, nil, nil, fmt.Errorf("missing header")
+	}
+
+	header := bytes.TrimSuffix(line, []byte("\n"))
+	err = json.Unmarshal(header, &h)
+	if err != nil {
+		return h, nil, nil, err
+	}
+
+	encrypted, err := io.ReadAll(r)
+	if err != nil {
+		return h, nil, nil, err
+	}
+
+	return h, header, encrypted, nil
+}
+
+// Import Account
+//  1. Read the bundle and derive the user's keys from the exported username
+//     and the password, with the deriver version recorded in the bundle.
+//  2. Decrypt the records and ensure the User and Keyset open with the
+//     derived keys.
+//  3. If the account is imported under a new username, derive the keys for
+//     the new username and reencrypt the User and Keyset with them. The
+//     recovery phrase depends on the username, so it is dropped.
+//  4. Save the records in a single transaction, failing if the username or
+//     any of the records already exist in this Store.
+//
+// If username is empty, the account is imported under the username it was
+// exported with. After the import the user logs in with the same password,
+// and is moved to this LockedBox's deriver if theirs is cheaper.
+func (l *LockedBox) ImportAccount(rd io.Reader, username, password string) error {
+	password = norm.NFKD.String(password)
+
+	// 1.  Read the bundle and derive the user's keys.
+	h, header, encrypted, err := readAccountBundle(rd)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	version, err := parseVersionToken(h.Deriver)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: unsupported bundle version")
+	}
+
+	if _, ok := deriverRank(version); !ok || h.Crypter != xChaChaCrypterVersion {
+		return fmt.Errorf("could not LockedBox.ImportAccount: unsupported bundle version")
+	}
+
+	derive := NewDeriver(version)
+
+	baseKey, err := derive.DeriveBaseKey(h.UserName, password)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	ak, err := derive.DeriveAuthKey(baseKey)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	ck, err := derive.DeriveCryptKey(baseKey, nil)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	// 2.  Decrypt the records and ensure the User and Keyset open.
+	l.crypt.ChangeKey(ck[:])
+	plaintext, err := l.crypt.Decrypt(encrypted, header)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: wrong password or damaged bundle")
+	}
+
+	var records accountRecords
+	err = json.Unmarshal(plaintext, &records)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	at, err := derive.DeriveAuthToken(baseKey, records.UserId)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	l.crypt.ChangeKey(ak[:])
+	user, err := newUserFromBytes(l.crypt, records.User, []byte(records.UserId.String()))
+	if err != nil || at != records.AuthToken {
+		return fmt.Errorf("could not LockedBox.ImportAccount: the User does not match the bundle")
+	}
+
+	l.crypt.ChangeKey(ck[:])
+	keyset, err := newKeysetFromBytes(l.crypt, records.Keyset, []byte(records.KeysetId.String()))
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	// 3.  If the account is imported under a new username, reencrypt the
+	//     User and Keyset with keys derived from the new username.
+	if username == "" {
+		username = h.UserName
+	}
+	username = NormalizeUserName(username)
+
+	if username != user.UserName {
+		baseKey, err = derive.DeriveBaseKey(username, password)
+		if err != nil {
+			return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+		}
+
+		ak, err = derive.DeriveAuthKey(baseKey)
+		if err != nil {
+			return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+		}
+
+		at, err = derive.DeriveAuthToken(baseKey, user.UserId)
+		if err != nil {
+			return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+		}
+
+		ck, err = derive.DeriveCryptKey(baseKey, nil)
+		if err != nil {
+			return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+		}
+
+		user.UserName = username
+		user.RecoveryId = AuthToken{}
+		user.RecoveryKey = CryptKey{}
+		records.Recovery = nil
+
+		l.crypt.ChangeKey(ak[:])
+		records.User, err = user.bytes(l.crypt)
+		if err != nil {
+			return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+		}
+
+		l.crypt.ChangeKey(ck[:])
+		records.Keyset, err = keyset.bytes(l.crypt)
+		if err != nil {
+			return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+		}
+	}
+
+	// 4.  Save the records in a single transaction.
+	err = l.store.Update(func(r recorder) error {
+		if r.GetUserId(username) != (UserToken{}) {
+			return fmt.Errorf("user %s already exists, import the account under a different username", username)
+		}
+
+		if _, err := r.GetKeyset(user.KeysetId); err == nil {
+			return fmt.Errorf("keyset %s already exists, the account was already imported", user.KeysetId)
+		}
+
+		if _, err := r.GetMetadata(user.MetadataId); err == nil {
+			return fmt.Errorf("metadata %s already exists, the account was already imported", user.MetadataId)
+		}
+
+		err := r.SaveUserId(username, user.UserId)
+		if err != nil {
+			return err
+		}
+
+		err = r.SaveDeriverVersion(user.UserId, version)
+		if err != nil {
+			return err
+		}
+
+		err = r.SaveUser(at, records.User)
+		if err != nil {
+			return err
+		}
+
+		err = r.SaveKeyset(user.KeysetId, records.Keyset)
+		if err != nil {
+			return err
+		}
+
+		err = r.SaveMetadata(user.MetadataId, records.Metadata)
+		if err != nil {
+			return err
+		}
+
+		for id, item := range records.Items {
+			iid, err := parseItemToken(id)
+			if err != nil {
+				return err
+			}
+
+			if _, err := r.GetItem(iid); err == nil {
+				return fmt.Errorf("item %s already exists", iid)
+			}
+
+			err = r.SaveItem(iid, item)
+			if err != nil {
+				return err
+			}
+		}
+
+		for id, att := range records.Attachments {
+			aid, err := parseAttachmentToken(id)
+			if err != nil {
+				return err
+			}
+
+			if _, err := r.GetAttachment(aid); err == nil {
+				return fmt.Errorf("attachment %s already exists", aid)
+			}
+
+			err = r.SaveAttachment(aid, att)
+			if err != nil {
+				return err
+			}
+		}
+
+		for id, rev := range records.Revisions {
+			rid, err := parseRevisionToken(id)
+			if err != nil {
+				return err
+			}
+
+			if _, err := r.GetRevision(rid); err == nil {
+				return fmt.Errorf("revision %s already exists", rid)
+			}
+
+			err = r.SaveRevision(rid, rev)
+			if err != nil {
+				return err
+			}
+		}
+
+		if records.Recovery != nil {
+			return r.SaveRecovery(records.RecoveryId, records.Recovery)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.ImportAccount: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package lckbx
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var (
+	accountSrcDB = "account_src_test.db"
+	accountDstDB = "account_dst_test.db"
+	accountUser  = "account_user"
+)
+
+// End-to-end test for moving an account between Stores
+//  1. Register a user with a recovery phrase and add some items.
+//  2. Export the account and import it into a second Store.
+//  3. Login to the second Store and ensure the items and the recovery phrase
+//     work.
+//  4. Ensure importing again fails and a wrong password is rejected.
+//  5. Import the account under a new username and login with the same
+//     password.
+func TestAccountExportImport(t *testing.T) {
+	fmt.Println(t.Name())
+
+	// 1.  Register a user with a recovery phrase and add some items.
+	src, err := NewStore(accountSrcDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(accountSrcDB)
+	defer src.Close()
+
+	slb, err := NewLockedBox(&src)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	phrase, err := slb.RegisterWithRecovery(accountUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := slb.login(accountUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var notes []NoteItem
+	for i := 0; i < 3; i++ {
+		n := NewNoteItem()
+		n.Name = fmt.Sprintf("Note %d", i)
+		n.Data = []byte(n.Name)
+
+		err = ub.AddNoteItem(n)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		notes = append(notes, n)
+	}
+
+	// 2.  Export the account and import it into a second Store.
+	var bundle bytes.Buffer
+	err = ub.ExportAccount(&bundle)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	dst, err := NewStore(accountDstDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(accountDstDB)
+	defer dst.Close()
+
+	dlb, err := NewLockedBox(&dst)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = dlb.ImportAccount(bytes.NewReader(bundle.Bytes()), "", lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 3.  Login to the second Store and ensure the items and the recovery
+	//     phrase work.
+	ub, err = dlb.login(accountUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, n := range notes {
+		n2, err := ub.GetItem(n.ItemId)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		if !n.Equal(n2) {
+			t.Fatalf("Expected %v, received %v", n, n2)
+		}
+	}
+	ub.Lock()
+
+	err = dlb.RecoverAccount(accountUser, phrase, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 4.  Ensure importing again fails and a wrong password is rejected.
+	err = dlb.ImportAccount(bytes.NewReader(bundle.Bytes()), "", lockedBoxGoodPassword)
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	err = dlb.ImportAccount(bytes.NewReader(bundle.Bytes()), "other_user", lockedBoxBadPassword)
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	// 5.  Import the account under a new username and login with the same
+	//     password.
+	err = slb.DeleteAccount(accountUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = slb.ImportAccount(bytes.NewReader(bundle.Bytes()), "Renamed_User", lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err = slb.login("renamed_user", lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	if ub.GetUserName() != "renamed_user" {
+		t.Fatalf("Expected renamed_user, received %s", ub.GetUserName())
+	}
+
+	if ub.HasRecoveryPhrase() {
+		t.Fatal("Expected the recovery phrase to be dropped")
+	}
+
+	if len(ub.GetItemList()) != len(notes) {
+		t.Fatalf("Expected %d items, received %d", len(notes), len(ub.GetItemList()))
+	}
+
+	if _, err := ub.GetItem(notes[0].ItemId); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+}
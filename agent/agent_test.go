@@ -0,0 +1,355 @@
+package agent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lckbx"
+)
+
+var (
+	agentUser     = "agent_user"
+	agentPassword = "agent-violin-gravel-usher"
+)
+
+// newTestBox registers a user in a new store and returns the UnlockedBox.
+func newTestBox(t *testing.T) *lckbx.UnlockedBox {
+	store, err := lckbx.NewStore(filepath.Join(t.TempDir(), "agent_test.db"))
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	lb, err := lckbx.NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(agentUser, agentPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.Login(agentUser, agentPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return &ub
+}
+
+func TestAgent(t *testing.T) {
+	fmt.Println(t.Name())
+
+	ub := newTestBox(t)
+	path := filepath.Join(t.TempDir(), "agent", "agent.sock")
+
+	server, err := NewServer(ub, path, 0)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- server.Serve() }()
+
+	// The socket must only be accessible by the current user.
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected socket mode 0600, received %v", info.Mode().Perm())
+	}
+
+	// A second agent cannot use the same socket.
+	_, err = NewServer(ub, path, 0)
+	if err == nil {
+		t.Fatal("Expected error for running agent, received nil")
+	}
+
+	// An existing directory that other users can open is refused.
+	open := filepath.Join(t.TempDir(), "open")
+	err = os.Mkdir(open, 0700)
+	if err == nil {
+		err = os.Chmod(open, 0755)
+	}
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	_, err = NewServer(ub, filepath.Join(open, "agent.sock"), 0)
+	if err == nil {
+		t.Fatal("Expected error for a directory other users can open, received nil")
+	}
+
+	client, err := Dial(path)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer client.Close()
+
+	username, err := client.GetUserName()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if username != agentUser {
+		t.Fatalf("Expected %s, received %s", agentUser, username)
+	}
+
+	// Add, read, update and delete an item through the agent.
+	note := lckbx.NewNoteItem()
+	note.Name = "Agent Note"
+	note.Data = []byte("Stored through the agent.")
+
+	err = client.AddNoteItem(note)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	items, err := client.GetItemList()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(items) != 1 || items[0].ItemId != note.ItemId {
+		t.Fatalf("Expected one item %s, received %+v", note.ItemId, items)
+	}
+
+	items, err = client.GetItemListWithOptions(lckbx.ItemListOptions{Type: lckbx.LoginType})
+	if err != nil || len(items) != 0 {
+		t.Fatalf("Expected no logins, received %+v and %v", items, err)
+	}
+
+	results, err := client.Search("stored agnet", lckbx.ItemListOptions{})
+	if err != nil || len(results) != 1 || results[0].Item.ItemId != note.ItemId {
+		t.Fatalf("Expected the note, received %+v and %v", results, err)
+	}
+
+	if _, err := client.Search("", lckbx.ItemListOptions{}); err == nil {
+		t.Fatal("Expected error for an empty query, received nil")
+	}
+
+	csv := []byte("url,username,password\nhttps://example.com,bob,pw\n")
+	report, err := client.Import("", csv, lckbx.ImportOptions{DryRun: true})
+	if err != nil || report.Format != "csv" || report.Items != 1 {
+		t.Fatalf("Expected one csv item, received %+v and %v", report, err)
+	}
+
+	if _, err := client.Import("kdbx", []byte("not a database"), lckbx.ImportOptions{}); err == nil {
+		t.Fatal("Expected error for an invalid KeePass database, received nil")
+	}
+
+	if _, err := client.Export(lckbx.ExportJSON, lckbx.ExportOptions{}); err == nil {
+		t.Fatal("Expected error for an unconfirmed plaintext export, received nil")
+	}
+
+	exported, err := client.Export(lckbx.ExportJSON, lckbx.ExportOptions{Plaintext: true})
+	if err != nil || !bytes.Contains(exported, []byte(note.Name)) {
+		t.Fatalf("Expected the note in the export, received %s and %v", exported, err)
+	}
+
+	// Organize the note with a folder and a tag.
+	fid, err := client.CreateFolder("Agent", lckbx.FolderToken{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = client.MoveItem(note.ItemId, fid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = client.TagItem(note.ItemId, "agent")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	items, err = client.GetItemListWithOptions(lckbx.ItemListOptions{Folder: &fid, Tag: "agent"})
+	if err != nil || len(items) != 1 {
+		t.Fatalf("Expected the note, received %+v and %v", items, err)
+	}
+
+	folders, err := client.GetFolders()
+	if err != nil || len(folders) != 1 || folders[0].Name != "Agent" {
+		t.Fatalf("Expected the Agent folder, received %+v and %v", folders, err)
+	}
+
+	tags, err := client.GetTags()
+	if err != nil || len(tags) != 1 {
+		t.Fatalf("Expected the agent tag, received %v and %v", tags, err)
+	}
+
+	note2, err := client.GetItem(note.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !note2.Equal(note) {
+		t.Fatalf("Expected NoteItems to be equal, received: \n%+v\n%+v\n", note, note2)
+	}
+
+	note2.Data = []byte("Updated through the agent.")
+	err = client.UpdateNoteItem(note2)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	note3, err := client.GetItem(note.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !bytes.Equal(note3.Data, note2.Data) {
+		t.Fatalf("Expected %s, received %s", note2.Data, note3.Data)
+	}
+
+	// One-time codes are generated by the agent.
+	otp := lckbx.NewItem(lckbx.OTPType)
+	otp.Name = "Agent OTP"
+	otp.OTP.Secret = "JBSWY3DPEHPK3PXP"
+
+	err = client.AddItem(otp)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	code, expires, err := client.GetOTPCode(otp.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(code) != 6 || expires < 1 {
+		t.Fatalf("Expected a six digit code, received %q expiring in %d", code, expires)
+	}
+
+	_, _, err = client.GetOTPCode(note.ItemId)
+	if err == nil {
+		t.Fatal("Expected error for a note, received nil")
+	}
+
+	// Attachments are stored and extracted through the agent.
+	aid, err := client.AddAttachment(note.ItemId, "agent.txt", strings.NewReader("attached"))
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	atts, err := client.GetAttachmentList(note.ItemId)
+	if err != nil || len(atts) != 1 || atts[0].AttachmentId != aid {
+		t.Fatalf("Expected one attachment, received %+v, %v", atts, err)
+	}
+
+	var data bytes.Buffer
+	err = client.ExtractAttachment(note.ItemId, aid, &data)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if data.String() != "attached" {
+		t.Fatalf("Expected attached, received %s", data.String())
+	}
+
+	err = client.DeleteAttachment(note.ItemId, aid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = client.DeleteItem(otp.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = client.DeleteItem(note.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	_, err = client.GetItem(note.ItemId)
+	if err == nil {
+		t.Fatal("Expected error for deleted item, received nil")
+	}
+
+	trash, err := client.GetTrashList()
+	if err != nil || len(trash) != 2 {
+		t.Fatalf("Expected two items in the trash, received %v and %v", trash, err)
+	}
+
+	err = client.RestoreItem(note.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = client.SetTrashDays(7)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	days, err := client.GetTrashDays()
+	if err != nil || days != 7 {
+		t.Fatalf("Expected seven days, received %d and %v", days, err)
+	}
+
+	purged, err := client.EmptyTrash()
+	if err != nil || purged != 1 {
+		t.Fatalf("Expected one item purged, received %d and %v", purged, err)
+	}
+
+	_, err = client.GetItem(note.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// Locking the agent stops the server and removes the socket.
+	err = client.Lock()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected agent to stop after lock")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected socket to be removed, received %v", err)
+	}
+}
+
+func TestAgentIdleTimeout(t *testing.T) {
+	fmt.Println(t.Name())
+
+	ub := newTestBox(t)
+	path := filepath.Join(t.TempDir(), "agent", "agent.sock")
+
+	server, err := NewServer(ub, path, 100*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- server.Serve() }()
+
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected agent to stop after the idle timeout")
+	}
+
+	_, err = Dial(path)
+	if err == nil {
+		t.Fatal("Expected error connecting to a locked agent, received nil")
+	}
+}
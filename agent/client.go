@@ -0,0 +1,400 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+
+	"lckbx"
+)
+
+// Client sends requests to a running agent.
+type Client struct {
+	conn net.Conn
+	enc  *json.Encoder
+	dec  *json.Decoder
+}
+
+// call sends a request to the agent and waits for the response.
+func (c *Client) call(req request) (response, error) {
+	var resp response
+
+	err := c.enc.Encode(req)
+	if err != nil {
+		return resp, fmt.Errorf("could not send request to agent: %v", err)
+	}
+
+	err = c.dec.Decode(&resp)
+	if err != nil {
+		return resp, fmt.Errorf("could not read response from agent: %v", err)
+	}
+
+	if resp.Error != "" {
+		return resp, fmt.Errorf("agent: %s", resp.Error)
+	}
+
+	return resp, nil
+}
+
+// GetUserName returns the username of the UnlockedBox held by the agent.
+func (c *Client) GetUserName() (string, error) {
+	resp, err := c.call(request{Op: opStatus})
+	return resp.UserName, err
+}
+
+// GetItemList returns the ItemMetadata for every item in the box.
+func (c *Client) GetItemList() ([]lckbx.ItemMetadata, error) {
+	resp, err := c.call(request{Op: opList})
+	return resp.Items, err
+}
+
+// GetItemListWithOptions returns the ItemMetadata for the items in the box
+// that match the options, in the order given by the options.
+func (c *Client) GetItemListWithOptions(opts lckbx.ItemListOptions) ([]lckbx.ItemMetadata, error) {
+	resp, err := c.call(request{Op: opList, Options: &opts})
+	return resp.Items, err
+}
+
+// Search returns the items that match every word in the query, best match
+// first, limited by the Type, Folder, and Tag in the options.
+func (c *Client) Search(query string, opts lckbx.ItemListOptions) ([]lckbx.SearchResult, error) {
+	resp, err := c.call(request{Op: opSearch, Query: query, Options: &opts})
+	return resp.Results, err
+}
+
+// GetItem returns the Item associated with the given ItemId.
+func (c *Client) GetItem(iid lckbx.ItemToken) (lckbx.Item, error) {
+	var item lckbx.Item
+
+	resp, err := c.call(request{Op: opGet, ItemId: iid})
+	if err != nil {
+		return item, err
+	}
+
+	if resp.Item == nil {
+		return item, fmt.Errorf("agent: missing item in response")
+	}
+
+	return *resp.Item, nil
+}
+
+// AddItem adds a new Item to the box.
+func (c *Client) AddItem(i lckbx.Item) error {
+	_, err := c.call(request{Op: opAdd, Item: &i})
+	return err
+}
+
+// AddNoteItem adds a new NoteItem to the box. It is the same as AddItem.
+func (c *Client) AddNoteItem(n lckbx.NoteItem) error {
+	return c.AddItem(n)
+}
+
+// UpdateItem saves changes to an existing Item.
+func (c *Client) UpdateItem(i lckbx.Item) error {
+	_, err := c.call(request{Op: opUpdate, Item: &i})
+	return err
+}
+
+// UpdateNoteItem saves changes to an existing NoteItem. It is the same as
+// UpdateItem.
+func (c *Client) UpdateNoteItem(n lckbx.NoteItem) error {
+	return c.UpdateItem(n)
+}
+
+// GetOTPCode returns the current one-time code for an OTP item and the
+// number of seconds it remains valid.
+func (c *Client) GetOTPCode(iid lckbx.ItemToken) (string, int, error) {
+	resp, err := c.call(request{Op: opOTP, ItemId: iid})
+	return resp.Code, resp.Expires, err
+}
+
+// AddAttachment adds the file read from src to an item and returns the id
+// of the new attachment. Requests are sent whole, so the file is read into
+// memory before it is sent to the agent.
+func (c *Client) AddAttachment(iid lckbx.ItemToken, name string, src io.Reader) (lckbx.AttachmentToken, error) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return lckbx.AttachmentToken{}, err
+	}
+
+	att := lckbx.Attachment{ItemId: iid, Name: name, Data: data}
+
+	resp, err := c.call(request{Op: opAttach, ItemId: iid, Attachment: &att})
+	return resp.AttachmentId, err
+}
+
+// GetAttachmentList returns the AttachmentMetadata for every attachment on
+// an item.
+func (c *Client) GetAttachmentList(iid lckbx.ItemToken) ([]lckbx.AttachmentMetadata, error) {
+	resp, err := c.call(request{Op: opAttachments, ItemId: iid})
+	return resp.Attachments, err
+}
+
+// ExtractAttachment writes the file of an attachment on an item to w.
+func (c *Client) ExtractAttachment(iid lckbx.ItemToken, aid lckbx.AttachmentToken, w io.Writer) error {
+	resp, err := c.call(request{Op: opExtract, ItemId: iid, AttachmentId: aid})
+	if err != nil {
+		return err
+	}
+
+	if resp.Attachment == nil {
+		return fmt.Errorf("agent: missing attachment in response")
+	}
+
+	_, err = w.Write(resp.Attachment.Data)
+	return err
+}
+
+// DeleteAttachment removes an attachment from an item.
+func (c *Client) DeleteAttachment(iid lckbx.ItemToken, aid lckbx.AttachmentToken) error {
+	_, err := c.call(request{Op: opDetach, ItemId: iid, AttachmentId: aid})
+	return err
+}
+
+// GetRevisionList returns the RevisionMetadata for every revision of an
+// item, newest first.
+func (c *Client) GetRevisionList(iid lckbx.ItemToken) ([]lckbx.RevisionMetadata, error) {
+	resp, err := c.call(request{Op: opRevisions, ItemId: iid})
+	return resp.Revisions, err
+}
+
+// GetRevision returns a revision of an item.
+func (c *Client) GetRevision(iid lckbx.ItemToken, rid lckbx.RevisionToken) (lckbx.Revision, error) {
+	var rev lckbx.Revision
+
+	resp, err := c.call(request{Op: opRevision, ItemId: iid, RevisionId: rid})
+	if err != nil {
+		return rev, err
+	}
+
+	if resp.Revision == nil {
+		return rev, fmt.Errorf("agent: missing revision in response")
+	}
+
+	return *resp.Revision, nil
+}
+
+// DiffRevisions compares two versions of an item. The zero RevisionToken
+// refers to the current item.
+func (c *Client) DiffRevisions(iid lckbx.ItemToken, from, to lckbx.RevisionToken) (lckbx.Diff, error) {
+	resp, err := c.call(request{Op: opDiff, ItemId: iid, RevisionId: from, ToRevisionId: to})
+	return resp.Diff, err
+}
+
+// RestoreRevision replaces an item with one of its revisions.
+func (c *Client) RestoreRevision(iid lckbx.ItemToken, rid lckbx.RevisionToken) error {
+	_, err := c.call(request{Op: opRestore, ItemId: iid, RevisionId: rid})
+	return err
+}
+
+// GetRevisionLimit returns the limits on the revisions kept for each item.
+func (c *Client) GetRevisionLimit() (lckbx.RevisionLimit, error) {
+	resp, err := c.call(request{Op: opGetLimit})
+	if err != nil {
+		return lckbx.RevisionLimit{}, err
+	}
+
+	if resp.Limit == nil {
+		return lckbx.RevisionLimit{}, fmt.Errorf("agent: missing revision limit in response")
+	}
+
+	return *resp.Limit, nil
+}
+
+// SetRevisionLimit changes the limits on the revisions kept for each item.
+func (c *Client) SetRevisionLimit(limit lckbx.RevisionLimit) error {
+	_, err := c.call(request{Op: opSetLimit, Limit: &limit})
+	return err
+}
+
+// DeleteItem moves an item to the trash.
+func (c *Client) DeleteItem(iid lckbx.ItemToken) error {
+	_, err := c.call(request{Op: opDelete, ItemId: iid})
+	return err
+}
+
+// GetTrashList returns the metadata of every item in the trash.
+func (c *Client) GetTrashList() ([]lckbx.ItemMetadata, error) {
+	resp, err := c.call(request{Op: opTrash})
+	return resp.Items, err
+}
+
+// RestoreItem moves an item out of the trash.
+func (c *Client) RestoreItem(iid lckbx.ItemToken) error {
+	_, err := c.call(request{Op: opUndelete, ItemId: iid})
+	return err
+}
+
+// PurgeItem permanently deletes an item in the trash.
+func (c *Client) PurgeItem(iid lckbx.ItemToken) error {
+	_, err := c.call(request{Op: opPurge, ItemId: iid})
+	return err
+}
+
+// EmptyTrash permanently deletes every item in the trash and returns the
+// number of items deleted.
+func (c *Client) EmptyTrash() (int, error) {
+	resp, err := c.call(request{Op: opEmptyTrash})
+	return resp.Purged, err
+}
+
+// GetTrashDays returns the number of days items stay in the trash.
+func (c *Client) GetTrashDays() (int, error) {
+	resp, err := c.call(request{Op: opGetTrashDays})
+	if err != nil {
+		return 0, err
+	}
+
+	if resp.Days == nil {
+		return 0, fmt.Errorf("agent: missing trash days in response")
+	}
+
+	return *resp.Days, nil
+}
+
+// SetTrashDays changes the number of days items stay in the trash.
+func (c *Client) SetTrashDays(days int) error {
+	_, err := c.call(request{Op: opSetTrashDays, Days: &days})
+	return err
+}
+
+// GetFolders returns every folder, sorted by path.
+func (c *Client) GetFolders() ([]lckbx.Folder, error) {
+	resp, err := c.call(request{Op: opFolders})
+	return resp.Folders, err
+}
+
+// CreateFolder adds a new folder inside the parent folder.
+func (c *Client) CreateFolder(name string, parent lckbx.FolderToken) (lckbx.FolderToken, error) {
+	resp, err := c.call(request{Op: opCreateFolder, Name: name, ParentId: parent})
+	return resp.FolderId, err
+}
+
+// RenameFolder changes the name of a folder.
+func (c *Client) RenameFolder(fid lckbx.FolderToken, name string) error {
+	_, err := c.call(request{Op: opRenameFolder, FolderId: fid, Name: name})
+	return err
+}
+
+// MoveFolder moves a folder inside the parent folder.
+func (c *Client) MoveFolder(fid, parent lckbx.FolderToken) error {
+	_, err := c.call(request{Op: opMoveFolder, FolderId: fid, ParentId: parent})
+	return err
+}
+
+// DeleteFolder removes a folder, moving what it holds to its parent.
+func (c *Client) DeleteFolder(fid lckbx.FolderToken) error {
+	_, err := c.call(request{Op: opDeleteFolder, FolderId: fid})
+	return err
+}
+
+// MoveItem moves an item into a folder.
+func (c *Client) MoveItem(iid lckbx.ItemToken, fid lckbx.FolderToken) error {
+	_, err := c.call(request{Op: opMoveItem, ItemId: iid, FolderId: fid})
+	return err
+}
+
+// GetTags returns every tag, sorted by name.
+func (c *Client) GetTags() ([]string, error) {
+	resp, err := c.call(request{Op: opTags})
+	return resp.Tags, err
+}
+
+// CreateTag adds a tag that can be given to items.
+func (c *Client) CreateTag(tag string) error {
+	_, err := c.call(request{Op: opCreateTag, Tag: tag})
+	return err
+}
+
+// RenameTag changes the name of a tag on every item that has it.
+func (c *Client) RenameTag(tag, name string) error {
+	_, err := c.call(request{Op: opRenameTag, Tag: tag, Name: name})
+	return err
+}
+
+// DeleteTag removes a tag from every item that has it.
+func (c *Client) DeleteTag(tag string) error {
+	_, err := c.call(request{Op: opDeleteTag, Tag: tag})
+	return err
+}
+
+// TagItem gives an item a tag.
+func (c *Client) TagItem(iid lckbx.ItemToken, tag string) error {
+	_, err := c.call(request{Op: opTagItem, ItemId: iid, Tag: tag})
+	return err
+}
+
+// UntagItem removes a tag from an item.
+func (c *Client) UntagItem(iid lckbx.ItemToken, tag string) error {
+	_, err := c.call(request{Op: opUntagItem, ItemId: iid, Tag: tag})
+	return err
+}
+
+// Import adds the entries of a file exported by another program to the
+// box, or only reports what would be added if DryRun is set. An empty
+// format is detected from the data.
+func (c *Client) Import(format string, data []byte, opts lckbx.ImportOptions) (lckbx.ImportReport, error) {
+	resp, err := c.call(request{Op: opImport, Format: format, Data: data, Import: &opts})
+	if err != nil {
+		return lckbx.ImportReport{}, err
+	}
+
+	if resp.Report == nil {
+		return lckbx.ImportReport{}, fmt.Errorf("agent: missing report in response")
+	}
+
+	return *resp.Report, nil
+}
+
+// Export returns every Item in the box in the given format. Plaintext
+// formats must be confirmed in the options.
+func (c *Client) Export(format string, opts lckbx.ExportOptions) ([]byte, error) {
+	resp, err := c.call(request{Op: opExport, Format: format, Export: &opts})
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Data, nil
+}
+
+// ExportMarkdown writes every Item in the box to a new directory as Markdown
+// files. The agent writes the files, so the directory is made absolute
+// first.
+func (c *Client) ExportMarkdown(dir string, opts lckbx.ExportOptions) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.call(request{Op: opExportMarkdown, Dir: dir, Export: &opts})
+	return err
+}
+
+// Lock tells the agent to lock its UnlockedBox and exit.
+func (c *Client) Lock() error {
+	_, err := c.call(request{Op: opLock})
+	return err
+}
+
+// Close closes the connection to the agent.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Dial connects to the agent listening on the socket at path.
+func Dial(path string) (*Client, error) {
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("could not Dial agent: %v", err)
+	}
+
+	c := Client{
+		conn: conn,
+		enc:  json.NewEncoder(conn),
+		dec:  json.NewDecoder(conn),
+	}
+
+	return &c, nil
+}
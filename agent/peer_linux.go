@@ -0,0 +1,45 @@
+//go:build linux
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// checkPeer verifies that the process on the other end of the connection is
+// running as the same user as the agent.
+func checkPeer(conn net.Conn) error {
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return fmt.Errorf("could not checkPeer: not a unix socket")
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return fmt.Errorf("could not checkPeer: %v", err)
+	}
+
+	var cred *unix.Ucred
+	var credErr error
+
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return fmt.Errorf("could not checkPeer: %v", err)
+	}
+
+	if credErr != nil {
+		return fmt.Errorf("could not checkPeer: %v", credErr)
+	}
+
+	if int(cred.Uid) != os.Getuid() {
+		return fmt.Errorf("could not checkPeer: uid %d is not allowed", cred.Uid)
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// Package agent holds an UnlockedBox in memory and serves it over a Unix
+// socket so that clients do not have to derive the user's keys for every
+// request.
+package agent
+
+import (
+	"os"
+	"path/filepath"
+
+	"lckbx"
+)
+
+// The operations supported by the agent.
+const (
+	opStatus = "status"
+	opList   = "list"
+	opGet    = "get"
+	opSearch = "search"
+	opAdd    = "add"
+	opUpdate = "update"
+	opDelete = "delete"
+	opOTP    = "otp"
+	opLock   = "lock"
+
+	opAttach      = "attach"
+	opAttachments = "attachments"
+	opExtract     = "extract"
+	opDetach      = "detach"
+
+	opRevisions = "revisions"
+	opRevision  = "revision"
+	opDiff      = "diff"
+	opRestore   = "restore"
+	opGetLimit  = "getlimit"
+	opSetLimit  = "setlimit"
+
+	opTrash        = "trash"
+	opUndelete     = "undelete"
+	opPurge        = "purge"
+	opEmptyTrash   = "emptytrash"
+	opGetTrashDays = "gettrashdays"
+	opSetTrashDays = "settrashdays"
+
+	opFolders      = "folders"
+	opCreateFolder = "createfolder"
+	opRenameFolder = "renamefolder"
+	opMoveFolder   = "movefolder"
+	opDeleteFolder = "deletefolder"
+	opMoveItem     = "moveitem"
+	opTags         = "tags"
+	opCreateTag    = "createtag"
+	opRenameTag    = "renametag"
+	opDeleteTag    = "deletetag"
+	opTagItem      = "tagitem"
+	opUntagItem    = "untagitem"
+
+	opImport         = "import"
+	opExport         = "export"
+	opExportMarkdown = "exportmarkdown"
+)
+
+// request is sent by the client to the agent. Each request is a single JSON
+// object on its own line.
+type request struct {
+	Op           string
+	ItemId       lckbx.ItemToken        `json:",omitempty"`
+	Item         *lckbx.Item            `json:",omitempty"`
+	AttachmentId lckbx.AttachmentToken  `json:",omitempty"`
+	Attachment   *lckbx.Attachment      `json:",omitempty"`
+	RevisionId   lckbx.RevisionToken    `json:",omitempty"`
+	ToRevisionId lckbx.RevisionToken    `json:",omitempty"`
+	Limit        *lckbx.RevisionLimit   `json:",omitempty"`
+	Days         *int                   `json:",omitempty"`
+	Options      *lckbx.ItemListOptions `json:",omitempty"`
+	FolderId     lckbx.FolderToken      `json:",omitempty"`
+	ParentId     lckbx.FolderToken      `json:",omitempty"`
+	Name         string                 `json:",omitempty"`
+	Tag          string                 `json:",omitempty"`
+	Query        string                 `json:",omitempty"`
+	Format       string                 `json:",omitempty"`
+	Data         []byte                 `json:",omitempty"`
+	Import       *lckbx.ImportOptions   `json:",omitempty"`
+	Export       *lckbx.ExportOptions   `json:",omitempty"`
+	Dir          string                 `json:",omitempty"`
+}
+
+// response is sent by the agent to the client for every request.
+type response struct {
+	Error    string               `json:",omitempty"`
+	UserName string               `json:",omitempty"`
+	Items    []lckbx.ItemMetadata `json:",omitempty"`
+	Item     *lckbx.Item          `json:",omitempty"`
+	Code     string               `json:",omitempty"`
+	Expires  int                  `json:",omitempty"`
+
+	AttachmentId lckbx.AttachmentToken      `json:",omitempty"`
+	Attachments  []lckbx.AttachmentMetadata `json:",omitempty"`
+	Attachment   *lckbx.Attachment          `json:",omitempty"`
+
+	Revisions []lckbx.RevisionMetadata `json:",omitempty"`
+	Revision  *lckbx.Revision          `json:",omitempty"`
+	Diff      lckbx.Diff               `json:",omitempty"`
+	Limit     *lckbx.RevisionLimit     `json:",omitempty"`
+
+	Purged int  `json:",omitempty"`
+	Days   *int `json:",omitempty"`
+
+	Folders  []lckbx.Folder    `json:",omitempty"`
+	FolderId lckbx.FolderToken `json:",omitempty"`
+	Tags     []string          `json:",omitempty"`
+
+	Results []lckbx.SearchResult `json:",omitempty"`
+
+	Report *lckbx.ImportReport `json:",omitempty"`
+	Data   []byte              `json:",omitempty"`
+}
+
+// SocketPath returns the path of the agent socket. The path is taken from
+// $LCKBX_AGENT_SOCK if it is set, otherwise it is agent.sock in the .lckbx
+// directory of the user's HOME.
+func SocketPath() string {
+	if path := os.Getenv("LCKBX_AGENT_SOCK"); path != "" {
+		return path
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "agent.sock"
+	}
+
+	return filepath.Join(home, ".lckbx", "agent.sock")
+}
@@ -0,0 +1,331 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lckbx"
+)
+
+// Server holds an UnlockedBox and serves requests for it on a Unix socket.
+// Only the user running the agent is allowed to connect. When no request
+// has been received for the idle timeout, the UnlockedBox is locked and the
+// server stops.
+type Server struct {
+	ub       *lckbx.UnlockedBox
+	path     string
+	timeout  time.Duration
+	listener net.Listener
+	timer    *time.Timer
+	mutex    sync.Mutex
+	once     sync.Once
+}
+
+// touch resets the idle timer. The caller holds the mutex.
+func (s *Server) touch() {
+	if s.timer != nil {
+		s.timer.Reset(s.timeout)
+	}
+}
+
+// do runs a single request against the UnlockedBox.
+func (s *Server) do(req request) response {
+	var resp response
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ub == nil {
+		resp.Error = "agent is locked"
+		return resp
+	}
+
+	s.touch()
+
+	var err error
+
+	switch req.Op {
+	case opStatus:
+		resp.UserName = s.ub.GetUserName()
+	case opList:
+		if req.Options == nil {
+			resp.Items = s.ub.GetItemList()
+			break
+		}
+		resp.Items = s.ub.GetItemListWithOptions(*req.Options)
+	case opSearch:
+		var opts lckbx.ItemListOptions
+		if req.Options != nil {
+			opts = *req.Options
+		}
+		resp.Results, err = s.ub.Search(req.Query, opts)
+	case opGet:
+		var item lckbx.Item
+		item, err = s.ub.GetItem(req.ItemId)
+		resp.Item = &item
+	case opAdd:
+		if req.Item == nil {
+			err = fmt.Errorf("missing item")
+			break
+		}
+		err = s.ub.AddItem(*req.Item)
+	case opUpdate:
+		if req.Item == nil {
+			err = fmt.Errorf("missing item")
+			break
+		}
+		err = s.ub.UpdateItem(*req.Item)
+	case opDelete:
+		err = s.ub.DeleteItem(req.ItemId)
+	case opOTP:
+		resp.Code, resp.Expires, err = s.ub.GetOTPCode(req.ItemId)
+	case opAttach:
+		if req.Attachment == nil {
+			err = fmt.Errorf("missing attachment")
+			break
+		}
+		resp.AttachmentId, err = s.ub.AddAttachment(req.ItemId, req.Attachment.Name, bytes.NewReader(req.Attachment.Data))
+	case opAttachments:
+		resp.Attachments, err = s.ub.GetAttachmentList(req.ItemId)
+	case opExtract:
+		var data bytes.Buffer
+		err = s.ub.ExtractAttachment(req.ItemId, req.AttachmentId, &data)
+		resp.Attachment = &lckbx.Attachment{AttachmentId: req.AttachmentId, ItemId: req.ItemId, Data: data.Bytes()}
+	case opDetach:
+		err = s.ub.DeleteAttachment(req.ItemId, req.AttachmentId)
+	case opRevisions:
+		resp.Revisions, err = s.ub.GetRevisionList(req.ItemId)
+	case opRevision:
+		var rev lckbx.Revision
+		rev, err = s.ub.GetRevision(req.ItemId, req.RevisionId)
+		resp.Revision = &rev
+	case opDiff:
+		resp.Diff, err = s.ub.DiffRevisions(req.ItemId, req.RevisionId, req.ToRevisionId)
+	case opRestore:
+		err = s.ub.RestoreRevision(req.ItemId, req.RevisionId)
+	case opGetLimit:
+		limit := s.ub.GetRevisionLimit()
+		resp.Limit = &limit
+	case opSetLimit:
+		if req.Limit == nil {
+			err = fmt.Errorf("missing revision limit")
+			break
+		}
+		err = s.ub.SetRevisionLimit(*req.Limit)
+	case opTrash:
+		resp.Items = s.ub.GetTrashList()
+	case opUndelete:
+		err = s.ub.RestoreItem(req.ItemId)
+	case opPurge:
+		err = s.ub.PurgeItem(req.ItemId)
+	case opEmptyTrash:
+		resp.Purged, err = s.ub.EmptyTrash()
+	case opGetTrashDays:
+		days := s.ub.GetTrashDays()
+		resp.Days = &days
+	case opSetTrashDays:
+		if req.Days == nil {
+			err = fmt.Errorf("missing trash days")
+			break
+		}
+		err = s.ub.SetTrashDays(*req.Days)
+	case opFolders:
+		resp.Folders = s.ub.GetFolders()
+	case opCreateFolder:
+		resp.FolderId, err = s.ub.CreateFolder(req.Name, req.ParentId)
+	case opRenameFolder:
+		err = s.ub.RenameFolder(req.FolderId, req.Name)
+	case opMoveFolder:
+		err = s.ub.MoveFolder(req.FolderId, req.ParentId)
+	case opDeleteFolder:
+		err = s.ub.DeleteFolder(req.FolderId)
+	case opMoveItem:
+		err = s.ub.MoveItem(req.ItemId, req.FolderId)
+	case opTags:
+		resp.Tags = s.ub.GetTags()
+	case opCreateTag:
+		err = s.ub.CreateTag(req.Tag)
+	case opRenameTag:
+		err = s.ub.RenameTag(req.Tag, req.Name)
+	case opDeleteTag:
+		err = s.ub.DeleteTag(req.Tag)
+	case opTagItem:
+		err = s.ub.TagItem(req.ItemId, req.Tag)
+	case opUntagItem:
+		err = s.ub.UntagItem(req.ItemId, req.Tag)
+	case opImport:
+		var opts lckbx.ImportOptions
+		if req.Import != nil {
+			opts = *req.Import
+		}
+		var report lckbx.ImportReport
+		report, err = s.ub.Import(req.Format, req.Data, opts)
+		resp.Report = &report
+	case opExport:
+		var opts lckbx.ExportOptions
+		if req.Export != nil {
+			opts = *req.Export
+		}
+		resp.Data, err = s.ub.Export(req.Format, opts)
+	case opExportMarkdown:
+		var opts lckbx.ExportOptions
+		if req.Export != nil {
+			opts = *req.Export
+		}
+		err = s.ub.ExportMarkdown(req.Dir, opts)
+	case opLock:
+		// The lock is handled by the caller once the response is sent.
+	default:
+		err = fmt.Errorf("unknown operation %q", req.Op)
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Item = nil
+		resp.Attachment = nil
+		resp.Revision = nil
+	}
+
+	return resp
+}
+
+// handle reads requests from the connection until it is closed.
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	err := checkPeer(conn)
+	if err != nil {
+		json.NewEncoder(conn).Encode(response{Error: err.Error()})
+		return
+	}
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+
+	for {
+		var req request
+
+		err := dec.Decode(&req)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				enc.Encode(response{Error: fmt.Sprintf("invalid request: %v", err)})
+			}
+			return
+		}
+
+		err = enc.Encode(s.do(req))
+		if err != nil {
+			return
+		}
+
+		if req.Op == opLock {
+			s.Close()
+			return
+		}
+	}
+}
+
+// Serve accepts connections until the server is closed, either by calling
+// Close, by a client sending a lock request, or by the idle timeout.
+func (s *Server) Serve() error {
+	// The timer is only read and written while holding the mutex, since
+	// it fires Close on its own goroutine.
+	s.mutex.Lock()
+	if s.timeout > 0 {
+		s.timer = time.AfterFunc(s.timeout, func() { s.Close() })
+	}
+	s.mutex.Unlock()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			s.mutex.Lock()
+			locked := s.ub == nil
+			s.mutex.Unlock()
+
+			if locked {
+				return nil
+			}
+
+			return fmt.Errorf("could not Server.Serve: %v", err)
+		}
+
+		go s.handle(conn)
+	}
+}
+
+// Close locks the UnlockedBox, stops the server and removes the socket.
+func (s *Server) Close() error {
+	var err error
+
+	s.once.Do(func() {
+		s.mutex.Lock()
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		s.ub.Lock()
+		s.ub = nil
+		s.mutex.Unlock()
+
+		err = s.listener.Close()
+		os.Remove(s.path)
+	})
+
+	return err
+}
+
+// NewServer creates a Server for the given UnlockedBox listening on the
+// socket at path. The socket's directory is created with mode 0700, and an
+// existing directory must be owned by the current user and closed to
+// everyone else. The socket itself is only accessible by the current user.
+// A timeout of zero disables the idle timeout.
+func NewServer(ub *lckbx.UnlockedBox, path string, timeout time.Duration) (*Server, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0700)
+	if err != nil {
+		return nil, fmt.Errorf("could not NewServer: %v", err)
+	}
+
+	err = checkSocketDir(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("could not NewServer: %v", err)
+	}
+
+	// Refuse to replace a running agent, but clean up a stale socket.
+	if _, err := os.Stat(path); err == nil {
+		conn, err := net.Dial("unix", path)
+		if err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("could not NewServer: agent already running on %s", path)
+		}
+
+		os.Remove(path)
+	}
+
+	listener, err := listenUnix(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not NewServer: %v", err)
+	}
+
+	err = os.Chmod(path, 0600)
+	if err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("could not NewServer: %v", err)
+	}
+
+	s := Server{
+		ub:       ub,
+		path:     path,
+		timeout:  timeout,
+		listener: listener,
+	}
+
+	return &s, nil
+}
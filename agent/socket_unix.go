@@ -0,0 +1,45 @@
+//go:build !windows
+
+package agent
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+)
+
+// checkSocketDir ensures that the directory holding the socket is owned by
+// the current user and that no one else can use it. MkdirAll does not change
+// the mode of a directory that already exists, so it is checked instead.
+func checkSocketDir(dir string) error {
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return fmt.Errorf("could not checkSocketDir: %v", err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("could not checkSocketDir: %s is not a directory", dir)
+	}
+
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("could not checkSocketDir: %s is not owned by the current user", dir)
+	}
+
+	if info.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("could not checkSocketDir: %s is accessible by other users, its mode is %v", dir, info.Mode().Perm())
+	}
+
+	return nil
+}
+
+// listenUnix listens on the socket at path with a umask that only lets the
+// current user use it, so the socket never exists with looser permissions.
+// The umask belongs to the whole process, so it is restored right away.
+func listenUnix(path string) (net.Listener, error) {
+	old := syscall.Umask(0077)
+	defer syscall.Umask(old)
+
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,18 @@
+//go:build windows
+
+package agent
+
+import (
+	"net"
+)
+
+// checkSocketDir relies on the permissions of the directory on Windows,
+// which has no owner and mode bits to check.
+func checkSocketDir(dir string) error {
+	return nil
+}
+
+// listenUnix listens on the socket at path.
+func listenUnix(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
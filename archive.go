@@ -0,0 +1,204 @@
+package lckbx
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"filippo.io/age"
+)
+
+const (
+	ageMagic        = "age-encryption.org/v1\n"
+	archiveDir      = "lckbx-export"
+	archiveJSON     = "export.json"
+	archiveMarkdown = "markdown"
+)
+
+// isAgeArchive reports whether the data is encrypted with age.
+func isAgeArchive(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(ageMagic))
+}
+
+// agePassphraseArchive reports whether the age header has an scrypt stanza,
+// which is only used for files encrypted with a passphrase.
+func agePassphraseArchive(data []byte) bool {
+	s := bufio.NewScanner(bytes.NewReader(data))
+
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "---") {
+			break
+		}
+
+		if strings.HasPrefix(line, "-> scrypt ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ageRecipients returns the age recipients for the options. The age format
+// does not allow a passphrase to be combined with other recipients.
+func (opts ExportOptions) ageRecipients() ([]age.Recipient, error) {
+	if opts.Passphrase != "" && len(opts.Recipients) != 0 {
+		return nil, fmt.Errorf("an age archive is encrypted with a passphrase or recipients, not both")
+	}
+
+	if opts.Passphrase != "" {
+		r, err := age.NewScryptRecipient(opts.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		return []age.Recipient{r}, nil
+	}
+
+	if len(opts.Recipients) == 0 {
+		return nil, fmt.Errorf("an age archive needs a passphrase or a recipient")
+	}
+
+	var recipients []age.Recipient
+	for _, s := range opts.Recipients {
+		r, err := age.ParseX25519Recipient(strings.TrimSpace(s))
+		if err != nil {
+			return nil, err
+		}
+
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+// Seal Archive
+//  1. Write the JSON export and the Markdown files to a tar archive, in a
+//     single lckbx-export directory.
+//  2. Encrypt the archive with age to the passphrase or recipients.
+//
+// The archive can be opened with the age and tar commands, and imported
+// with the lckbx Importer.
+func sealArchive(f exportFile, opts ExportOptions) ([]byte, error) {
+	recipients, err := opts.ageRecipients()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(f, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+
+	files := []archiveFile{{Path: archiveJSON, Data: data}}
+	for _, mf := range markdownFiles(f) {
+		files = append(files, archiveFile{Path: path.Join(archiveMarkdown, mf.Path), Data: mf.Data})
+	}
+
+	// 1.  Write the JSON export and the Markdown files to a tar archive.
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+
+	for _, af := range files {
+		err = tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     path.Join(archiveDir, af.Path),
+			Mode:     0600,
+			Size:     int64(len(af.Data)),
+			ModTime:  f.Exported,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		_, err = tw.Write(af.Data)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// 2.  Encrypt the archive with age.
+	var sealed bytes.Buffer
+
+	w, err := age.Encrypt(&sealed, recipients...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = w.Write(archive.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return sealed.Bytes(), nil
+}
+
+// openArchive decrypts an age archive with the password, or with the age
+// identities in the key file, and returns the JSON export inside it.
+func openArchive(data []byte, opts ImportOptions) ([]byte, error) {
+	var identities []age.Identity
+
+	if opts.Password != "" {
+		id, err := age.NewScryptIdentity(opts.Password)
+		if err != nil {
+			return nil, err
+		}
+
+		identities = append(identities, id)
+	}
+
+	if len(opts.KeyFile) != 0 {
+		ids, err := age.ParseIdentities(bytes.NewReader(opts.KeyFile))
+		if err != nil {
+			return nil, fmt.Errorf("invalid key file: %v", err)
+		}
+
+		identities = append(identities, ids...)
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("an age archive needs a password or a key file")
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, fmt.Errorf("wrong password or key file")
+		}
+
+		return nil, err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive has no %s", archiveJSON)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %v", err)
+		}
+
+		if h.Name == path.Join(archiveDir, archiveJSON) {
+			return io.ReadAll(tr)
+		}
+	}
+}
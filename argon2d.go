@@ -0,0 +1,306 @@
+package lckbx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/bits"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// The argon2d constants describe the memory layout from RFC 9106. Memory is
+// split into lanes that can be filled in parallel, and each lane is split
+// into four slices.
+const (
+	argon2Version    = 0x13
+	argon2BlockWords = 128
+	argon2SyncPoints = 4
+	argon2TypeD      = 0
+)
+
+// argon2Block is a 1 KiB block of Argon2 memory.
+type argon2Block [argon2BlockWords]uint64
+
+// argon2dKey derives a key with Argon2d, the variant used by default in
+// KeePass databases. golang.org/x/crypto only provides Argon2i and Argon2id,
+// and Argon2d is only needed to open other programs' files, so the lanes are
+// filled one after another instead of in parallel.
+func argon2dKey(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) ([]byte, error) {
+	if time < 1 {
+		return nil, fmt.Errorf("could not argon2dKey: time must be at least 1")
+	}
+
+	if threads < 1 {
+		return nil, fmt.Errorf("could not argon2dKey: threads must be at least 1")
+	}
+
+	if keyLen < 4 {
+		return nil, fmt.Errorf("could not argon2dKey: key must be at least 4 bytes")
+	}
+
+	// The memory is rounded down to a whole number of blocks in every slice
+	// of every lane. The initial hash uses the memory that was asked for.
+	lanes := uint32(threads)
+	rounded := memory
+	if rounded < 2*argon2SyncPoints*lanes {
+		rounded = 2 * argon2SyncPoints * lanes
+	}
+
+	segment := rounded / (argon2SyncPoints * lanes)
+	laneLength := segment * argon2SyncPoints
+	blocks := make([]argon2Block, laneLength*lanes)
+
+	h0 := argon2InitialHash(password, salt, secret, data, time, memory, lanes, keyLen)
+
+	// The first two blocks of each lane are filled from the initial hash.
+	var seed [blake2b.Size + 8]byte
+	copy(seed[:], h0)
+
+	for lane := uint32(0); lane < lanes; lane++ {
+		binary.LittleEndian.PutUint32(seed[blake2b.Size+4:], lane)
+
+		for n := uint32(0); n < 2; n++ {
+			binary.LittleEndian.PutUint32(seed[blake2b.Size:], n)
+
+			var buf [1024]byte
+			argon2Hash(buf[:], seed[:])
+			blocks[lane*laneLength+n].fromBytes(buf[:])
+		}
+	}
+
+	for pass := uint32(0); pass < time; pass++ {
+		for slice := uint32(0); slice < argon2SyncPoints; slice++ {
+			for lane := uint32(0); lane < lanes; lane++ {
+				argon2FillSegment(blocks, pass, slice, lane, lanes, segment)
+			}
+		}
+	}
+
+	// The last block of every lane is combined to make the key.
+	final := blocks[laneLength-1]
+	for lane := uint32(1); lane < lanes; lane++ {
+		last := &blocks[lane*laneLength+laneLength-1]
+		for n := range final {
+			final[n] ^= last[n]
+		}
+	}
+
+	key := make([]byte, keyLen)
+	argon2Hash(key, final.bytes())
+
+	return key, nil
+}
+
+// argon2InitialHash returns H0, the hash of the parameters and inputs.
+func argon2InitialHash(password, salt, secret, data []byte, time, memory, lanes, keyLen uint32) []byte {
+	h, _ := blake2b.New512(nil)
+
+	writeUint32 := func(v uint32) {
+		var b [4]byte
+		binary.LittleEndian.PutUint32(b[:], v)
+		h.Write(b[:])
+	}
+
+	writeBytes := func(b []byte) {
+		writeUint32(uint32(len(b)))
+		h.Write(b)
+	}
+
+	writeUint32(lanes)
+	writeUint32(keyLen)
+	writeUint32(memory)
+	writeUint32(time)
+	writeUint32(argon2Version)
+	writeUint32(argon2TypeD)
+	writeBytes(password)
+	writeBytes(salt)
+	writeBytes(secret)
+	writeBytes(data)
+
+	return h.Sum(nil)
+}
+
+// argon2Hash is the variable length hash H' from RFC 9106. Outputs longer
+// than a Blake2b hash are built from a chain of hashes, keeping the first
+// half of each.
+func argon2Hash(out, in []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(out)))
+
+	if len(out) <= blake2b.Size {
+		h, _ := blake2b.New(len(out), nil)
+		h.Write(length[:])
+		h.Write(in)
+		h.Sum(out[:0])
+		return
+	}
+
+	var h hash.Hash
+	h, _ = blake2b.New512(nil)
+	h.Write(length[:])
+	h.Write(in)
+	v := h.Sum(nil)
+
+	n := 0
+	for ; len(out)-n > blake2b.Size; n += blake2b.Size / 2 {
+		copy(out[n:], v[:blake2b.Size/2])
+
+		if len(out)-n-blake2b.Size/2 <= blake2b.Size {
+			break
+		}
+
+		h.Reset()
+		h.Write(v)
+		v = h.Sum(v[:0])
+	}
+
+	n += blake2b.Size / 2
+	h, _ = blake2b.New(len(out)-n, nil)
+	h.Write(v)
+	h.Sum(out[n:n])
+}
+
+// argon2FillSegment fills one slice of one lane. Argon2d chooses the block
+// to mix in from the contents of the previous block.
+func argon2FillSegment(blocks []argon2Block, pass, slice, lane, lanes, segment uint32) {
+	laneLength := segment * argon2SyncPoints
+
+	start := uint32(0)
+	if pass == 0 && slice == 0 {
+		start = 2
+	}
+
+	offset := lane*laneLength + slice*segment + start
+
+	for index := start; index < segment; index, offset = index+1, offset+1 {
+		prev := offset - 1
+		if offset%laneLength == 0 {
+			prev = offset + laneLength - 1
+		}
+
+		random := blocks[prev][0]
+
+		// The first slice of the first pass can only refer to its own lane,
+		// since the other lanes have not been started.
+		refLane := uint32(random>>32) % lanes
+		if pass == 0 && slice == 0 {
+			refLane = lane
+		}
+
+		refIndex := argon2RefIndex(pass, slice, index, segment, uint32(random), refLane == lane)
+
+		var mixed argon2Block
+		argon2Compress(&mixed, &blocks[prev], &blocks[refLane*laneLength+refIndex])
+
+		// Later passes combine the new block with the old one.
+		if pass > 0 {
+			for n := range mixed {
+				blocks[offset][n] ^= mixed[n]
+			}
+		} else {
+			blocks[offset] = mixed
+		}
+	}
+}
+
+// argon2RefIndex maps the pseudo-random value onto the blocks that can be
+// referenced, favoring recently filled blocks.
+func argon2RefIndex(pass, slice, index, segment, random uint32, sameLane bool) uint32 {
+	var area uint32
+
+	switch {
+	case pass == 0 && sameLane:
+		area = slice*segment + index - 1
+	case pass == 0:
+		area = slice * segment
+	case sameLane:
+		area = 3*segment + index - 1
+	default:
+		area = 3 * segment
+	}
+
+	// Blocks in other lanes that are still being filled cannot be used,
+	// including the one just before the block being filled.
+	if !sameLane && index == 0 {
+		area--
+	}
+
+	x := (uint64(random) * uint64(random)) >> 32
+	relative := uint64(area) - 1 - (uint64(area)*x)>>32
+
+	startPos := uint32(0)
+	if pass > 0 && slice != argon2SyncPoints-1 {
+		startPos = (slice + 1) * segment
+	}
+
+	return uint32((uint64(startPos) + relative) % uint64(segment*argon2SyncPoints))
+}
+
+// argon2Compress is the compression function G. It mixes the two blocks
+// with the Blake2b round function, first by rows and then by columns.
+func argon2Compress(out, x, y *argon2Block) {
+	var r, z argon2Block
+
+	for n := range r {
+		r[n] = x[n] ^ y[n]
+	}
+
+	z = r
+
+	for i := 0; i < 8; i++ {
+		o := 16 * i
+		argon2Round(&z, o, o+1, o+2, o+3, o+4, o+5, o+6, o+7, o+8, o+9, o+10, o+11, o+12, o+13, o+14, o+15)
+	}
+
+	for i := 0; i < 8; i++ {
+		o := 2 * i
+		argon2Round(&z, o, o+1, o+16, o+17, o+32, o+33, o+48, o+49, o+64, o+65, o+80, o+81, o+96, o+97, o+112, o+113)
+	}
+
+	for n := range out {
+		out[n] = z[n] ^ r[n]
+	}
+}
+
+// argon2Round is the permutation P applied to sixteen words of a block.
+func argon2Round(b *argon2Block, i ...int) {
+	gb := func(a, b2, c, d *uint64) {
+		*a = *a + *b2 + 2*uint64(uint32(*a))*uint64(uint32(*b2))
+		*d = bits.RotateLeft64(*d^*a, -32)
+		*c = *c + *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+		*b2 = bits.RotateLeft64(*b2^*c, -24)
+		*a = *a + *b2 + 2*uint64(uint32(*a))*uint64(uint32(*b2))
+		*d = bits.RotateLeft64(*d^*a, -16)
+		*c = *c + *d + 2*uint64(uint32(*c))*uint64(uint32(*d))
+		*b2 = bits.RotateLeft64(*b2^*c, -63)
+	}
+
+	v := func(n int) *uint64 { return &b[i[n]] }
+
+	gb(v(0), v(4), v(8), v(12))
+	gb(v(1), v(5), v(9), v(13))
+	gb(v(2), v(6), v(10), v(14))
+	gb(v(3), v(7), v(11), v(15))
+	gb(v(0), v(5), v(10), v(15))
+	gb(v(1), v(6), v(11), v(12))
+	gb(v(2), v(7), v(8), v(13))
+	gb(v(3), v(4), v(9), v(14))
+}
+
+// fromBytes sets the block from 1 KiB of little-endian words.
+func (b *argon2Block) fromBytes(buf []byte) {
+	for n := range b {
+		b[n] = binary.LittleEndian.Uint64(buf[n*8:])
+	}
+}
+
+// bytes returns the block as 1 KiB of little-endian words.
+func (b *argon2Block) bytes() []byte {
+	buf := make([]byte, 1024)
+	for n := range b {
+		binary.LittleEndian.PutUint64(buf[n*8:], b[n])
+	}
+
+	return buf
+}
@@ -0,0 +1,34 @@
+package lckbx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// TestArgon2d checks argon2dKey against the Argon2d test vector in RFC 9106,
+// section 5.1.
+func TestArgon2d(t *testing.T) {
+	fmt.Println(t.Name())
+
+	password := bytes.Repeat([]byte{0x01}, 32)
+	salt := bytes.Repeat([]byte{0x02}, 16)
+	secret := bytes.Repeat([]byte{0x03}, 8)
+	data := bytes.Repeat([]byte{0x04}, 12)
+
+	expected, _ := hex.DecodeString("512b391b6f1162975371d3091973429" + "4f868e3be3984f3c1a13a4db9fabe4acb")
+
+	key, err := argon2dKey(password, salt, secret, data, 3, 32, 4, 32)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !bytes.Equal(key, expected) {
+		t.Fatalf("Expected %x, received %x", expected, key)
+	}
+
+	if _, err := argon2dKey(password, salt, nil, nil, 0, 32, 4, 32); err == nil {
+		t.Fatal("Expected error for zero passes, received nil")
+	}
+}
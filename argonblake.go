@@ -20,9 +20,11 @@ type argonBlakeDerive struct {
 func (a argonBlakeDerive) DeriveBaseKey(username, passphrase string) (BaseKey, error) {
 	var bk BaseKey
 
-	// Verify password length
+	// Verify password length. The length is counted in bytes, so that
+	// every existing password can still be used to login. New passwords are
+	// held to the PasswordPolicy, which counts characters.
 	if len(passphrase) < minPassphraseLength {
-		return bk, fmt.Errorf("could not DeriveBaseKey: passphrase less than %d character", minPassphraseLength)
+		return bk, fmt.Errorf("could not DeriveBaseKey: passphrase less than %d bytes", minPassphraseLength)
 	}
 
 	// Hash our username to use it as a salt
@@ -85,11 +87,20 @@ func (a argonBlakeDerive) DeriveCryptKey(baseKey BaseKey, salt []byte) (CryptKey
 	return ck, nil
 }
 
+// newArgonBlake returns an argonBlakeDerive with the parameters of the
+// original argonBlakeDeriverVersion.
 func newArgonBlake() argonBlakeDerive {
+	return newArgonBlakeWithParams(argonBlakeVersions[0])
+}
+
+// newArgonBlakeWithParams returns an argonBlakeDerive with the Argon2
+// parameters of one of the argonBlakeVersions. Only the cost of the BaseKey
+// changes between versions, the other keys are derived the same way.
+func newArgonBlakeWithParams(p argonBlakeParams) argonBlakeDerive {
 	return argonBlakeDerive{
-		time:      3,
-		memory:    64 * 1024,
-		threads:   4,
+		time:      p.time,
+		memory:    p.memory,
+		threads:   p.threads,
 		authInfo:  []byte("This key will be used for authentication."),
 		cryptInfo: []byte("This key will be used for encryption."),
 	}
@@ -0,0 +1,363 @@
+package lckbx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Attachment is a file stored with an Item. Attachments are kept in their
+// own bucket, so large files do not slow down loading the Item, and are
+// encrypted with a key derived from the Keyset BaseKey and the
+// AttachmentToken. The ItemToken is part of the authenticated data so an
+// Attachment cannot be moved to another Item.
+//
+// The record holds only the file, encrypted as a stream, and its name and
+// size are kept in the AttachmentMetadata, so the file is read and written
+// a chunk at a time. An Attachment holds the whole file, which is how
+// Attachments were sealed in one piece before they were streamed, and how
+// the agent sends them.
+type Attachment struct {
+	AttachmentId AttachmentToken
+	ItemId       ItemToken
+	Name         string
+	Data         []byte
+}
+
+// attachmentAD returns the authenticated data used to encrypt an
+// Attachment.
+func attachmentAD(aid AttachmentToken, iid ItemToken) []byte {
+	return []byte(aid.String() + iid.String())
+}
+
+// ad returns the authenticated data used to encrypt the Attachment.
+func (a *Attachment) ad() []byte {
+	return attachmentAD(a.AttachmentId, a.ItemId)
+}
+
+// bytes returns the Attachment as encrypted bytes using the given crypter.
+func (a *Attachment) bytes(crypt crypter) ([]byte, error) {
+	var encrypted []byte
+
+	bytes, err := json.Marshal(a)
+	if err != nil {
+		return encrypted, fmt.Errorf("could not Attachment.Bytes: %v", err)
+	}
+
+	encrypted, err = crypt.Encrypt(bytes, a.ad())
+	if err != nil {
+		return encrypted, fmt.Errorf("could not Attachment.Bytes: %v", err)
+	}
+
+	return encrypted, nil
+}
+
+// Save stores the Attachment sealed in one piece in the given recorder.
+// New Attachments are saved as a stream with sealAttachment instead.
+func (a *Attachment) Save(store recorder, crypt crypter) error {
+	bytes, err := a.bytes(crypt)
+	if err != nil {
+		return fmt.Errorf("could not Attachment.Save: %v", err)
+	}
+
+	err = store.SaveAttachment(a.AttachmentId, bytes)
+	if err != nil {
+		return fmt.Errorf("could not Attachment.Save: %v", err)
+	}
+
+	return nil
+}
+
+// NewAttachment creates a new Attachment for the given Item.
+func NewAttachment(iid ItemToken, name string, data []byte) Attachment {
+	return Attachment{
+		AttachmentId: NewAttachmentToken(),
+		ItemId:       iid,
+		Name:         name,
+		Data:         data,
+	}
+}
+
+// newAttachmentFromBytes creates a new Attachment from encrypted bytes.
+func newAttachmentFromBytes(crypt crypter, encrypted []byte, ad []byte) (Attachment, error) {
+	var att Attachment
+
+	plaintext, err := crypt.Decrypt(encrypted, ad)
+	if err != nil {
+		return att, err
+	}
+
+	err = json.Unmarshal(plaintext, &att)
+	if err != nil {
+		return att, err
+	}
+
+	return att, nil
+}
+
+// NewAttachmentFromStore retrieves the encrypted Attachment bytes from the
+// given recorder, decrypts the bytes, and returns an Attachment. It only
+// opens Attachments sealed in one piece.
+func NewAttachmentFromStore(store recorder, crypt crypter, iid ItemToken, aid AttachmentToken) (Attachment, error) {
+	var att Attachment
+
+	bytes, err := store.GetAttachment(aid)
+	if err != nil {
+		return att, fmt.Errorf("could not NewAttachmentFromStore: %v", err)
+	}
+
+	att, err = newAttachmentFromBytes(crypt, bytes, attachmentAD(aid, iid))
+	if err != nil {
+		return att, fmt.Errorf("could not NewAttachmentFromStore: %v", err)
+	}
+
+	return att, nil
+}
+
+// sealAttachment encrypts the file read from src as a stream and returns
+// the Attachment record and the size of the file. A bolt record is written
+// whole, so the encrypted file is held in memory until it is saved, but
+// the plaintext is only held a chunk at a time.
+func sealAttachment(crypt crypter, iid ItemToken, aid AttachmentToken, src io.Reader) ([]byte, int, error) {
+	var encrypted bytes.Buffer
+
+	w, err := crypt.EncryptStream(&encrypted, attachmentAD(aid, iid))
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not sealAttachment: %v", err)
+	}
+
+	size, err := io.Copy(w, src)
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not sealAttachment: %v", err)
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, 0, fmt.Errorf("could not sealAttachment: %v", err)
+	}
+
+	return encrypted.Bytes(), int(size), nil
+}
+
+// countReader counts the bytes read through it.
+type countReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+
+	return n, err
+}
+
+// writeAttachment decrypts the Attachment described by the
+// AttachmentMetadata and writes the file to w. Like loadItem, every key in
+// the Keyset is tried if the recorded key version does not work, and the key
+// version that decrypted the Attachment is returned. A stream only returns
+// plaintext once its chunk has been authenticated, so once any of the file
+// has been decrypted the key is right, and a later error is returned
+// without trying the other keys.
+func (u *UnlockedBox) writeAttachment(r recorder, iid ItemToken, amd AttachmentMetadata, w io.Writer) (VersionToken, error) {
+	versions := []VersionToken{amd.KeyVersion, u.keyset.Latest}
+	for keyId := range u.keyset.Keys {
+		kv, _ := parseVersionToken(keyId)
+		versions = append(versions, kv)
+	}
+
+	var err error
+	for _, kv := range versions {
+		var key CryptKey
+
+		key, err = u.keyset.GetAttachmentKey(kv, amd.AttachmentId)
+		if err != nil {
+			continue
+		}
+
+		u.crypt.ChangeKey(key[:])
+
+		// Attachments sealed in one piece are decrypted whole.
+		if !amd.Stream {
+			var att Attachment
+
+			att, err = NewAttachmentFromStore(r, u.crypt, iid, amd.AttachmentId)
+			if err != nil {
+				continue
+			}
+
+			_, err = w.Write(att.Data)
+			if err != nil {
+				break
+			}
+
+			return kv, nil
+		}
+
+		var src, plain io.Reader
+
+		src, err = r.ReadAttachment(amd.AttachmentId)
+		if err != nil {
+			break
+		}
+
+		plain, err = u.crypt.DecryptStream(src, attachmentAD(amd.AttachmentId, iid))
+		if err != nil {
+			continue
+		}
+
+		counted := &countReader{r: plain}
+		_, err = io.Copy(w, counted)
+		if err == nil {
+			return kv, nil
+		}
+
+		if counted.n != 0 {
+			break
+		}
+	}
+
+	return VersionToken{}, fmt.Errorf("could not UnlockedBox.writeAttachment: %v", err)
+}
+
+// Add Attachment
+//  1. Get the ItemMetadata for the Item.
+//  2. Encrypt the file read from src as a stream with a new key.
+//  3. Save the Attachment.
+//  4. Add the AttachmentMetadata to the ItemMetadata.
+//  5. Save the Metadata.
+//
+// The file is encrypted before the transaction starts, so a slow reader
+// does not hold up other writes. Steps 3 through 5 run in a single
+// transaction.
+func (u *UnlockedBox) AddAttachment(iid ItemToken, name string, src io.Reader) (AttachmentToken, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if name == "" {
+		return AttachmentToken{}, fmt.Errorf("could not UnlockedBox.AddAttachment: name is empty")
+	}
+
+	// 1.  Get the ItemMetadata for the Item.
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return AttachmentToken{}, fmt.Errorf("could not UnlockedBox.AddAttachment: %v", err)
+	}
+
+	// 2.  Encrypt the file read from src as a stream with a new key.
+	aid := NewAttachmentToken()
+
+	newKey, err := u.keyset.GetNewAttachmentKey(aid)
+	if err != nil {
+		return AttachmentToken{}, fmt.Errorf("could not UnlockedBox.AddAttachment: %v", err)
+	}
+
+	u.crypt.ChangeKey(newKey[:])
+	encrypted, size, err := sealAttachment(u.crypt, iid, aid, src)
+	if err != nil {
+		return AttachmentToken{}, fmt.Errorf("could not UnlockedBox.AddAttachment: %v", err)
+	}
+
+	err = u.store.Update(func(r recorder) error {
+		// 3.  Save the Attachment.
+		err := r.SaveAttachment(aid, encrypted)
+		if err != nil {
+			return err
+		}
+
+		// 4.  Add the AttachmentMetadata to the ItemMetadata.
+		u.metadata.AddItem(imd.withAttachment(newAttachmentMetadata(aid, name, size, u.keyset.Latest)))
+
+		// 5.  Save the Metadata.
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		u.metadata.AddItem(imd)
+		return AttachmentToken{}, fmt.Errorf("could not UnlockedBox.AddAttachment: %v", err)
+	}
+
+	return aid, nil
+}
+
+// GetAttachmentList returns the AttachmentMetadata of every Attachment on
+// the given Item, without decrypting the Attachments.
+func (u *UnlockedBox) GetAttachmentList(iid ItemToken) ([]AttachmentMetadata, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return nil, fmt.Errorf("could not UnlockedBox.GetAttachmentList: %v", err)
+	}
+
+	return append([]AttachmentMetadata{}, imd.Attachments...), nil
+}
+
+// ExtractAttachment decrypts an Attachment on the given Item and writes the
+// file to w. The file is decrypted straight from the database, a chunk at a
+// time, in a read-only transaction.
+func (u *UnlockedBox) ExtractAttachment(iid ItemToken, aid AttachmentToken, w io.Writer) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExtractAttachment: %v", err)
+	}
+
+	amd, err := imd.GetAttachment(aid)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExtractAttachment: %v", err)
+	}
+
+	err = u.store.View(func(r recorder) error {
+		_, err := u.writeAttachment(r, iid, amd, w)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExtractAttachment: %v", err)
+	}
+
+	return nil
+}
+
+// Delete Attachment
+//  1. Delete the Attachment from the database.
+//  2. Remove the AttachmentMetadata from the ItemMetadata.
+//  3. Save the Metadata.
+//
+// All three steps run in a single transaction.
+func (u *UnlockedBox) DeleteAttachment(iid ItemToken, aid AttachmentToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.DeleteAttachment: %v", err)
+	}
+
+	if _, err := imd.GetAttachment(aid); err != nil {
+		return fmt.Errorf("could not UnlockedBox.DeleteAttachment: %v", err)
+	}
+
+	err = u.store.Update(func(r recorder) error {
+		// 1.  Delete the Attachment from the database.
+		err := r.DeleteAttachment(aid)
+		if err != nil {
+			return err
+		}
+
+		// 2.  Remove the AttachmentMetadata from the ItemMetadata.
+		u.metadata.AddItem(imd.withoutAttachment(aid))
+
+		// 3.  Save the Metadata.
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		u.metadata.AddItem(imd)
+		return fmt.Errorf("could not UnlockedBox.DeleteAttachment: %v", err)
+	}
+
+	return nil
+}
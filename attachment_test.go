@@ -0,0 +1,415 @@
+package lckbx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+var (
+	attachmentDB     = "attachment_test.db"
+	attachmentCopyDB = "attachment_copy_test.db"
+	attachmentUser   = "attachment_user"
+)
+
+func TestAttachment(t *testing.T) {
+	store, err := NewStore(attachmentDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(attachmentDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Attachment Add Get Delete", func(t *testing.T) { testAttachmentAddGetDelete(t, &lb) })
+	t.Run("Test Attachment Large", func(t *testing.T) { testAttachmentLarge(t, &lb) })
+	t.Run("Test Attachment Sealed", func(t *testing.T) { testAttachmentSealed(t, &lb) })
+	t.Run("Test Attachment Reencrypt", func(t *testing.T) { testAttachmentReencrypt(t, &lb) })
+	t.Run("Test Attachment Delete Item", func(t *testing.T) { testAttachmentDeleteItem(t, &lb) })
+	t.Run("Test Attachment Check", func(t *testing.T) { testAttachmentCheck(t, &lb) })
+	t.Run("Test Attachment Export", func(t *testing.T) { testAttachmentExport(t, &lb) })
+}
+
+// addAttachmentNote adds a note with a single attachment and returns both
+// ids.
+func addAttachmentNote(t *testing.T, ub *UnlockedBox, name string) (ItemToken, AttachmentToken) {
+	n := NewNoteItem()
+	n.Name = name
+
+	err := ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	aid, err := ub.AddAttachment(n.ItemId, name+".txt", strings.NewReader(name))
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return n.ItemId, aid
+}
+
+// extractAttachment returns the file of an attachment.
+func extractAttachment(t *testing.T, ub *UnlockedBox, iid ItemToken, aid AttachmentToken) string {
+	var data bytes.Buffer
+
+	err := ub.ExtractAttachment(iid, aid, &data)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return data.String()
+}
+
+func testAttachmentAddGetDelete(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	iid, aid := addAttachmentNote(t, &ub, "Add Get Delete")
+
+	_, err = ub.AddAttachment(NewItemToken(), "missing.txt", strings.NewReader("missing"))
+	if err == nil {
+		t.Fatal("Expected an error adding an attachment to a missing item")
+	}
+
+	list, err := ub.GetAttachmentList(iid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(list) != 1 || list[0].AttachmentId != aid || list[0].Name != "Add Get Delete.txt" || list[0].Size != len("Add Get Delete") || !list[0].Stream {
+		t.Fatalf("Expected one attachment, received %+v", list)
+	}
+
+	if data := extractAttachment(t, &ub, iid, aid); data != "Add Get Delete" {
+		t.Fatalf("Expected the saved attachment, received %q", data)
+	}
+
+	// The record holds only the encrypted file.
+	record, _ := ub.store.GetAttachment(aid)
+	if bytes.Contains(record, []byte("Add Get Delete")) || len(record) != streamPrefixSize+streamTagSize+len("Add Get Delete") {
+		t.Fatalf("Expected a stream holding only the file, received %d bytes", len(record))
+	}
+
+	// The attachment is bound to its item.
+	other, _ := addAttachmentNote(t, &ub, "Other")
+	imd, _ := ub.metadata.GetItem(iid)
+	amd, _ := imd.GetAttachment(aid)
+	_, err = ub.writeAttachment(ub.store, other, amd, io.Discard)
+	if err == nil {
+		t.Fatal("Expected an error loading an attachment with the wrong item")
+	}
+
+	// The attachment is saved in the Metadata.
+	ub2, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	list, _ = ub2.GetAttachmentList(iid)
+	if len(list) != 1 {
+		t.Fatalf("Expected one attachment, received %+v", list)
+	}
+	ub2.Lock()
+
+	err = ub.DeleteAttachment(iid, aid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	list, _ = ub.GetAttachmentList(iid)
+	if len(list) != 0 {
+		t.Fatalf("Expected no attachments, received %+v", list)
+	}
+
+	if _, err := ub.store.GetAttachment(aid); err == nil {
+		t.Fatal("Expected the attachment to be deleted from the store")
+	}
+
+	if err := ub.DeleteAttachment(iid, aid); err == nil {
+		t.Fatal("Expected an error deleting a missing attachment")
+	}
+}
+
+// A file of several chunks is read from a reader and written to a writer
+// without being held in memory as plaintext.
+func testAttachmentLarge(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	n := NewNoteItem()
+	n.Name = "Large"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	data := bytes.Repeat([]byte("0123456789abcdef"), 3*streamChunkSize/16+5)
+
+	aid, err := ub.AddAttachment(n.ItemId, "large.bin", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	list, _ := ub.GetAttachmentList(n.ItemId)
+	if len(list) != 1 || list[0].Size != len(data) {
+		t.Fatalf("Expected one attachment of %d bytes, received %+v", len(data), list)
+	}
+
+	if extracted := extractAttachment(t, &ub, n.ItemId, aid); extracted != string(data) {
+		t.Fatalf("Expected %d bytes, received %d", len(data), len(extracted))
+	}
+
+	// A record cut short at a chunk boundary is not extracted.
+	record, _ := ub.store.GetAttachment(aid)
+	ub.store.SaveAttachment(aid, record[:streamPrefixSize+2*streamSealedChunk])
+
+	err = ub.ExtractAttachment(n.ItemId, aid, io.Discard)
+	if err == nil {
+		t.Fatal("Expected an error extracting a truncated attachment")
+	}
+
+	ub.store.SaveAttachment(aid, record)
+}
+
+// Attachments sealed in one piece, before they were streamed, can still be
+// extracted and are saved as a stream when their Item is reencrypted.
+func testAttachmentSealed(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	n := NewNoteItem()
+	n.Name = "Sealed"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	att := NewAttachment(n.ItemId, "sealed.txt", []byte("Sealed"))
+	key, _ := ub.keyset.GetNewAttachmentKey(att.AttachmentId)
+	ub.crypt.ChangeKey(key[:])
+
+	err = att.Save(ub.store, ub.crypt)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	imd, _ := ub.metadata.GetItem(n.ItemId)
+	amd := AttachmentMetadata{
+		AttachmentId: att.AttachmentId,
+		Name:         att.Name,
+		Size:         len(att.Data),
+		KeyVersion:   ub.keyset.Latest,
+	}
+	ub.metadata.AddItem(imd.withAttachment(amd))
+
+	if data := extractAttachment(t, &ub, n.ItemId, att.AttachmentId); data != "Sealed" {
+		t.Fatalf("Expected Sealed, received %s", data)
+	}
+
+	err = ub.reencryptItem(n.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	imd, _ = ub.metadata.GetItem(n.ItemId)
+	amd, _ = imd.GetAttachment(att.AttachmentId)
+	if !amd.Stream {
+		t.Fatalf("Expected the attachment to be saved as a stream, received %+v", amd)
+	}
+
+	if data := extractAttachment(t, &ub, n.ItemId, att.AttachmentId); data != "Sealed" {
+		t.Fatalf("Expected Sealed, received %s", data)
+	}
+}
+
+// Changing the password rotates the keys. The maintenance job reencrypts
+// the attachments with the Items and the old key is purged.
+func testAttachmentReencrypt(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	iid, aid := addAttachmentNote(t, &ub, "Reencrypt")
+	ub.Lock()
+
+	err = lb.ChangePassword(attachmentUser, lockedBoxGoodPassword, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer lb.ChangePassword(attachmentUser, lockedBoxBadPassword, lockedBoxGoodPassword)
+
+	ub, err = lb.login(attachmentUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	if len(ub.staleItems()) == 0 {
+		t.Fatal("Expected stale items, received none")
+	}
+
+	ub.startMaintenance()
+	status := ub.WaitMaintenance()
+	if status.Err != nil {
+		t.Fatalf("Expected no error, received %v", status.Err)
+	}
+
+	if status.Purged != 1 {
+		t.Fatalf("Expected one key purged, received %+v", status)
+	}
+
+	imd, _ := ub.metadata.GetItem(iid)
+	amd, _ := imd.GetAttachment(aid)
+	if amd.KeyVersion.String() != ub.keyset.Latest.String() {
+		t.Fatalf("Expected attachment key version %s, received %s", ub.keyset.Latest, amd.KeyVersion)
+	}
+
+	if data := extractAttachment(t, &ub, iid, aid); data != "Reencrypt" {
+		t.Fatalf("Expected Reencrypt, received %s", data)
+	}
+}
+
+func testAttachmentDeleteItem(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	iid, aid := addAttachmentNote(t, &ub, "Delete Item")
+
+	err = ub.DeleteItem(iid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if _, err := ub.store.GetAttachment(aid); err != nil {
+		t.Fatal("Expected the attachment to be kept while the item is in the trash")
+	}
+
+	err = ub.PurgeItem(iid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if _, err := ub.store.GetAttachment(aid); err == nil {
+		t.Fatal("Expected the attachment to be deleted with the item")
+	}
+}
+
+func testAttachmentCheck(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	iid, aid := addAttachmentNote(t, &ub, "Check Missing")
+	iid2, aid2 := addAttachmentNote(t, &ub, "Check Corrupt")
+
+	ub.store.DeleteAttachment(aid)
+	ub.store.SaveAttachment(aid2, []byte("corrupt"))
+
+	problems, err := ub.Check(true)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 2 {
+		t.Fatalf("Expected two problems, received %v", problems)
+	}
+
+	for _, id := range []ItemToken{iid, iid2} {
+		list, _ := ub.GetAttachmentList(id)
+		if len(list) != 0 {
+			t.Fatalf("Expected no attachments, received %+v", list)
+		}
+	}
+
+	s := ub.store.(*Store)
+	if s.read(quarantineBucket, attachmentBucket+"/"+aid2.String()) == nil {
+		t.Fatal("Expected corrupt attachment to be in the quarantine bucket")
+	}
+}
+
+func testAttachmentExport(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	iid, aid := addAttachmentNote(t, &ub, "Export")
+
+	var bundle bytes.Buffer
+	err = ub.ExportAccount(&bundle)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	dst, err := NewStore(attachmentCopyDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(attachmentCopyDB)
+	defer dst.Close()
+
+	dlb, err := NewLockedBox(&dst)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = dlb.ImportAccount(&bundle, "", lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	dub, err := dlb.login(attachmentUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer dub.Lock()
+
+	if data := extractAttachment(t, &dub, iid, aid); data != "Export" {
+		t.Fatalf("Expected Export, received %s", data)
+	}
+}
@@ -0,0 +1,490 @@
+package lckbx
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base32"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/boltdb/bolt"
+)
+
+const (
+	backupMagic      = "lckbx encrypted backup\n"
+	backupPrefix     = "lckbx-"
+	backupTimeFormat = "20060102T150405.000000000Z"
+	backupExtension  = ".db"
+	backupEncrypted  = ".enc"
+)
+
+// backupHeader is stored, as a single line of JSON, after the backupMagic at
+// the start of an encrypted backup. It records the versions of the deriver
+// and crypter used and the random salt for the passphrase. The whole line is
+// used as associated data when encrypting the database.
+type backupHeader struct {
+	Deriver string
+	Crypter string
+	Salt    string
+}
+
+// key derives the CryptKey for the backup from the passphrase.
+func (h backupHeader) key(passphrase string) (CryptKey, error) {
+	var ck CryptKey
+
+	version, err := parseVersionToken(h.Deriver)
+	if err != nil {
+		return ck, fmt.Errorf("could not backupHeader.key: %v", err)
+	}
+
+	derive := NewDeriver(version)
+
+	baseKey, err := derive.DeriveBaseKey(h.Salt, passphrase)
+	if err != nil {
+		return ck, fmt.Errorf("could not backupHeader.key: %v", err)
+	}
+
+	ck, err = derive.DeriveCryptKey(baseKey, nil)
+	if err != nil {
+		return ck, fmt.Errorf("could not backupHeader.key: %v", err)
+	}
+
+	return ck, nil
+}
+
+// crypter returns the crypter recorded in the header, keyed with the
+// CryptKey derived from the passphrase.
+func (h backupHeader) crypter(passphrase string) (crypter, error) {
+	version, err := parseVersionToken(h.Crypter)
+	if err != nil {
+		return nil, fmt.Errorf("could not backupHeader.crypter: %v", err)
+	}
+
+	key, err := h.key(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("could not backupHeader.crypter: %v", err)
+	}
+
+	crypt := NewCrypter(version)
+
+	err = crypt.ChangeKey(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("could not backupHeader.crypter: %v", err)
+	}
+
+	return crypt, nil
+}
+
+// newBackupHeader creates a backupHeader with the current deriver and
+// crypter versions and a random salt.
+func newBackupHeader() backupHeader {
+	salt := newTokenBytes()
+
+	return backupHeader{
+		Deriver: argonBlakeDeriverVersion,
+		Crypter: xChaChaCrypterVersion,
+		Salt:    base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(salt[:]),
+	}
+}
+
+// sealBackup encrypts the database bytes with the passphrase and returns
+// the contents of an encrypted backup file.
+func sealBackup(data []byte, passphrase string) ([]byte, error) {
+	h := newBackupHeader()
+
+	header, err := json.Marshal(h)
+	if err != nil {
+		return nil, fmt.Errorf("could not sealBackup: %v", err)
+	}
+
+	crypt, err := h.crypter(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("could not sealBackup: %v", err)
+	}
+
+	encrypted, err := crypt.Encrypt(data, header)
+	if err != nil {
+		return nil, fmt.Errorf("could not sealBackup: %v", err)
+	}
+
+	var out bytes.Buffer
+	out.WriteString(backupMagic)
+	out.Write(header)
+	out.WriteString("\n")
+	out.Write(encrypted)
+
+	return out.Bytes(), nil
+}
+
+// openBackup returns the database bytes from the contents of a backup file.
+// Unencrypted backups are returned as they are.
+func openBackup(data []byte, passphrase string) ([]byte, error) {
+	if !bytes.HasPrefix(data, []byte(backupMagic)) {
+		return data, nil
+	}
+
+	r := bufio.NewReader(bytes.NewReader(data[len(backupMagic):]))
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("could not openBackup: missing header")
+	}
+
+	header := bytes.TrimSuffix(line, []byte("\n"))
+
+	var h backupHeader
+	err = json.Unmarshal(header, &h)
+	if err != nil {
+		return nil, fmt.Errorf("could not openBackup: %v", err)
+	}
+
+	crypt, err := h.crypter(passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("could not openBackup: %v", err)
+	}
+
+	encrypted, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("could not openBackup: %v", err)
+	}
+
+	plaintext, err := crypt.Decrypt(encrypted, header)
+	if err != nil {
+		return nil, fmt.Errorf("could not openBackup: wrong passphrase or damaged backup")
+	}
+
+	return plaintext, nil
+}
+
+// IsEncryptedBackup reports whether the file is a backup encrypted with a
+// passphrase.
+func IsEncryptedBackup(filename string) (bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return false, fmt.Errorf("could not IsEncryptedBackup: %v", err)
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(backupMagic))
+	_, err = io.ReadFull(file, magic)
+	if err != nil {
+		return false, nil
+	}
+
+	return string(magic) == backupMagic, nil
+}
+
+// writeNewFile writes data to a file that must not already exist. If the
+// write fails, the partial file is removed.
+func writeNewFile(filename string, data []byte) error {
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+
+	return nil
+}
+
+// Check Database
+//  1. Open the file as a bolt database.
+//  2. Ensure each of the required Store buckets is present.
+//  3. Ensure there are no buckets the Store does not know about.
+//  4. Ensure every record in each Store bucket is well formed.
+//
+// A truncated or foreign database is rejected rather than replacing the
+// live one. Buckets added since the required ones may be missing, since
+// NewStore creates them when an older database is opened.
+func checkDatabase(filename string) error {
+	// 1.  Open the file as a bolt database.
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bolt.Tx) error {
+		// 2.  Ensure each of the required Store buckets is present.
+		for _, bucket := range requiredBuckets {
+			if tx.Bucket([]byte(bucket)) == nil {
+				return fmt.Errorf("missing %s bucket", bucket)
+			}
+		}
+
+		// 3.  Ensure there are no unknown buckets.
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			for _, bucket := range storeBuckets {
+				if bucket == string(name) {
+					return nil
+				}
+			}
+
+			return fmt.Errorf("unknown %s bucket", name)
+		})
+		if err != nil {
+			return err
+		}
+
+		// 4.  Ensure every record in each Store bucket is well formed.
+		for _, bucket := range storeBuckets {
+			b := tx.Bucket([]byte(bucket))
+			if b == nil || bucket == quarantineBucket {
+				continue
+			}
+
+			err := b.ForEach(func(k, v []byte) error {
+				err := checkRecord(bucket, k, v)
+				if err != nil {
+					return fmt.Errorf("bad record %q in %s bucket: %v", k, bucket, err)
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// checkDatabaseBytes writes the database bytes to a temporary file in dir
+// and checks it with checkDatabase. The name of the temporary file is
+// returned if keep is true, otherwise it is removed.
+func checkDatabaseBytes(dir string, data []byte, keep bool) (string, error) {
+	file, err := os.CreateTemp(dir, ".lckbx-restore-*")
+	if err != nil {
+		return "", err
+	}
+
+	name := file.Name()
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = checkDatabase(name)
+	}
+
+	if err != nil || !keep {
+		os.Remove(name)
+		name = ""
+	}
+
+	return name, err
+}
+
+// VerifyBackup ensures the backup can be read, decrypting it with the
+// passphrase if it is encrypted, and that it passes the same checks as
+// Restore, so a backup that verifies can be restored.
+func VerifyBackup(filename, passphrase string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("could not VerifyBackup: %v", err)
+	}
+
+	data, err = openBackup(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("could not VerifyBackup: %v", err)
+	}
+
+	_, err = checkDatabaseBytes("", data, false)
+	if err != nil {
+		return fmt.Errorf("could not VerifyBackup: %v", err)
+	}
+
+	return nil
+}
+
+// Store Backup
+//  1. Copy the database in a read transaction.
+//  2. Encrypt the copy with the passphrase, if one is given.
+//  3. Write the copy to the file, which must not already exist.
+//  4. Verify the file can be read back as a database with every bucket,
+//     and remove it if it cannot.
+func (s *Store) backup(filename, passphrase string) error {
+	// 1.  Copy the database in a read transaction.
+	var buf bytes.Buffer
+	err := s.db.View(func(tx *bolt.Tx) error {
+		_, err := tx.WriteTo(&buf)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// 2.  Encrypt the copy with the passphrase, if one is given.
+	data := buf.Bytes()
+	if passphrase != "" {
+		data, err = sealBackup(data, passphrase)
+		if err != nil {
+			return err
+		}
+	}
+
+	// 3.  Write the copy to the file, which must not already exist.
+	err = writeNewFile(filename, data)
+	if err != nil {
+		return err
+	}
+
+	// 4.  Verify the file can be read back.
+	err = VerifyBackup(filename, passphrase)
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+
+	return nil
+}
+
+// Backup creates a verified backup of the database in the given file. An
+// error is returned if the file already exists.
+func (s *Store) Backup(filename string) error {
+	err := s.backup(filename, "")
+	if err != nil {
+		return fmt.Errorf("could not Store.Backup: %v", err)
+	}
+
+	return nil
+}
+
+// BackupEncrypted creates a verified backup of the database in the given
+// file, encrypted with a key derived from the passphrase. An error is
+// returned if the file already exists.
+func (s *Store) BackupEncrypted(filename, passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("could not Store.BackupEncrypted: missing passphrase")
+	}
+
+	err := s.backup(filename, passphrase)
+	if err != nil {
+		return fmt.Errorf("could not Store.BackupEncrypted: %v", err)
+	}
+
+	return nil
+}
+
+// BackupRotate creates a timestamped backup in dir, encrypted if a
+// passphrase is given, then removes the oldest timestamped backups so that
+// only the newest keep remain. If keep is zero, no backups are removed. The
+// name of the new backup is returned.
+func (s *Store) BackupRotate(dir string, keep int, passphrase string) (string, error) {
+	name := backupPrefix + time.Now().UTC().Format(backupTimeFormat) + backupExtension
+	if passphrase != "" {
+		name += backupEncrypted
+	}
+
+	filename := filepath.Join(dir, name)
+
+	err := s.backup(filename, passphrase)
+	if err != nil {
+		return "", fmt.Errorf("could not Store.BackupRotate: %v", err)
+	}
+
+	if keep <= 0 {
+		return filename, nil
+	}
+
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return filename, fmt.Errorf("could not Store.BackupRotate: %v", err)
+	}
+
+	for len(backups) > keep {
+		err = os.Remove(backups[0])
+		if err != nil {
+			return filename, fmt.Errorf("could not Store.BackupRotate: %v", err)
+		}
+
+		backups = backups[1:]
+	}
+
+	return filename, nil
+}
+
+// ListBackups returns the timestamped backups created by BackupRotate in
+// dir, oldest first.
+func ListBackups(dir string) ([]string, error) {
+	var backups []string
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not ListBackups: %v", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, backupPrefix) {
+			continue
+		}
+
+		stamp := strings.TrimPrefix(name, backupPrefix)
+		stamp = strings.TrimSuffix(stamp, backupEncrypted)
+		stamp = strings.TrimSuffix(stamp, backupExtension)
+
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+
+		backups = append(backups, filepath.Join(dir, name))
+	}
+
+	// The timestamps sort in the same order as the times they represent.
+	sort.Strings(backups)
+
+	return backups, nil
+}
+
+// Restore
+//  1. Read the backup, decrypting it with the passphrase if it is
+//     encrypted.
+//  2. Write the database to a temporary file next to dbPath and ensure it
+//     is a bolt database with every Store bucket.
+//  3. Move the temporary file to dbPath, which must not already exist.
+//
+// The database must not be open while it is restored.
+func Restore(filename, dbPath, passphrase string) error {
+	// 1.  Read the backup.
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("could not Restore: %v", err)
+	}
+
+	data, err = openBackup(data, passphrase)
+	if err != nil {
+		return fmt.Errorf("could not Restore: %v", err)
+	}
+
+	// 2.  Write the database to a temporary file and check it.
+	tmp, err := checkDatabaseBytes(filepath.Dir(dbPath), data, true)
+	if err != nil {
+		return fmt.Errorf("could not Restore: %v", err)
+	}
+	defer os.Remove(tmp)
+
+	// 3.  Move the temporary file to dbPath. A hard link fails if dbPath
+	//     exists, so an existing database is never replaced.
+	err = os.Link(tmp, dbPath)
+	if err != nil {
+		return fmt.Errorf("could not Restore: %v", err)
+	}
+
+	return nil
+}
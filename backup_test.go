@@ -0,0 +1,250 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	backupDB         = "backup_src_test.db"
+	backupFile       = "backup_file_test.db"
+	backupRestoreDB  = "backup_restore_test.db"
+	backupPassphrase = "correct horse battery staple"
+	backupUserKey    = NewAuthToken().String()
+)
+
+func TestBackup(t *testing.T) {
+	s, err := NewStore(backupDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer s.Close()
+	defer os.Remove(backupDB)
+
+	s.write(userBucket, backupUserKey, []byte("value1"))
+
+	t.Run("Test Backup Refuses Existing File", func(t *testing.T) { testBackupExisting(t, &s) })
+	t.Run("Test Backup Encrypted", func(t *testing.T) { testBackupEncrypted(t, &s) })
+	t.Run("Test Backup Rotate", func(t *testing.T) { testBackupRotate(t, &s) })
+	t.Run("Test Restore", func(t *testing.T) { testRestore(t, &s) })
+	t.Run("Test Restore Invalid", testRestoreInvalid)
+}
+
+func testBackupExisting(t *testing.T, s *Store) {
+	fmt.Println(t.Name())
+
+	err := os.WriteFile(backupFile, []byte("keep me"), 0600)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(backupFile)
+
+	err = s.Backup(backupFile)
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	data, _ := os.ReadFile(backupFile)
+	if string(data) != "keep me" {
+		t.Fatalf("Expected existing file to be unchanged, received %q", data)
+	}
+}
+
+func testBackupEncrypted(t *testing.T, s *Store) {
+	fmt.Println(t.Name())
+
+	err := s.BackupEncrypted(backupFile, backupPassphrase)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(backupFile)
+
+	encrypted, err := IsEncryptedBackup(backupFile)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !encrypted {
+		t.Fatal("Expected backup to be encrypted")
+	}
+
+	err = VerifyBackup(backupFile, backupPassphrase)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = VerifyBackup(backupFile, "the wrong passphrase")
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	err = Restore(backupFile, backupRestoreDB, "the wrong passphrase")
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+}
+
+func testBackupRotate(t *testing.T, s *Store) {
+	fmt.Println(t.Name())
+
+	dir, err := os.MkdirTemp("", "lckbx-backup")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Files that are not timestamped backups are never removed.
+	other := filepath.Join(dir, "lckbx-other.db")
+	os.WriteFile(other, []byte("other"), 0600)
+
+	var names []string
+	for i := 0; i < 5; i++ {
+		name, err := s.BackupRotate(dir, 3, "")
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		names = append(names, name)
+	}
+
+	backups, err := ListBackups(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(backups) != 3 {
+		t.Fatalf("Expected three backups, received %v", backups)
+	}
+
+	for i, name := range names[2:] {
+		if backups[i] != name {
+			t.Fatalf("Expected %s, received %s", name, backups[i])
+		}
+	}
+
+	if _, err := os.Stat(other); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+}
+
+func testRestore(t *testing.T, s *Store) {
+	fmt.Println(t.Name())
+
+	err := s.BackupEncrypted(backupFile, backupPassphrase)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(backupFile)
+
+	err = Restore(backupFile, backupRestoreDB, backupPassphrase)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(backupRestoreDB)
+
+	// Restore never replaces an existing database.
+	err = Restore(backupFile, backupRestoreDB, backupPassphrase)
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	r, err := NewStore(backupRestoreDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer r.Close()
+
+	if string(r.read(userBucket, backupUserKey)) != "value1" {
+		t.Fatalf("Expected value1, received %s", r.read(userBucket, backupUserKey))
+	}
+}
+
+func testRestoreInvalid(t *testing.T) {
+	fmt.Println(t.Name())
+
+	// A file that is not a database is rejected.
+	err := os.WriteFile(backupFile, []byte("not a database"), 0600)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = Restore(backupFile, backupRestoreDB, "")
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+	os.Remove(backupFile)
+
+	// A database without the Store buckets is rejected.
+	db, err := bolt.Open(backupFile, 0600, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	db.Close()
+	defer os.Remove(backupFile)
+
+	err = Restore(backupFile, backupRestoreDB, "")
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	// A database with the Store buckets but records that do not belong in
+	// them is rejected.
+	db, err = bolt.Open(backupFile, 0600, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range requiredBuckets {
+			_, err := tx.CreateBucketIfNotExists([]byte(bucket))
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Bucket([]byte(itemBucket)).Put([]byte("not a token"), []byte("value"))
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = Restore(backupFile, backupRestoreDB, "")
+	if err == nil {
+		t.Fatal("Expected error for a bad record, received nil")
+	}
+
+	// A database with a bucket the Store does not know about is rejected.
+	db, err = bolt.Open(backupFile, 0600, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		err := tx.Bucket([]byte(itemBucket)).Delete([]byte("not a token"))
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket([]byte("foreign"))
+		return err
+	})
+	db.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = Restore(backupFile, backupRestoreDB, "")
+	if err == nil {
+		t.Fatal("Expected error for an unknown bucket, received nil")
+	}
+
+	if _, err := os.Stat(backupRestoreDB); err == nil {
+		os.Remove(backupRestoreDB)
+		t.Fatal("Expected no database to be restored")
+	}
+}
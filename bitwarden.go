@@ -0,0 +1,408 @@
+package lckbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// The types of Bitwarden items and key derivation functions.
+const (
+	bitwardenLogin    = 1
+	bitwardenNote     = 2
+	bitwardenCard     = 3
+	bitwardenIdentity = 4
+
+	bitwardenPBKDF2 = 0
+	bitwardenArgon2 = 1
+)
+
+// The most expensive key derivation parameters Bitwarden allows. The
+// parameters are read from the export before it can be authenticated, so
+// larger ones are rejected rather than left to exhaust memory or time.
+const (
+	bitwardenMaxPBKDF2Iterations = 2000000
+	bitwardenMaxArgon2Iterations = 10
+	bitwardenMaxArgon2Memory     = 1024
+	bitwardenMaxArgon2Threads    = 16
+)
+
+// bitwardenHeader holds the fields that say whether a Bitwarden export is
+// encrypted, and how to derive the key from the export password.
+type bitwardenHeader struct {
+	Encrypted         *bool
+	PasswordProtected bool
+	Salt              string
+	KdfType           int
+	KdfIterations     uint32
+	KdfMemory         uint32
+	KdfParallelism    uint8
+	EncKeyValidation  string `json:"encKeyValidation_DO_NOT_EDIT"`
+	Data              string
+}
+
+// bitwardenExport is an unencrypted Bitwarden JSON export.
+type bitwardenExport struct {
+	Folders []struct {
+		Id   string
+		Name string
+	}
+	Items []bitwardenItem
+}
+
+// bitwardenItem is a single item in a Bitwarden export.
+type bitwardenItem struct {
+	Id           string
+	FolderId     string
+	Type         int
+	Name         string
+	Notes        string
+	Favorite     bool
+	CreationDate time.Time
+	RevisionDate time.Time
+	Fields       []struct {
+		Name  string
+		Value string
+		Type  int
+	}
+	Login *struct {
+		Username string
+		Password string
+		Totp     string
+		Uris     []struct {
+			Uri string
+		}
+	}
+	Card *struct {
+		CardholderName string
+		Brand          string
+		Number         string
+		ExpMonth       string
+		ExpYear        string
+		Code           string
+	}
+	Identity *struct {
+		Title          string
+		FirstName      string
+		MiddleName     string
+		LastName       string
+		Address1       string
+		Address2       string
+		Address3       string
+		City           string
+		State          string
+		PostalCode     string
+		Country        string
+		Company        string
+		Email          string
+		Phone          string
+		SSN            string
+		Username       string
+		PassportNumber string
+		LicenseNumber  string
+	}
+}
+
+// readBitwardenHeader reads the header of a Bitwarden JSON export. Every
+// export has an "encrypted" field.
+func readBitwardenHeader(data []byte) (bitwardenHeader, error) {
+	var h bitwardenHeader
+
+	err := json.Unmarshal(data, &h)
+	if err != nil || h.Encrypted == nil {
+		return h, fmt.Errorf("not a Bitwarden export")
+	}
+
+	return h, nil
+}
+
+// bitwardenKeys derives the encryption and MAC keys from the export
+// password. The salt is used as text by PBKDF2 and hashed for Argon2id, and
+// the key is stretched into two keys with HKDF. The Argon2id memory is in
+// MiB.
+func (h bitwardenHeader) keys(password string) ([]byte, []byte, error) {
+	var key []byte
+
+	switch h.KdfType {
+	case bitwardenPBKDF2:
+		if h.KdfIterations < 1 || h.KdfIterations > bitwardenMaxPBKDF2Iterations {
+			return nil, nil, fmt.Errorf("invalid PBKDF2 parameters")
+		}
+
+		key = pbkdf2.Key([]byte(password), []byte(h.Salt), int(h.KdfIterations), 32, sha256.New)
+	case bitwardenArgon2:
+		if h.KdfIterations < 1 || h.KdfIterations > bitwardenMaxArgon2Iterations ||
+			h.KdfMemory < 1 || h.KdfMemory > bitwardenMaxArgon2Memory ||
+			h.KdfParallelism < 1 || h.KdfParallelism > bitwardenMaxArgon2Threads {
+			return nil, nil, fmt.Errorf("invalid Argon2 parameters")
+		}
+
+		salt := sha256.Sum256([]byte(h.Salt))
+		key = argon2.IDKey([]byte(password), salt[:], h.KdfIterations, h.KdfMemory*1024, h.KdfParallelism, 32)
+	default:
+		return nil, nil, fmt.Errorf("unsupported key derivation function %d", h.KdfType)
+	}
+
+	encKey := make([]byte, 32)
+	macKey := make([]byte, 32)
+
+	io.ReadFull(hkdf.Expand(sha256.New, key, []byte("enc")), encKey)
+	io.ReadFull(hkdf.Expand(sha256.New, key, []byte("mac")), macKey)
+
+	return encKey, macKey, nil
+}
+
+// bitwardenDecrypt decrypts a Bitwarden EncString of type 2, which is
+// "2.iv|ciphertext|mac" in base64, encrypted with AES-256-CBC and
+// authenticated with HMAC-SHA-256. A MAC that does not match means the
+// password is wrong.
+func bitwardenDecrypt(s string, encKey, macKey []byte) ([]byte, error) {
+	if !strings.HasPrefix(s, "2.") {
+		return nil, fmt.Errorf("unsupported encryption type")
+	}
+
+	parts := strings.Split(s[2:], "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid encrypted string")
+	}
+
+	var decoded [3][]byte
+	for n, part := range parts {
+		b, err := base64.StdEncoding.DecodeString(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encrypted string")
+		}
+		decoded[n] = b
+	}
+
+	iv, ciphertext, mac := decoded[0], decoded[1], decoded[2]
+
+	h := hmac.New(sha256.New, macKey)
+	h.Write(iv)
+	h.Write(ciphertext)
+	if !hmac.Equal(h.Sum(nil), mac) {
+		return nil, fmt.Errorf("wrong password")
+	}
+
+	block, err := aes.NewCipher(encKey)
+	if err != nil || len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("invalid encrypted string")
+	}
+
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(plain[len(plain)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+
+	return plain[:len(plain)-pad], nil
+}
+
+// entry converts a Bitwarden item to an ImportEntry. Custom fields, TOTP
+// secrets, and identity numbers that have no place in an Item are added to
+// its notes, and favorites are tagged "favorite".
+func (b bitwardenItem) entry(folders map[string][]string) (ImportEntry, error) {
+	var e ImportEntry
+	var extra []string
+
+	// add records a field and keeps its value for the notes.
+	add := func(from, name, value string) {
+		if value != "" {
+			extra = append(extra, name+": "+value)
+			e.mapField(from, "notes")
+		}
+	}
+
+	// set stores a non-empty field in the Item.
+	set := func(from, to string, field *string, value string) {
+		if value != "" {
+			*field = value
+			e.mapField(from, to)
+		}
+	}
+
+	e.Folder = folders[b.FolderId]
+	e.Entry = strings.Join(append(append([]string{}, e.Folder...), b.Name), "/")
+
+	switch {
+	case b.Type == bitwardenLogin && b.Login != nil:
+		e.Item = NewItem(LoginType)
+		l := e.Item.Login
+
+		set("login.username", "username", &l.Username, b.Login.Username)
+		set("login.password", "password", &l.Password, b.Login.Password)
+
+		for _, uri := range b.Login.Uris {
+			if uri.Uri != "" {
+				l.URLs = append(l.URLs, uri.Uri)
+				e.mapField("login.uris", "url")
+			}
+		}
+
+		add("login.totp", "totp", b.Login.Totp)
+	case b.Type == bitwardenNote:
+		e.Item = NewItem(SecureNoteType)
+	case b.Type == bitwardenCard && b.Card != nil:
+		e.Item = NewItem(CardType)
+		c := e.Item.Card
+
+		set("card.cardholderName", "cardholder", &c.Cardholder, b.Card.CardholderName)
+		set("card.brand", "brand", &c.Brand, b.Card.Brand)
+		set("card.number", "number", &c.Number, b.Card.Number)
+		set("card.code", "code", &c.Code, b.Card.Code)
+
+		month := b.Card.ExpMonth
+		if len(month) == 1 {
+			month = "0" + month
+		}
+		set("card.expMonth", "expiry", &c.Expiry, strings.Trim(month+"/"+b.Card.ExpYear, "/"))
+	case b.Type == bitwardenIdentity && b.Identity != nil:
+		e.Item = NewItem(IdentityType)
+		i, id := e.Item.Identity, b.Identity
+
+		set("identity.title", "title", &i.Title, id.Title)
+		set("identity.firstName", "first_name", &i.FirstName, id.FirstName)
+		set("identity.middleName", "middle_name", &i.MiddleName, id.MiddleName)
+		set("identity.lastName", "last_name", &i.LastName, id.LastName)
+		set("identity.company", "company", &i.Company, id.Company)
+		set("identity.email", "email", &i.Email, id.Email)
+		set("identity.phone", "phone", &i.Phone, id.Phone)
+		set("identity.city", "city", &i.City, id.City)
+		set("identity.state", "state", &i.State, id.State)
+		set("identity.postalCode", "postal_code", &i.PostalCode, id.PostalCode)
+		set("identity.country", "country", &i.Country, id.Country)
+
+		var address []string
+		for _, line := range []string{id.Address1, id.Address2, id.Address3} {
+			if line != "" {
+				address = append(address, line)
+			}
+		}
+		set("identity.address1", "address", &i.Address, strings.Join(address, ", "))
+
+		add("identity.ssn", "ssn", id.SSN)
+		add("identity.username", "username", id.Username)
+		add("identity.passportNumber", "passport_number", id.PassportNumber)
+		add("identity.licenseNumber", "license_number", id.LicenseNumber)
+	default:
+		return e, fmt.Errorf("unsupported item type %d", b.Type)
+	}
+
+	e.Item.Name = b.Name
+	e.mapField("name", "name")
+
+	// Linked fields only point at other fields of the item.
+	const linkedField = 3
+	for _, f := range b.Fields {
+		if f.Type != linkedField {
+			add("fields", f.Name, f.Value)
+		}
+	}
+
+	if b.Notes != "" {
+		e.mapField("notes", "notes")
+	}
+	e.Item.Data = []byte(importNotes(b.Notes, extra))
+
+	if len(e.Folder) > 0 {
+		e.mapField("folderId", "folder")
+	}
+
+	if b.Favorite {
+		e.Tags = []string{"favorite"}
+		e.mapField("favorite", "tags")
+	}
+
+	e.Created = b.CreationDate
+	e.Modified = b.RevisionDate
+
+	return e, nil
+}
+
+// bitwardenImporter reads Bitwarden JSON exports, either unencrypted or
+// protected with an export password. Exports encrypted with the account key
+// cannot be read outside of Bitwarden. Logins, secure notes, cards, and
+// identities become Items of the same type, and nested folders, which
+// Bitwarden names with their path, become Folders.
+type bitwardenImporter struct{}
+
+// Detect reports whether the data is a Bitwarden JSON export.
+func (bitwardenImporter) Detect(data []byte) bool {
+	_, err := readBitwardenHeader(data)
+	return err == nil
+}
+
+// Encrypted reports whether the export is protected with a password.
+func (bitwardenImporter) Encrypted(data []byte) bool {
+	h, err := readBitwardenHeader(data)
+	return err == nil && *h.Encrypted
+}
+
+// Read decrypts the export, if it is encrypted, and converts its items.
+func (bitwardenImporter) Read(data []byte, opts ImportOptions) ([]ImportEntry, []ImportFailure, error) {
+	h, err := readBitwardenHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if *h.Encrypted {
+		if !h.PasswordProtected {
+			return nil, nil, fmt.Errorf("export is encrypted with the Bitwarden account key, export it again with a password")
+		}
+
+		encKey, macKey, err := h.keys(opts.Password)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		_, err = bitwardenDecrypt(h.EncKeyValidation, encKey, macKey)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		data, err = bitwardenDecrypt(h.Data, encKey, macKey)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var export bitwardenExport
+	err = json.Unmarshal(data, &export)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid Bitwarden export: %v", err)
+	}
+
+	folders := make(map[string][]string)
+	for _, f := range export.Folders {
+		folders[f.Id] = strings.Split(f.Name, "/")
+	}
+
+	var entries []ImportEntry
+	var failures []ImportFailure
+
+	for _, b := range export.Items {
+		e, err := b.entry(folders)
+		if err != nil {
+			failures = append(failures, ImportFailure{Entry: e.Entry, Reason: err.Error()})
+			continue
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, failures, nil
+}
@@ -0,0 +1,201 @@
+package lckbx
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var bitwardenExportJSON = `{
+	"encrypted": false,
+	"folders": [{"id": "f1", "name": "Work/Email"}],
+	"items": [
+		{
+			"id": "i1", "folderId": "f1", "type": 1, "name": "Mail", "favorite": true,
+			"notes": "Shared inbox.",
+			"creationDate": "2022-01-02T03:04:05.000Z", "revisionDate": "2023-01-02T03:04:05.000Z",
+			"fields": [{"name": "PIN", "value": "1234", "type": 1}, {"name": "Linked", "value": null, "type": 3}],
+			"login": {"username": "alice", "password": "hunter2", "totp": "JBSWY3DPEHPK3PXP",
+				"uris": [{"match": null, "uri": "https://mail.example.com"}]}
+		},
+		{
+			"id": "i2", "folderId": null, "type": 3, "name": "Visa",
+			"card": {"cardholderName": "Alice", "brand": "Visa", "number": "4111111111111111",
+				"expMonth": "3", "expYear": "2030", "code": "123"}
+		},
+		{
+			"id": "i3", "type": 4, "name": "Me",
+			"identity": {"firstName": "Alice", "lastName": "Smith", "address1": "1 Main St",
+				"address2": "Apt 2", "city": "Springfield", "ssn": "000-00-0000"}
+		},
+		{"id": "i4", "type": 2, "name": "Note", "notes": "Just text.", "secureNote": {"type": 0}},
+		{"id": "i5", "type": 5, "name": "SSH Key"}
+	]
+}`
+
+// bitwardenEncrypt encrypts the data as a Bitwarden EncString of type 2.
+func bitwardenEncrypt(data, encKey, macKey []byte) string {
+	iv := bytes.Repeat([]byte{0x42}, aes.BlockSize)
+
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	padded := append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	block, _ := aes.NewCipher(encKey)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(padded, padded)
+
+	h := hmac.New(sha256.New, macKey)
+	h.Write(iv)
+	h.Write(padded)
+
+	enc := base64.StdEncoding.EncodeToString
+	return "2." + enc(iv) + "|" + enc(padded) + "|" + enc(h.Sum(nil))
+}
+
+// bitwardenProtect returns the export protected with the password, using
+// the given key derivation function.
+func bitwardenProtect(t *testing.T, export, password string, kdfType int) []byte {
+	h := bitwardenHeader{
+		PasswordProtected: true,
+		Salt:              "c2FsdHNhbHRzYWx0c2FsdA==",
+		KdfType:           kdfType,
+		KdfIterations:     1000,
+	}
+
+	if kdfType == bitwardenArgon2 {
+		h.KdfIterations, h.KdfMemory, h.KdfParallelism = 1, 1, 1
+	}
+
+	encKey, macKey, err := h.keys(password)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	protected, _ := json.Marshal(map[string]interface{}{
+		"encrypted":                    true,
+		"passwordProtected":            true,
+		"salt":                         h.Salt,
+		"kdfType":                      h.KdfType,
+		"kdfIterations":                h.KdfIterations,
+		"kdfMemory":                    h.KdfMemory,
+		"kdfParallelism":               h.KdfParallelism,
+		"encKeyValidation_DO_NOT_EDIT": bitwardenEncrypt([]byte("validation"), encKey, macKey),
+		"data":                         bitwardenEncrypt([]byte(export), encKey, macKey),
+	})
+
+	return protected
+}
+
+func TestBitwarden(t *testing.T) {
+	t.Run("Test Bitwarden Read", testBitwardenRead)
+	t.Run("Test Bitwarden Encrypted", testBitwardenEncrypted)
+}
+
+func testBitwardenRead(t *testing.T) {
+	fmt.Println(t.Name())
+
+	imp := bitwardenImporter{}
+	data := []byte(bitwardenExportJSON)
+
+	if !imp.Detect(data) || imp.Encrypted(data) {
+		t.Fatal("Expected an unencrypted Bitwarden export")
+	}
+
+	if imp.Detect([]byte(`{"items": []}`)) {
+		t.Fatal("Expected JSON without an encrypted field to be rejected")
+	}
+
+	entries, failures, err := imp.Read(data, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(entries) != 4 || len(failures) != 1 || failures[0].Entry != "SSH Key" {
+		t.Fatalf("Expected 4 entries and the SSH key to fail, received %d and %+v", len(entries), failures)
+	}
+
+	mail := entries[0]
+	if strings.Join(mail.Folder, "/") != "Work/Email" || mail.Entry != "Work/Email/Mail" || strings.Join(mail.Tags, ",") != "favorite" {
+		t.Fatalf("Expected a favorite in Work/Email, received %+v", mail)
+	}
+
+	l := mail.Item.Login
+	if l.Username != "alice" || l.Password != "hunter2" || strings.Join(l.URLs, " ") != "https://mail.example.com" {
+		t.Fatalf("Expected the Mail login, received %+v", l)
+	}
+
+	if string(mail.Item.Data) != "Shared inbox.\n\ntotp: JBSWY3DPEHPK3PXP\nPIN: 1234" {
+		t.Fatalf("Expected notes with the extra fields, received %q", mail.Item.Data)
+	}
+
+	if mail.Created.Year() != 2022 || mail.Modified.Year() != 2023 {
+		t.Fatalf("Expected the timestamps, received %v and %v", mail.Created, mail.Modified)
+	}
+
+	card := entries[1].Item.Card
+	if card == nil || card.Number != "4111111111111111" || card.Expiry != "03/2030" || card.Code != "123" {
+		t.Fatalf("Expected the Visa card, received %+v", entries[1].Item)
+	}
+
+	identity := entries[2].Item.Identity
+	if identity == nil || identity.Address != "1 Main St, Apt 2" || identity.City != "Springfield" {
+		t.Fatalf("Expected the identity, received %+v", entries[2].Item)
+	}
+
+	if string(entries[2].Item.Data) != "ssn: 000-00-0000" {
+		t.Fatalf("Expected the ssn in the notes, received %q", entries[2].Item.Data)
+	}
+
+	if entries[3].Item.Type != SecureNoteType || string(entries[3].Item.Data) != "Just text." {
+		t.Fatalf("Expected the note, received %+v", entries[3].Item)
+	}
+}
+
+func testBitwardenEncrypted(t *testing.T) {
+	fmt.Println(t.Name())
+
+	imp := bitwardenImporter{}
+
+	for _, kdfType := range []int{bitwardenPBKDF2, bitwardenArgon2} {
+		data := bitwardenProtect(t, bitwardenExportJSON, "export password", kdfType)
+
+		if !imp.Detect(data) || !imp.Encrypted(data) {
+			t.Fatal("Expected an encrypted Bitwarden export")
+		}
+
+		entries, _, err := imp.Read(data, ImportOptions{Password: "export password"})
+		if err != nil || len(entries) != 4 {
+			t.Fatalf("Expected 4 entries, received %d and %v", len(entries), err)
+		}
+
+		_, _, err = imp.Read(data, ImportOptions{Password: "wrong password"})
+		if err == nil || !strings.Contains(err.Error(), "wrong password") {
+			t.Fatalf("Expected wrong password, received %v", err)
+		}
+	}
+
+	// Parameters beyond Bitwarden's limits are rejected before deriving.
+	huge := []bitwardenHeader{
+		{KdfType: bitwardenPBKDF2, KdfIterations: 2000001},
+		{KdfType: bitwardenArgon2, KdfIterations: 11, KdfMemory: 64, KdfParallelism: 4},
+		{KdfType: bitwardenArgon2, KdfIterations: 3, KdfMemory: 1 << 22, KdfParallelism: 4},
+		{KdfType: bitwardenArgon2, KdfIterations: 3, KdfMemory: 64, KdfParallelism: 17},
+	}
+
+	for _, h := range huge {
+		if _, _, err := h.keys("export password"); err == nil {
+			t.Fatalf("Expected error for %+v, received nil", h)
+		}
+	}
+
+	account := []byte(`{"encrypted": true, "encKeyValidation_DO_NOT_EDIT": "2.a|b|c", "data": "2.a|b|c"}`)
+	if _, _, err := imp.Read(account, ImportOptions{Password: "export password"}); err == nil {
+		t.Fatal("Expected error for an export encrypted with the account key, received nil")
+	}
+}
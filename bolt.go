@@ -1,23 +1,48 @@
 package lckbx
 
 import (
+	"bytes"
 	"fmt"
-	"os"
+	"io"
 	"time"
 
 	"github.com/boltdb/bolt"
 )
 
 const (
-	userBucket     = "user"
-	authBucket     = "auth"
-	keysetBucket   = "keyset"
-	metadataBucket = "metadata"
-	itemBucket     = "item"
+	userBucket       = "user"
+	authBucket       = "auth"
+	keysetBucket     = "keyset"
+	metadataBucket   = "metadata"
+	itemBucket       = "item"
+	recoveryBucket   = "recovery"
+	quarantineBucket = "quarantine"
+	attachmentBucket = "attachment"
+	revisionBucket   = "revision"
+	deriverBucket    = "deriver"
+
+	// defaultDeriverKey is the key in the deriver bucket of the deriver
+	// version new passwords are derived with. The other keys are UserTokens.
+	defaultDeriverKey = "default"
 )
 
 var (
-	storeBuckets = [5]string{
+	storeBuckets = [10]string{
+		userBucket,
+		authBucket,
+		keysetBucket,
+		metadataBucket,
+		itemBucket,
+		recoveryBucket,
+		quarantineBucket,
+		attachmentBucket,
+		revisionBucket,
+		deriverBucket,
+	}
+
+	// requiredBuckets are the buckets every lckbx database has had. Buckets
+	// added since are created by NewStore when an older database is opened.
+	requiredBuckets = []string{
 		userBucket,
 		authBucket,
 		keysetBucket,
@@ -60,15 +85,37 @@ func (s *Store) createBucket(bucket string) error {
 	})
 }
 
-// Write stores the given key/value pair in the given bucket.
-func (s *Store) write(bucket, key string, value []byte) error {
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
+// Update runs the given function in a single read-write transaction. The
+// recorder passed to the function reads and writes records in that
+// transaction. If the function returns an error, none of its writes are
+// saved.
+func (s *Store) Update(fn func(r recorder) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
 
-		return b.Put([]byte(key), []byte(value))
+// View runs the given function in a single read-only transaction, so the
+// records it reads are consistent with each other without taking the write
+// lock. Writes through the recorder passed to the function fail.
+func (s *Store) View(fn func(r recorder) error) error {
+	return s.view(func(r boltTx) error {
+		return fn(r)
 	})
+}
 
-	return err
+// view runs the given function in a read-only transaction.
+func (s *Store) view(fn func(r boltTx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Write stores the given key/value pair in the given bucket.
+func (s *Store) write(bucket, key string, value []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.write(bucket, key, value)
+	})
 }
 
 // Read gets the value associated with the given key in the given bucket. If the
@@ -76,11 +123,8 @@ func (s *Store) write(bucket, key string, value []byte) error {
 func (s *Store) read(bucket, key string) []byte {
 	var val []byte
 
-	s.db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-
-		val = b.Get([]byte(key))
-
+	s.view(func(r boltTx) error {
+		val = r.read(bucket, key)
 		return nil
 	})
 
@@ -90,97 +134,126 @@ func (s *Store) read(bucket, key string) []byte {
 // Delete removes a key/value pair from the given bucket. An error is returned
 // if the key/value pair cannot be deleted.
 func (s *Store) delete(bucket, key string) error {
-	err := s.db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(bucket))
-
-		return b.Delete([]byte(key))
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return boltTx{tx}.delete(bucket, key)
 	})
-
-	return err
 }
 
-// SaveUserId takes a username and UserToken and stores them in the auth
-// bucket. This allows the UserId to be found by username. The UserId is then
-// used to derive an AuthToken, which is used to lookup the user in the user
-// bucket.
+// SaveUserId stores the UserToken for the username in its own transaction.
 func (s *Store) SaveUserId(username string, uid UserToken) error {
-	err := s.write(authBucket, username, []byte(uid.String()))
-	if err != nil {
-		return fmt.Errorf("could not Store.SaveUserId: %v", err)
-	}
-
-	return nil
+	return s.Update(func(r recorder) error {
+		return r.SaveUserId(username, uid)
+	})
 }
 
 // GetUserId returns the UserToken associated with the given username. If the
 // username cannot be found or if there is an error parsing the token, a
 // random token is returned.
 func (s *Store) GetUserId(username string) UserToken {
-	var uid []byte
-	var ut UserToken
+	var uid UserToken
 
-	uid = s.read(authBucket, username)
-	if uid == nil {
-		return ut
-	}
-
-	token, err := parseUserToken(string(uid))
-	if err != nil {
-		return ut
-	}
+	s.view(func(r boltTx) error {
+		uid = r.GetUserId(username)
+		return nil
+	})
 
-	return token
+	return uid
 }
 
-// DeleteUserId deletes from the database the bytes for the UserToken
-// associated with the username. If the UserToken is deleted, you will not
-// be able to derive the AuthToken needed to get the user and you will not
-// be able to decrypt the user because the UserToken is used as authenticated
-// data during the encryption process.
+// DeleteUserId deletes the UserToken for the username in its own
+// transaction.
 func (s *Store) DeleteUserId(username string) error {
-	return s.delete(authBucket, username)
+	return s.Update(func(r recorder) error {
+		return r.DeleteUserId(username)
+	})
 }
 
-// SaveUser takes an AuthToken and the encrypted user bytes and saves them to
-// the user bucket. The AuthToken is derived from the unique UserToken
-// associated with the user.
-func (s *Store) SaveUser(aid AuthToken, data []byte) error {
-	err := s.write(userBucket, aid.String(), data)
+// SaveDeriverVersion stores the user's deriver version in its own
+// transaction.
+func (s *Store) SaveDeriverVersion(uid UserToken, version VersionToken) error {
+	return s.Update(func(r recorder) error {
+		return r.SaveDeriverVersion(uid, version)
+	})
+}
+
+// GetDeriverVersion returns the version of the deriver the user's password
+// is derived with.
+func (s *Store) GetDeriverVersion(uid UserToken) VersionToken {
+	var version VersionToken
+
+	s.view(func(r boltTx) error {
+		version = r.GetDeriverVersion(uid)
+		return nil
+	})
+
+	return version
+}
+
+// DeleteDeriverVersion deletes the user's deriver version in its own
+// transaction.
+func (s *Store) DeleteDeriverVersion(uid UserToken) error {
+	return s.Update(func(r recorder) error {
+		return r.DeleteDeriverVersion(uid)
+	})
+}
+
+// SaveDefaultDeriverVersion stores the version of the deriver that new
+// passwords are derived with.
+func (s *Store) SaveDefaultDeriverVersion(version VersionToken) error {
+	err := s.write(deriverBucket, defaultDeriverKey, []byte(version.String()))
 	if err != nil {
-		return fmt.Errorf("could not SaveUser: %v", err)
+		return fmt.Errorf("could not Store.SaveDefaultDeriverVersion: %v", err)
 	}
 
 	return nil
 }
 
+// GetDefaultDeriverVersion returns the version of the deriver that new
+// passwords are derived with. If none has been saved, or it cannot be
+// parsed, the original argonBlakeDeriverVersion is returned.
+func (s *Store) GetDefaultDeriverVersion() VersionToken {
+	var version VersionToken
+
+	s.view(func(r boltTx) error {
+		version = r.readDeriverVersion(defaultDeriverKey)
+		return nil
+	})
+
+	return version
+}
+
+// SaveUser saves the encrypted User bytes in its own transaction.
+func (s *Store) SaveUser(aid AuthToken, data []byte) error {
+	return s.Update(func(r recorder) error {
+		return r.SaveUser(aid, data)
+	})
+}
+
 // GetUser takes an AuthToken and returns the encrypted bytes for the user.
 func (s *Store) GetUser(aid AuthToken) ([]byte, error) {
 	var user []byte
 
-	user = s.read(userBucket, aid.String())
-	if user == nil {
-		return user, fmt.Errorf("could not GetUser: user %s not found", aid)
-	}
+	err := s.view(func(r boltTx) error {
+		var err error
+		user, err = r.GetUser(aid)
+		return err
+	})
 
-	return user, nil
+	return user, err
 }
 
-// DeleteUser takes an AuthToken and removes the encrypted bytes associated
-// with it from the user bucket. The AuthToken is derived from the unique
-// UserToken associated with the user.
+// DeleteUser deletes the encrypted User bytes in its own transaction.
 func (s *Store) DeleteUser(aid AuthToken) error {
-	return s.delete(userBucket, aid.String())
+	return s.Update(func(r recorder) error {
+		return r.DeleteUser(aid)
+	})
 }
 
-// SaveMetadata takes a MetadataToken and the encrypted metadata bytes and
-// saves them to the metadata bucket.
+// SaveMetadata saves the encrypted Metadata bytes in its own transaction.
 func (s *Store) SaveMetadata(mid MetadataToken, data []byte) error {
-	err := s.write(metadataBucket, mid.String(), data)
-	if err != nil {
-		return fmt.Errorf("could not SaveMetadata: %v", err)
-	}
-
-	return nil
+	return s.Update(func(r recorder) error {
+		return r.SaveMetadata(mid, data)
+	})
 }
 
 // GetMetadata takes a MetadataToken and returns the encrypted bytes for the
@@ -188,29 +261,28 @@ func (s *Store) SaveMetadata(mid MetadataToken, data []byte) error {
 func (s *Store) GetMetadata(mid MetadataToken) ([]byte, error) {
 	var md []byte
 
-	md = s.read(metadataBucket, mid.String())
-	if md == nil {
-		return md, fmt.Errorf("could not GetMetadata: metadata %s not found", mid)
-	}
+	err := s.view(func(r boltTx) error {
+		var err error
+		md, err = r.GetMetadata(mid)
+		return err
+	})
 
-	return md, nil
+	return md, err
 }
 
-// DeleteMetadata takes a MetadataToken and removes the encrypted bytes
-// associated with it from the metadata bucket.
+// DeleteMetadata deletes the encrypted Metadata bytes in its own
+// transaction.
 func (s *Store) DeleteMetadata(mid MetadataToken) error {
-	return s.delete(metadataBucket, mid.String())
+	return s.Update(func(r recorder) error {
+		return r.DeleteMetadata(mid)
+	})
 }
 
-// SaveKeyset takes a KeysetToken and the encrypted keyset bytes and saves
-// them to the keyset bucket.
+// SaveKeyset saves the encrypted Keyset bytes in its own transaction.
 func (s *Store) SaveKeyset(kid KeysetToken, data []byte) error {
-	err := s.write(keysetBucket, kid.String(), data)
-	if err != nil {
-		return fmt.Errorf("could not SaveKeyset: %v", err)
-	}
-
-	return nil
+	return s.Update(func(r recorder) error {
+		return r.SaveKeyset(kid, data)
+	})
 }
 
 // GetKeyset takes a KeysetToken and returns the encrypted bytes for the
@@ -218,67 +290,331 @@ func (s *Store) SaveKeyset(kid KeysetToken, data []byte) error {
 func (s *Store) GetKeyset(kid KeysetToken) ([]byte, error) {
 	var ks []byte
 
-	ks = s.read(keysetBucket, kid.String())
-	if ks == nil {
-		return ks, fmt.Errorf("could not GetKeyset: keyset %s not found", kid)
-	}
+	err := s.view(func(r boltTx) error {
+		var err error
+		ks, err = r.GetKeyset(kid)
+		return err
+	})
 
-	return ks, nil
+	return ks, err
 }
 
-// DeleteKeyset takes a KeysetToken and removes the encrypted bytes associated
-// with it from the keyset bucket.
+// DeleteKeyset deletes the encrypted Keyset bytes in its own transaction.
 func (s *Store) DeleteKeyset(kid KeysetToken) error {
-	return s.delete(keysetBucket, kid.String())
+	return s.Update(func(r recorder) error {
+		return r.DeleteKeyset(kid)
+	})
 }
 
-// SaveItem takes an ItemToken and the encrypted Item bytes and saves them
-// to the item bucket.
+// SaveItem saves the encrypted Item bytes in its own transaction.
 func (s *Store) SaveItem(iid ItemToken, data []byte) error {
-	err := s.write(itemBucket, iid.String(), data)
-	if err != nil {
-		return fmt.Errorf("could not SaveItem: %v", err)
-	}
-
-	return nil
+	return s.Update(func(r recorder) error {
+		return r.SaveItem(iid, data)
+	})
 }
 
 // GetItem takes an ItemToken and returns the encrypted bytes for the item.
 func (s *Store) GetItem(iid ItemToken) ([]byte, error) {
 	var item []byte
 
-	item = s.read(itemBucket, iid.String())
-	if item == nil {
-		return item, fmt.Errorf("could not GetItem: item %s not found", iid)
+	err := s.view(func(r boltTx) error {
+		var err error
+		item, err = r.GetItem(iid)
+		return err
+	})
+
+	return item, err
+}
+
+// DeleteItem deletes the encrypted Item bytes in its own transaction.
+func (s *Store) DeleteItem(iid ItemToken) error {
+	return s.Update(func(r recorder) error {
+		return r.DeleteItem(iid)
+	})
+}
+
+// SaveRecovery saves the recovery record bytes in its own transaction.
+func (s *Store) SaveRecovery(rid AuthToken, data []byte) error {
+	return s.Update(func(r recorder) error {
+		return r.SaveRecovery(rid, data)
+	})
+}
+
+// GetRecovery takes a RecoveryId and returns the bytes for the recovery
+// record.
+func (s *Store) GetRecovery(rid AuthToken) ([]byte, error) {
+	var rec []byte
+
+	err := s.view(func(r boltTx) error {
+		var err error
+		rec, err = r.GetRecovery(rid)
+		return err
+	})
+
+	return rec, err
+}
+
+// DeleteRecovery deletes the recovery record bytes in its own transaction.
+func (s *Store) DeleteRecovery(rid AuthToken) error {
+	return s.Update(func(r recorder) error {
+		return r.DeleteRecovery(rid)
+	})
+}
+
+// SaveAttachment saves the encrypted Attachment bytes in its own
+// transaction.
+func (s *Store) SaveAttachment(aid AttachmentToken, data []byte) error {
+	return s.Update(func(r recorder) error {
+		return r.SaveAttachment(aid, data)
+	})
+}
+
+// GetAttachment takes an AttachmentToken and returns the encrypted bytes for
+// the attachment.
+func (s *Store) GetAttachment(aid AttachmentToken) ([]byte, error) {
+	var att []byte
+
+	err := s.view(func(r boltTx) error {
+		var err error
+		att, err = r.GetAttachment(aid)
+		return err
+	})
+
+	return att, err
+}
+
+// ReadAttachment returns a reader over a copy of the encrypted Attachment
+// bytes, since the transaction it runs in ends before the reader is used.
+// Use View to read them without copying.
+func (s *Store) ReadAttachment(aid AttachmentToken) (io.Reader, error) {
+	att, err := s.GetAttachment(aid)
+	if err != nil {
+		return nil, err
 	}
 
-	return item, nil
+	return bytes.NewReader(att), nil
+}
 
+// DeleteAttachment deletes the encrypted Attachment bytes in its own
+// transaction.
+func (s *Store) DeleteAttachment(aid AttachmentToken) error {
+	return s.Update(func(r recorder) error {
+		return r.DeleteAttachment(aid)
+	})
 }
 
-// DeleteItem takes an ItemToken and removes the encrypted bytes associated
-// with it from the item bucket.
-func (s *Store) DeleteItem(iid ItemToken) error {
-	return s.delete(itemBucket, iid.String())
+// QuarantineAttachment moves the encrypted Attachment bytes to the
+// quarantine bucket in its own transaction.
+func (s *Store) QuarantineAttachment(aid AttachmentToken) error {
+	return s.Update(func(r recorder) error {
+		return r.QuarantineAttachment(aid)
+	})
 }
 
-// Backup creates a backup of the database to the given filename.
-func (s *Store) Backup(filename string) error {
-	err := s.db.View(func(tx *bolt.Tx) error {
-		file, e := os.Create(filename)
-		if e != nil {
-			return e
-		}
+// SaveRevision saves the encrypted Revision bytes in its own
+// transaction.
+func (s *Store) SaveRevision(rid RevisionToken, data []byte) error {
+	return s.Update(func(r recorder) error {
+		return r.SaveRevision(rid, data)
+	})
+}
+
+// GetRevision takes a RevisionToken and returns the encrypted bytes for
+// the revision.
+func (s *Store) GetRevision(rid RevisionToken) ([]byte, error) {
+	var rev []byte
+
+	err := s.view(func(r boltTx) error {
+		var err error
+		rev, err = r.GetRevision(rid)
+		return err
+	})
 
-		defer file.Close()
+	return rev, err
+}
+
+// DeleteRevision deletes the encrypted Revision bytes in its own
+// transaction.
+func (s *Store) DeleteRevision(rid RevisionToken) error {
+	return s.Update(func(r recorder) error {
+		return r.DeleteRevision(rid)
+	})
+}
 
-		_, e = tx.WriteTo(file)
-		return e
+// QuarantineRevision moves the encrypted Revision bytes to the
+// quarantine bucket in its own transaction.
+func (s *Store) QuarantineRevision(rid RevisionToken) error {
+	return s.Update(func(r recorder) error {
+		return r.QuarantineRevision(rid)
 	})
+}
+
+// GetItemIds returns the ItemToken of every Item in the item bucket.
+func (s *Store) GetItemIds() ([]ItemToken, error) {
+	var iids []ItemToken
+
+	err := s.view(func(r boltTx) error {
+		var err error
+		iids, err = r.GetItemIds()
+		return err
+	})
+
+	return iids, err
+}
+
+// QuarantineItem moves the encrypted Item bytes to the quarantine bucket in
+// its own transaction.
+func (s *Store) QuarantineItem(iid ItemToken) error {
+	return s.Update(func(r recorder) error {
+		return r.QuarantineItem(iid)
+	})
+}
+
+// checkRecord verifies that a key/value pair is well formed for the bucket
+// it is stored in. The records are encrypted, so only the tokens used as
+// keys, and the UserToken stored in the auth bucket, can be checked.
+func checkRecord(bucket string, key, value []byte) error {
+	var err error
+
+	if len(value) == 0 {
+		return fmt.Errorf("empty value")
+	}
+
+	switch bucket {
+	case authBucket:
+		if len(key) == 0 {
+			return fmt.Errorf("empty username")
+		}
+
+		_, err = parseUserToken(string(value))
+	case userBucket, recoveryBucket:
+		_, err = parseAuthToken(string(key))
+	case keysetBucket:
+		_, err = parseKeysetToken(string(key))
+	case metadataBucket:
+		_, err = parseMetadataToken(string(key))
+	case itemBucket:
+		_, err = parseItemToken(string(key))
+	case attachmentBucket:
+		_, err = parseAttachmentToken(string(key))
+	case revisionBucket:
+		_, err = parseRevisionToken(string(key))
+	case deriverBucket:
+		if string(key) != defaultDeriverKey {
+			_, err = parseUserToken(string(key))
+		}
+
+		if err == nil {
+			_, err = parseVersionToken(string(value))
+		}
+	}
 
 	return err
 }
 
+// Check
+//  1. Ensure each of the Store buckets exists, creating it in repair mode.
+//  2. Report any unknown buckets.
+//  3. Check that every record in each bucket is well formed, moving any
+//     that are not to the quarantine bucket in repair mode.
+//
+// Check only looks at the structure of the database. Use UnlockedBox.Check
+// to cross-check a user's Metadata, Keyset, and Items.
+func (s *Store) Check(repair bool) ([]Problem, error) {
+	var problems []Problem
+
+	check := func(tx *bolt.Tx) error {
+		// 1.  Ensure each of the Store buckets exists.
+		for _, bucket := range storeBuckets {
+			if tx.Bucket([]byte(bucket)) != nil {
+				continue
+			}
+
+			p := Problem{Bucket: bucket, Issue: "bucket is missing"}
+			if repair {
+				_, err := tx.CreateBucket([]byte(bucket))
+				if err != nil {
+					return err
+				}
+
+				p.Repair = "created bucket"
+			}
+
+			problems = append(problems, p)
+		}
+
+		// 2.  Report any unknown buckets.
+		err := tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			for _, bucket := range storeBuckets {
+				if bucket == string(name) {
+					return nil
+				}
+			}
+
+			problems = append(problems, Problem{Bucket: string(name), Issue: "unknown bucket"})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// 3.  Check every record in each bucket.
+		for _, bucket := range storeBuckets {
+			var bad []string
+
+			b := tx.Bucket([]byte(bucket))
+			if b == nil || bucket == quarantineBucket {
+				continue
+			}
+
+			err := b.ForEach(func(k, v []byte) error {
+				err := checkRecord(bucket, k, v)
+				if err != nil {
+					problems = append(problems, Problem{Bucket: bucket, Key: string(k), Issue: err.Error()})
+					bad = append(bad, string(k))
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if !repair {
+				continue
+			}
+
+			for _, key := range bad {
+				err := boltTx{tx}.quarantine(bucket, key)
+				if err != nil {
+					return err
+				}
+
+				for i := range problems {
+					if problems[i].Bucket == bucket && problems[i].Key == key {
+						problems[i].Repair = "quarantined"
+					}
+				}
+			}
+		}
+
+		return nil
+	}
+
+	var err error
+	if repair {
+		err = s.db.Update(check)
+	} else {
+		err = s.db.View(check)
+	}
+
+	if err != nil {
+		return problems, fmt.Errorf("could not Store.Check: %v", err)
+	}
+
+	return problems, nil
+}
+
 // Close closes the connection to the bolt database.
 func (s *Store) Close() error {
 	return s.db.Close()
@@ -12,10 +12,12 @@ func TestStore(t *testing.T) {
 	t.Run("Test StoreRWD", testStoreRWD)
 	t.Run("Test Store Backup", testStoreBackup)
 	t.Run("Test Store UserId", testStoreUserId)
+	t.Run("Test Store DeriverVersion", testStoreDeriverVersion)
 	t.Run("Test Store User", testStoreUser)
 	t.Run("Test Store Keyset", testStoreKeyset)
 	t.Run("Test Store Metadata", testStoreMetadata)
 	t.Run("Test Store Item", testStoreItem)
+	t.Run("Test Store Update", testStoreUpdate)
 }
 
 func testNewStore(t *testing.T) {
@@ -76,7 +78,7 @@ func testStoreRWD(t *testing.T) {
 func testStoreBackup(t *testing.T) {
 	fmt.Println(t.Name())
 
-	key := "user1"
+	key := NewAuthToken().String()
 	val := []byte("value1")
 
 	s, _ := NewStore("test.db")
@@ -128,6 +130,66 @@ func testStoreUserId(t *testing.T) {
 
 }
 
+func testStoreDeriverVersion(t *testing.T) {
+	fmt.Println(t.Name())
+
+	s, _ := NewStore("test.db")
+	defer s.Close()
+	defer os.Remove("test.db")
+
+	uid := NewUserToken()
+	original, _ := parseVersionToken(argonBlakeDeriverVersion)
+	upgraded, _ := parseVersionToken(argonBlake3x256DeriverVersion)
+
+	// Users without a record use the original deriver.
+	if v := s.GetDeriverVersion(uid); v != original {
+		t.Fatal("Expected", original.String(), ", received", v.String())
+	}
+
+	if v := s.GetDefaultDeriverVersion(); v != original {
+		t.Fatal("Expected", original.String(), ", received", v.String())
+	}
+
+	err := s.SaveDeriverVersion(uid, upgraded)
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	err = s.SaveDefaultDeriverVersion(upgraded)
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	if v := s.GetDeriverVersion(uid); v != upgraded {
+		t.Fatal("Expected", upgraded.String(), ", received", v.String())
+	}
+
+	if v := s.GetDefaultDeriverVersion(); v != upgraded {
+		t.Fatal("Expected", upgraded.String(), ", received", v.String())
+	}
+
+	// The records pass the store check, and a bad one does not.
+	s.write(deriverBucket, NewUserToken().String(), []byte("not a version"))
+
+	problems, err := s.Check(false)
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	if len(problems) != 1 || problems[0].Bucket != deriverBucket {
+		t.Fatal("Expected one problem in the deriver bucket, received", problems)
+	}
+
+	err = s.DeleteDeriverVersion(uid)
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	if v := s.GetDeriverVersion(uid); v != original {
+		t.Fatal("Expected", original.String(), ", received", v.String())
+	}
+}
+
 func testStoreUser(t *testing.T) {
 	fmt.Println(t.Name())
 
@@ -227,3 +289,93 @@ func testStoreItem(t *testing.T) {
 		t.Fatal("Expected", string(itemBytes), ", received", string(item))
 	}
 }
+
+func testStoreUpdate(t *testing.T) {
+	fmt.Println(t.Name())
+
+	s, _ := NewStore("test.db")
+	defer s.Close()
+	defer os.Remove("test.db")
+
+	username := "testuser"
+	uid := NewUserToken()
+	aid := NewAuthToken()
+	kid := NewKeysetToken()
+
+	// A successful Update saves every record.
+	err := s.Update(func(r recorder) error {
+		err := r.SaveUserId(username, uid)
+		if err != nil {
+			return err
+		}
+
+		err = r.SaveUser(aid, []byte("user"))
+		if err != nil {
+			return err
+		}
+
+		// Records written earlier in the transaction can be read.
+		if r.GetUserId(username) != uid {
+			return fmt.Errorf("expected %s", uid)
+		}
+
+		return r.SaveKeyset(kid, []byte("keyset"))
+	})
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	if s.GetUserId(username) != uid {
+		t.Fatal("Expected", uid, "received", s.GetUserId(username))
+	}
+
+	if _, err := s.GetKeyset(kid); err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	// A failed Update saves nothing, including the deletes.
+	iid := NewItemToken()
+	err = s.Update(func(r recorder) error {
+		err := r.SaveItem(iid, []byte("item"))
+		if err != nil {
+			return err
+		}
+
+		err = r.DeleteUser(aid)
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("failed")
+	})
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	if _, err := s.GetItem(iid); err == nil {
+		t.Fatal("Expected error for rolled back item, received nil")
+	}
+
+	if _, err := s.GetUser(aid); err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+}
+
+// failingStore is a Store whose transactions run but are never committed.
+// It is used to test that multi-record writes are all rolled back together.
+type failingStore struct {
+	*Store
+}
+
+func (f failingStore) Update(fn func(r recorder) error) error {
+	err := f.Store.Update(func(r recorder) error {
+		err := fn(r)
+		if err != nil {
+			return err
+		}
+
+		return fmt.Errorf("failingStore: transaction rolled back")
+	})
+
+	return err
+}
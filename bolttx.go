@@ -0,0 +1,401 @@
+package lckbx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/boltdb/bolt"
+)
+
+// boltTx implements the recorder interface on a single bolt transaction.
+// Every record read, written, or deleted through a boltTx is committed, or
+// rolled back, together.
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// write stores the given key/value pair in the given bucket.
+func (b boltTx) write(bucket, key string, value []byte) error {
+	return b.tx.Bucket([]byte(bucket)).Put([]byte(key), value)
+}
+
+// read gets the value associated with the given key in the given bucket. If
+// the key does not exist, read returns nil. The value is copied because
+// bolt only guarantees it for the life of the transaction.
+func (b boltTx) read(bucket, key string) []byte {
+	val := b.tx.Bucket([]byte(bucket)).Get([]byte(key))
+	if val == nil {
+		return nil
+	}
+
+	return append([]byte{}, val...)
+}
+
+// delete removes a key/value pair from the given bucket.
+func (b boltTx) delete(bucket, key string) error {
+	return b.tx.Bucket([]byte(bucket)).Delete([]byte(key))
+}
+
+// SaveUserId takes a username and UserToken and stores them in the auth
+// bucket. This allows the UserId to be found by username. The UserId is then
+// used to derive an AuthToken, which is used to lookup the user in the user
+// bucket.
+func (b boltTx) SaveUserId(username string, uid UserToken) error {
+	err := b.write(authBucket, username, []byte(uid.String()))
+	if err != nil {
+		return fmt.Errorf("could not Store.SaveUserId: %v", err)
+	}
+
+	return nil
+}
+
+// GetUserId returns the UserToken associated with the given username. If the
+// username cannot be found or if there is an error parsing the token, a
+// random token is returned.
+func (b boltTx) GetUserId(username string) UserToken {
+	var ut UserToken
+
+	uid := b.read(authBucket, username)
+	if uid == nil {
+		return ut
+	}
+
+	token, err := parseUserToken(string(uid))
+	if err != nil {
+		return ut
+	}
+
+	return token
+}
+
+// DeleteUserId deletes from the database the bytes for the UserToken
+// associated with the username. If the UserToken is deleted, you will not
+// be able to derive the AuthToken needed to get the user and you will not
+// be able to decrypt the user because the UserToken is used as authenticated
+// data during the encryption process.
+func (b boltTx) DeleteUserId(username string) error {
+	return b.delete(authBucket, username)
+}
+
+// SaveDeriverVersion takes a UserToken and the version of the deriver the
+// user's password is derived with and stores them in the deriver bucket. The
+// version is read before the user's keys are derived, so it is not
+// encrypted.
+func (b boltTx) SaveDeriverVersion(uid UserToken, version VersionToken) error {
+	err := b.write(deriverBucket, uid.String(), []byte(version.String()))
+	if err != nil {
+		return fmt.Errorf("could not SaveDeriverVersion: %v", err)
+	}
+
+	return nil
+}
+
+// GetDeriverVersion returns the version of the deriver the user's password
+// is derived with. Users registered before the version was recorded have no
+// record, and the original argonBlakeDeriverVersion is returned for them.
+func (b boltTx) GetDeriverVersion(uid UserToken) VersionToken {
+	return b.readDeriverVersion(uid.String())
+}
+
+// DeleteDeriverVersion removes the user's deriver version from the deriver
+// bucket.
+func (b boltTx) DeleteDeriverVersion(uid UserToken) error {
+	return b.delete(deriverBucket, uid.String())
+}
+
+// readDeriverVersion returns the VersionToken stored under the key in the
+// deriver bucket, or the original argonBlakeDeriverVersion if there is none
+// or it cannot be parsed.
+func (b boltTx) readDeriverVersion(key string) VersionToken {
+	version, _ := parseVersionToken(argonBlakeDeriverVersion)
+
+	val := b.read(deriverBucket, key)
+	if val == nil {
+		return version
+	}
+
+	token, err := parseVersionToken(string(val))
+	if err != nil {
+		return version
+	}
+
+	return token
+}
+
+// SaveUser takes an AuthToken and the encrypted user bytes and saves them to
+// the user bucket. The AuthToken is derived from the unique UserToken
+// associated with the user.
+func (b boltTx) SaveUser(aid AuthToken, data []byte) error {
+	err := b.write(userBucket, aid.String(), data)
+	if err != nil {
+		return fmt.Errorf("could not SaveUser: %v", err)
+	}
+
+	return nil
+}
+
+// GetUser takes an AuthToken and returns the encrypted bytes for the user.
+func (b boltTx) GetUser(aid AuthToken) ([]byte, error) {
+	user := b.read(userBucket, aid.String())
+	if user == nil {
+		return user, fmt.Errorf("could not GetUser: user %s not found", aid)
+	}
+
+	return user, nil
+}
+
+// DeleteUser takes an AuthToken and removes the encrypted bytes associated
+// with it from the user bucket.
+func (b boltTx) DeleteUser(aid AuthToken) error {
+	return b.delete(userBucket, aid.String())
+}
+
+// SaveMetadata takes a MetadataToken and the encrypted metadata bytes and
+// saves them to the metadata bucket.
+func (b boltTx) SaveMetadata(mid MetadataToken, data []byte) error {
+	err := b.write(metadataBucket, mid.String(), data)
+	if err != nil {
+		return fmt.Errorf("could not SaveMetadata: %v", err)
+	}
+
+	return nil
+}
+
+// GetMetadata takes a MetadataToken and returns the encrypted bytes for the
+// metadata.
+func (b boltTx) GetMetadata(mid MetadataToken) ([]byte, error) {
+	md := b.read(metadataBucket, mid.String())
+	if md == nil {
+		return md, fmt.Errorf("could not GetMetadata: metadata %s not found", mid)
+	}
+
+	return md, nil
+}
+
+// DeleteMetadata takes a MetadataToken and removes the encrypted bytes
+// associated with it from the metadata bucket.
+func (b boltTx) DeleteMetadata(mid MetadataToken) error {
+	return b.delete(metadataBucket, mid.String())
+}
+
+// SaveKeyset takes a KeysetToken and the encrypted keyset bytes and saves
+// them to the keyset bucket.
+func (b boltTx) SaveKeyset(kid KeysetToken, data []byte) error {
+	err := b.write(keysetBucket, kid.String(), data)
+	if err != nil {
+		return fmt.Errorf("could not SaveKeyset: %v", err)
+	}
+
+	return nil
+}
+
+// GetKeyset takes a KeysetToken and returns the encrypted bytes for the
+// keyset.
+func (b boltTx) GetKeyset(kid KeysetToken) ([]byte, error) {
+	ks := b.read(keysetBucket, kid.String())
+	if ks == nil {
+		return ks, fmt.Errorf("could not GetKeyset: keyset %s not found", kid)
+	}
+
+	return ks, nil
+}
+
+// DeleteKeyset takes a KeysetToken and removes the encrypted bytes associated
+// with it from the keyset bucket.
+func (b boltTx) DeleteKeyset(kid KeysetToken) error {
+	return b.delete(keysetBucket, kid.String())
+}
+
+// SaveItem takes an ItemToken and the encrypted Item bytes and saves them
+// to the item bucket.
+func (b boltTx) SaveItem(iid ItemToken, data []byte) error {
+	err := b.write(itemBucket, iid.String(), data)
+	if err != nil {
+		return fmt.Errorf("could not SaveItem: %v", err)
+	}
+
+	return nil
+}
+
+// GetItem takes an ItemToken and returns the encrypted bytes for the item.
+func (b boltTx) GetItem(iid ItemToken) ([]byte, error) {
+	item := b.read(itemBucket, iid.String())
+	if item == nil {
+		return item, fmt.Errorf("could not GetItem: item %s not found", iid)
+	}
+
+	return item, nil
+}
+
+// DeleteItem takes an ItemToken and removes the encrypted bytes associated
+// with it from the item bucket.
+func (b boltTx) DeleteItem(iid ItemToken) error {
+	return b.delete(itemBucket, iid.String())
+}
+
+// SaveRecovery takes a RecoveryId and the recovery record bytes and saves
+// them to the recovery bucket.
+func (b boltTx) SaveRecovery(rid AuthToken, data []byte) error {
+	err := b.write(recoveryBucket, rid.String(), data)
+	if err != nil {
+		return fmt.Errorf("could not SaveRecovery: %v", err)
+	}
+
+	return nil
+}
+
+// GetRecovery takes a RecoveryId and returns the bytes for the recovery
+// record.
+func (b boltTx) GetRecovery(rid AuthToken) ([]byte, error) {
+	rec := b.read(recoveryBucket, rid.String())
+	if rec == nil {
+		return rec, fmt.Errorf("could not GetRecovery: recovery %s not found", rid)
+	}
+
+	return rec, nil
+}
+
+// DeleteRecovery takes a RecoveryId and removes the recovery record
+// associated with it from the recovery bucket.
+func (b boltTx) DeleteRecovery(rid AuthToken) error {
+	return b.delete(recoveryBucket, rid.String())
+}
+
+// SaveAttachment takes an AttachmentToken and the encrypted Attachment bytes
+// and saves them to the attachment bucket.
+func (b boltTx) SaveAttachment(aid AttachmentToken, data []byte) error {
+	err := b.write(attachmentBucket, aid.String(), data)
+	if err != nil {
+		return fmt.Errorf("could not SaveAttachment: %v", err)
+	}
+
+	return nil
+}
+
+// GetAttachment takes an AttachmentToken and returns the encrypted bytes for
+// the attachment.
+func (b boltTx) GetAttachment(aid AttachmentToken) ([]byte, error) {
+	att := b.read(attachmentBucket, aid.String())
+	if att == nil {
+		return att, fmt.Errorf("could not GetAttachment: attachment %s not found", aid)
+	}
+
+	return att, nil
+}
+
+// ReadAttachment takes an AttachmentToken and returns a reader over the
+// encrypted bytes for the attachment. The bytes are read from the database
+// without being copied, so the reader can only be used until the
+// transaction ends.
+func (b boltTx) ReadAttachment(aid AttachmentToken) (io.Reader, error) {
+	att := b.tx.Bucket([]byte(attachmentBucket)).Get([]byte(aid.String()))
+	if att == nil {
+		return nil, fmt.Errorf("could not ReadAttachment: attachment %s not found", aid)
+	}
+
+	return bytes.NewReader(att), nil
+}
+
+// DeleteAttachment takes an AttachmentToken and removes the encrypted bytes
+// associated with it from the attachment bucket.
+func (b boltTx) DeleteAttachment(aid AttachmentToken) error {
+	return b.delete(attachmentBucket, aid.String())
+}
+
+// QuarantineAttachment moves the encrypted Attachment bytes to the
+// quarantine bucket.
+func (b boltTx) QuarantineAttachment(aid AttachmentToken) error {
+	err := b.quarantine(attachmentBucket, aid.String())
+	if err != nil {
+		return fmt.Errorf("could not QuarantineAttachment: %v", err)
+	}
+
+	return nil
+}
+
+// SaveRevision takes a RevisionToken and the encrypted Revision bytes
+// and saves them to the revision bucket.
+func (b boltTx) SaveRevision(rid RevisionToken, data []byte) error {
+	err := b.write(revisionBucket, rid.String(), data)
+	if err != nil {
+		return fmt.Errorf("could not SaveRevision: %v", err)
+	}
+
+	return nil
+}
+
+// GetRevision takes a RevisionToken and returns the encrypted bytes for
+// the revision.
+func (b boltTx) GetRevision(rid RevisionToken) ([]byte, error) {
+	rev := b.read(revisionBucket, rid.String())
+	if rev == nil {
+		return rev, fmt.Errorf("could not GetRevision: revision %s not found", rid)
+	}
+
+	return rev, nil
+}
+
+// DeleteRevision takes a RevisionToken and removes the encrypted bytes
+// associated with it from the revision bucket.
+func (b boltTx) DeleteRevision(rid RevisionToken) error {
+	return b.delete(revisionBucket, rid.String())
+}
+
+// QuarantineRevision moves the encrypted Revision bytes to the
+// quarantine bucket.
+func (b boltTx) QuarantineRevision(rid RevisionToken) error {
+	err := b.quarantine(revisionBucket, rid.String())
+	if err != nil {
+		return fmt.Errorf("could not QuarantineRevision: %v", err)
+	}
+
+	return nil
+}
+
+// GetItemIds returns the ItemToken of every Item in the item bucket. Keys
+// that are not valid ItemTokens are skipped, Store.Check reports them.
+func (b boltTx) GetItemIds() ([]ItemToken, error) {
+	var iids []ItemToken
+
+	err := b.tx.Bucket([]byte(itemBucket)).ForEach(func(k, _ []byte) error {
+		iid, err := parseItemToken(string(k))
+		if err == nil {
+			iids = append(iids, iid)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return iids, fmt.Errorf("could not GetItemIds: %v", err)
+	}
+
+	return iids, nil
+}
+
+// QuarantineItem moves the encrypted Item bytes to the quarantine bucket.
+func (b boltTx) QuarantineItem(iid ItemToken) error {
+	err := b.quarantine(itemBucket, iid.String())
+	if err != nil {
+		return fmt.Errorf("could not QuarantineItem: %v", err)
+	}
+
+	return nil
+}
+
+// quarantine moves a record from the given bucket to the quarantine bucket,
+// keyed on the bucket name and the original key, so that it is kept for
+// inspection but no longer used.
+func (b boltTx) quarantine(bucket, key string) error {
+	val := b.read(bucket, key)
+	if val == nil {
+		return fmt.Errorf("%s %s not found", bucket, key)
+	}
+
+	err := b.write(quarantineBucket, bucket+"/"+key, val)
+	if err != nil {
+		return err
+	}
+
+	return b.delete(bucket, key)
+}
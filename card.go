@@ -0,0 +1,49 @@
+package lckbx
+
+import (
+	"fmt"
+)
+
+// The CardItem struct holds the details of a payment card.
+type CardItem struct {
+	Cardholder string
+	Brand      string
+	Number     string
+	Expiry     string
+	Code       string
+	PIN        string
+}
+
+// fields returns the CardItem as a list of ItemFields.
+func (c *CardItem) fields() []ItemField {
+	return []ItemField{
+		{Name: "cardholder", Value: c.Cardholder},
+		{Name: "brand", Value: c.Brand},
+		{Name: "number", Value: c.Number, Secret: true},
+		{Name: "expiry", Value: c.Expiry},
+		{Name: "code", Value: c.Code, Secret: true},
+		{Name: "pin", Value: c.PIN, Secret: true},
+	}
+}
+
+// setField sets the named field.
+func (c *CardItem) setField(name, value string) error {
+	switch name {
+	case "cardholder":
+		c.Cardholder = value
+	case "brand":
+		c.Brand = value
+	case "number":
+		c.Number = value
+	case "expiry":
+		c.Expiry = value
+	case "code":
+		c.Code = value
+	case "pin":
+		c.PIN = value
+	default:
+		return fmt.Errorf("unknown card field %q", name)
+	}
+
+	return nil
+}
@@ -1,7 +1,9 @@
 package lckbx
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"testing"
 )
 
@@ -11,6 +13,8 @@ func testXChaChaCrypter(t *testing.T) {
 	t.Run("Test Encrypt", testXChaChaEncrypt)
 	t.Run("Test Decrypt", testXChaChaDecrypt)
 	t.Run("Test RoundTrip", testXChaChaRoundTrip)
+	t.Run("Test Stream RoundTrip", testXChaChaStreamRoundTrip)
+	t.Run("Test Stream Tamper", testXChaChaStreamTamper)
 }
 
 func testXChaChaEncrypt(t *testing.T) {
@@ -96,3 +100,144 @@ func testXChaChaRoundTrip(t *testing.T) {
 		t.Fatal("Expected", string(plaintext), ", received", string(decrypted))
 	}
 }
+
+// encryptStream encrypts the data with EncryptStream, writing it in pieces
+// of the given size.
+func encryptStream(t *testing.T, c crypter, data []byte, piece int) []byte {
+	var out bytes.Buffer
+
+	w, err := c.EncryptStream(&out, goodAssociatedData)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for len(data) > 0 {
+		n := piece
+		if n > len(data) {
+			n = len(data)
+		}
+
+		_, err = w.Write(data[:n])
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		data = data[n:]
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return out.Bytes()
+}
+
+// decryptStream decrypts the stream with DecryptStream and reads all of it.
+func decryptStream(c crypter, encrypted, ad []byte) ([]byte, error) {
+	r, err := c.DecryptStream(bytes.NewReader(encrypted), ad)
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(r)
+}
+
+func testXChaChaStreamRoundTrip(t *testing.T) {
+	fmt.Println(t.Name())
+
+	version, _ := parseVersionToken(xChaChaCrypterVersion)
+	crypter := NewCrypter(version)
+
+	_, err := crypter.EncryptStream(&bytes.Buffer{}, goodAssociatedData)
+	if err == nil {
+		t.Fatal("Expected error since no key has been set, received nil")
+	}
+
+	crypter.ChangeKey(cryptKeyBytes)
+
+	_, err = crypter.EncryptStream(&bytes.Buffer{}, shortAssociatedData)
+	if err == nil {
+		t.Fatal("Expected error because short associated data, received nil")
+	}
+
+	sizes := []int{0, 1, streamChunkSize - 1, streamChunkSize, streamChunkSize + 1, 3*streamChunkSize + 5}
+	for _, size := range sizes {
+		data := bytes.Repeat(plaintext, size/len(plaintext)+1)[:size]
+
+		for _, piece := range []int{7, streamChunkSize, size + 1} {
+			encrypted := encryptStream(t, crypter, data, piece)
+
+			chunks := size/streamChunkSize + 1
+			if size > 0 && size%streamChunkSize == 0 {
+				chunks--
+			}
+
+			if len(encrypted) != streamPrefixSize+size+chunks*streamTagSize {
+				t.Fatalf("Expected %d bytes for %d bytes of plaintext, received %d", streamPrefixSize+size+chunks*streamTagSize, size, len(encrypted))
+			}
+
+			decrypted, err := decryptStream(crypter, encrypted, goodAssociatedData)
+			if err != nil {
+				t.Fatalf("Expected no error, received %v", err)
+			}
+
+			if !bytes.Equal(decrypted, data) {
+				t.Fatalf("Expected %d bytes to round trip, received %d", size, len(decrypted))
+			}
+		}
+	}
+}
+
+func testXChaChaStreamTamper(t *testing.T) {
+	fmt.Println(t.Name())
+
+	version, _ := parseVersionToken(xChaChaCrypterVersion)
+	crypter := NewCrypter(version)
+	crypter.ChangeKey(cryptKeyBytes)
+
+	data := bytes.Repeat([]byte{'a'}, 3*streamChunkSize+100)
+	encrypted := encryptStream(t, crypter, data, streamChunkSize)
+	first := streamPrefixSize
+	second := first + streamSealedChunk
+	third := second + streamSealedChunk
+
+	// Swap the first two chunks.
+	reordered := append([]byte{}, encrypted[:first]...)
+	reordered = append(reordered, encrypted[second:third]...)
+	reordered = append(reordered, encrypted[first:second]...)
+	reordered = append(reordered, encrypted[third:]...)
+
+	flipped := append([]byte{}, encrypted...)
+	flipped[second+10] ^= 1
+
+	tests := map[string][]byte{
+		"truncated at a chunk":   encrypted[:third+streamSealedChunk],
+		"truncated in a chunk":   encrypted[:len(encrypted)-1],
+		"missing the last chunk": encrypted[:third],
+		"missing a chunk":        append(append([]byte{}, encrypted[:first]...), encrypted[second:]...),
+		"reordered":              reordered,
+		"modified":               flipped,
+		"extended":               append(append([]byte{}, encrypted...), 0),
+		"too short":              encrypted[:streamPrefixSize-1],
+	}
+
+	for name, stream := range tests {
+		_, err := decryptStream(crypter, stream, goodAssociatedData)
+		if err == nil {
+			t.Fatalf("Expected error for a stream %s, received nil", name)
+		}
+	}
+
+	_, err := decryptStream(crypter, encrypted, bytes.ToUpper(goodAssociatedData))
+	if err == nil {
+		t.Fatal("Expected error for the wrong associated data, received nil")
+	}
+
+	// Plaintext from authenticated chunks is returned before the error.
+	r, _ := crypter.DecryptStream(bytes.NewReader(encrypted[:third]), goodAssociatedData)
+	decrypted, err := io.ReadAll(r)
+	if err == nil || len(decrypted) != streamChunkSize {
+		t.Fatalf("Expected one chunk and an error, received %d bytes and %v", len(decrypted), err)
+	}
+}
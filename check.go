@@ -0,0 +1,400 @@
+package lckbx
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Problem describes a single issue found by Store.Check or
+// UnlockedBox.Check. Repair describes what was done to fix the issue and is
+// empty if the check was not run in repair mode or the issue cannot be
+// repaired automatically.
+type Problem struct {
+	Bucket string
+	Key    string
+	Issue  string
+	Repair string
+}
+
+// String returns the Problem in a form suitable for printing.
+func (p Problem) String() string {
+	s := p.Bucket
+	if p.Key != "" {
+		s = fmt.Sprintf("%s %s", s, p.Key)
+	}
+
+	s = fmt.Sprintf("%s: %s", s, p.Issue)
+	if p.Repair != "" {
+		s = fmt.Sprintf("%s (%s)", s, p.Repair)
+	}
+
+	return s
+}
+
+// Check
+//  1. Ensure the latest key exists in the Keyset and the recovery record
+//     exists if the user has a recovery phrase.
+//  2. Cross-check each ItemMetadata against the item bucket and the Keyset.
+//     a. Items that are missing are removed from the Metadata.
+//     b. Items that decrypt with a different key than the one recorded, or
+//     that have a different type, are re-linked.
+//     c. Items that cannot be decrypted with any key are quarantined, along
+//     with their Attachments and Revisions, and removed from the Metadata.
+//     d. Attachments and Revisions are checked the same way: missing ones
+//     are removed, ones encrypted with another key are re-linked, and ones
+//     that cannot be decrypted are quarantined.
+//     e. Items in a Folder that does not exist are moved to the top level,
+//     and tags missing from the list of tags are added to it. Folders whose
+//     parent does not exist, or that are inside themselves, are moved to
+//     the top level first.
+//  3. Find Items in the item bucket that decrypt with the user's Keyset but
+//     are not listed in the Metadata, and re-link them.
+//  4. Save the repairs in a single transaction.
+//
+// The fixes are only applied in repair mode. Items that belong to other
+// users cannot be decrypted with this Keyset and are ignored.
+func (u *UnlockedBox) Check(repair bool) ([]Problem, error) {
+	var problems []Problem
+	var quarantine []ItemToken
+	var quarantineAttachments []AttachmentToken
+	var quarantineRevisions []RevisionToken
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// 1.  Ensure the latest key exists in the Keyset and the recovery record
+	//     exists.
+	if _, err := u.keyset.GetLatestKey(); err != nil {
+		problems = append(problems, Problem{
+			Bucket: keysetBucket,
+			Key:    u.keyset.KeysetId.String(),
+			Issue:  "latest key is missing",
+		})
+	}
+
+	if u.user.RecoveryId != (AuthToken{}) {
+		if _, err := u.store.GetRecovery(u.user.RecoveryId); err != nil {
+			problems = append(problems, Problem{
+				Bucket: recoveryBucket,
+				Key:    u.user.RecoveryId.String(),
+				Issue:  "recovery record is missing, create a new recovery phrase",
+			})
+		}
+	}
+
+	// 2.  Cross-check each ItemMetadata against the item bucket and the
+	//     Keyset.
+	metadata := NewMetadata(u.metadata.MetadataId)
+	metadata.RevisionLimit = u.metadata.RevisionLimit
+	metadata.TrashDays = u.metadata.TrashDays
+	metadata.Tags = append([]string{}, u.metadata.Tags...)
+	listed := make(map[string]bool)
+
+	// 2.e Folders whose parent does not exist, or that are inside
+	//     themselves, are moved to the top level.
+	var fids []string
+	metadata.Folders = make(map[string]Folder)
+	for key, f := range u.metadata.Folders {
+		metadata.Folders[key] = f
+		fids = append(fids, key)
+	}
+	sort.Strings(fids)
+
+	for _, key := range fids {
+		f := metadata.Folders[key]
+		if metadata.hasFolder(f.Parent) && !metadata.isWithin(f.Parent, f.FolderId) {
+			continue
+		}
+
+		problems = append(problems, Problem{
+			Bucket: metadataBucket,
+			Key:    f.FolderId.String(),
+			Issue:  "folder has a missing or circular parent",
+			Repair: "moved to the top level",
+		})
+		f.Parent = FolderToken{}
+		metadata.Folders[key] = f
+	}
+
+	for mapKey, imd := range u.metadata.Items {
+		listed[imd.ItemId.String()] = true
+
+		if mapKey != imd.ItemId.String() {
+			problems = append(problems, Problem{
+				Bucket: metadataBucket,
+				Key:    mapKey,
+				Issue:  fmt.Sprintf("item %s is listed under the wrong id", imd.ItemId),
+				Repair: "re-linked",
+			})
+		}
+
+		if _, err := u.keyset.GetKey(imd.KeyVersion); err != nil {
+			problems = append(problems, Problem{
+				Bucket: metadataBucket,
+				Key:    imd.ItemId.String(),
+				Issue:  fmt.Sprintf("key version %s is not in the keyset", imd.KeyVersion),
+			})
+		}
+
+		// 2.a Items that are missing are removed from the Metadata.
+		if _, err := u.store.GetItem(imd.ItemId); err != nil {
+			problems = append(problems, Problem{
+				Bucket: metadataBucket,
+				Key:    imd.ItemId.String(),
+				Issue:  "item is missing",
+				Repair: "removed from metadata",
+			})
+			continue
+		}
+
+		// 2.b Items that decrypt with a different key, or that have a
+		//     different type, are re-linked.
+		item, kv, err := u.loadItem(imd)
+		if err == nil && kv.String() != imd.KeyVersion.String() {
+			problems = append(problems, Problem{
+				Bucket: itemBucket,
+				Key:    imd.ItemId.String(),
+				Issue:  fmt.Sprintf("item is encrypted with key version %s, not %s", kv, imd.KeyVersion),
+				Repair: "re-linked",
+			})
+			imd.KeyVersion = kv
+		}
+
+		if err == nil && item.Type != imd.Type {
+			problems = append(problems, Problem{
+				Bucket: metadataBucket,
+				Key:    imd.ItemId.String(),
+				Issue:  fmt.Sprintf("item is a %s, not a %s", item.Type, imd.Type),
+				Repair: "re-linked",
+			})
+			imd.Type = item.Type
+		}
+
+		// 2.c Items that cannot be decrypted are quarantined. Nothing would
+		//     list their Attachments and Revisions once the Item is removed
+		//     from the Metadata, so they are quarantined too.
+		if err != nil {
+			problems = append(problems, Problem{
+				Bucket: itemBucket,
+				Key:    imd.ItemId.String(),
+				Issue:  "item cannot be decrypted",
+				Repair: "quarantined",
+			})
+			quarantine = append(quarantine, imd.ItemId)
+
+			for _, amd := range imd.Attachments {
+				if _, err := u.store.GetAttachment(amd.AttachmentId); err != nil {
+					continue
+				}
+
+				problems = append(problems, Problem{
+					Bucket: attachmentBucket,
+					Key:    amd.AttachmentId.String(),
+					Issue:  fmt.Sprintf("attachment belongs to item %s, which cannot be decrypted", imd.ItemId),
+					Repair: "quarantined",
+				})
+				quarantineAttachments = append(quarantineAttachments, amd.AttachmentId)
+			}
+
+			for _, rmd := range imd.Revisions {
+				if _, err := u.store.GetRevision(rmd.RevisionId); err != nil {
+					continue
+				}
+
+				problems = append(problems, Problem{
+					Bucket: revisionBucket,
+					Key:    rmd.RevisionId.String(),
+					Issue:  fmt.Sprintf("revision belongs to item %s, which cannot be decrypted", imd.ItemId),
+					Repair: "quarantined",
+				})
+				quarantineRevisions = append(quarantineRevisions, rmd.RevisionId)
+			}
+
+			continue
+		}
+
+		// 2.d Check each Attachment and Revision of the Item.
+		var attachments []AttachmentMetadata
+		for _, amd := range imd.Attachments {
+			if _, err := u.store.GetAttachment(amd.AttachmentId); err != nil {
+				problems = append(problems, Problem{
+					Bucket: metadataBucket,
+					Key:    imd.ItemId.String(),
+					Issue:  fmt.Sprintf("attachment %s is missing", amd.AttachmentId),
+					Repair: "removed from metadata",
+				})
+				continue
+			}
+
+			akv, err := u.writeAttachment(u.store, imd.ItemId, amd, io.Discard)
+			if err != nil {
+				problems = append(problems, Problem{
+					Bucket: attachmentBucket,
+					Key:    amd.AttachmentId.String(),
+					Issue:  "attachment cannot be decrypted",
+					Repair: "quarantined",
+				})
+				quarantineAttachments = append(quarantineAttachments, amd.AttachmentId)
+				continue
+			}
+
+			if akv.String() != amd.KeyVersion.String() {
+				problems = append(problems, Problem{
+					Bucket: attachmentBucket,
+					Key:    amd.AttachmentId.String(),
+					Issue:  fmt.Sprintf("attachment is encrypted with key version %s, not %s", akv, amd.KeyVersion),
+					Repair: "re-linked",
+				})
+				amd.KeyVersion = akv
+			}
+
+			attachments = append(attachments, amd)
+		}
+		imd.Attachments = attachments
+
+		var revisions []RevisionMetadata
+		for _, rmd := range imd.Revisions {
+			if _, err := u.store.GetRevision(rmd.RevisionId); err != nil {
+				problems = append(problems, Problem{
+					Bucket: metadataBucket,
+					Key:    imd.ItemId.String(),
+					Issue:  fmt.Sprintf("revision %s is missing", rmd.RevisionId),
+					Repair: "removed from metadata",
+				})
+				continue
+			}
+
+			_, rkv, err := u.loadRevision(u.store, imd.ItemId, rmd)
+			if err != nil {
+				problems = append(problems, Problem{
+					Bucket: revisionBucket,
+					Key:    rmd.RevisionId.String(),
+					Issue:  "revision cannot be decrypted",
+					Repair: "quarantined",
+				})
+				quarantineRevisions = append(quarantineRevisions, rmd.RevisionId)
+				continue
+			}
+
+			if rkv.String() != rmd.KeyVersion.String() {
+				problems = append(problems, Problem{
+					Bucket: revisionBucket,
+					Key:    rmd.RevisionId.String(),
+					Issue:  fmt.Sprintf("revision is encrypted with key version %s, not %s", rkv, rmd.KeyVersion),
+					Repair: "re-linked",
+				})
+				rmd.KeyVersion = rkv
+			}
+
+			revisions = append(revisions, rmd)
+		}
+		imd.Revisions = revisions
+
+		// 2.e Items in a Folder that does not exist are moved to the top
+		//     level, and missing tags are added to the list of tags.
+		if !metadata.hasFolder(imd.Folder) {
+			problems = append(problems, Problem{
+				Bucket: metadataBucket,
+				Key:    imd.ItemId.String(),
+				Issue:  fmt.Sprintf("folder %s is missing", imd.Folder),
+				Repair: "moved to the top level",
+			})
+			imd.Folder = FolderToken{}
+		}
+
+		for _, tag := range imd.Tags {
+			if len(withTag(metadata.Tags, tag)) != len(metadata.Tags) {
+				problems = append(problems, Problem{
+					Bucket: metadataBucket,
+					Key:    imd.ItemId.String(),
+					Issue:  fmt.Sprintf("tag %q is not in the list of tags", tag),
+					Repair: "added to the list of tags",
+				})
+				metadata.Tags = withTag(metadata.Tags, tag)
+			}
+		}
+
+		metadata.AddItem(imd)
+	}
+
+	// 3.  Find Items that decrypt with the user's Keyset but are not listed
+	//     in the Metadata.
+	iids, err := u.store.GetItemIds()
+	if err != nil {
+		return problems, fmt.Errorf("could not UnlockedBox.Check: %v", err)
+	}
+
+	for _, iid := range iids {
+		if listed[iid.String()] {
+			continue
+		}
+
+		item, kv, err := u.loadItem(ItemMetadata{ItemId: iid, KeyVersion: u.keyset.Latest})
+		if err != nil {
+			continue
+		}
+
+		problems = append(problems, Problem{
+			Bucket: itemBucket,
+			Key:    iid.String(),
+			Issue:  "item is not listed in the metadata",
+			Repair: "re-linked",
+		})
+		// The time the Item was created is not known.
+		metadata.AddItem(newItemMetadataFromItem(item, kv, time.Time{}))
+	}
+
+	if !repair {
+		for i := range problems {
+			problems[i].Repair = ""
+		}
+
+		return problems, nil
+	}
+
+	// 4.  Save the repairs in a single transaction.
+	if metadata.Equal(u.metadata) && len(quarantine) == 0 &&
+		len(quarantineAttachments) == 0 && len(quarantineRevisions) == 0 {
+		return problems, nil
+	}
+
+	old := u.metadata
+	u.metadata = metadata
+
+	err = u.store.Update(func(r recorder) error {
+		for _, iid := range quarantine {
+			err := r.QuarantineItem(iid)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, aid := range quarantineAttachments {
+			err := r.QuarantineAttachment(aid)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, rid := range quarantineRevisions {
+			err := r.QuarantineRevision(rid)
+			if err != nil {
+				return err
+			}
+		}
+
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		u.metadata = old
+		return problems, fmt.Errorf("could not UnlockedBox.Check: %v", err)
+	}
+
+	// The repaired Items are indexed again the next time the box is
+	// searched.
+	u.index.clear()
+
+	return problems, nil
+}
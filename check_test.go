@@ -0,0 +1,287 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+var (
+	checkDB   = "check_test.db"
+	checkUser = "check_user"
+)
+
+func TestCheck(t *testing.T) {
+	t.Run("Test Store Check", testStoreCheck)
+	t.Run("Test UnlockedBox Check", testUnlockedBoxCheck)
+	t.Run("Test Check Corrupt Item Records", testCheckCorruptItemRecords)
+}
+
+func testStoreCheck(t *testing.T) {
+	fmt.Println(t.Name())
+
+	s, err := NewStore("test.db")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer s.Close()
+	defer os.Remove("test.db")
+
+	// A new store has no problems.
+	problems, err := s.Check(false)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 0 {
+		t.Fatalf("Expected no problems, received %v", problems)
+	}
+
+	// Add records with keys that are not valid tokens.
+	s.write(itemBucket, "kt_NOTANITEM", []byte("item"))
+	s.write(authBucket, "user", []byte("not a token"))
+	s.SaveItem(NewItemToken(), []byte("item"))
+
+	problems, err = s.Check(false)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 2 {
+		t.Fatalf("Expected two problems, received %v", problems)
+	}
+
+	// Repair the store and ensure the records were quarantined.
+	problems, err = s.Check(true)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, p := range problems {
+		if p.Repair != "quarantined" {
+			t.Fatalf("Expected problem to be quarantined, received %v", p)
+		}
+	}
+
+	if s.read(quarantineBucket, itemBucket+"/kt_NOTANITEM") == nil {
+		t.Fatal("Expected item to be in the quarantine bucket")
+	}
+
+	problems, err = s.Check(false)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 0 {
+		t.Fatalf("Expected no problems, received %v", problems)
+	}
+}
+
+// End-to-end test for the per-user check
+//  1. Register a user and add three items.
+//  2. Remove an item, add an unlisted item, and corrupt an item.
+//  3. Check the UnlockedBox and ensure the problems are found.
+//  4. Repair the UnlockedBox and ensure the problems are fixed.
+func testUnlockedBoxCheck(t *testing.T) {
+	fmt.Println(t.Name())
+
+	// 1.  Register a user and add three items.
+	store, err := NewStore(checkDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(checkUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.login(checkUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	var notes []NoteItem
+	for i := 0; i < 3; i++ {
+		n := NewNoteItem()
+		n.Name = fmt.Sprintf("Note %d", i)
+
+		err = ub.AddNoteItem(n)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		notes = append(notes, n)
+	}
+
+	problems, err := ub.Check(false)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 0 {
+		t.Fatalf("Expected no problems, received %v", problems)
+	}
+
+	// 2.  Remove an item, add an unlisted item, and corrupt an item.
+	store.DeleteItem(notes[0].ItemId)
+	store.SaveItem(notes[1].ItemId, []byte("corrupt"))
+
+	unlisted := NewNoteItem()
+	unlisted.Name = "Unlisted"
+	key, _ := ub.keyset.GetNewItemKey(unlisted.ItemId)
+	ub.crypt.ChangeKey(key[:])
+	unlisted.Save(&store, ub.crypt)
+
+	// 3.  Check the UnlockedBox and ensure the problems are found.
+	problems, err = ub.Check(false)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 3 {
+		t.Fatalf("Expected three problems, received %v", problems)
+	}
+
+	// 4.  Repair the UnlockedBox and ensure the problems are fixed.
+	_, err = ub.Check(true)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	problems, err = ub.Check(false)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 0 {
+		t.Fatalf("Expected no problems, received %v", problems)
+	}
+
+	items := ub.GetItemList()
+	if len(items) != 2 {
+		t.Fatalf("Expected two items, received %v", items)
+	}
+
+	n, err := ub.GetItem(unlisted.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if n.Name != unlisted.Name {
+		t.Fatalf("Expected %s, received %s", unlisted.Name, n.Name)
+	}
+
+	if store.read(quarantineBucket, itemBucket+"/"+notes[1].ItemId.String()) == nil {
+		t.Fatal("Expected corrupt item to be in the quarantine bucket")
+	}
+
+	// The repaired Metadata was saved.
+	ub2, err := lb.login(checkUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub2.Lock()
+
+	if len(ub2.GetItemList()) != 2 {
+		t.Fatalf("Expected two items, received %v", ub2.GetItemList())
+	}
+}
+
+// Check a corrupt Item with an Attachment and a Revision
+//  1. Add a note with an attachment and a revision, then corrupt the note.
+//  2. Repair the UnlockedBox and ensure the attachment and revision are
+//     quarantined with the note.
+func testCheckCorruptItemRecords(t *testing.T) {
+	fmt.Println(t.Name())
+
+	db := "check_corrupt_test.db"
+	store, err := NewStore(db)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(db)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(checkUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.login(checkUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	// 1.  Add a note with an attachment and a revision, then corrupt the
+	//     note.
+	n := NewNoteItem()
+	n.Name = "Corrupt"
+	n.Data = []byte("one\n")
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	aid, err := ub.AddAttachment(n.ItemId, "file.txt", strings.NewReader("attached"))
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	n = updateNote(t, &ub, n, "one\ntwo\n")
+
+	revisions, err := ub.GetRevisionList(n.ItemId)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("Expected one revision, received %v and %v", revisions, err)
+	}
+	rid := revisions[0].RevisionId
+
+	store.SaveItem(n.ItemId, []byte("corrupt"))
+
+	// 2.  Repair the UnlockedBox and ensure the attachment and revision are
+	//     quarantined with the note.
+	problems, err := ub.Check(true)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 3 {
+		t.Fatalf("Expected three problems, received %v", problems)
+	}
+
+	if _, err := store.GetAttachment(aid); err == nil {
+		t.Fatal("Expected the attachment to be removed, received nil")
+	}
+
+	if _, err := store.GetRevision(rid); err == nil {
+		t.Fatal("Expected the revision to be removed, received nil")
+	}
+
+	if store.read(quarantineBucket, attachmentBucket+"/"+aid.String()) == nil {
+		t.Fatal("Expected the attachment to be in the quarantine bucket")
+	}
+
+	if store.read(quarantineBucket, revisionBucket+"/"+rid.String()) == nil {
+		t.Fatal("Expected the revision to be in the quarantine bucket")
+	}
+
+	problems, err = ub.Check(false)
+	if err != nil || len(problems) != 0 {
+		t.Fatalf("Expected no problems, received %v and %v", problems, err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"lckbx"
+	"lckbx/agent"
+
+	"golang.org/x/term"
+)
+
+// defaultDatabase returns the path to lckbx.db in the .lckbx directory of
+// the user's HOME.
+func defaultDatabase() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "lckbx.db"
+	}
+
+	return filepath.Join(home, ".lckbx", "lckbx.db")
+}
+
+// defaultUsername returns the value of $LCKBX_USER if it is set, otherwise
+// it returns $USER.
+func defaultUsername() string {
+	if username := os.Getenv("LCKBX_USER"); username != "" {
+		return username
+	}
+
+	return os.Getenv("USER")
+}
+
+// readPassword reads the password from the terminal without echo, or as a
+// single line from stdin.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+
+	if term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "Password: ")
+		password, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+
+		return string(password), err
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func main() {
+	dbPath := flag.String("db", defaultDatabase(), "path to the lckbx database")
+	username := flag.String("u", defaultUsername(), "username, defaults to $LCKBX_USER or $USER")
+	socket := flag.String("socket", agent.SocketPath(), "path to the agent socket, defaults to $LCKBX_AGENT_SOCK")
+	timeout := flag.Duration("timeout", 15*time.Minute, "lock the box after this much idle time, 0 to disable")
+	flag.Parse()
+
+	log.SetPrefix("lckbx-agent: ")
+	log.SetFlags(0)
+
+	// The agent holds the database open, and with it the bolt file lock, for
+	// as long as it runs.
+	store, err := lckbx.NewStore(*dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer store.Close()
+
+	lb, err := lckbx.NewLockedBox(&store)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	password, err := readPassword()
+	if err != nil {
+		log.Fatalf("could not read password: %v", err)
+	}
+
+	ub, err := lb.Login(*username, password)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	server, err := agent.NewServer(&ub, *socket, *timeout)
+	if err != nil {
+		ub.Lock()
+		log.Fatal(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		<-signals
+		server.Close()
+	}()
+
+	log.Printf("unlocked %s, listening on %s", ub.GetUserName(), *socket)
+
+	go func() {
+		status := ub.WaitMaintenance()
+		switch {
+		case status.Err != nil:
+			log.Printf("maintenance: %v", status.Err)
+		case status.Total != 0 || status.Purged != 0:
+			log.Printf("maintenance: reencrypted %d of %d item(s), purged %d old key(s)", status.Done, status.Total, status.Purged)
+		}
+	}()
+
+	err = server.Serve()
+	if err != nil {
+		log.Print(err)
+	}
+
+	log.Print("locked")
+}
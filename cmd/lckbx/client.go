@@ -0,0 +1,446 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"lckbx"
+	"lckbx/agent"
+)
+
+// box is the set of item operations shared by a local UnlockedBox and a
+// running lckbx-agent.
+type box interface {
+	GetItemList() ([]lckbx.ItemMetadata, error)
+	GetItemListWithOptions(opts lckbx.ItemListOptions) ([]lckbx.ItemMetadata, error)
+	Search(query string, opts lckbx.ItemListOptions) ([]lckbx.SearchResult, error)
+	GetItem(iid lckbx.ItemToken) (lckbx.Item, error)
+	AddItem(i lckbx.Item) error
+	UpdateItem(i lckbx.Item) error
+	GetOTPCode(iid lckbx.ItemToken) (string, int, error)
+	DeleteItem(iid lckbx.ItemToken) error
+	AddAttachment(iid lckbx.ItemToken, name string, src io.Reader) (lckbx.AttachmentToken, error)
+	GetAttachmentList(iid lckbx.ItemToken) ([]lckbx.AttachmentMetadata, error)
+	ExtractAttachment(iid lckbx.ItemToken, aid lckbx.AttachmentToken, w io.Writer) error
+	DeleteAttachment(iid lckbx.ItemToken, aid lckbx.AttachmentToken) error
+	GetRevisionList(iid lckbx.ItemToken) ([]lckbx.RevisionMetadata, error)
+	GetRevision(iid lckbx.ItemToken, rid lckbx.RevisionToken) (lckbx.Revision, error)
+	DiffRevisions(iid lckbx.ItemToken, from, to lckbx.RevisionToken) (lckbx.Diff, error)
+	RestoreRevision(iid lckbx.ItemToken, rid lckbx.RevisionToken) error
+	GetRevisionLimit() (lckbx.RevisionLimit, error)
+	SetRevisionLimit(limit lckbx.RevisionLimit) error
+	GetTrashList() ([]lckbx.ItemMetadata, error)
+	RestoreItem(iid lckbx.ItemToken) error
+	PurgeItem(iid lckbx.ItemToken) error
+	EmptyTrash() (int, error)
+	GetTrashDays() (int, error)
+	SetTrashDays(days int) error
+	GetFolders() ([]lckbx.Folder, error)
+	CreateFolder(name string, parent lckbx.FolderToken) (lckbx.FolderToken, error)
+	RenameFolder(fid lckbx.FolderToken, name string) error
+	MoveFolder(fid, parent lckbx.FolderToken) error
+	DeleteFolder(fid lckbx.FolderToken) error
+	MoveItem(iid lckbx.ItemToken, fid lckbx.FolderToken) error
+	GetTags() ([]string, error)
+	CreateTag(tag string) error
+	RenameTag(tag, name string) error
+	DeleteTag(tag string) error
+	TagItem(iid lckbx.ItemToken, tag string) error
+	UntagItem(iid lckbx.ItemToken, tag string) error
+	Import(format string, data []byte, opts lckbx.ImportOptions) (lckbx.ImportReport, error)
+	Export(format string, opts lckbx.ExportOptions) ([]byte, error)
+	ExportMarkdown(dir string, opts lckbx.ExportOptions) error
+	Close() error
+}
+
+// localBox adapts an UnlockedBox to the box interface. Closing a localBox
+// locks the UnlockedBox.
+type localBox struct {
+	*lckbx.UnlockedBox
+}
+
+func (l localBox) GetItemList() ([]lckbx.ItemMetadata, error) {
+	return l.UnlockedBox.GetItemList(), nil
+}
+
+func (l localBox) GetItemListWithOptions(opts lckbx.ItemListOptions) ([]lckbx.ItemMetadata, error) {
+	return l.UnlockedBox.GetItemListWithOptions(opts), nil
+}
+
+func (l localBox) GetRevisionLimit() (lckbx.RevisionLimit, error) {
+	return l.UnlockedBox.GetRevisionLimit(), nil
+}
+
+func (l localBox) GetTrashList() ([]lckbx.ItemMetadata, error) {
+	return l.UnlockedBox.GetTrashList(), nil
+}
+
+func (l localBox) GetTrashDays() (int, error) {
+	return l.UnlockedBox.GetTrashDays(), nil
+}
+
+func (l localBox) GetFolders() ([]lckbx.Folder, error) {
+	return l.UnlockedBox.GetFolders(), nil
+}
+
+func (l localBox) GetTags() ([]string, error) {
+	return l.UnlockedBox.GetTags(), nil
+}
+
+func (l localBox) Close() error {
+	l.UnlockedBox.Lock()
+	return nil
+}
+
+// client holds the paths and username used by every command. The database
+// is only opened when a command needs it, because a running agent holds the
+// lock on it.
+type client struct {
+	dbPath   string
+	socket   string
+	username string
+	breaches string
+	store    *lckbx.Store
+	locked   *lckbx.LockedBox
+	list     *lckbx.BreachList
+	input    *input
+}
+
+// breachListName is the breach list used when none is given, if it exists
+// next to the database.
+const breachListName = "breached.txt"
+
+// open opens the database, creating the parent directory if needed.
+func (c *client) open() error {
+	if c.store != nil {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(c.dbPath), 0700)
+	if err != nil {
+		return fmt.Errorf("could not create database directory: %v", err)
+	}
+
+	store, err := lckbx.NewStore(c.dbPath)
+	if err != nil {
+		if _, serr := os.Stat(c.socket); serr == nil {
+			return fmt.Errorf("%v: the database is in use, stop lckbx-agent with 'lckbx lock'", err)
+		}
+
+		return err
+	}
+
+	locked, err := lckbx.NewLockedBox(&store)
+	if err != nil {
+		store.Close()
+		return err
+	}
+
+	c.store = &store
+	c.locked = &locked
+
+	// New passwords are also checked against the breach list, if there is
+	// one.
+	breaches := c.breaches
+	if breaches == "" {
+		breaches = filepath.Join(filepath.Dir(c.dbPath), breachListName)
+		if _, err := os.Stat(breaches); err != nil {
+			return nil
+		}
+	}
+
+	c.list, err = lckbx.OpenBreachList(breaches)
+	if err != nil {
+		return err
+	}
+
+	policy := lckbx.DefaultPasswordPolicy
+	policy.Breaches = c.list
+	c.locked.SetPasswordPolicy(policy)
+
+	return nil
+}
+
+// newPassword prompts for a new password and checks it against the
+// password policy, listing every reason it was rejected.
+func (c *client) newPassword(prompt string) (string, error) {
+	password, err := c.input.newPassword(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	err = c.locked.CheckPassword(c.username, password)
+
+	var pe *lckbx.PasswordError
+	if errors.As(err, &pe) {
+		for _, p := range pe.Problems {
+			fmt.Fprintf(os.Stderr, "  %s\n", p.Message)
+		}
+
+		return "", fmt.Errorf("the new password was rejected")
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	return password, nil
+}
+
+// dialAgent connects to a running agent for the client's user. It returns
+// nil if no agent is running.
+func (c *client) dialAgent() (*agent.Client, error) {
+	if _, err := os.Stat(c.socket); err != nil {
+		return nil, nil
+	}
+
+	ac, err := agent.Dial(c.socket)
+	if err != nil {
+		return nil, nil
+	}
+
+	username, err := ac.GetUserName()
+	if err != nil {
+		ac.Close()
+		return nil, err
+	}
+
+	if username != lckbx.NormalizeUserName(c.username) {
+		ac.Close()
+		return nil, fmt.Errorf("lckbx-agent is running for %s, not %s", username, c.username)
+	}
+
+	return ac, nil
+}
+
+// unlock returns a box for the client's user. A running agent is used if
+// there is one, otherwise it prompts for the user's password and logs in.
+func (c *client) unlock() (box, error) {
+	ac, err := c.dialAgent()
+	if err != nil {
+		return nil, err
+	}
+
+	if ac != nil {
+		return ac, nil
+	}
+
+	err = c.open()
+	if err != nil {
+		return nil, err
+	}
+
+	password, err := c.input.password("Password: ")
+	if err != nil {
+		return nil, err
+	}
+
+	ub, err := c.locked.Login(c.username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return localBox{&ub}, nil
+}
+
+// Close closes the database if it was opened.
+func (c *client) Close() {
+	if c.store != nil {
+		c.store.Close()
+		c.store = nil
+	}
+
+	if c.list != nil {
+		c.list.Close()
+		c.list = nil
+	}
+}
+
+// newClient returns a client for the given database, agent socket,
+// username, and breach list.
+func newClient(dbPath, socket, username, breaches string) (*client, error) {
+	if username == "" {
+		return nil, fmt.Errorf("no username given, use -u or set $LCKBX_USER")
+	}
+
+	c := client{
+		dbPath:   dbPath,
+		socket:   socket,
+		username: username,
+		breaches: breaches,
+		input:    newInput(),
+	}
+
+	return &c, nil
+}
+
+// sortedItems returns the items in the box sorted by name.
+func sortedItems(b box) ([]lckbx.ItemMetadata, error) {
+	items, err := b.GetItemList()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Name == items[j].Name {
+			return items[i].ItemId.String() < items[j].ItemId.String()
+		}
+
+		return items[i].Name < items[j].Name
+	})
+
+	return items, nil
+}
+
+// findItem returns the ItemMetadata whose ItemId or Name matches the given
+// string. An error is returned if no item matches or if more than one item
+// has the given name.
+func findItem(b box, s string) (lckbx.ItemMetadata, error) {
+	items, err := sortedItems(b)
+	if err != nil {
+		return lckbx.ItemMetadata{}, err
+	}
+
+	return matchItem(items, s, "item")
+}
+
+// findTrashedItem returns the ItemMetadata of the item in the trash whose
+// ItemId or Name matches the given string.
+func findTrashedItem(b box, s string) (lckbx.ItemMetadata, error) {
+	items, err := b.GetTrashList()
+	if err != nil {
+		return lckbx.ItemMetadata{}, err
+	}
+
+	return matchItem(items, s, "item in the trash")
+}
+
+// matchItem returns the item in the list whose ItemId or Name matches the
+// given string. The kind describes the list in error messages.
+func matchItem(items []lckbx.ItemMetadata, s, kind string) (lckbx.ItemMetadata, error) {
+	var found []lckbx.ItemMetadata
+
+	for _, item := range items {
+		if item.ItemId.String() == s {
+			return item, nil
+		}
+
+		if item.Name == s {
+			found = append(found, item)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return lckbx.ItemMetadata{}, fmt.Errorf("no %s named %q", kind, s)
+	case 1:
+		return found[0], nil
+	default:
+		return lckbx.ItemMetadata{}, fmt.Errorf("%d items named %q, use the item id", len(found), s)
+	}
+}
+
+// findAttachment returns the AttachmentMetadata on the given item whose
+// AttachmentId or Name matches the given string.
+func findAttachment(b box, iid lckbx.ItemToken, s string) (lckbx.AttachmentMetadata, error) {
+	var found []lckbx.AttachmentMetadata
+
+	atts, err := b.GetAttachmentList(iid)
+	if err != nil {
+		return lckbx.AttachmentMetadata{}, err
+	}
+
+	for _, att := range atts {
+		if att.AttachmentId.String() == s {
+			return att, nil
+		}
+
+		if att.Name == s {
+			found = append(found, att)
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return lckbx.AttachmentMetadata{}, fmt.Errorf("no attachment named %q", s)
+	case 1:
+		return found[0], nil
+	default:
+		return lckbx.AttachmentMetadata{}, fmt.Errorf("%d attachments named %q, use the attachment id", len(found), s)
+	}
+}
+
+// findRevision returns the RevisionMetadata of the given item whose
+// RevisionId matches the given string, or whose position in the history,
+// counting from 1 for the newest, is the given number.
+func findRevision(b box, iid lckbx.ItemToken, s string) (lckbx.RevisionMetadata, error) {
+	revisions, err := b.GetRevisionList(iid)
+	if err != nil {
+		return lckbx.RevisionMetadata{}, err
+	}
+
+	for n, rev := range revisions {
+		if rev.RevisionId.String() == s || strconv.Itoa(n+1) == s {
+			return rev, nil
+		}
+	}
+
+	return lckbx.RevisionMetadata{}, fmt.Errorf("no revision %q", s)
+}
+
+// folderPaths returns the path of every folder, with the names of the
+// folder and its parents joined with /.
+func folderPaths(folders []lckbx.Folder) map[lckbx.FolderToken]string {
+	byId := make(map[lckbx.FolderToken]lckbx.Folder)
+	for _, f := range folders {
+		byId[f.FolderId] = f
+	}
+
+	paths := make(map[lckbx.FolderToken]string)
+	for _, f := range folders {
+		var names []string
+
+		fid := f.FolderId
+		for n := 0; n <= len(folders); n++ {
+			parent, ok := byId[fid]
+			if !ok {
+				break
+			}
+
+			names = append([]string{parent.Name}, names...)
+			fid = parent.Parent
+		}
+
+		paths[f.FolderId] = strings.Join(names, "/")
+	}
+
+	return paths
+}
+
+// findFolder returns the FolderToken of the folder whose FolderId or path
+// matches the given string. The top level is "/" or an empty string.
+func findFolder(b box, s string) (lckbx.FolderToken, error) {
+	path := strings.Trim(s, "/")
+	if path == "" {
+		return lckbx.FolderToken{}, nil
+	}
+
+	folders, err := b.GetFolders()
+	if err != nil {
+		return lckbx.FolderToken{}, err
+	}
+
+	for fid, p := range folderPaths(folders) {
+		if fid.String() == s || p == path {
+			return fid, nil
+		}
+	}
+
+	return lckbx.FolderToken{}, fmt.Errorf("no folder named %q", s)
+}
@@ -0,0 +1,1764 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"lckbx"
+	"lckbx/agent"
+)
+
+// parseFlags parses the flags for a subcommand and verifies the number of
+// remaining positional arguments.
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) ([]string, error) {
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() != nargs {
+		return nil, fmt.Errorf("%s: expected %d argument(s), received %d", fs.Name(), nargs, fs.NArg())
+	}
+
+	return fs.Args(), nil
+}
+
+func registerCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("register", flag.ContinueOnError)
+	recovery := fs.Bool("recovery", false, "print a recovery phrase that can reset a forgotten password")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := c.open()
+	if err != nil {
+		return err
+	}
+
+	password, err := c.newPassword("New password: ")
+	if err != nil {
+		return err
+	}
+
+	if !*recovery {
+		err = c.locked.Register(c.username, password)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Registered %s.\n", c.username)
+
+		return nil
+	}
+
+	phrase, err := c.locked.RegisterWithRecovery(c.username, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Registered %s. Write down the recovery phrase and keep it safe:\n", c.username)
+	fmt.Println(phrase)
+
+	return nil
+}
+
+func loginCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("login", flag.ContinueOnError)
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := c.open()
+	if err != nil {
+		return err
+	}
+
+	password, err := c.input.password("Password: ")
+	if err != nil {
+		return err
+	}
+
+	ub, err := c.locked.Login(c.username, password)
+	if err != nil {
+		return err
+	}
+	defer ub.Lock()
+
+	fmt.Fprintf(os.Stderr, "Unlocked %s, %d item(s).\n", ub.GetUserName(), len(ub.GetItemList()))
+
+	// Give the maintenance job time to finish, since this is the only
+	// command that keeps the box unlocked while doing nothing else.
+	status := ub.WaitMaintenance()
+	if status.Total != 0 || status.Purged != 0 {
+		fmt.Fprintf(os.Stderr, "Reencrypted %d of %d item(s), purged %d old key(s).\n", status.Done, status.Total, status.Purged)
+	}
+
+	return status.Err
+}
+
+// listFilter holds the FILTER flags shared by ls and search.
+type listFilter struct {
+	typeName *string
+	folder   *string
+	tag      *string
+}
+
+// addFilterFlags adds the -type, -folder, and -tag flags to the FlagSet.
+func addFilterFlags(fs *flag.FlagSet) listFilter {
+	return listFilter{
+		typeName: fs.String("type", "", "only list items of the given `TYPE`"),
+		folder:   fs.String("folder", "", "only list items directly in `FOLDER`, / is the top level"),
+		tag:      fs.String("tag", "", "only list items with the given `TAG`"),
+	}
+}
+
+// apply sets the filters given on the command line in the options. The box
+// is used to find the folder.
+func (f listFilter) apply(b box, opts *lckbx.ItemListOptions) error {
+	var err error
+
+	if *f.typeName != "" {
+		opts.Type, err = lckbx.ParseItemType(*f.typeName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if *f.folder != "" {
+		fid, err := findFolder(b, *f.folder)
+		if err != nil {
+			return err
+		}
+		opts.Folder = &fid
+	}
+
+	opts.Tag = *f.tag
+
+	return nil
+}
+
+func lsCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ContinueOnError)
+	filter := addFilterFlags(fs)
+	sortName := fs.String("sort", "name", "sort `BY` name, type, created, modified, or accessed")
+	reverse := fs.Bool("r", false, "reverse the order")
+	long := fs.Bool("l", false, "also list the dates, folder, and tags of each item")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	var opts lckbx.ItemListOptions
+	var err error
+
+	opts.Sort, err = lckbx.ParseItemSort(*sortName)
+	if err != nil {
+		return err
+	}
+	opts.Reverse = *reverse
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	err = filter.apply(b, &opts)
+	if err != nil {
+		return err
+	}
+
+	items, err := b.GetItemListWithOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	var paths map[lckbx.FolderToken]string
+	if *long {
+		folders, err := b.GetFolders()
+		if err != nil {
+			return err
+		}
+		paths = folderPaths(folders)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, item := range items {
+		if *long {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t/%s\t%s\t%s\n", item.ItemId, item.Type,
+				formatTime(item.Created), formatTime(item.Modified), formatTime(item.Accessed),
+				paths[item.Folder], strings.Join(item.Tags, ","), item.Name)
+			continue
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", item.ItemId, item.Type, item.Name)
+	}
+
+	return tw.Flush()
+}
+
+// formatTime returns the time in local time, or "-" if it is not known.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+func showCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	rev := fs.String("rev", "", "show revision `REV` instead of the current item")
+
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	var item lckbx.Item
+	if *rev != "" {
+		rmd, err := findRevision(b, imd.ItemId, *rev)
+		if err != nil {
+			return err
+		}
+
+		revision, err := b.GetRevision(imd.ItemId, rmd.RevisionId)
+		if err != nil {
+			return err
+		}
+
+		item = revision.Item
+	} else {
+		item, err = b.GetItem(imd.ItemId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = os.Stdout.WriteString(item.FormatText())
+
+	return err
+}
+
+func addCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	file := fs.String("f", "-", "read the item data from `FILE`, - for stdin")
+	typeName := fs.String("type", string(lckbx.SecureNoteType), "the `TYPE` of item: login, card, identity, otp, or note")
+
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	itemType, err := lckbx.ParseItemType(*typeName)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	data, err := c.input.data(*file)
+	if err != nil {
+		return err
+	}
+
+	item := lckbx.NewItem(itemType)
+	item.Name = args[0]
+
+	err = item.ParseText(string(data))
+	if err != nil {
+		return err
+	}
+
+	err = b.AddItem(item)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(item.ItemId)
+
+	return nil
+}
+
+func editCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("edit", flag.ContinueOnError)
+	name := fs.String("name", "", "rename the item to `NAME`")
+	file := fs.String("f", "", "replace the item data with `FILE`, - for stdin")
+
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if *name == "" && *file == "" {
+		return fmt.Errorf("edit: nothing to change, use -name and/or -f")
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	item, err := b.GetItem(imd.ItemId)
+	if err != nil {
+		return err
+	}
+
+	if *name != "" {
+		item.Name = *name
+	}
+
+	if *file != "" {
+		data, err := c.input.data(*file)
+		if err != nil {
+			return err
+		}
+
+		err = item.ParseText(string(data))
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.UpdateItem(item)
+}
+
+func otpCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("otp", flag.ContinueOnError)
+	watch := fs.Bool("watch", false, "keep showing the current code until interrupted")
+
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	code, remaining, err := b.GetOTPCode(imd.ItemId)
+	if err != nil {
+		return err
+	}
+
+	// HOTP codes do not expire, so there is nothing to watch.
+	if !*watch || remaining == 0 {
+		fmt.Println(code)
+		return nil
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		fmt.Fprintf(os.Stderr, "\r%s  %2ds ", code, remaining)
+
+		select {
+		case <-interrupt:
+			fmt.Fprintln(os.Stderr)
+			return nil
+		case <-ticker.C:
+		}
+
+		code, remaining, err = b.GetOTPCode(imd.ItemId)
+		if err != nil {
+			fmt.Fprintln(os.Stderr)
+			return err
+		}
+	}
+}
+
+func rmCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	return b.DeleteItem(imd.ItemId)
+}
+
+func searchCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	filter := addFilterFlags(fs)
+	limit := fs.Int("n", 20, "show at most `N` results, 0 shows every result")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() == 0 {
+		return fmt.Errorf("search: expected a query")
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	var opts lckbx.ItemListOptions
+	err = filter.apply(b, &opts)
+	if err != nil {
+		return err
+	}
+
+	results, err := b.Search(strings.Join(fs.Args(), " "), opts)
+	if err != nil {
+		return err
+	}
+
+	if *limit > 0 && len(results) > *limit {
+		results = results[:*limit]
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%.2f\t%s\t%s\n", r.Item.ItemId, r.Item.Type, r.Score, r.Item.Name, strings.Join(r.Matches, ","))
+	}
+
+	return tw.Flush()
+}
+
+func foldersCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("folders", flag.ContinueOnError)
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	folders, err := b.GetFolders()
+	if err != nil {
+		return err
+	}
+
+	items, err := b.GetItemList()
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[lckbx.FolderToken]int)
+	for _, item := range items {
+		counts[item.Folder]++
+	}
+
+	paths := folderPaths(folders)
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, f := range folders {
+		fmt.Fprintf(tw, "%s\t/%s\t%d\n", f.FolderId, paths[f.FolderId], counts[f.FolderId])
+	}
+
+	return tw.Flush()
+}
+
+func mkdirCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("mkdir", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	// Create each folder in the path that does not exist yet.
+	var parent lckbx.FolderToken
+	var path string
+	for _, name := range strings.Split(strings.Trim(args[0], "/"), "/") {
+		path = strings.TrimPrefix(path+"/"+name, "/")
+
+		fid, err := findFolder(b, path)
+		if err == nil {
+			parent = fid
+			continue
+		}
+
+		parent, err = b.CreateFolder(name, parent)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func rmdirCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("rmdir", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	fid, err := findFolder(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	if fid == (lckbx.FolderToken{}) {
+		return fmt.Errorf("rmdir: the top level cannot be deleted")
+	}
+
+	return b.DeleteFolder(fid)
+}
+
+func mvdirCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("mvdir", flag.ContinueOnError)
+	name := fs.String("name", "", "rename the folder to `NAME`")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 || fs.NArg() > 2 || (*name == "" && fs.NArg() == 1) {
+		return fmt.Errorf("mvdir: expected a folder and a new parent, -name, or both")
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	fid, err := findFolder(b, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if fid == (lckbx.FolderToken{}) {
+		return fmt.Errorf("mvdir: the top level cannot be moved")
+	}
+
+	if *name != "" {
+		err = b.RenameFolder(fid, *name)
+		if err != nil {
+			return err
+		}
+	}
+
+	if fs.NArg() == 1 {
+		return nil
+	}
+
+	parent, err := findFolder(b, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return b.MoveFolder(fid, parent)
+}
+
+func mvCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("mv", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	fid, err := findFolder(b, args[1])
+	if err != nil {
+		return err
+	}
+
+	return b.MoveItem(imd.ItemId, fid)
+}
+
+func tagCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	remove := fs.Bool("d", false, "remove the tags from the item instead of adding them")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 {
+		return fmt.Errorf("tag: expected an item and at least one tag")
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range fs.Args()[1:] {
+		if *remove {
+			err = b.UntagItem(imd.ItemId, tag)
+		} else {
+			err = b.TagItem(imd.ItemId, tag)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func tagsCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("tags", flag.ContinueOnError)
+	add := fs.Bool("add", false, "create TAG without giving it to an item")
+	remove := fs.Bool("d", false, "delete TAG from every item")
+	rename := fs.String("rename", "", "rename TAG to `NAME` on every item")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	changes := 0
+	for _, set := range []bool{*add, *remove, *rename != ""} {
+		if set {
+			changes++
+		}
+	}
+
+	if changes > 1 || (changes == 1) != (fs.NArg() == 1) || fs.NArg() > 1 {
+		return fmt.Errorf("tags: expected -add, -d, or -rename with a tag, or no arguments")
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	switch {
+	case *add:
+		return b.CreateTag(fs.Arg(0))
+	case *remove:
+		return b.DeleteTag(fs.Arg(0))
+	case *rename != "":
+		return b.RenameTag(fs.Arg(0), *rename)
+	}
+
+	tags, err := b.GetTags()
+	if err != nil {
+		return err
+	}
+
+	items, err := b.GetItemList()
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		for _, tag := range item.Tags {
+			counts[tag]++
+		}
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, tag := range tags {
+		fmt.Fprintf(tw, "%s\t%d\n", tag, counts[tag])
+	}
+
+	return tw.Flush()
+}
+
+func trashCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("trash", flag.ContinueOnError)
+	days := fs.Int("days", -1, "purge items after `N` days in the trash, 0 keeps them until purged")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if *days >= 0 {
+		return b.SetTrashDays(*days)
+	}
+
+	items, err := b.GetTrashList()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, item := range items {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", item.ItemId, item.Name, item.Trashed.Local().Format(time.RFC3339))
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+
+	n, err := b.GetTrashDays()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		fmt.Fprintf(os.Stderr, "Items are kept in the trash until they are purged.\n")
+	} else {
+		fmt.Fprintf(os.Stderr, "Items are purged after %d day(s) in the trash.\n", n)
+	}
+
+	return nil
+}
+
+func undeleteCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("undelete", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findTrashedItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	return b.RestoreItem(imd.ItemId)
+}
+
+func purgeCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	all := fs.Bool("all", false, "purge every item in the trash")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *all == (fs.NArg() == 1) || fs.NArg() > 1 {
+		return fmt.Errorf("purge: expected an item or -all")
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if *all {
+		n, err := b.EmptyTrash()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Purged %d item(s).\n", n)
+		return nil
+	}
+
+	imd, err := findTrashedItem(b, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return b.PurgeItem(imd.ItemId)
+}
+
+func attachCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("attach", flag.ContinueOnError)
+	name := fs.String("name", "", "store the file as `NAME`, defaults to the base name of FILE")
+
+	args, err := parseFlags(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	if *name == "" {
+		*name = filepath.Base(args[1])
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	aid, err := b.AddAttachment(imd.ItemId, *name, file)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(aid)
+
+	return nil
+}
+
+func filesCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("files", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	atts, err := b.GetAttachmentList(imd.ItemId)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(atts, func(i, j int) bool {
+		return atts[i].Name < atts[j].Name
+	})
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, att := range atts {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", att.AttachmentId, att.Size, att.Name)
+	}
+
+	return tw.Flush()
+}
+
+func extractCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	out := fs.String("o", "-", "write the file to `FILE`, - for stdout")
+
+	args, err := parseFlags(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	amd, err := findAttachment(b, imd.ItemId, args[1])
+	if err != nil {
+		return err
+	}
+
+	if *out == "-" {
+		return b.ExtractAttachment(imd.ItemId, amd.AttachmentId, os.Stdout)
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = b.ExtractAttachment(imd.ItemId, amd.AttachmentId, file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	return nil
+}
+
+func detachCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("detach", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	amd, err := findAttachment(b, imd.ItemId, args[1])
+	if err != nil {
+		return err
+	}
+
+	return b.DeleteAttachment(imd.ItemId, amd.AttachmentId)
+}
+
+func historyCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	revisions, err := b.GetRevisionList(imd.ItemId)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for n, rev := range revisions {
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", n+1, rev.RevisionId, rev.Created.Local().Format(time.RFC3339))
+	}
+
+	return tw.Flush()
+}
+
+func diffCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if fs.NArg() < 2 || fs.NArg() > 3 {
+		return fmt.Errorf("diff: expected 2 or 3 arguments, received %d", fs.NArg())
+	}
+	args = fs.Args()
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	from, err := findRevision(b, imd.ItemId, args[1])
+	if err != nil {
+		return err
+	}
+
+	// Without a second revision, compare with the current item.
+	var to lckbx.RevisionMetadata
+	if len(args) == 3 {
+		to, err = findRevision(b, imd.ItemId, args[2])
+		if err != nil {
+			return err
+		}
+	}
+
+	diff, err := b.DiffRevisions(imd.ItemId, from.RevisionId, to.RevisionId)
+	if err != nil {
+		return err
+	}
+
+	_, err = os.Stdout.WriteString(diff.String())
+
+	return err
+}
+
+func revertCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("revert", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	imd, err := findItem(b, args[0])
+	if err != nil {
+		return err
+	}
+
+	rmd, err := findRevision(b, imd.ItemId, args[1])
+	if err != nil {
+		return err
+	}
+
+	return b.RestoreRevision(imd.ItemId, rmd.RevisionId)
+}
+
+func keepCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("keep", flag.ContinueOnError)
+	count := fs.Int("count", -1, "keep at most `N` revisions of each item, 0 turns off the history")
+	age := fs.Duration("age", -1, "delete revisions older than `DURATION`, 0 keeps them until -count is reached")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	limit, err := b.GetRevisionLimit()
+	if err != nil {
+		return err
+	}
+
+	if *count < 0 && *age < 0 {
+		fmt.Printf("count: %d\nage: %s\n", limit.Count, limit.Age)
+		return nil
+	}
+
+	if *count >= 0 {
+		limit.Count = *count
+	}
+
+	if *age >= 0 {
+		limit.Age = *age
+	}
+
+	return b.SetRevisionLimit(limit)
+}
+
+func passwdCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("passwd", flag.ContinueOnError)
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := c.open()
+	if err != nil {
+		return err
+	}
+
+	oldPassword, err := c.input.password("Old password: ")
+	if err != nil {
+		return err
+	}
+
+	newPassword, err := c.newPassword("New password: ")
+	if err != nil {
+		return err
+	}
+
+	err = c.locked.ChangePassword(c.username, oldPassword, newPassword)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Password changed for %s.\n", c.username)
+
+	return nil
+}
+
+func recoverCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("recover", flag.ContinueOnError)
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := c.open()
+	if err != nil {
+		return err
+	}
+
+	phrase, err := c.input.password("Recovery phrase: ")
+	if err != nil {
+		return err
+	}
+
+	newPassword, err := c.newPassword("New password: ")
+	if err != nil {
+		return err
+	}
+
+	err = c.locked.RecoverAccount(c.username, phrase, newPassword)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Password reset for %s.\n", c.username)
+
+	return nil
+}
+
+func recoveryCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("recovery", flag.ContinueOnError)
+	revoke := fs.Bool("revoke", false, "revoke the recovery phrase instead of creating a new one")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := c.open()
+	if err != nil {
+		return err
+	}
+
+	password, err := c.input.password("Password: ")
+	if err != nil {
+		return err
+	}
+
+	ub, err := c.locked.Login(c.username, password)
+	if err != nil {
+		return err
+	}
+	defer ub.Lock()
+
+	if *revoke {
+		err = ub.RevokeRecoveryPhrase()
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Recovery phrase revoked for %s.\n", c.username)
+
+		return nil
+	}
+
+	phrase, err := ub.RotateRecoveryPhrase()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "The old recovery phrase no longer works. Write down the new one:\n")
+	fmt.Println(phrase)
+
+	return nil
+}
+
+// parseClasses returns the character classes named by the letters l, u, d,
+// and s, for lowercase, uppercase, digits, and symbols.
+func parseClasses(s string) (lckbx.CharClass, error) {
+	letters := map[rune]lckbx.CharClass{
+		'l': lckbx.LowerClass,
+		'u': lckbx.UpperClass,
+		'd': lckbx.DigitClass,
+		's': lckbx.SymbolClass,
+	}
+
+	var classes lckbx.CharClass
+	for _, r := range s {
+		class, ok := letters[r]
+		if !ok {
+			return 0, fmt.Errorf("unknown character class %q, expected l, u, d, or s", r)
+		}
+
+		classes |= class
+	}
+
+	return classes, nil
+}
+
+func generateCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	length := fs.Int("length", lckbx.DefaultPasswordRules.Length, "number of characters in the password")
+	classes := fs.String("classes", "luds", "character `CLASSES` to use: lowercase, uppercase, digits, and symbols")
+	require := fs.String("require", "", "character `CLASSES` that must appear, defaults to -classes")
+	unambiguous := fs.Bool("x", false, "leave out characters that are easily confused, such as 0 and O")
+	words := fs.Int("words", 0, "generate a diceware passphrase of `N` words instead")
+	separator := fs.String("sep", lckbx.DefaultPassphraseRules.Separator, "separator between the words of a passphrase")
+	capitalize := fs.Bool("cap", false, "capitalize the words of a passphrase")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *words != 0 {
+		rules := lckbx.PassphraseRules{
+			Words:      *words,
+			Separator:  *separator,
+			Capitalize: *capitalize,
+		}
+
+		passphrase, err := lckbx.GeneratePassphrase(rules)
+		if err != nil {
+			return err
+		}
+
+		fmt.Println(passphrase)
+		fmt.Fprintf(os.Stderr, "%.1f bits of entropy.\n", rules.Entropy())
+
+		return nil
+	}
+
+	if *require == "" {
+		*require = *classes
+	}
+
+	rules := lckbx.PasswordRules{
+		Length:           *length,
+		ExcludeAmbiguous: *unambiguous,
+	}
+
+	var err error
+	rules.Classes, err = parseClasses(*classes)
+	if err != nil {
+		return err
+	}
+
+	rules.Required, err = parseClasses(*require)
+	if err != nil {
+		return err
+	}
+
+	password, err := lckbx.GeneratePassword(rules)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(password)
+	fmt.Fprintf(os.Stderr, "%.1f bits of entropy.\n", rules.Entropy())
+
+	return nil
+}
+
+func kdfCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("kdf", flag.ContinueOnError)
+	calibrate := fs.Duration("calibrate", 0, "choose the parameters that take about `DURATION` to unlock a box on this machine")
+	dryRun := fs.Bool("n", false, "report the calibrated parameters without saving them")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := c.open()
+	if err != nil {
+		return err
+	}
+
+	if *calibrate <= 0 {
+		version := c.locked.DeriverVersion()
+		fmt.Printf("%s\t%s\n", version, lckbx.DescribeDeriver(version))
+
+		return nil
+	}
+
+	version, took, err := lckbx.CalibrateDeriver(*calibrate)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s\t%s\n", version, lckbx.DescribeDeriver(version))
+	fmt.Fprintf(os.Stderr, "Unlocking takes about %v.\n", took.Round(time.Millisecond))
+
+	if *dryRun {
+		return nil
+	}
+
+	err = c.locked.SetDeriverVersion(version)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Saved. Users are moved to these parameters the next time they login.\n")
+
+	return nil
+}
+
+func fsckCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ContinueOnError)
+	repair := fs.Bool("repair", false, "quarantine or re-link the records with problems")
+	user := fs.Bool("user", true, "also check the user's items, which needs their password")
+
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	err := c.open()
+	if err != nil {
+		return err
+	}
+
+	problems, err := c.store.Check(*repair)
+	if err != nil {
+		return err
+	}
+
+	if *user {
+		password, err := c.input.password("Password: ")
+		if err != nil {
+			return err
+		}
+
+		ub, err := c.locked.Login(c.username, password)
+		if err != nil {
+			return err
+		}
+		defer ub.Lock()
+
+		userProblems, err := ub.Check(*repair)
+		if err != nil {
+			return err
+		}
+
+		problems = append(problems, userProblems...)
+	}
+
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if len(problems) != 0 && !*repair {
+		return fmt.Errorf("found %d problem(s), run 'lckbx fsck -repair' to fix them", len(problems))
+	}
+
+	fmt.Fprintf(os.Stderr, "Found %d problem(s).\n", len(problems))
+
+	return nil
+}
+
+func backupCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	encrypt := fs.Bool("p", false, "encrypt the backup with a passphrase")
+	keep := fs.Int("keep", -1, "write a timestamped backup to the directory and keep only the newest N, 0 keeps all")
+
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var passphrase string
+	if *encrypt {
+		passphrase, err = c.input.newPassword("Backup passphrase: ")
+		if err != nil {
+			return err
+		}
+
+		if passphrase == "" {
+			return fmt.Errorf("missing backup passphrase")
+		}
+	}
+
+	err = c.open()
+	if err != nil {
+		return err
+	}
+
+	filename := args[0]
+	switch {
+	case *keep >= 0:
+		filename, err = c.store.BackupRotate(args[0], *keep, passphrase)
+	case *encrypt:
+		err = c.store.BackupEncrypted(filename, passphrase)
+	default:
+		err = c.store.Backup(filename)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote backup to %s.\n", filename)
+
+	return nil
+}
+
+func restoreCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var passphrase string
+	encrypted, err := lckbx.IsEncryptedBackup(args[0])
+	if err != nil {
+		return err
+	}
+
+	if encrypted {
+		passphrase, err = c.input.password("Backup passphrase: ")
+		if err != nil {
+			return err
+		}
+	}
+
+	err = lckbx.VerifyBackup(args[0], passphrase)
+	if err != nil {
+		return err
+	}
+
+	// Move the current database aside rather than replacing it. Opening it
+	// first ensures lckbx-agent or the GUI is not using it.
+	if _, err := os.Stat(c.dbPath); err == nil {
+		err = c.open()
+		if err != nil {
+			return err
+		}
+		c.Close()
+
+		old := fmt.Sprintf("%s.%s.old", c.dbPath, time.Now().UTC().Format("20060102T150405Z"))
+		err = os.Link(c.dbPath, old)
+		if err != nil {
+			return fmt.Errorf("could not move the current database aside: %v", err)
+		}
+
+		err = os.Remove(c.dbPath)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Moved the current database to %s.\n", old)
+	}
+
+	err = os.MkdirAll(filepath.Dir(c.dbPath), 0700)
+	if err != nil {
+		return err
+	}
+
+	err = lckbx.Restore(args[0], c.dbPath, passphrase)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Restored %s to %s.\n", args[0], c.dbPath)
+
+	return nil
+}
+
+func exportCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "", "export the items as `FORMAT`: "+strings.Join(lckbx.ExportFormats, ", "))
+	plaintext := fs.Bool("plaintext", false, "confirm an export that is not encrypted")
+	encrypt := fs.Bool("p", false, "encrypt the age archive with a passphrase")
+	recipients := fs.String("r", "", "encrypt the age archive to the comma separated age `RECIPIENTS`")
+
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	if *format != "" {
+		opts := lckbx.ExportOptions{Plaintext: *plaintext}
+		if *recipients != "" {
+			opts.Recipients = strings.Split(*recipients, ",")
+		}
+
+		if *encrypt {
+			opts.Passphrase, err = c.input.newPassword("Archive passphrase: ")
+			if err != nil {
+				return err
+			}
+
+			if opts.Passphrase == "" {
+				return fmt.Errorf("missing archive passphrase")
+			}
+		}
+
+		return exportItems(c, args[0], *format, opts)
+	}
+
+	err = c.open()
+	if err != nil {
+		return err
+	}
+
+	password, err := c.input.password("Password: ")
+	if err != nil {
+		return err
+	}
+
+	ub, err := c.locked.Login(c.username, password)
+	if err != nil {
+		return err
+	}
+	defer ub.Lock()
+
+	file, err := os.OpenFile(args[0], os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = ub.ExportAccount(file)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(args[0])
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported %s to %s.\n", c.username, args[0])
+
+	return nil
+}
+
+// exportItems writes the items in the user's box to a new file, or to a new
+// directory for the markdown format.
+func exportItems(c *client, filename, format string, opts lckbx.ExportOptions) error {
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if format == lckbx.ExportMarkdown {
+		err = b.ExportMarkdown(filename, opts)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(os.Stderr, "Exported the items to %s.\n", filename)
+		return nil
+	}
+
+	data, err := b.Export(format, opts)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		os.Remove(filename)
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Exported the items to %s.\n", filename)
+
+	return nil
+}
+
+func importCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	as := fs.String("as", "", "import the account under a different username")
+	format := fs.String("format", "", "read FILE as `FORMAT`: "+strings.Join(lckbx.ImportFormats(), ", "))
+	keyFile := fs.String("key", "", "open a KeePass database, or an age archive, with the key file `FILE`")
+	dryRun := fs.Bool("n", false, "report what would be imported without changing the box")
+
+	args, err := parseFlags(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	// Files in no other format are account bundles.
+	if *format == "" {
+		*format, _ = lckbx.DetectImportFormat(data)
+	}
+
+	if *format != "" {
+		return importFile(c, args[0], *format, data, *keyFile, *dryRun)
+	}
+
+	err = c.open()
+	if err != nil {
+		return err
+	}
+
+	password, err := c.input.password("Password: ")
+	if err != nil {
+		return err
+	}
+
+	err = c.locked.ImportAccount(bytes.NewReader(data), *as, password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %s.\n", args[0])
+
+	return nil
+}
+
+// importFile adds the entries of a file exported by another program to the
+// user's box and prints every entry that could not be converted. A dry run
+// prints how each field would be imported instead.
+func importFile(c *client, filename, format string, data []byte, keyFilename string, dryRun bool) error {
+	opts := lckbx.ImportOptions{DryRun: dryRun}
+	var err error
+
+	if keyFilename != "" {
+		opts.KeyFile, err = os.ReadFile(keyFilename)
+		if err != nil {
+			return err
+		}
+	}
+
+	b, err := c.unlock()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	if lckbx.ImportNeedsPassword(format, data) {
+		opts.Password, err = c.input.password("Password for " + filepath.Base(filename) + ": ")
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := b.Import(format, data, opts)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		for _, m := range report.Mapping {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", m.From, m.To, m.Count)
+		}
+		tw.Flush()
+	}
+
+	for _, f := range report.Failures {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", f.Entry, f.Reason)
+	}
+
+	var types []string
+	for _, t := range []lckbx.ItemType{lckbx.LoginType, lckbx.CardType, lckbx.IdentityType, lckbx.OTPType, lckbx.SecureNoteType} {
+		if report.Types[t] > 0 {
+			types = append(types, fmt.Sprintf("%d %s", report.Types[t], t))
+		}
+	}
+
+	verb := "Imported"
+	if dryRun {
+		verb = "Would import"
+	}
+
+	fmt.Fprintf(os.Stderr, "%s %d items (%s), %d folders, and %d attachments from %s as %s, %d problems.\n",
+		verb, report.Items, strings.Join(types, ", "), report.Folders, report.Attachments, filename, format, len(report.Failures))
+
+	return nil
+}
+
+func lockCommand(c *client, args []string) error {
+	fs := flag.NewFlagSet("lock", flag.ContinueOnError)
+	if _, err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+
+	ac, err := agent.Dial(c.socket)
+	if err != nil {
+		return fmt.Errorf("lckbx-agent is not running")
+	}
+	defer ac.Close()
+
+	return ac.Lock()
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lckbx"
+)
+
+var (
+	cliUser        = "cli_user"
+	cliPassword    = "cli-lantern-orbit-thimble"
+	cliNewPassword = "cli-saddle-comet-marble"
+	cliPassphrase  = "cli-harbor-quartz-fennel"
+)
+
+// runCommand runs the named command as a separate invocation of lckbx
+// would, with a new client for the database and the given text on stdin.
+// It returns everything the command wrote to stdout and stderr.
+func runCommand(t *testing.T, dir, stdin string, args []string) (string, error) {
+	c := &client{
+		dbPath:   filepath.Join(dir, "lckbx.db"),
+		socket:   filepath.Join(dir, "agent.sock"),
+		username: cliUser,
+		input:    &input{reader: bufio.NewReader(strings.NewReader(stdin))},
+	}
+
+	var run func(c *client, args []string) error
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			run = cmd.run
+		}
+	}
+
+	if run == nil {
+		t.Fatalf("Expected command %q, received nil", args[0])
+	}
+
+	out, err := os.CreateTemp(t.TempDir(), "out")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer out.Close()
+
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = out, out
+
+	err = run(c, args[1:])
+	c.Close()
+
+	os.Stdout, os.Stderr = stdout, stderr
+
+	data, rerr := os.ReadFile(out.Name())
+	if rerr != nil {
+		t.Fatalf("Expected no error, received %v", rerr)
+	}
+
+	return string(data), err
+}
+
+func TestCommands(t *testing.T) {
+	fmt.Println(t.Name())
+
+	dir := t.TempDir()
+	backup := filepath.Join(dir, "backup.db")
+	encrypted := filepath.Join(dir, "backup.age")
+
+	login := cliPassword + "\nusername: octocat\npassword: hunter2\n\nrecovery codes\n"
+	edit := cliPassword + "\nusername: tanuki\npassword: hunter3\n"
+
+	tests := []struct {
+		name    string
+		args    []string
+		stdin   string
+		output  string
+		missing string
+		err     string
+	}{
+		{"Register", []string{"register"}, cliPassword + "\n", "Registered " + cliUser, "", ""},
+		{"Register Existing", []string{"register"}, cliPassword + "\n", "", "", "exists"},
+		{"Register Arguments", []string{"register", "extra"}, cliPassword + "\n", "", "", "expected 0 argument(s)"},
+		{"Login", []string{"login"}, cliPassword + "\n", "0 item(s)", "", ""},
+		{"Login Bad Password", []string{"login"}, cliNewPassword + "\n", "", "", "could not LockedBox.Login"},
+		{"Login No Password", []string{"login"}, "", "", "", "could not read password from stdin"},
+		{"Add", []string{"add", "-type", "login", "GitHub"}, login, "it_", "", ""},
+		{"Add Bad Type", []string{"add", "-type", "boat", "Boat"}, cliPassword + "\n", "", "", "boat"},
+		{"List", []string{"ls"}, cliPassword + "\n", "GitHub", "", ""},
+		{"List Type", []string{"ls", "-type", "note"}, cliPassword + "\n", "", "GitHub", ""},
+		{"Show", []string{"show", "GitHub"}, cliPassword + "\n", "username: octocat\npassword: hunter2\n\nrecovery codes\n", "", ""},
+		{"Show Missing", []string{"show", "GitLab"}, cliPassword + "\n", "", "", "no item named"},
+		{"Edit", []string{"edit", "-name", "GitLab", "-f", "-", "GitHub"}, edit, "", "", ""},
+		{"Edit Nothing", []string{"edit", "GitLab"}, cliPassword + "\n", "", "", "nothing to change"},
+		{"Show Edited", []string{"show", "GitLab"}, cliPassword + "\n", "username: tanuki\npassword: hunter3\n", "recovery codes", ""},
+		{"Show Revision", []string{"show", "-rev", "1", "GitLab"}, cliPassword + "\n", "username: octocat", "", ""},
+		{"Remove", []string{"rm", "GitLab"}, cliPassword + "\n", "", "", ""},
+		{"List Removed", []string{"ls"}, cliPassword + "\n", "", "GitLab", ""},
+		{"Trash", []string{"trash"}, cliPassword + "\n", "GitLab", "", ""},
+		{"Passwd Bad Password", []string{"passwd"}, cliNewPassword + "\n" + cliNewPassword + "\n", "", "", "could not LockedBox.ChangePassword"},
+		{"Passwd Weak Password", []string{"passwd"}, cliPassword + "\npassword\n", "", "", "rejected"},
+		{"Passwd", []string{"passwd"}, cliPassword + "\n" + cliNewPassword + "\n", "Password changed for " + cliUser, "", ""},
+		{"Login Old Password", []string{"login"}, cliPassword + "\n", "", "", "could not LockedBox.Login"},
+		{"Login New Password", []string{"login"}, cliNewPassword + "\n", "0 item(s)", "", ""},
+		{"Backup", []string{"backup", backup}, "", "Wrote backup to " + backup, "", ""},
+		{"Backup Existing", []string{"backup", backup}, "", "", "", "exists"},
+		{"Backup Encrypted", []string{"backup", "-p", encrypted}, cliPassphrase + "\n", "Wrote backup to " + encrypted, "", ""},
+		{"Backup No Passphrase", []string{"backup", "-p", encrypted + ".2"}, "", "", "", "could not read password from stdin"},
+	}
+
+	for _, test := range tests {
+		output, err := runCommand(t, dir, test.stdin, test.args)
+
+		if test.err != "" {
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Fatalf("%s: Expected error containing %q, received %v", test.name, test.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: Expected no error, received %v", test.name, err)
+		}
+
+		if !strings.Contains(output, test.output) {
+			t.Fatalf("%s: Expected output containing %q, received %q", test.name, test.output, output)
+		}
+
+		if test.missing != "" && strings.Contains(output, test.missing) {
+			t.Fatalf("%s: Expected output without %q, received %q", test.name, test.missing, output)
+		}
+	}
+
+	// The backups must be complete copies of the database.
+	err := lckbx.VerifyBackup(backup, "")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lckbx.VerifyBackup(encrypted, cliPassphrase)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// input reads passwords and item data. When stdin is a terminal, passwords
+// are read without echo. Otherwise each password is read as a single line
+// from stdin and any remaining input can be used as item data.
+type input struct {
+	reader   *bufio.Reader
+	terminal bool
+}
+
+// password reads a single password, displaying the prompt on a terminal.
+func (i *input) password(prompt string) (string, error) {
+	if i.terminal {
+		fmt.Fprint(os.Stderr, prompt)
+		password, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+
+		if err != nil {
+			return "", fmt.Errorf("could not read password: %v", err)
+		}
+
+		return string(password), nil
+	}
+
+	line, err := i.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("could not read password from stdin: %v", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// newPassword reads a new password. On a terminal the password must be
+// entered twice.
+func (i *input) newPassword(prompt string) (string, error) {
+	password, err := i.password(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	if !i.terminal {
+		return password, nil
+	}
+
+	confirm, err := i.password("Confirm password: ")
+	if err != nil {
+		return "", err
+	}
+
+	if password != confirm {
+		return "", fmt.Errorf("passwords do not match")
+	}
+
+	return password, nil
+}
+
+// data returns the contents of the given file. If the filename is "-", the
+// remainder of stdin is returned.
+func (i *input) data(filename string) ([]byte, error) {
+	if filename != "-" {
+		return os.ReadFile(filename)
+	}
+
+	if i.terminal {
+		fmt.Fprintln(os.Stderr, "Reading item data from stdin, end with Ctrl-D.")
+	}
+
+	return io.ReadAll(i.reader)
+}
+
+func newInput() *input {
+	return &input{
+		reader:   bufio.NewReader(os.Stdin),
+		terminal: term.IsTerminal(int(os.Stdin.Fd())),
+	}
+}
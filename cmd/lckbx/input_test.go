@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestInput(t *testing.T) {
+	fmt.Println(t.Name())
+
+	tests := []struct {
+		name     string
+		stdin    string
+		password string
+		data     string
+		err      bool
+	}{
+		{"Line", "password\n", "password", "", false},
+		{"CRLF", "password\r\n", "password", "", false},
+		{"No Newline", "password", "password", "", false},
+		{"Spaces", " pass word \n", " pass word ", "", false},
+		{"Data", "password\nfirst\nsecond\n", "password", "first\nsecond\n", false},
+		{"Empty Line", "\ndata", "", "data", false},
+		{"Empty", "", "", "", true},
+	}
+
+	for _, test := range tests {
+		in := &input{reader: bufio.NewReader(strings.NewReader(test.stdin))}
+
+		password, err := in.password("Password: ")
+		if test.err {
+			if err == nil {
+				t.Fatalf("%s: Expected error, received nil", test.name)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%s: Expected no error, received %v", test.name, err)
+		}
+
+		if password != test.password {
+			t.Fatalf("%s: Expected password %q, received %q", test.name, test.password, password)
+		}
+
+		// The rest of stdin is the item data.
+		data, err := in.data("-")
+		if err != nil {
+			t.Fatalf("%s: Expected no error, received %v", test.name, err)
+		}
+
+		if string(data) != test.data {
+			t.Fatalf("%s: Expected data %q, received %q", test.name, test.data, data)
+		}
+	}
+
+	// A new password is only read once when stdin is not a terminal.
+	in := &input{reader: bufio.NewReader(strings.NewReader("first\nsecond\n"))}
+
+	password, err := in.newPassword("New password: ")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if password != "first" {
+		t.Fatalf("Expected password %q, received %q", "first", password)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"lckbx/agent"
+)
+
+// command describes a single lckbx subcommand.
+type command struct {
+	name  string
+	args  string
+	usage string
+	run   func(c *client, args []string) error
+}
+
+var commands = []command{
+	{"register", "[-recovery]", "Register a new user, optionally printing a recovery phrase.", registerCommand},
+	{"login", "", "Verify the user's password and report the number of items.", loginCommand},
+	{"ls", "[-l] [-r] [-sort BY] [FILTER]", "List the items in the user's box in order.", lsCommand},
+	{"search", "[-n N] [FILTER] QUERY...", "Search the names, notes, and fields of the items, best match first.", searchCommand},
+	{"show", "[-rev REV] ITEM", "Print the data stored in an item, or in one of its revisions.", showCommand},
+	{"add", "[-type TYPE] [-f FILE] NAME", "Add a new item, reading its data from FILE or stdin.", addCommand},
+	{"edit", "[-name NAME] [-f FILE] ITEM", "Rename an item or replace its data.", editCommand},
+	{"otp", "[-watch] ITEM", "Print the current one-time code of an otp item.", otpCommand},
+	{"mv", "ITEM FOLDER", "Move an item into a folder.", mvCommand},
+	{"tag", "[-d] ITEM TAG...", "Add tags to an item, or remove them.", tagCommand},
+	{"tags", "[-add|-d|-rename NAME] [TAG]", "List the tags, or create, delete, or rename one.", tagsCommand},
+	{"folders", "", "List the folders and the number of items in each.", foldersCommand},
+	{"mkdir", "FOLDER", "Create a folder, and any missing parent folders.", mkdirCommand},
+	{"mvdir", "[-name NAME] FOLDER [PARENT]", "Rename a folder or move it into another folder.", mvdirCommand},
+	{"rmdir", "FOLDER", "Delete a folder, moving its contents to its parent.", rmdirCommand},
+	{"rm", "ITEM", "Move an item to the trash.", rmCommand},
+	{"trash", "[-days N]", "List the items in the trash, or change how long they are kept.", trashCommand},
+	{"undelete", "ITEM", "Restore an item from the trash.", undeleteCommand},
+	{"purge", "[-all] [ITEM]", "Permanently delete an item in the trash, or all of them.", purgeCommand},
+	{"history", "ITEM", "List the revisions of an item, newest first.", historyCommand},
+	{"diff", "ITEM REV [REV]", "Compare a revision with the current item, or two revisions.", diffCommand},
+	{"revert", "ITEM REV", "Restore an item to one of its revisions.", revertCommand},
+	{"keep", "[-count N] [-age DURATION]", "Show or change how many revisions are kept.", keepCommand},
+	{"attach", "[-name NAME] ITEM FILE", "Attach a file to an item.", attachCommand},
+	{"files", "ITEM", "List the files attached to an item.", filesCommand},
+	{"extract", "[-o FILE] ITEM FILE", "Write an attached file to FILE or stdout.", extractCommand},
+	{"detach", "ITEM FILE", "Delete a file attached to an item.", detachCommand},
+	{"passwd", "", "Change the user's password.", passwdCommand},
+	{"recover", "", "Reset a forgotten password with the recovery phrase.", recoverCommand},
+	{"recovery", "[-revoke]", "Replace the recovery phrase, or revoke it.", recoveryCommand},
+	{"generate", "[-length N] [-x] [-words N]", "Print a random password, or a diceware passphrase.", generateCommand},
+	{"kdf", "[-calibrate DURATION] [-n]", "Show the key derivation parameters, or calibrate them.", kdfCommand},
+	{"fsck", "[-repair] [-user=false]", "Check the database and the user's items for problems.", fsckCommand},
+	{"backup", "[-p] [-keep N] FILE|DIR", "Write a verified backup to FILE, or a rotated one to DIR.", backupCommand},
+	{"restore", "FILE", "Restore the database from a backup, keeping the current one.", restoreCommand},
+	{"export", "[-format F] [-plaintext|-p|-r R] FILE", "Export the account to an encrypted bundle, or the items as FORMAT.", exportCommand},
+	{"import", "[-as NAME] [-format F] [-n] FILE", "Import an account bundle, or another password manager's export.", importCommand},
+	{"lock", "", "Lock the box held by lckbx-agent and stop the agent.", lockCommand},
+}
+
+// usage prints the global flags and the list of subcommands to stderr.
+func usage() {
+	out := flag.CommandLine.Output()
+
+	fmt.Fprintf(out, "Usage: lckbx [-db FILE] [-u USER] [-socket FILE] [-breaches FILE] COMMAND [ARGS]\n\n")
+	fmt.Fprintf(out, "Flags:\n")
+	flag.PrintDefaults()
+
+	fmt.Fprintf(out, "\nCommands:\n")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-8s %-33s %s\n", cmd.name, cmd.args, cmd.usage)
+	}
+
+	fmt.Fprintf(out, "\nITEM is either an item id (it_...) or an item name. Attached files are named\n")
+	fmt.Fprintf(out, "by their id (ft_...) or their name. REV is a revision id (rt_...) or its number\n")
+	fmt.Fprintf(out, "in the history, starting at 1 for the newest. FOLDER is a folder id (dt_...)\n")
+	fmt.Fprintf(out, "or its path, such as Work/Email, and / is the top level. FILTER is any of\n")
+	fmt.Fprintf(out, "-type TYPE, -folder FOLDER, and -tag TAG.\n")
+	fmt.Fprintf(out, "TYPE is login, card, identity, otp, or note. Items other than notes are read\n")
+	fmt.Fprintf(out, "and shown as \"field: value\" lines, then a blank line and free-form notes.\n")
+	fmt.Fprintf(out, "Passwords are read from the terminal, or one per line from stdin.\n")
+	fmt.Fprintf(out, "Item commands use a running lckbx-agent instead of asking for a password.\n")
+}
+
+// defaultDatabase returns the path to lckbx.db in the .lckbx directory of
+// the user's HOME, which is the same database used by the GUI.
+func defaultDatabase() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "lckbx.db"
+	}
+
+	return filepath.Join(home, ".lckbx", "lckbx.db")
+}
+
+// defaultUsername returns the value of $LCKBX_USER if it is set, otherwise
+// it returns $USER.
+func defaultUsername() string {
+	if username := os.Getenv("LCKBX_USER"); username != "" {
+		return username
+	}
+
+	return os.Getenv("USER")
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "lckbx: %v\n", err)
+	os.Exit(1)
+}
+
+func main() {
+	dbPath := flag.String("db", defaultDatabase(), "path to the lckbx database")
+	username := flag.String("u", defaultUsername(), "username, defaults to $LCKBX_USER or $USER")
+	socket := flag.String("socket", agent.SocketPath(), "path to the lckbx-agent socket, defaults to $LCKBX_AGENT_SOCK")
+	breaches := flag.String("breaches", os.Getenv("LCKBX_BREACHES"), "sorted SHA-1 `FILE` of breached passwords, defaults to $LCKBX_BREACHES or breached.txt next to the database")
+
+	flag.Usage = usage
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := flag.Arg(0)
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		c, err := newClient(*dbPath, *socket, *username, *breaches)
+		if err != nil {
+			fatal(err)
+		}
+
+		err = cmd.run(c, flag.Args()[1:])
+		c.Close()
+
+		if err != nil {
+			fatal(err)
+		}
+
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "lckbx: unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
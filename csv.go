@@ -0,0 +1,278 @@
+package lckbx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// csvColumns maps the column names used by browsers and password managers,
+// in lower case, to the parts of a Login Item. Chrome and Edge export name,
+// url, username, password, and note, Firefox exports url, username,
+// password, and timestamps in milliseconds, and Safari and Bitwarden use
+// their own names for the same columns.
+var csvColumns = map[string]string{
+	"name":                "name",
+	"title":               "name",
+	"url":                 "url",
+	"uri":                 "url",
+	"website":             "url",
+	"login_uri":           "url",
+	"username":            "username",
+	"login_username":      "username",
+	"password":            "password",
+	"login_password":      "password",
+	"note":                "notes",
+	"notes":               "notes",
+	"extra":               "notes",
+	"folder":              "folder",
+	"grouping":            "folder",
+	"group":               "folder",
+	"tags":                "tags",
+	"timecreated":         "created",
+	"timepasswordchanged": "modified",
+}
+
+// csvIgnored lists the columns that only matter to the program that wrote
+// the file.
+var csvIgnored = map[string]bool{
+	"guid":             true,
+	"httprealm":        true,
+	"formactionorigin": true,
+	"timelastused":     true,
+	"reprompt":         true,
+	"favorite":         true,
+	"type":             true,
+}
+
+// readCSVHeader reads the first row of the file and returns the name of
+// each column and the part of a Login Item it holds, which is empty for
+// columns that have no place in one.
+func readCSVHeader(r *csv.Reader) ([]string, []string, error) {
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a CSV export")
+	}
+
+	columns := make([]string, len(header))
+	for n, name := range header {
+		name = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		header[n] = name
+
+		if to, ok := csvColumns[strings.ToLower(name)]; ok {
+			columns[n] = to
+		}
+	}
+
+	return header, columns, nil
+}
+
+// newCSVReader returns a reader that allows quotes inside unquoted fields,
+// which some browsers write in notes.
+func newCSVReader(data []byte) *csv.Reader {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.LazyQuotes = true
+
+	return r
+}
+
+// csvTime reads a timestamp in milliseconds since the Unix epoch.
+func csvTime(value string) time.Time {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms <= 0 {
+		return time.Time{}
+	}
+
+	return time.UnixMilli(ms)
+}
+
+// csvImporter reads CSV files exported by browsers, and any other CSV file
+// with a password column. Each row becomes a Login Item. Rows without a
+// name are named after the host of their URL, and columns that have no
+// place in a Login become "column: value" lines in its notes.
+type csvImporter struct{}
+
+// Detect reports whether the first row of the data names a password
+// column.
+func (csvImporter) Detect(data []byte) bool {
+	_, columns, err := readCSVHeader(newCSVReader(data))
+	if err != nil {
+		return false
+	}
+
+	for _, to := range columns {
+		if to == "password" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encrypted reports false, since CSV files are not encrypted.
+func (csvImporter) Encrypted(data []byte) bool {
+	return false
+}
+
+// Read converts every row after the header. Rows with the wrong number of
+// columns and rows that are empty are reported.
+func (csvImporter) Read(data []byte, opts ImportOptions) ([]ImportEntry, []ImportFailure, error) {
+	r := newCSVReader(data)
+
+	header, columns, err := readCSVHeader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []ImportEntry
+	var failures []ImportFailure
+
+	for row := 2; ; row++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+
+		entryName := fmt.Sprintf("row %d", row)
+
+		if errors.Is(err, csv.ErrFieldCount) {
+			failures = append(failures, ImportFailure{Entry: entryName, Reason: "wrong number of columns"})
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+
+		e := ImportEntry{Item: NewItem(LoginType)}
+		l := e.Item.Login
+
+		var extra []string
+		empty := true
+
+		for n, value := range record {
+			if strings.TrimSpace(value) == "" {
+				continue
+			}
+
+			name := header[n]
+
+			switch columns[n] {
+			case "name":
+				e.Item.Name = value
+			case "url":
+				l.URLs = append(l.URLs, strings.TrimSpace(value))
+			case "username":
+				l.Username = value
+			case "password":
+				l.Password = value
+			case "notes":
+				e.Item.Data = []byte(value)
+			case "folder":
+				e.Folder = strings.Split(value, "/")
+			case "tags":
+				e.Tags = strings.Split(value, ",")
+			case "created":
+				e.Created = csvTime(value)
+			case "modified":
+				e.Modified = csvTime(value)
+			default:
+				if csvIgnored[strings.ToLower(name)] {
+					continue
+				}
+
+				extra = append(extra, name+": "+value)
+				e.mapField(name, "notes")
+				empty = false
+				continue
+			}
+
+			e.mapField(name, columns[n])
+			if columns[n] != "created" && columns[n] != "modified" && columns[n] != "tags" {
+				empty = false
+			}
+		}
+
+		if empty {
+			failures = append(failures, ImportFailure{Entry: entryName, Reason: "row is empty"})
+			continue
+		}
+
+		e.Item.Data = []byte(importNotes(string(e.Item.Data), extra))
+
+		if e.Item.Name == "" && len(l.URLs) > 0 {
+			if u, err := url.Parse(l.URLs[0]); err == nil && u.Hostname() != "" {
+				e.Item.Name = u.Hostname()
+			} else {
+				e.Item.Name = l.URLs[0]
+			}
+		}
+
+		e.Entry = e.Item.Name
+		if e.Entry == "" {
+			e.Entry = entryName
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, failures, nil
+}
+
+// csvExportColumns are the columns written by writeCSV. They are the columns
+// exported by Chrome, followed by the Folder, tags, and type of each Item.
+var csvExportColumns = []string{"name", "url", "username", "password", "note", "folder", "tags", "type"}
+
+// writeCSV writes a row for each Item. A Login fills the url, username, and
+// password columns, and any other URLs are added to its notes as "url:"
+// lines. The other kinds of Item have their fields written to the notes as
+// text, the same as FormatText.
+func writeCSV(items []exportItem) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	err := w.Write(csvExportColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, ei := range items {
+		item := ei.item()
+		notes := item.FormatText()
+
+		var link, username, password string
+		if l := item.Login; l != nil {
+			username, password = l.Username, l.Password
+
+			var extra []string
+			for n, u := range l.URLs {
+				if n == 0 {
+					link = u
+					continue
+				}
+
+				extra = append(extra, "url: "+u)
+			}
+
+			notes = importNotes(string(item.Data), extra)
+		}
+
+		err = w.Write([]string{item.Name, link, username, password, notes, ei.Folder, strings.Join(ei.Tags, ","), string(item.Type)})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
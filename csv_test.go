@@ -0,0 +1,64 @@
+package lckbx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCSV(t *testing.T) {
+	fmt.Println(t.Name())
+
+	imp := csvImporter{}
+
+	chrome := "\ufeffname,url,username,password,note\n" +
+		"GitHub,https://github.com/login,octocat,hunter2,\"Has \"\"quotes\"\"\"\n" +
+		",https://mail.example.com/,alice,secret,\n" +
+		",,,,\n" +
+		"Short,https://short.example.com\n"
+
+	firefox := "\"url\",\"username\",\"password\",\"httpRealm\",\"formActionOrigin\",\"guid\",\"timeCreated\",\"timeLastUsed\",\"timePasswordChanged\"\n" +
+		"\"https://example.com\",\"bob\",\"pw\",,\"https://example.com\",\"{abc}\",\"1614298956000\",\"1614298956000\",\"1635346445000\"\n"
+
+	if !imp.Detect([]byte(chrome)) || !imp.Detect([]byte(firefox)) || imp.Encrypted([]byte(chrome)) {
+		t.Fatal("Expected unencrypted CSV exports")
+	}
+
+	if imp.Detect([]byte("name,notes\nMy Note,text\n")) {
+		t.Fatal("Expected CSV without a password column to be rejected")
+	}
+
+	entries, failures, err := imp.Read([]byte(chrome), ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var reasons []string
+	for _, f := range failures {
+		reasons = append(reasons, f.Entry+": "+f.Reason)
+	}
+
+	expected := "row 4: row is empty|row 5: wrong number of columns"
+	if len(entries) != 2 || strings.Join(reasons, "|") != expected {
+		t.Fatalf("Expected 2 entries and %s, received %d and %s", expected, len(entries), strings.Join(reasons, "|"))
+	}
+
+	github := entries[0].Item
+	if github.Name != "GitHub" || github.Login.Username != "octocat" || github.Login.Password != "hunter2" || string(github.Data) != `Has "quotes"` {
+		t.Fatalf("Expected the GitHub login, received %+v", github)
+	}
+
+	if entries[1].Item.Name != "mail.example.com" {
+		t.Fatalf("Expected the name from the URL, received %q", entries[1].Item.Name)
+	}
+
+	entries, _, err = imp.Read([]byte(firefox), ImportOptions{})
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("Expected 1 entry, received %d and %v", len(entries), err)
+	}
+
+	bob := entries[0]
+	if bob.Item.Name != "example.com" || len(bob.Item.Data) != 0 || bob.Created.Unix() != 1614298956 || bob.Modified.Unix() != 1635346445 {
+		t.Fatalf("Expected the Firefox login with its timestamps, received %+v", bob)
+	}
+}
@@ -1,14 +1,124 @@
 package lckbx
 
+import (
+	"fmt"
+	"time"
+)
+
 const (
-	minPassphraseLength      = 16
-	argonBlakeDeriverVersion = "vt_W5BREZKAIEU4PZEWSZEHYFS53UNZD43ONKWOODRA2L2DZDIS5DYA"
+	minPassphraseLength            = 16
+	argonBlakeDeriverVersion       = "vt_W5BREZKAIEU4PZEWSZEHYFS53UNZD43ONKWOODRA2L2DZDIS5DYA"
+	argonBlake3x128DeriverVersion  = "vt_ZYJHHUEOFRGL554APN4SY6QGNUE7CHWF7PQOBADPA2S47JIBN4LQ"
+	argonBlake3x256DeriverVersion  = "vt_JRZ4RQDIFAJKA6MMZB4QJFZGV5PONBCTG7GBBFPZTDU5OPNKGGNQ"
+	argonBlake3x512DeriverVersion  = "vt_ZWFODPAFGB2K7K7IACM3S5Y6XSMSEJTWKKNXT2NFKO4XP2GOQ6CA"
+	argonBlake3x1024DeriverVersion = "vt_GD6CUCJP26VBXGKYCYKU55C5JUIPLFQAXVLGQDJMKIAAZMYAGMUQ"
+	argonBlake6x1024DeriverVersion = "vt_YX56FW6AZ2K4AYOD3OEZQRE7SOFTEFNO2ZDISDPKTJV56VI3GPWQ"
 )
 
+// argonBlakeParams are the Argon2 parameters of an argonBlake deriver
+// version. The memory is in KiB.
+type argonBlakeParams struct {
+	version string
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// argonBlakeVersions lists the argonBlake deriver versions from the
+// cheapest to the most expensive. Each one takes about twice as long as the
+// one before it. The first is the version every user was registered with
+// before the parameters could be changed.
+var argonBlakeVersions = []argonBlakeParams{
+	{argonBlakeDeriverVersion, 3, 64 * 1024, 4},
+	{argonBlake3x128DeriverVersion, 3, 128 * 1024, 4},
+	{argonBlake3x256DeriverVersion, 3, 256 * 1024, 4},
+	{argonBlake3x512DeriverVersion, 3, 512 * 1024, 4},
+	{argonBlake3x1024DeriverVersion, 3, 1024 * 1024, 4},
+	{argonBlake6x1024DeriverVersion, 6, 1024 * 1024, 4},
+}
+
+// deriverRank returns the position of the version in argonBlakeVersions,
+// and false if the version is unknown.
+func deriverRank(version VersionToken) (int, bool) {
+	for n, p := range argonBlakeVersions {
+		if p.version == version.String() {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
 // NewDeriver returns a deriver based on the VersionToken provided.
 func NewDeriver(version VersionToken) deriver {
-	switch version.String() {
+	switch n, ok := deriverRank(version); {
+	case ok:
+		return newArgonBlakeWithParams(argonBlakeVersions[n])
 	default:
 		return newArgonBlake()
 	}
 }
+
+// DescribeDeriver returns the parameters of the deriver version in a form
+// suitable for printing.
+func DescribeDeriver(version VersionToken) string {
+	n, ok := deriverRank(version)
+	if !ok {
+		return "unknown deriver"
+	}
+
+	p := argonBlakeVersions[n]
+
+	return fmt.Sprintf("Argon2id, %d passes over %d MiB with %d threads", p.time, p.memory/1024, p.threads)
+}
+
+// Calibrate Deriver
+//  1. Go through the deriver versions from the cheapest to the most
+//     expensive, stopping before one that is expected to take longer than
+//     the target.
+//  2. Time the derivation of a BaseKey, stopping if it took longer than the
+//     target.
+//  3. Return the last version that did not, and how long it took.
+//
+// The first version is returned even if it takes longer than the target, so
+// that calibrating never chooses weaker parameters than the original ones.
+func CalibrateDeriver(target time.Duration) (VersionToken, time.Duration, error) {
+	var chosen VersionToken
+	var took time.Duration
+
+	for n, p := range argonBlakeVersions {
+		// 1.  Stop before a version that is expected to take longer than the
+		//     target. The time grows with the passes times the memory.
+		if n > 0 {
+			last := argonBlakeVersions[n-1]
+			cost := float64(p.time) * float64(p.memory) / (float64(last.time) * float64(last.memory))
+			if time.Duration(float64(took)*cost) > target {
+				break
+			}
+		}
+
+		// 2.  Time the derivation of a BaseKey.
+		start := time.Now()
+		_, err := newArgonBlakeWithParams(p).DeriveBaseKey("calibrate", "calibrate the deriver")
+		if err != nil {
+			return chosen, took, fmt.Errorf("could not CalibrateDeriver: %v", err)
+		}
+		elapsed := time.Since(start)
+
+		// Stop if it took longer than the target.
+		if n > 0 && elapsed > target {
+			break
+		}
+
+		// 3.  Remember the last version that did not take too long.
+		version, err := parseVersionToken(p.version)
+		if err != nil {
+			return chosen, took, fmt.Errorf("could not CalibrateDeriver: %v", err)
+		}
+
+		chosen = version
+		took = elapsed
+	}
+
+	return chosen, took, nil
+}
@@ -2,7 +2,9 @@ package lckbx
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 var (
@@ -18,6 +20,8 @@ func TestDeriver(t *testing.T) {
 
 	// Test NewDeriver after all derivers have been tested.
 	t.Run("Test NewDeriver", testNewDeriver)
+	t.Run("Test Deriver Versions", testDeriverVersions)
+	t.Run("Test CalibrateDeriver", testCalibrateDeriver)
 }
 
 func testNewDeriver(t *testing.T) {
@@ -31,3 +35,69 @@ func testNewDeriver(t *testing.T) {
 		t.Fatal("Expected", argonBlakeBaseKey, ", received", bk.String())
 	}
 }
+
+func testDeriverVersions(t *testing.T) {
+	fmt.Println(t.Name())
+
+	// Each version is more expensive than the one before it.
+	for n, p := range argonBlakeVersions[1:] {
+		last := argonBlakeVersions[n]
+		if uint64(p.time)*uint64(p.memory) <= uint64(last.time)*uint64(last.memory) {
+			t.Fatalf("Expected %s to be more expensive than %s", p.version, last.version)
+		}
+	}
+
+	// A version with different parameters derives a different BaseKey, but
+	// the same keys from a BaseKey.
+	original, _ := parseVersionToken(argonBlakeDeriverVersion)
+	upgraded, _ := parseVersionToken(argonBlake3x128DeriverVersion)
+
+	bk, err := NewDeriver(upgraded).DeriveBaseKey(deriveUsername, deriveGoodPassword)
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	if bk.String() == argonBlakeBaseKey {
+		t.Fatal("Expected a different BaseKey, received", bk.String())
+	}
+
+	ak, _ := NewDeriver(original).DeriveAuthKey(bk)
+	ak2, _ := NewDeriver(upgraded).DeriveAuthKey(bk)
+	if ak != ak2 {
+		t.Fatal("Expected", ak.String(), ", received", ak2.String())
+	}
+
+	if d := DescribeDeriver(upgraded); !strings.Contains(d, "128 MiB") {
+		t.Fatal("Expected 128 MiB, received", d)
+	}
+
+	if d := DescribeDeriver(NewVersionToken()); d != "unknown deriver" {
+		t.Fatal("Expected unknown deriver, received", d)
+	}
+}
+
+func testCalibrateDeriver(t *testing.T) {
+	fmt.Println(t.Name())
+
+	// The original version is chosen even when it takes longer than the
+	// target.
+	version, took, err := CalibrateDeriver(time.Millisecond)
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	if version.String() != argonBlakeDeriverVersion || took <= 0 {
+		t.Fatal("Expected", argonBlakeDeriverVersion, ", received", version.String(), took)
+	}
+
+	// A longer target chooses a version that takes no longer than it.
+	target := 4 * took
+	version, took, err = CalibrateDeriver(target)
+	if err != nil {
+		t.Fatal("Expected no error, received", err)
+	}
+
+	if _, ok := deriverRank(version); !ok || took > target {
+		t.Fatal("Expected a known version within", target, ", received", version.String(), took)
+	}
+}
@@ -0,0 +1,112 @@
+package lckbx
+
+import (
+	"strings"
+)
+
+// DiffOp describes how a line changed between two texts.
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = " "
+	DiffDelete DiffOp = "-"
+	DiffInsert DiffOp = "+"
+)
+
+// DiffLine is a single line of a Diff.
+type DiffLine struct {
+	Op   DiffOp
+	Text string
+}
+
+// Diff is the list of lines that changed, and did not change, between two
+// texts.
+type Diff []DiffLine
+
+// Changed reports whether any line was deleted or inserted.
+func (d Diff) Changed() bool {
+	for _, line := range d {
+		if line.Op != DiffEqual {
+			return true
+		}
+	}
+
+	return false
+}
+
+// String returns the Diff with each line prefixed by its DiffOp.
+func (d Diff) String() string {
+	var b strings.Builder
+
+	for _, line := range d {
+		b.WriteString(string(line.Op))
+		b.WriteString(line.Text)
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+// splitLines splits the text into lines without the trailing newline.
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+
+	return strings.Split(s, "\n")
+}
+
+// diffText compares two texts line by line using the longest common
+// subsequence of their lines. Items are small, so the quadratic table is
+// not a concern.
+func diffText(from, to string) Diff {
+	a := splitLines(from)
+	b := splitLines(to)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff Diff
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{DiffEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, DiffLine{DiffDelete, a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{DiffInsert, b[j]})
+			j++
+		}
+	}
+
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{DiffDelete, a[i]})
+	}
+
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{DiffInsert, b[j]})
+	}
+
+	return diff
+}
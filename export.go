@@ -0,0 +1,434 @@
+package lckbx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	exportMagic   = "lckbx export"
+	exportVersion = 1
+)
+
+// The formats an UnlockedBox can be exported to. Every format except
+// ExportAge is written in plaintext.
+const (
+	ExportJSON     = "json"
+	ExportCSV      = "csv"
+	ExportMarkdown = "markdown"
+	ExportAge      = "age"
+)
+
+// ExportFormats lists every export format.
+var ExportFormats = []string{ExportAge, ExportCSV, ExportJSON, ExportMarkdown}
+
+// ExportOptions control how an export is protected. Plaintext must be set to
+// confirm an export that is not encrypted. An age archive is encrypted with
+// either the Passphrase or the Recipients, which are age X25519 public keys.
+type ExportOptions struct {
+	Plaintext  bool     `json:",omitempty"`
+	Passphrase string   `json:",omitempty"`
+	Recipients []string `json:",omitempty"`
+}
+
+// exportContent is the content of an Item, or of one of its Revisions. The
+// Data is written as Notes when it is text.
+type exportContent struct {
+	Type     ItemType
+	Name     string
+	Notes    string        `json:",omitempty"`
+	Data     []byte        `json:",omitempty"`
+	Login    *LoginItem    `json:",omitempty"`
+	Card     *CardItem     `json:",omitempty"`
+	Identity *IdentityItem `json:",omitempty"`
+	OTP      *OTPItem      `json:",omitempty"`
+}
+
+// newExportContent returns the content of the Item.
+func newExportContent(i Item) exportContent {
+	c := exportContent{
+		Type:     i.Type,
+		Name:     i.Name,
+		Login:    i.Login,
+		Card:     i.Card,
+		Identity: i.Identity,
+		OTP:      i.OTP,
+	}
+
+	if utf8.Valid(i.Data) {
+		c.Notes = string(i.Data)
+	} else {
+		c.Data = i.Data
+	}
+
+	return c
+}
+
+// item returns the content as a new Item.
+func (c exportContent) item() Item {
+	i := Item{
+		ItemId:   NewItemToken(),
+		Type:     c.Type,
+		Name:     c.Name,
+		Data:     c.Data,
+		Login:    c.Login,
+		Card:     c.Card,
+		Identity: c.Identity,
+		OTP:      c.OTP,
+	}
+
+	if c.Notes != "" {
+		i.Data = []byte(c.Notes)
+	}
+
+	return i
+}
+
+// exportRevision is a Revision of an exported Item.
+type exportRevision struct {
+	Created time.Time
+	exportContent
+}
+
+// exportItem is an Item with everything stored about it: the path of its
+// Folder, its tags and timestamps, its Attachments, and its Revisions,
+// oldest first.
+type exportItem struct {
+	exportContent
+	Folder      string   `json:",omitempty"`
+	Tags        []string `json:",omitempty"`
+	Created     time.Time
+	Modified    time.Time
+	Accessed    time.Time
+	Trashed     *time.Time         `json:",omitempty"`
+	Attachments []ImportAttachment `json:",omitempty"`
+	Revisions   []exportRevision   `json:",omitempty"`
+}
+
+// exportFile is the JSON export of a box. It holds every Item, including
+// the Items in the trash, and every Folder and tag, including the ones that
+// are empty. Tokens are not exported, so the file can be imported into any
+// box.
+type exportFile struct {
+	Format   string
+	Version  int
+	Exported time.Time
+	Folders  []string `json:",omitempty"`
+	Tags     []string `json:",omitempty"`
+	Items    []exportItem
+}
+
+// active returns the Items that are not in the trash.
+func (f *exportFile) active() []exportItem {
+	var items []exportItem
+
+	for _, i := range f.Items {
+		if i.Trashed == nil {
+			items = append(items, i)
+		}
+	}
+
+	return items
+}
+
+// exportData decrypts every Item in the box, with its Attachments and
+// Revisions, sorted by Folder and name. Unlike GetItem, the time the Items
+// were read is not saved.
+func (u *UnlockedBox) exportData() (exportFile, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	f := exportFile{
+		Format:   exportMagic,
+		Version:  exportVersion,
+		Exported: time.Now().UTC(),
+		Tags:     append([]string{}, u.metadata.Tags...),
+	}
+
+	for _, folder := range u.metadata.Folders {
+		f.Folders = append(f.Folders, u.metadata.FolderPath(folder.FolderId))
+	}
+	sort.Strings(f.Folders)
+
+	for _, imd := range u.metadata.GetItems() {
+		item, _, err := u.loadItem(imd)
+		if err != nil {
+			return f, fmt.Errorf("item %q: %v", imd.Name, err)
+		}
+
+		ei := exportItem{
+			exportContent: newExportContent(item),
+			Folder:        u.metadata.FolderPath(imd.Folder),
+			Tags:          imd.Tags,
+			Created:       imd.Created.UTC(),
+			Modified:      imd.Modified.UTC(),
+			Accessed:      imd.Accessed.UTC(),
+			Trashed:       imd.Trashed,
+		}
+
+		for _, amd := range imd.Attachments {
+			var data bytes.Buffer
+
+			_, err := u.writeAttachment(u.store, imd.ItemId, amd, &data)
+			if err != nil {
+				return f, fmt.Errorf("attachment %q of %q: %v", amd.Name, imd.Name, err)
+			}
+
+			ei.Attachments = append(ei.Attachments, ImportAttachment{Name: amd.Name, Data: data.Bytes()})
+		}
+
+		for _, rmd := range imd.Revisions {
+			rev, _, err := u.loadRevision(u.store, imd.ItemId, rmd)
+			if err != nil {
+				return f, fmt.Errorf("revision of %q: %v", imd.Name, err)
+			}
+
+			ei.Revisions = append(ei.Revisions, exportRevision{
+				Created:       rev.Created.UTC(),
+				exportContent: newExportContent(rev.Item),
+			})
+		}
+
+		sort.SliceStable(ei.Revisions, func(i, j int) bool {
+			return ei.Revisions[i].Created.Before(ei.Revisions[j].Created)
+		})
+
+		f.Items = append(f.Items, ei)
+	}
+
+	sort.SliceStable(f.Items, func(i, j int) bool {
+		a, b := f.Items[i], f.Items[j]
+		if a.Folder != b.Folder {
+			return a.Folder < b.Folder
+		}
+
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+
+		return a.Created.Before(b.Created)
+	})
+
+	return f, nil
+}
+
+// checkPlaintext ensures a plaintext export has been confirmed.
+func (opts ExportOptions) checkPlaintext(format string) error {
+	if !opts.Plaintext {
+		return fmt.Errorf("the %s export is not encrypted and must be confirmed", format)
+	}
+
+	return nil
+}
+
+// Export writes every Item in the box in the given format.
+//   - json holds everything in the box, including the Items in the trash,
+//     Attachments, Revisions, and empty Folders and tags, and can be
+//     imported again without losing anything with the lckbx Importer.
+//   - csv holds one row for each Item that is not in the trash, in the
+//     columns read by browsers and the csv Importer.
+//   - age is a tar archive of the json export and the Markdown files,
+//     encrypted with age to a passphrase or to X25519 recipients.
+//
+// The json and csv formats are plaintext and must be confirmed with the
+// Plaintext option. ExportMarkdown writes the Markdown files to a directory.
+func (u *UnlockedBox) Export(format string, opts ExportOptions) ([]byte, error) {
+	var data []byte
+
+	switch format {
+	case ExportJSON, ExportCSV:
+		err := opts.checkPlaintext(format)
+		if err != nil {
+			return nil, fmt.Errorf("could not UnlockedBox.Export: %v", err)
+		}
+	case ExportAge:
+		_, err := opts.ageRecipients()
+		if err != nil {
+			return nil, fmt.Errorf("could not UnlockedBox.Export: %v", err)
+		}
+	case ExportMarkdown:
+		return nil, fmt.Errorf("could not UnlockedBox.Export: markdown is exported to a directory")
+	default:
+		return nil, fmt.Errorf("could not UnlockedBox.Export: unknown export format %q", format)
+	}
+
+	f, err := u.exportData()
+	if err != nil {
+		return nil, fmt.Errorf("could not UnlockedBox.Export: %v", err)
+	}
+
+	switch format {
+	case ExportJSON:
+		data, err = json.MarshalIndent(f, "", "\t")
+	case ExportCSV:
+		data, err = writeCSV(f.active())
+	case ExportAge:
+		data, err = sealArchive(f, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not UnlockedBox.Export: %v", err)
+	}
+
+	return data, nil
+}
+
+// ExportMarkdown writes every Item that is not in the trash to a new
+// directory as a Markdown file, in a directory for each Folder. The
+// Attachments of an Item are written next to its file. The files are
+// plaintext, so the export must be confirmed with the Plaintext option.
+func (u *UnlockedBox) ExportMarkdown(dir string, opts ExportOptions) error {
+	err := opts.checkPlaintext(ExportMarkdown)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportMarkdown: %v", err)
+	}
+
+	f, err := u.exportData()
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportMarkdown: %v", err)
+	}
+
+	err = os.Mkdir(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.ExportMarkdown: %v", err)
+	}
+
+	for _, mf := range markdownFiles(f) {
+		path := filepath.Join(dir, filepath.FromSlash(mf.Path))
+
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+		if err == nil {
+			err = writeNewFile(path, mf.Data)
+		}
+
+		if err != nil {
+			os.RemoveAll(dir)
+			return fmt.Errorf("could not UnlockedBox.ExportMarkdown: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// readExportFile reads a JSON export.
+func readExportFile(data []byte) (exportFile, error) {
+	var f exportFile
+
+	err := json.Unmarshal(data, &f)
+	if err != nil || f.Format != exportMagic {
+		return f, fmt.Errorf("not an lckbx export")
+	}
+
+	if f.Version > exportVersion {
+		return f, fmt.Errorf("lckbx export version %d is newer than %d", f.Version, exportVersion)
+	}
+
+	return f, nil
+}
+
+// lckbxImporter reads the JSON export written by Export, either as it is or
+// inside an age archive. Every Item is imported with its Folder, tags,
+// timestamps, Attachments, and Revisions, Items in the trash are imported
+// into the trash, and empty Folders and tags are created.
+type lckbxImporter struct{}
+
+// Detect reports whether the data is a JSON export or an age archive.
+func (lckbxImporter) Detect(data []byte) bool {
+	if isAgeArchive(data) {
+		return true
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		return false
+	}
+
+	_, err := readExportFile(trimmed)
+	return err == nil
+}
+
+// Encrypted reports whether the data is an age archive encrypted with a
+// passphrase. Archives encrypted to a recipient are opened with the key
+// file holding its identity.
+func (lckbxImporter) Encrypted(data []byte) bool {
+	return isAgeArchive(data) && agePassphraseArchive(data)
+}
+
+// Read returns an entry for every Item in the export, followed by an entry
+// for each Folder and one for the tags.
+func (lckbxImporter) Read(data []byte, opts ImportOptions) ([]ImportEntry, []ImportFailure, error) {
+	if isAgeArchive(data) {
+		var err error
+
+		data, err = openArchive(data, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	f, err := readExportFile(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var entries []ImportEntry
+
+	for _, ei := range f.Items {
+		e := ImportEntry{
+			Item:        ei.item(),
+			Tags:        ei.Tags,
+			Attachments: ei.Attachments,
+			Created:     ei.Created,
+			Modified:    ei.Modified,
+			Accessed:    ei.Accessed,
+		}
+
+		if ei.Folder != "" {
+			e.Folder = strings.Split(ei.Folder, "/")
+		}
+
+		e.Entry = strings.Join(append(append([]string{}, e.Folder...), ei.Name), "/")
+
+		if ei.Trashed != nil {
+			e.Trashed = *ei.Trashed
+			e.mapField("trashed", "trash")
+		}
+
+		for _, er := range ei.Revisions {
+			e.Revisions = append(e.Revisions, Revision{Created: er.Created, Item: er.item()})
+		}
+
+		e.mapField("name", "name")
+		e.mapField(string(ei.Type), string(ei.Type))
+
+		if ei.Notes != "" || len(ei.Data) != 0 {
+			e.mapField("notes", "notes")
+		}
+
+		if len(ei.Attachments) != 0 {
+			e.mapField("attachments", "attachments")
+		}
+
+		if len(ei.Revisions) != 0 {
+			e.mapField("revisions", "revisions")
+		}
+
+		entries = append(entries, e)
+	}
+
+	for _, path := range f.Folders {
+		entries = append(entries, ImportEntry{Entry: path, Folder: strings.Split(path, "/")})
+	}
+
+	if len(f.Tags) != 0 {
+		entries = append(entries, ImportEntry{Entry: "tags", Tags: f.Tags})
+	}
+
+	return entries, nil, nil
+}
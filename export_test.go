@@ -0,0 +1,330 @@
+package lckbx
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+)
+
+var (
+	exportDB       = "export_test.db"
+	exportUser     = "export_user"
+	exportCopyUser = "export_copy_user"
+	exportDir      = "export_test_markdown"
+)
+
+func TestExport(t *testing.T) {
+	store, err := NewStore(exportDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(exportDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, user := range []string{exportUser, exportCopyUser} {
+		err = lb.Register(user, lockedBoxGoodPassword)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+
+	ub, err := lb.login(exportUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	fillExportBox(t, &ub)
+
+	t.Run("Test Export JSON Round Trip", func(t *testing.T) { testExportRoundTrip(t, &lb, &ub) })
+	t.Run("Test Export Plaintext", func(t *testing.T) { testExportPlaintext(t, &ub) })
+	t.Run("Test Export Age", func(t *testing.T) { testExportAge(t, &ub) })
+}
+
+// fillExportBox adds an Item of every type to the box, with nested and
+// empty Folders, tags, an Attachment, a Revision, and an Item in the trash.
+func fillExportBox(t *testing.T, ub *UnlockedBox) {
+	check := func(err error) {
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+
+	work, err := ub.CreateFolder("Work", FolderToken{})
+	check(err)
+	email, err := ub.CreateFolder("Email", work)
+	check(err)
+	_, err = ub.CreateFolder("Empty", FolderToken{})
+	check(err)
+	check(ub.CreateTag("unused"))
+
+	login := NewItem(LoginType)
+	login.Name = "GitHub"
+	login.Data = []byte("Recovery codes are attached.")
+	login.Login.Username = "octocat"
+	login.Login.Password = "old `password`"
+	login.Login.URLs = []string{"https://github.com/login", "https://github.com"}
+	check(ub.AddItem(login))
+	check(ub.MoveItem(login.ItemId, email))
+	check(ub.TagItem(login.ItemId, "dev"))
+	_, err = ub.AddAttachment(login.ItemId, "codes.txt", strings.NewReader("1234-5678"))
+	check(err)
+
+	login.Login.Password = "new `password`"
+	check(ub.UpdateItem(login))
+
+	card := NewItem(CardType)
+	card.Name = "Visa"
+	card.Card.Number = "4111111111111111"
+	card.Card.Expiry = "03/2030"
+	check(ub.AddItem(card))
+	check(ub.MoveItem(card.ItemId, work))
+
+	identity := NewItem(IdentityType)
+	identity.Name = "Me"
+	identity.Identity.FirstName = "Alice"
+	check(ub.AddItem(identity))
+
+	otp := NewItem(OTPType)
+	otp.Name = "Bank"
+	otp.OTP.Kind = HOTPKind
+	otp.OTP.Secret = "JBSWY3DPEHPK3PXP"
+	otp.OTP.Counter = 5
+	check(ub.AddItem(otp))
+
+	binary := NewItem(SecureNoteType)
+	binary.Name = "Binary"
+	binary.Data = []byte{0xff, 0x00, 0xfe}
+	check(ub.AddItem(binary))
+
+	old := NewItem(SecureNoteType)
+	old.Name = "Old"
+	old.Data = []byte("Deleted.")
+	check(ub.AddItem(old))
+	check(ub.DeleteItem(old.ItemId))
+}
+
+// exportJSON exports the box as JSON with the export time removed, so that
+// two exports can be compared.
+func exportJSON(t *testing.T, ub *UnlockedBox) []byte {
+	data, err := ub.Export(ExportJSON, ExportOptions{Plaintext: true})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var f exportFile
+	err = json.Unmarshal(data, &f)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	f.Exported = time.Time{}
+	data, _ = json.Marshal(f)
+
+	return data
+}
+
+// End-to-end test for the JSON export
+//  1. Export the box and ensure every Item is in the file.
+//  2. Import the file into another user's box.
+//  3. Export the other box and ensure nothing was lost.
+func testExportRoundTrip(t *testing.T, lb *LockedBox, ub *UnlockedBox) {
+	fmt.Println(t.Name())
+
+	// 1.  Export the box and ensure every Item is in the file.
+	data, err := ub.Export(ExportJSON, ExportOptions{Plaintext: true})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	f, err := readExportFile(data)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(f.Items) != 6 || strings.Join(f.Folders, ",") != "Empty,Work,Work/Email" || strings.Join(f.Tags, ",") != "dev,unused" {
+		t.Fatalf("Expected 6 items, 3 folders, and 2 tags, received %+v", f)
+	}
+
+	github := f.Items[len(f.Items)-1]
+	if github.Name != "GitHub" || len(github.Revisions) != 1 || len(github.Attachments) != 1 || github.Revisions[0].Login.Password != "old `password`" {
+		t.Fatalf("Expected GitHub with a revision and an attachment, received %+v", github)
+	}
+
+	// 2.  Import the file into another user's box.
+	copied, err := lb.login(exportCopyUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer copied.Lock()
+
+	report, err := copied.Import("", data, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if report.Format != "lckbx" || report.Items != 6 || report.Folders != 3 || len(report.Failures) != 0 {
+		t.Fatalf("Expected 6 items in 3 folders, received %+v", report)
+	}
+
+	if len(copied.GetTrashList()) != 1 || len(copied.GetItemList()) != 5 {
+		t.Fatalf("Expected 5 items and 1 in the trash, received %d and %d", len(copied.GetItemList()), len(copied.GetTrashList()))
+	}
+
+	// 3.  Export the other box and ensure nothing was lost.
+	original := exportJSON(t, ub)
+	roundTrip := exportJSON(t, &copied)
+
+	if !bytes.Equal(original, roundTrip) {
+		t.Fatalf("Expected the same export, received\n%s\n%s", original, roundTrip)
+	}
+}
+
+func testExportPlaintext(t *testing.T, ub *UnlockedBox) {
+	fmt.Println(t.Name())
+	defer os.RemoveAll(exportDir)
+
+	for _, format := range []string{ExportJSON, ExportCSV} {
+		_, err := ub.Export(format, ExportOptions{})
+		if err == nil || !strings.Contains(err.Error(), "must be confirmed") {
+			t.Fatalf("Expected the %s export to need confirmation, received %v", format, err)
+		}
+	}
+
+	if err := ub.ExportMarkdown(exportDir, ExportOptions{}); err == nil {
+		t.Fatal("Expected the markdown export to need confirmation, received nil")
+	}
+
+	if _, err := ub.Export("xml", ExportOptions{Plaintext: true}); err == nil {
+		t.Fatal("Expected error for an unknown format, received nil")
+	}
+
+	data, err := ub.Export(ExportCSV, ExportOptions{Plaintext: true})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	entries, failures, err := csvImporter{}.Read(data, ImportOptions{})
+	if err != nil || len(entries) != 5 || len(failures) != 0 {
+		t.Fatalf("Expected 5 rows, received %d, %+v, and %v", len(entries), failures, err)
+	}
+
+	github := entries[len(entries)-1]
+	l := github.Item.Login
+	if l.Password != "new `password`" || strings.Join(l.URLs, " ") != "https://github.com/login" || strings.Join(github.Folder, "/") != "Work/Email" || strings.Join(github.Tags, ",") != "dev" {
+		t.Fatalf("Expected the GitHub row, received %+v", github)
+	}
+
+	if string(github.Item.Data) != "Recovery codes are attached.\n\nurl: https://github.com" {
+		t.Fatalf("Expected the notes with the second URL, received %q", github.Item.Data)
+	}
+
+	err = ub.ExportMarkdown(exportDir, ExportOptions{Plaintext: true})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	md, err := os.ReadFile(filepath.Join(exportDir, "Work", "Email", "GitHub.md"))
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, expected := range []string{"# GitHub\n", "- password: `` new `password` ``\n", "- Tags: dev\n", "[codes.txt](<GitHub.files/codes.txt>)"} {
+		if !strings.Contains(string(md), expected) {
+			t.Fatalf("Expected %q in the markdown, received\n%s", expected, md)
+		}
+	}
+
+	codes, err := os.ReadFile(filepath.Join(exportDir, "Work", "Email", "GitHub.files", "codes.txt"))
+	if err != nil || string(codes) != "1234-5678" {
+		t.Fatalf("Expected the attachment, received %q and %v", codes, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(exportDir, "Old.md")); err == nil {
+		t.Fatal("Expected the item in the trash to be left out")
+	}
+
+	if err := ub.ExportMarkdown(exportDir, ExportOptions{Plaintext: true}); err == nil {
+		t.Fatal("Expected error for an existing directory, received nil")
+	}
+}
+
+func testExportAge(t *testing.T, ub *UnlockedBox) {
+	fmt.Println(t.Name())
+
+	imp := lckbxImporter{}
+
+	id, _ := age.GenerateX25519Identity()
+	other, _ := age.GenerateX25519Identity()
+
+	if _, err := ub.Export(ExportAge, ExportOptions{}); err == nil {
+		t.Fatal("Expected error without a passphrase or recipient, received nil")
+	}
+
+	both := ExportOptions{Passphrase: "export passphrase", Recipients: []string{id.Recipient().String()}}
+	if _, err := ub.Export(ExportAge, both); err == nil {
+		t.Fatal("Expected error for a passphrase and a recipient, received nil")
+	}
+
+	data, err := ub.Export(ExportAge, ExportOptions{Recipients: []string{id.Recipient().String()}})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !imp.Detect(data) || imp.Encrypted(data) {
+		t.Fatal("Expected an archive encrypted to a recipient")
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(data), id)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var names []string
+	tr := tar.NewReader(r)
+	for h, err := tr.Next(); err == nil; h, err = tr.Next() {
+		names = append(names, h.Name)
+	}
+
+	archived := strings.Join(names, ",")
+	if !strings.Contains(archived, "lckbx-export/export.json") || !strings.Contains(archived, "lckbx-export/markdown/Work/Email/GitHub.md") {
+		t.Fatalf("Expected the json and markdown files, received %s", archived)
+	}
+
+	entries, _, err := imp.Read(data, ImportOptions{KeyFile: []byte(id.String() + "\n")})
+	if err != nil || len(entries) != 6+3+1 {
+		t.Fatalf("Expected 6 items, 3 folders, and the tags, received %d and %v", len(entries), err)
+	}
+
+	_, _, err = imp.Read(data, ImportOptions{KeyFile: []byte(other.String())})
+	if err == nil || !strings.Contains(err.Error(), "wrong password or key file") {
+		t.Fatalf("Expected wrong key file, received %v", err)
+	}
+
+	data, err = ub.Export(ExportAge, ExportOptions{Passphrase: "export passphrase"})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !imp.Encrypted(data) {
+		t.Fatal("Expected an archive encrypted with a passphrase")
+	}
+
+	entries, _, err = imp.Read(data, ImportOptions{Password: "export passphrase"})
+	if err != nil || len(entries) != 6+3+1 {
+		t.Fatalf("Expected 6 items, 3 folders, and the tags, received %d and %v", len(entries), err)
+	}
+}
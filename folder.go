@@ -0,0 +1,357 @@
+package lckbx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Folder groups Items, and other Folders, under a name. Folders are stored in
+// the encrypted Metadata, so their names are never written in plaintext. The
+// zero Parent is the top level.
+type Folder struct {
+	FolderId FolderToken
+	Name     string
+	Parent   FolderToken
+}
+
+// validateFolderName ensures a Folder name can be shown as part of a path.
+func validateFolderName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+
+	if name == "" {
+		return name, fmt.Errorf("folder name is empty")
+	}
+
+	if strings.Contains(name, "/") {
+		return name, fmt.Errorf("folder name cannot contain /")
+	}
+
+	return name, nil
+}
+
+// getFolder returns the Folder with the given FolderToken.
+func (m *Metadata) getFolder(fid FolderToken) (Folder, error) {
+	f, ok := m.Folders[fid.String()]
+	if !ok {
+		return f, fmt.Errorf("folder not found")
+	}
+
+	return f, nil
+}
+
+// hasFolder reports whether the FolderToken is the top level or a Folder in
+// the Metadata.
+func (m *Metadata) hasFolder(fid FolderToken) bool {
+	if fid == (FolderToken{}) {
+		return true
+	}
+
+	_, ok := m.Folders[fid.String()]
+
+	return ok
+}
+
+// checkFolderName ensures no other Folder with the same parent has the
+// given name, so every Folder has a unique path.
+func (m *Metadata) checkFolderName(fid, parent FolderToken, name string) error {
+	for _, f := range m.Folders {
+		if f.FolderId != fid && f.Parent == parent && f.Name == name {
+			return fmt.Errorf("folder %q already exists", name)
+		}
+	}
+
+	return nil
+}
+
+// FolderPath returns the names of the Folder and its parents joined with /.
+// The top level is an empty path.
+func (m *Metadata) FolderPath(fid FolderToken) string {
+	var names []string
+
+	// A Folder can have no more parents than there are Folders, which
+	// guards against a cycle in a damaged Metadata.
+	for n := 0; n <= len(m.Folders) && fid != (FolderToken{}); n++ {
+		f, err := m.getFolder(fid)
+		if err != nil {
+			break
+		}
+
+		names = append([]string{f.Name}, names...)
+		fid = f.Parent
+	}
+
+	return strings.Join(names, "/")
+}
+
+// isWithin reports whether the Folder fid is the Folder ancestor or is
+// inside it.
+func (m *Metadata) isWithin(fid, ancestor FolderToken) bool {
+	for n := 0; n <= len(m.Folders); n++ {
+		if fid == ancestor {
+			return true
+		}
+
+		if fid == (FolderToken{}) {
+			return false
+		}
+
+		f, err := m.getFolder(fid)
+		if err != nil {
+			return false
+		}
+
+		fid = f.Parent
+	}
+
+	return false
+}
+
+// organize applies a change to the Folders, Tags, and ItemMetadata and saves
+// the Metadata. The Metadata is put back the way it was if the change fails
+// or the Metadata cannot be saved. The change must replace ItemMetadata
+// rather than modify the slices they hold.
+func (u *UnlockedBox) organize(change func() error) error {
+	folders := make(map[string]Folder)
+	for key, f := range u.metadata.Folders {
+		folders[key] = f
+	}
+
+	tags := append([]string{}, u.metadata.Tags...)
+
+	items := make(map[string]ItemMetadata)
+	for key, imd := range u.metadata.Items {
+		items[key] = imd
+	}
+
+	err := change()
+	if err == nil {
+		err = u.store.Update(u.saveMetadata)
+	}
+
+	if err != nil {
+		u.metadata.mutex.Lock()
+		u.metadata.Folders = folders
+		u.metadata.Tags = tags
+		u.metadata.Items = items
+		u.metadata.mutex.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// GetFolders returns every Folder, sorted by path.
+func (u *UnlockedBox) GetFolders() []Folder {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	var folders []Folder
+	for _, f := range u.metadata.Folders {
+		folders = append(folders, f)
+	}
+
+	sort.Slice(folders, func(i, j int) bool {
+		return u.metadata.FolderPath(folders[i].FolderId) < u.metadata.FolderPath(folders[j].FolderId)
+	})
+
+	return folders
+}
+
+// GetFolderPath returns the names of the Folder and its parents joined with
+// /. The top level is an empty path.
+func (u *UnlockedBox) GetFolderPath(fid FolderToken) string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.metadata.FolderPath(fid)
+}
+
+// CreateFolder adds a new Folder inside the parent Folder. The zero parent
+// is the top level.
+func (u *UnlockedBox) CreateFolder(name string, parent FolderToken) (FolderToken, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	f := Folder{FolderId: NewFolderToken(), Parent: parent}
+
+	err := u.organize(func() error {
+		var err error
+
+		f.Name, err = validateFolderName(name)
+		if err != nil {
+			return err
+		}
+
+		if !u.metadata.hasFolder(parent) {
+			return fmt.Errorf("parent folder not found")
+		}
+
+		err = u.metadata.checkFolderName(f.FolderId, parent, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if u.metadata.Folders == nil {
+			u.metadata.Folders = make(map[string]Folder)
+		}
+		u.metadata.Folders[f.FolderId.String()] = f
+
+		return nil
+	})
+	if err != nil {
+		return FolderToken{}, fmt.Errorf("could not UnlockedBox.CreateFolder: %v", err)
+	}
+
+	return f.FolderId, nil
+}
+
+// RenameFolder changes the name of a Folder.
+func (u *UnlockedBox) RenameFolder(fid FolderToken, name string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		f, err := u.metadata.getFolder(fid)
+		if err != nil {
+			return err
+		}
+
+		f.Name, err = validateFolderName(name)
+		if err != nil {
+			return err
+		}
+
+		err = u.metadata.checkFolderName(fid, f.Parent, f.Name)
+		if err != nil {
+			return err
+		}
+
+		u.metadata.Folders[fid.String()] = f
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.RenameFolder: %v", err)
+	}
+
+	return nil
+}
+
+// MoveFolder moves a Folder, and everything in it, inside the parent Folder.
+// A Folder cannot be moved inside itself.
+func (u *UnlockedBox) MoveFolder(fid, parent FolderToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		f, err := u.metadata.getFolder(fid)
+		if err != nil {
+			return err
+		}
+
+		if !u.metadata.hasFolder(parent) {
+			return fmt.Errorf("parent folder not found")
+		}
+
+		if u.metadata.isWithin(parent, fid) {
+			return fmt.Errorf("a folder cannot be moved inside itself")
+		}
+
+		err = u.metadata.checkFolderName(fid, parent, f.Name)
+		if err != nil {
+			return err
+		}
+
+		f.Parent = parent
+		u.metadata.Folders[fid.String()] = f
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.MoveFolder: %v", err)
+	}
+
+	return nil
+}
+
+// Delete Folder
+// The DeleteFolder function removes a Folder without deleting anything in
+// it.
+//  1. Move the Items in the Folder, including Items in the trash, to its
+//     parent.
+//  2. Remove the Folder.
+//  3. Move the Folders in the Folder to its parent and save the Metadata.
+func (u *UnlockedBox) DeleteFolder(fid FolderToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		f, err := u.metadata.getFolder(fid)
+		if err != nil {
+			return err
+		}
+
+		// 1.  Move the Items in the Folder to its parent.
+		for _, imd := range u.metadata.GetItems() {
+			if imd.Folder == fid {
+				imd.Folder = f.Parent
+				u.metadata.AddItem(imd)
+			}
+		}
+
+		// 2.  Remove the Folder.
+		delete(u.metadata.Folders, fid.String())
+
+		// 3.  Move the Folders in the Folder to its parent.
+		for key, child := range u.metadata.Folders {
+			if child.Parent != fid {
+				continue
+			}
+
+			err = u.metadata.checkFolderName(child.FolderId, f.Parent, child.Name)
+			if err != nil {
+				return err
+			}
+
+			child.Parent = f.Parent
+			u.metadata.Folders[key] = child
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.DeleteFolder: %v", err)
+	}
+
+	return nil
+}
+
+// MoveItem moves an Item into a Folder. The zero FolderToken moves the Item
+// to the top level.
+func (u *UnlockedBox) MoveItem(iid ItemToken, fid FolderToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		imd, err := u.getItemMetadata(iid)
+		if err != nil {
+			return err
+		}
+
+		if !u.metadata.hasFolder(fid) {
+			return fmt.Errorf("folder not found")
+		}
+
+		imd.Folder = fid
+		u.metadata.AddItem(imd)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.MoveItem: %v", err)
+	}
+
+	return nil
+}
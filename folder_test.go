@@ -0,0 +1,257 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+var (
+	folderDB   = "folder_test.db"
+	folderUser = "folder_user"
+)
+
+func TestFolder(t *testing.T) {
+	store, err := NewStore(folderDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(folderDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(folderUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Folders", func(t *testing.T) { testFolders(t, &lb) })
+	t.Run("Test Folder Items", func(t *testing.T) { testFolderItems(t, &lb) })
+	t.Run("Test Folder Check", func(t *testing.T) { testFolderCheck(t, &lb) })
+}
+
+// createFolder creates a Folder and fails the test on error.
+func createFolder(t *testing.T, ub *UnlockedBox, name string, parent FolderToken) FolderToken {
+	fid, err := ub.CreateFolder(name, parent)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return fid
+}
+
+// End-to-end test for Folders
+//  1. Create nested Folders and ensure their paths.
+//  2. Rename and move a Folder.
+//  3. Ensure invalid names and moves are rejected.
+//  4. Ensure the Folders are saved in the Metadata.
+func testFolders(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(folderUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	// 1.  Create nested Folders and ensure their paths.
+	work := createFolder(t, &ub, "Work", FolderToken{})
+	email := createFolder(t, &ub, " Email ", work)
+	home := createFolder(t, &ub, "Home", FolderToken{})
+
+	if ub.GetFolderPath(email) != "Work/Email" {
+		t.Fatalf("Expected Work/Email, received %s", ub.GetFolderPath(email))
+	}
+
+	// 2.  Rename and move a Folder.
+	err = ub.RenameFolder(work, "Office")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = ub.MoveFolder(email, home)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var paths []string
+	for _, f := range ub.GetFolders() {
+		paths = append(paths, ub.GetFolderPath(f.FolderId))
+	}
+
+	if fmt.Sprint(paths) != "[Home Home/Email Office]" {
+		t.Fatalf("Expected [Home Home/Email Office], received %v", paths)
+	}
+
+	// 3.  Ensure invalid names and moves are rejected.
+	if _, err := ub.CreateFolder("", FolderToken{}); err == nil {
+		t.Fatal("Expected error for an empty name, received nil")
+	}
+
+	if _, err := ub.CreateFolder("a/b", FolderToken{}); err == nil {
+		t.Fatal("Expected error for a name with a /, received nil")
+	}
+
+	if _, err := ub.CreateFolder("Email", home); err == nil {
+		t.Fatal("Expected error for a duplicate name, received nil")
+	}
+
+	if _, err := ub.CreateFolder("Lost", NewFolderToken()); err == nil {
+		t.Fatal("Expected error for a missing parent, received nil")
+	}
+
+	if err := ub.MoveFolder(home, email); err == nil {
+		t.Fatal("Expected error for moving a folder inside itself, received nil")
+	}
+
+	if err := ub.MoveFolder(home, home); err == nil {
+		t.Fatal("Expected error for moving a folder into itself, received nil")
+	}
+
+	// 4.  Ensure the Folders are saved in the Metadata.
+	ub2, err := lb.login(folderUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub2.Lock()
+
+	if !ub2.metadata.Equal(ub.metadata) || ub2.GetFolderPath(email) != "Home/Email" {
+		t.Fatalf("Expected the folders to be saved, received %v", ub2.GetFolders())
+	}
+
+	for _, f := range ub.GetFolders() {
+		err = ub.DeleteFolder(f.FolderId)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+}
+
+// Items can be moved into Folders and listed by Folder. Deleting a Folder
+// moves what it holds to its parent.
+func testFolderItems(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(folderUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	outer := createFolder(t, &ub, "Outer", FolderToken{})
+	inner := createFolder(t, &ub, "Inner", outer)
+	nested := createFolder(t, &ub, "Nested", inner)
+
+	n := NewNoteItem()
+	n.Name = "In a folder"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = ub.MoveItem(n.ItemId, inner)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if err := ub.MoveItem(n.ItemId, NewFolderToken()); err == nil {
+		t.Fatal("Expected error for a missing folder, received nil")
+	}
+
+	top := FolderToken{}
+	if len(ub.GetItemListWithOptions(ItemListOptions{Folder: &top})) != 0 {
+		t.Fatal("Expected no items at the top level")
+	}
+
+	items := ub.GetItemListWithOptions(ItemListOptions{Folder: &inner})
+	if len(items) != 1 || items[0].ItemId != n.ItemId {
+		t.Fatalf("Expected the note in the folder, received %v", items)
+	}
+
+	// Updating the Item keeps it in the Folder.
+	n.Data = []byte("updated")
+
+	err = ub.UpdateItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if imd, _ := ub.metadata.GetItem(n.ItemId); imd.Folder != inner {
+		t.Fatalf("Expected the note to stay in the folder, received %v", imd)
+	}
+
+	// Deleting a Folder moves its Items and Folders to its parent.
+	err = ub.DeleteFolder(inner)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if imd, _ := ub.metadata.GetItem(n.ItemId); imd.Folder != outer {
+		t.Fatalf("Expected the note to move to the parent, received %v", imd)
+	}
+
+	if ub.GetFolderPath(nested) != "Outer/Nested" {
+		t.Fatalf("Expected Outer/Nested, received %s", ub.GetFolderPath(nested))
+	}
+
+	if err := ub.DeleteFolder(inner); err == nil {
+		t.Fatal("Expected error for a deleted folder, received nil")
+	}
+}
+
+// Check moves Items out of missing Folders and breaks Folder cycles.
+func testFolderCheck(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(folderUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	a := createFolder(t, &ub, "A", FolderToken{})
+	b := createFolder(t, &ub, "B", a)
+
+	n := NewNoteItem()
+	n.Name = "Orphan"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	imd, _ := ub.metadata.GetItem(n.ItemId)
+	imd.Folder = NewFolderToken()
+	imd.Tags = []string{"lost"}
+	ub.metadata.AddItem(imd)
+
+	fa := ub.metadata.Folders[a.String()]
+	fa.Parent = b
+	ub.metadata.Folders[a.String()] = fa
+
+	problems, err := ub.Check(true)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(problems) != 3 {
+		t.Fatalf("Expected three problems, received %v", problems)
+	}
+
+	if imd, _ := ub.metadata.GetItem(n.ItemId); imd.Folder != (FolderToken{}) {
+		t.Fatalf("Expected the note at the top level, received %v", imd)
+	}
+
+	if ub.metadata.isWithin(b, a) == ub.metadata.isWithin(a, b) {
+		t.Fatalf("Expected the cycle to be broken, received %v", ub.metadata.Folders)
+	}
+
+	if fmt.Sprint(ub.GetTags()) != "[lost]" {
+		t.Fatalf("Expected the tag to be listed, received %v", ub.GetTags())
+	}
+}
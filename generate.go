@@ -0,0 +1,286 @@
+package lckbx
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// CharClass is a set of the classes of characters a password is made of.
+type CharClass uint8
+
+const (
+	LowerClass CharClass = 1 << iota
+	UpperClass
+	DigitClass
+	SymbolClass
+
+	AllClasses = LowerClass | UpperClass | DigitClass | SymbolClass
+)
+
+// charClasses lists the characters in each class, in the order they are
+// checked.
+var charClasses = []struct {
+	class CharClass
+	chars string
+}{
+	{LowerClass, "abcdefghijklmnopqrstuvwxyz"},
+	{UpperClass, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"},
+	{DigitClass, "0123456789"},
+	{SymbolClass, "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"},
+}
+
+// ambiguousChars are easily confused with each other when they are read or
+// typed: zero and O, one, I, l, and the vertical bar, and the quote marks.
+const ambiguousChars = "0Oo1Il|`'\""
+
+const (
+	maxPasswordLength  = 1024
+	maxPassphraseWords = 64
+)
+
+// PasswordRules describe a random password. Each character is drawn from
+// the Classes, leaving out the ambiguous characters if ExcludeAmbiguous is
+// set, and every class in Required appears at least once.
+type PasswordRules struct {
+	Length           int
+	Classes          CharClass
+	Required         CharClass
+	ExcludeAmbiguous bool
+}
+
+// DefaultPasswordRules generate a 20 character password with at least one
+// character of every class.
+var DefaultPasswordRules = PasswordRules{
+	Length:   20,
+	Classes:  AllClasses,
+	Required: AllClasses,
+}
+
+// sets returns the characters of each class in the rules, without the
+// ambiguous characters if they are excluded.
+func (r PasswordRules) sets() []string {
+	var sets []string
+
+	for _, c := range charClasses {
+		if r.Classes&c.class == 0 {
+			continue
+		}
+
+		chars := c.chars
+		if r.ExcludeAmbiguous {
+			chars = strings.Map(func(ch rune) rune {
+				if strings.ContainsRune(ambiguousChars, ch) {
+					return -1
+				}
+
+				return ch
+			}, chars)
+		}
+
+		sets = append(sets, chars)
+	}
+
+	return sets
+}
+
+// required returns the characters of each Required class.
+func (r PasswordRules) required() []string {
+	return PasswordRules{Classes: r.Required, ExcludeAmbiguous: r.ExcludeAmbiguous}.sets()
+}
+
+// validate ensures a password can be generated with the rules.
+func (r PasswordRules) validate() error {
+	if r.Length <= 0 || r.Length > maxPasswordLength {
+		return fmt.Errorf("password length must be between 1 and %d", maxPasswordLength)
+	}
+
+	if r.Classes&AllClasses == 0 {
+		return fmt.Errorf("no character classes are allowed")
+	}
+
+	if r.Required&^r.Classes != 0 {
+		return fmt.Errorf("a required character class is not allowed")
+	}
+
+	if len(r.required()) > r.Length {
+		return fmt.Errorf("password is too short for every required character class")
+	}
+
+	return nil
+}
+
+// Entropy estimates the strength of the passwords generated with the rules,
+// in bits. It is the base 2 logarithm of the number of passwords the rules
+// allow, which is counted by excluding the passwords that are missing a
+// Required class. The entropy of invalid rules is zero.
+func (r PasswordRules) Entropy() float64 {
+	if r.validate() != nil {
+		return 0
+	}
+
+	pool := len(strings.Join(r.sets(), ""))
+	required := r.required()
+
+	count := new(big.Int)
+	length := big.NewInt(int64(r.Length))
+
+	// Each subset of the Required classes is the set of classes that are
+	// missing. The classes share no characters, so the passwords without
+	// them are drawn from what is left of the pool.
+	for subset := 0; subset < 1<<len(required); subset++ {
+		left := pool
+		missing := 0
+
+		for n, chars := range required {
+			if subset&(1<<n) != 0 {
+				left -= len(chars)
+				missing++
+			}
+		}
+
+		term := new(big.Int).Exp(big.NewInt(int64(left)), length, nil)
+		if missing%2 == 0 {
+			count.Add(count, term)
+		} else {
+			count.Sub(count, term)
+		}
+	}
+
+	return log2(count)
+}
+
+// log2 returns the base 2 logarithm of a positive integer.
+func log2(n *big.Int) float64 {
+	if n.Sign() <= 0 {
+		return 0
+	}
+
+	mant := new(big.Float)
+	exp := new(big.Float).SetInt(n).MantExp(mant)
+	m, _ := mant.Float64()
+
+	return float64(exp) + math.Log2(m)
+}
+
+// GeneratePassword returns a random password following the rules. Every
+// character is drawn uniformly from the allowed classes, and passwords
+// missing a Required class are discarded, so every password the rules allow
+// is equally likely.
+func GeneratePassword(rules PasswordRules) (string, error) {
+	err := rules.validate()
+	if err != nil {
+		return "", fmt.Errorf("could not GeneratePassword: %v", err)
+	}
+
+	pool := []rune(strings.Join(rules.sets(), ""))
+	required := rules.required()
+
+	for {
+		password := make([]rune, rules.Length)
+		for n := range password {
+			password[n] = pool[randomIndex(len(pool))]
+		}
+
+		complete := true
+		for _, chars := range required {
+			if !strings.ContainsAny(string(password), chars) {
+				complete = false
+				break
+			}
+		}
+
+		if complete {
+			return string(password), nil
+		}
+	}
+}
+
+//go:embed wordlist/eff_large_wordlist.txt
+var effWordlist []byte
+
+var (
+	dicewareWords     []string
+	dicewareWordsOnce sync.Once
+)
+
+// getDicewareWords returns the 7776 words of the EFF large wordlist. Each
+// line of the list is five dice rolls and a word, separated by a tab.
+func getDicewareWords() []string {
+	dicewareWordsOnce.Do(func() {
+		s := bufio.NewScanner(bytes.NewReader(effWordlist))
+		for s.Scan() {
+			_, word, ok := strings.Cut(s.Text(), "\t")
+			if ok {
+				dicewareWords = append(dicewareWords, word)
+			}
+		}
+	})
+
+	return dicewareWords
+}
+
+// PassphraseRules describe a diceware passphrase of Words random words
+// from the EFF large wordlist, joined with the Separator. Capitalize starts
+// each word with a capital letter, which does not add to the entropy.
+type PassphraseRules struct {
+	Words      int
+	Separator  string
+	Capitalize bool
+}
+
+// DefaultPassphraseRules generate a passphrase of six words separated by
+// hyphens.
+var DefaultPassphraseRules = PassphraseRules{
+	Words:     6,
+	Separator: "-",
+}
+
+// validate ensures a passphrase can be generated with the rules.
+func (r PassphraseRules) validate() error {
+	if r.Words <= 0 || r.Words > maxPassphraseWords {
+		return fmt.Errorf("passphrase must have between 1 and %d words", maxPassphraseWords)
+	}
+
+	return nil
+}
+
+// Entropy estimates the strength of the passphrases generated with the
+// rules, in bits. Each word adds the base 2 logarithm of the number of
+// words in the list, about 12.9 bits. The entropy of invalid rules is zero.
+func (r PassphraseRules) Entropy() float64 {
+	if r.validate() != nil {
+		return 0
+	}
+
+	return float64(r.Words) * math.Log2(float64(len(getDicewareWords())))
+}
+
+// GeneratePassphrase returns a random diceware passphrase following the
+// rules.
+func GeneratePassphrase(rules PassphraseRules) (string, error) {
+	err := rules.validate()
+	if err != nil {
+		return "", fmt.Errorf("could not GeneratePassphrase: %v", err)
+	}
+
+	list := getDicewareWords()
+
+	words := make([]string, rules.Words)
+	for n := range words {
+		word := []rune(list[randomIndex(len(list))])
+		if rules.Capitalize {
+			word[0] = unicode.ToUpper(word[0])
+		}
+
+		words[n] = string(word)
+	}
+
+	return strings.Join(words, rules.Separator), nil
+}
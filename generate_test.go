@@ -0,0 +1,143 @@
+package lckbx
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestGenerate(t *testing.T) {
+	t.Run("Test Generate Password", testGeneratePassword)
+	t.Run("Test Generate Password Entropy", testGeneratePasswordEntropy)
+	t.Run("Test Generate Passphrase", testGeneratePassphrase)
+}
+
+func testGeneratePassword(t *testing.T) {
+	fmt.Println(t.Name())
+
+	rules := PasswordRules{Length: 4, Classes: AllClasses, Required: AllClasses, ExcludeAmbiguous: true}
+
+	for n := 0; n < 200; n++ {
+		password, err := GeneratePassword(rules)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		if len(password) != 4 || strings.ContainsAny(password, ambiguousChars) {
+			t.Fatalf("Expected 4 unambiguous characters, received %q", password)
+		}
+
+		for _, c := range charClasses {
+			if !strings.ContainsAny(password, c.chars) {
+				t.Fatalf("Expected every class, received %q", password)
+			}
+		}
+	}
+
+	digits, err := GeneratePassword(PasswordRules{Length: 32, Classes: DigitClass})
+	if err != nil || strings.Trim(digits, "0123456789") != "" || len(digits) != 32 {
+		t.Fatalf("Expected 32 digits, received %q and %v", digits, err)
+	}
+
+	invalid := []PasswordRules{
+		{Length: 0, Classes: AllClasses},
+		{Length: maxPasswordLength + 1, Classes: AllClasses},
+		{Length: 8},
+		{Length: 8, Classes: LowerClass, Required: DigitClass},
+		{Length: 3, Classes: AllClasses, Required: AllClasses},
+	}
+
+	for _, rules := range invalid {
+		if _, err := GeneratePassword(rules); err == nil {
+			t.Fatalf("Expected error for %+v, received nil", rules)
+		}
+
+		if rules.Entropy() != 0 {
+			t.Fatalf("Expected no entropy for %+v, received %f", rules, rules.Entropy())
+		}
+	}
+}
+
+func testGeneratePasswordEntropy(t *testing.T) {
+	fmt.Println(t.Name())
+
+	tests := []struct {
+		rules    PasswordRules
+		expected float64
+	}{
+		{PasswordRules{Length: 10, Classes: DigitClass}, 10 * math.Log2(10)},
+		{PasswordRules{Length: 20, Classes: AllClasses}, 20 * math.Log2(94)},
+		{PasswordRules{Length: 12, Classes: AllClasses, ExcludeAmbiguous: true}, 12 * math.Log2(84)},
+		// 36^2 passwords, less the 10^2 without a letter and the 26^2
+		// without a digit.
+		{PasswordRules{Length: 2, Classes: LowerClass | DigitClass, Required: LowerClass | DigitClass}, math.Log2(520)},
+	}
+
+	for _, test := range tests {
+		entropy := test.rules.Entropy()
+		if math.Abs(entropy-test.expected) > 1e-9 {
+			t.Fatalf("Expected %f bits for %+v, received %f", test.expected, test.rules, entropy)
+		}
+	}
+
+	required := DefaultPasswordRules.Entropy()
+	if required >= 20*math.Log2(94) || required < 20*math.Log2(94)-1 {
+		t.Fatalf("Expected required classes to cost less than a bit, received %f", required)
+	}
+}
+
+func testGeneratePassphrase(t *testing.T) {
+	fmt.Println(t.Name())
+
+	words := getDicewareWords()
+	if len(words) != 7776 || words[0] != "abacus" || words[len(words)-1] != "zoom" {
+		t.Fatalf("Expected the EFF large wordlist, received %d words", len(words))
+	}
+
+	known := make(map[string]bool)
+	for _, w := range words {
+		known[w] = true
+	}
+
+	if len(known) != 7776 {
+		t.Fatalf("Expected 7776 different words, received %d", len(known))
+	}
+
+	passphrase, err := GeneratePassphrase(PassphraseRules{Words: 5, Separator: " "})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	parts := strings.Split(passphrase, " ")
+	if len(parts) != 5 {
+		t.Fatalf("Expected 5 words, received %q", passphrase)
+	}
+
+	for _, p := range parts {
+		if !known[p] {
+			t.Fatalf("Expected words from the list, received %q", passphrase)
+		}
+	}
+
+	passphrase, err = GeneratePassphrase(PassphraseRules{Words: 3, Separator: ".", Capitalize: true})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, p := range strings.Split(passphrase, ".") {
+		if !unicode.IsUpper([]rune(p)[0]) || !known[strings.ToLower(p)] {
+			t.Fatalf("Expected capitalized words, received %q", passphrase)
+		}
+	}
+
+	entropy := DefaultPassphraseRules.Entropy()
+	if math.Abs(entropy-6*math.Log2(7776)) > 1e-9 {
+		t.Fatalf("Expected %f bits, received %f", 6*math.Log2(7776), entropy)
+	}
+
+	if _, err := GeneratePassphrase(PassphraseRules{}); err == nil {
+		t.Fatal("Expected error for no words, received nil")
+	}
+}
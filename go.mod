@@ -3,9 +3,12 @@ module lckbx
 go 1.18
 
 require (
+	filippo.io/age v1.2.1
 	fyne.io/fyne/v2 v2.5.3
 	github.com/boltdb/bolt v1.3.1
 	golang.org/x/crypto v0.26.0
+	golang.org/x/sys v0.23.0
+	golang.org/x/term v0.23.0
 	golang.org/x/text v0.17.0
 )
 
@@ -36,6 +39,5 @@ require (
 	golang.org/x/image v0.18.0 // indirect
 	golang.org/x/mobile v0.0.0-20231127183840-76ac6878050a // indirect
 	golang.org/x/net v0.25.0 // indirect
-	golang.org/x/sys v0.23.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,73 @@
+package lckbx
+
+import (
+	"fmt"
+)
+
+// The IdentityItem struct holds personal details used to fill in forms.
+type IdentityItem struct {
+	Title      string
+	FirstName  string
+	MiddleName string
+	LastName   string
+	Company    string
+	Email      string
+	Phone      string
+	Address    string
+	City       string
+	State      string
+	PostalCode string
+	Country    string
+}
+
+// fields returns the IdentityItem as a list of ItemFields.
+func (i *IdentityItem) fields() []ItemField {
+	return []ItemField{
+		{Name: "title", Value: i.Title},
+		{Name: "first_name", Value: i.FirstName},
+		{Name: "middle_name", Value: i.MiddleName},
+		{Name: "last_name", Value: i.LastName},
+		{Name: "company", Value: i.Company},
+		{Name: "email", Value: i.Email},
+		{Name: "phone", Value: i.Phone},
+		{Name: "address", Value: i.Address},
+		{Name: "city", Value: i.City},
+		{Name: "state", Value: i.State},
+		{Name: "postal_code", Value: i.PostalCode},
+		{Name: "country", Value: i.Country},
+	}
+}
+
+// setField sets the named field.
+func (i *IdentityItem) setField(name, value string) error {
+	switch name {
+	case "title":
+		i.Title = value
+	case "first_name":
+		i.FirstName = value
+	case "middle_name":
+		i.MiddleName = value
+	case "last_name":
+		i.LastName = value
+	case "company":
+		i.Company = value
+	case "email":
+		i.Email = value
+	case "phone":
+		i.Phone = value
+	case "address":
+		i.Address = value
+	case "city":
+		i.City = value
+	case "state":
+		i.State = value
+	case "postal_code":
+		i.PostalCode = value
+	case "country":
+		i.Country = value
+	default:
+		return fmt.Errorf("unknown identity field %q", name)
+	}
+
+	return nil
+}
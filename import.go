@@ -0,0 +1,513 @@
+package lckbx
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ImportOptions hold the password and key file that open an encrypted file.
+// A dry run reads the file and reports what would be imported without
+// changing the box.
+type ImportOptions struct {
+	Password string `json:",omitempty"`
+	KeyFile  []byte `json:",omitempty"`
+	DryRun   bool   `json:",omitempty"`
+}
+
+// ImportFailure is an entry in an imported file that was not added to the
+// box, or was added without something it held, and the reason why.
+type ImportFailure struct {
+	Entry  string
+	Reason string
+}
+
+// ImportMapping is a field in another program's file and the part of an
+// Item it was imported into. In a report, Count is the number of entries
+// that had the field.
+type ImportMapping struct {
+	From  string
+	To    string
+	Count int `json:",omitempty"`
+}
+
+// ImportReport describes the result of an import: the format of the file,
+// how many Items, Folders, and Attachments were added, the number of Items
+// of each type, how the fields were mapped, and every entry that could not
+// be converted. A dry run reports what would have been added.
+type ImportReport struct {
+	Format      string
+	DryRun      bool `json:",omitempty"`
+	Items       int
+	Folders     int
+	Attachments int
+	Types       map[ItemType]int `json:",omitempty"`
+	Mapping     []ImportMapping  `json:",omitempty"`
+	Failures    []ImportFailure  `json:",omitempty"`
+}
+
+// ImportAttachment is a file attached to an imported entry.
+type ImportAttachment struct {
+	Name string
+	Data []byte
+}
+
+// ImportEntry is an Item read from another program's file, with the path of
+// the Folder it belongs in, its tags, its attachments, its Revisions, and
+// its timestamps. An Item with a Trashed time is imported into the trash.
+// The Entry names it in the ImportReport, and the Mapping lists the fields
+// it was read from.
+//
+// An entry without an Item only creates its Folder and tags, so that
+// Folders and tags that hold no Items can be imported.
+type ImportEntry struct {
+	Entry       string
+	Item        Item
+	Folder      []string
+	Tags        []string
+	Attachments []ImportAttachment
+	Revisions   []Revision
+	Created     time.Time
+	Modified    time.Time
+	Accessed    time.Time
+	Trashed     time.Time
+	Mapping     []ImportMapping
+}
+
+// mapField records that a field of the entry was imported into the named
+// part of the Item.
+func (e *ImportEntry) mapField(from, to string) {
+	for _, m := range e.Mapping {
+		if m.From == from && m.To == to {
+			return
+		}
+	}
+
+	e.Mapping = append(e.Mapping, ImportMapping{From: from, To: to})
+}
+
+// An Importer reads the entries of a file exported by another program.
+type Importer interface {
+	// Detect reports whether the data is in the format read by the
+	// Importer.
+	Detect(data []byte) bool
+
+	// Encrypted reports whether a password is needed to read the data.
+	Encrypted(data []byte) bool
+
+	// Read converts the data into entries. Entries that cannot be converted
+	// are returned as failures, and an error is only returned when the file
+	// cannot be read at all.
+	Read(data []byte, opts ImportOptions) ([]ImportEntry, []ImportFailure, error)
+}
+
+// importers holds the Importer for each format, by name.
+var (
+	importers = map[string]Importer{
+		"1pux":      onePuxImporter{},
+		"bitwarden": bitwardenImporter{},
+		"csv":       csvImporter{},
+		"kdbx":      kdbxImporter{},
+		"lckbx":     lckbxImporter{},
+	}
+	importersMutex sync.RWMutex
+)
+
+// RegisterImporter makes an Importer available under the format name. It
+// panics if the name is empty or already registered.
+func RegisterImporter(format string, imp Importer) {
+	importersMutex.Lock()
+	defer importersMutex.Unlock()
+
+	if format == "" || imp == nil {
+		panic("lckbx: RegisterImporter with an empty format or nil Importer")
+	}
+
+	if _, ok := importers[format]; ok {
+		panic("lckbx: RegisterImporter called twice for " + format)
+	}
+
+	importers[format] = imp
+}
+
+// ImportFormats returns the names of the registered formats, sorted.
+func ImportFormats() []string {
+	importersMutex.RLock()
+	defer importersMutex.RUnlock()
+
+	var formats []string
+	for format := range importers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// getImporter returns the Importer for the format.
+func getImporter(format string) (Importer, error) {
+	importersMutex.RLock()
+	defer importersMutex.RUnlock()
+
+	imp, ok := importers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown import format %q", format)
+	}
+
+	return imp, nil
+}
+
+// DetectImportFormat returns the name of the first format, in sorted order,
+// whose Importer recognizes the data.
+func DetectImportFormat(data []byte) (string, error) {
+	for _, format := range ImportFormats() {
+		imp, err := getImporter(format)
+		if err == nil && imp.Detect(data) {
+			return format, nil
+		}
+	}
+
+	return "", fmt.Errorf("unknown import format, use one of %s", strings.Join(ImportFormats(), ", "))
+}
+
+// ImportNeedsPassword reports whether the data, in the given format, can
+// only be read with a password.
+func ImportNeedsPassword(format string, data []byte) bool {
+	imp, err := getImporter(format)
+	if err != nil {
+		return false
+	}
+
+	return imp.Encrypted(data)
+}
+
+// importNotes appends "name: value" lines, for fields that have no place
+// in an Item, to its notes.
+func importNotes(notes string, lines []string) string {
+	if len(lines) == 0 {
+		return notes
+	}
+
+	if notes != "" {
+		notes += "\n\n"
+	}
+
+	return notes + strings.Join(lines, "\n")
+}
+
+// importFolderName makes a name from another program usable as a Folder
+// name.
+func importFolderName(name string) string {
+	name = strings.TrimSpace(strings.ReplaceAll(name, "/", "-"))
+	if name == "" {
+		return "Untitled"
+	}
+
+	return name
+}
+
+// importFolder returns the Folder for the path, creating any Folders that do
+// not exist. Existing Folders with the same names are reused, so importing
+// the same file twice does not create a second set of Folders. A dry run
+// only counts the Folders it would create.
+func (u *UnlockedBox) importFolder(path []string, folders map[string]FolderToken, report *ImportReport) (FolderToken, error) {
+	var fid FolderToken
+	var key string
+
+	for _, name := range path {
+		name = importFolderName(name)
+		key += "/" + name
+
+		if known, ok := folders[key]; ok {
+			fid = known
+			continue
+		}
+
+		parent := fid
+		for _, f := range u.GetFolders() {
+			if f.Parent == parent && f.Name == name {
+				fid = f.FolderId
+				break
+			}
+		}
+
+		if fid == parent {
+			created := NewFolderToken()
+
+			if !report.DryRun {
+				var err error
+
+				created, err = u.CreateFolder(name, parent)
+				if err != nil {
+					return FolderToken{}, err
+				}
+			}
+
+			fid = created
+			report.Folders++
+		}
+
+		folders[key] = fid
+	}
+
+	return fid, nil
+}
+
+// Add Imported Item
+//  1. Add the Item to the database, as AddItem does.
+//  2. Encrypt each Attachment with a new key and save it.
+//  3. Encrypt each Revision with a new key and save it.
+//  4. Create the ItemMetadata in the Folder, with the tags and timestamps.
+//  5. Save the Metadata.
+//
+// Everything is saved in a single transaction, so an entry is imported
+// completely or not at all.
+func (u *UnlockedBox) addImportedItem(e ImportEntry, fid FolderToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	i := e.Item
+
+	if !u.metadata.hasFolder(fid) {
+		return fmt.Errorf("folder not found")
+	}
+
+	created := e.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	imd := newItemMetadataFromItem(i, u.keyset.Latest, created)
+	imd.Folder = fid
+
+	if !e.Modified.IsZero() && e.Modified.After(created) {
+		imd.Modified = e.Modified.UTC()
+		imd.Accessed = imd.Modified
+	}
+
+	if !e.Accessed.IsZero() && !e.Accessed.Before(created) {
+		imd.Accessed = e.Accessed.UTC()
+	}
+
+	if !e.Trashed.IsZero() {
+		trashed := e.Trashed.UTC()
+		imd.Trashed = &trashed
+	}
+
+	tags := u.metadata.Tags
+	for _, tag := range e.Tags {
+		tag, err := validateTag(tag)
+		if err != nil {
+			continue
+		}
+
+		imd.Tags = withTag(imd.Tags, tag)
+	}
+
+	err := u.store.Update(func(r recorder) error {
+		// 1.  Add the Item to the database, as AddItem does.
+		newKey, err := u.keyset.GetNewItemKey(i.ItemId)
+		if err != nil {
+			return err
+		}
+
+		err = u.crypt.ChangeKey(newKey[:])
+		if err != nil {
+			return err
+		}
+
+		err = i.Save(r, u.crypt)
+		if err != nil {
+			return err
+		}
+
+		// 2.  Encrypt each Attachment with a new key and save it.
+		for _, a := range e.Attachments {
+			name := a.Name
+			if name == "" {
+				name = "attachment"
+			}
+
+			aid := NewAttachmentToken()
+
+			newKey, err := u.keyset.GetNewAttachmentKey(aid)
+			if err != nil {
+				return err
+			}
+
+			u.crypt.ChangeKey(newKey[:])
+			encrypted, size, err := sealAttachment(u.crypt, i.ItemId, aid, bytes.NewReader(a.Data))
+			if err != nil {
+				return err
+			}
+
+			err = r.SaveAttachment(aid, encrypted)
+			if err != nil {
+				return err
+			}
+
+			imd = imd.withAttachment(newAttachmentMetadata(aid, name, size, u.keyset.Latest))
+		}
+
+		// 3.  Encrypt each Revision with a new key and save it.
+		for _, ir := range e.Revisions {
+			ir.Item.ItemId = i.ItemId
+			rev := NewRevision(ir.Item, ir.Created)
+
+			newKey, err := u.keyset.GetNewRevisionKey(rev.RevisionId)
+			if err != nil {
+				return err
+			}
+
+			u.crypt.ChangeKey(newKey[:])
+			err = rev.Save(r, u.crypt)
+			if err != nil {
+				return err
+			}
+
+			imd.Revisions = append(imd.Revisions, RevisionMetadata{
+				RevisionId: rev.RevisionId,
+				Created:    rev.Created,
+				KeyVersion: u.keyset.Latest,
+			})
+		}
+
+		// 4.  Create the ItemMetadata in the Folder, with the tags and
+		//     timestamps.
+		u.metadata.AddItem(imd)
+		for _, tag := range imd.Tags {
+			u.metadata.Tags = withTag(u.metadata.Tags, tag)
+		}
+
+		// 5.  Save the Metadata.
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		u.metadata.DeleteItem(i.ItemId)
+		u.metadata.Tags = tags
+		return err
+	}
+
+	if imd.IsTrashed() {
+		return nil
+	}
+
+	u.indexItem(i)
+
+	return nil
+}
+
+// importTags creates the tags, unless this is a dry run. Tags that cannot be
+// created are listed in the report.
+func (u *UnlockedBox) importTags(entry string, tags []string, report *ImportReport) {
+	for _, tag := range tags {
+		if report.DryRun {
+			continue
+		}
+
+		err := u.CreateTag(tag)
+		if err != nil {
+			report.Failures = append(report.Failures, ImportFailure{Entry: entry, Reason: err.Error()})
+		}
+	}
+}
+
+// importItems adds the entries to the box, creating their Folders. An entry
+// that cannot be added is listed in the report and the rest are still
+// added. The Mapping of every added entry is counted in the report.
+func (u *UnlockedBox) importItems(entries []ImportEntry, report *ImportReport) {
+	folders := make(map[string]FolderToken)
+	report.Types = make(map[ItemType]int)
+
+	for _, e := range entries {
+		fail := func(err error) {
+			report.Failures = append(report.Failures, ImportFailure{Entry: e.Entry, Reason: err.Error()})
+		}
+
+		if e.Item.Type == "" {
+			_, err := u.importFolder(e.Folder, folders, report)
+			if err != nil {
+				fail(err)
+				continue
+			}
+
+			u.importTags(e.Entry, e.Tags, report)
+			continue
+		}
+
+		err := e.Item.validate()
+		if err != nil {
+			fail(err)
+			continue
+		}
+
+		fid, err := u.importFolder(e.Folder, folders, report)
+		if err != nil {
+			fail(err)
+			continue
+		}
+
+		if !report.DryRun {
+			err = u.addImportedItem(e, fid)
+			if err != nil {
+				fail(err)
+				continue
+			}
+		}
+
+		report.Items++
+		report.Attachments += len(e.Attachments)
+		report.Types[e.Item.Type]++
+
+		for _, m := range e.Mapping {
+			report.addMapping(m)
+		}
+	}
+}
+
+// addMapping counts an entry with the mapped field.
+func (r *ImportReport) addMapping(m ImportMapping) {
+	for n := range r.Mapping {
+		if r.Mapping[n].From == m.From && r.Mapping[n].To == m.To {
+			r.Mapping[n].Count++
+			return
+		}
+	}
+
+	r.Mapping = append(r.Mapping, ImportMapping{From: m.From, To: m.To, Count: 1})
+}
+
+// Import reads a file exported by another program and adds its entries to
+// the box with the Importer for the format. An empty format is detected
+// from the data. Every entry that could not be converted or added is
+// listed in the report, and the other entries are still imported. With
+// DryRun set nothing is added, and the report describes what would be.
+func (u *UnlockedBox) Import(format string, data []byte, opts ImportOptions) (ImportReport, error) {
+	var err error
+
+	if format == "" {
+		format, err = DetectImportFormat(data)
+		if err != nil {
+			return ImportReport{}, fmt.Errorf("could not UnlockedBox.Import: %v", err)
+		}
+	}
+
+	imp, err := getImporter(format)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("could not UnlockedBox.Import: %v", err)
+	}
+
+	entries, failures, err := imp.Read(data, opts)
+	if err != nil {
+		return ImportReport{}, fmt.Errorf("could not UnlockedBox.Import: %v", err)
+	}
+
+	report := ImportReport{Format: format, DryRun: opts.DryRun}
+	u.importItems(entries, &report)
+	report.Failures = append(failures, report.Failures...)
+
+	return report, nil
+}
@@ -0,0 +1,165 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+var (
+	importDB   = "import_test.db"
+	importUser = "import_user"
+)
+
+func TestImport(t *testing.T) {
+	store, err := NewStore(importDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(importDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(importUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Import Formats", testImportFormats)
+	t.Run("Test Import Dry Run", func(t *testing.T) { testImportDryRun(t, &lb) })
+}
+
+// testImporter reads one Login Item per line.
+type testImporter struct{}
+
+func (testImporter) Detect(data []byte) bool {
+	return strings.HasPrefix(string(data), "test\n")
+}
+
+func (testImporter) Encrypted(data []byte) bool {
+	return false
+}
+
+func (testImporter) Read(data []byte, opts ImportOptions) ([]ImportEntry, []ImportFailure, error) {
+	var entries []ImportEntry
+
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n")[1:] {
+		e := ImportEntry{Entry: line, Item: NewItem(LoginType), Folder: []string{"Test"}}
+		e.Item.Name = line
+		e.mapField("line", "name")
+		entries = append(entries, e)
+	}
+
+	return entries, nil, nil
+}
+
+func testImportFormats(t *testing.T) {
+	fmt.Println(t.Name())
+
+	RegisterImporter("test", testImporter{})
+
+	formats := strings.Join(ImportFormats(), ",")
+	if formats != "1pux,bitwarden,csv,kdbx,lckbx,test" {
+		t.Fatalf("Expected every format, received %s", formats)
+	}
+
+	files := map[string][]byte{
+		"1pux":      buildOnePux(onePuxExportData),
+		"bitwarden": []byte(bitwardenExportJSON),
+		"csv":       []byte("url,username,password\nhttps://example.com,bob,pw\n"),
+		"kdbx":      buildKDBX3(kdbxPassword, false),
+		"lckbx":     []byte(`{"Format": "lckbx export", "Version": 1, "Items": []}`),
+		"test":      []byte("test\none\n"),
+	}
+
+	for expected, data := range files {
+		format, err := DetectImportFormat(data)
+		if err != nil || format != expected {
+			t.Fatalf("Expected %s, received %s and %v", expected, format, err)
+		}
+	}
+
+	if _, err := DetectImportFormat([]byte("lckbx account bundle\n{}")); err == nil {
+		t.Fatal("Expected error for an unknown format, received nil")
+	}
+
+	if !ImportNeedsPassword("kdbx", files["kdbx"]) || ImportNeedsPassword("csv", files["csv"]) {
+		t.Fatal("Expected only the KeePass database to need a password")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Expected a panic when registering a format twice")
+		}
+	}()
+
+	RegisterImporter("csv", testImporter{})
+}
+
+// End-to-end test for Import
+//  1. Run a dry run and ensure the counts and mapping.
+//  2. Ensure the dry run did not change the box.
+//  3. Import the file and ensure the report matches the dry run.
+func testImportDryRun(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(importUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	data := []byte(bitwardenExportJSON)
+
+	// 1.  Run a dry run and ensure the counts and mapping.
+	dry, err := ub.Import("", data, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !dry.DryRun || dry.Format != "bitwarden" || dry.Items != 4 || dry.Folders != 2 || len(dry.Failures) != 1 {
+		t.Fatalf("Expected 4 items in 2 folders, received %+v", dry)
+	}
+
+	types := dry.Types
+	if types[LoginType] != 1 || types[CardType] != 1 || types[IdentityType] != 1 || types[SecureNoteType] != 1 {
+		t.Fatalf("Expected one item of each type, received %+v", types)
+	}
+
+	mapping := make(map[string]int)
+	for _, m := range dry.Mapping {
+		mapping[m.From+">"+m.To] = m.Count
+	}
+
+	if mapping["name>name"] != 4 || mapping["login.password>password"] != 1 || mapping["fields>notes"] != 1 || mapping["card.expMonth>expiry"] != 1 {
+		t.Fatalf("Expected the field mapping, received %+v", dry.Mapping)
+	}
+
+	// 2.  Ensure the dry run did not change the box.
+	if len(ub.GetItemList()) != 0 || len(ub.GetFolders()) != 0 || len(ub.GetTags()) != 0 {
+		t.Fatalf("Expected an empty box, received %d items", len(ub.GetItemList()))
+	}
+
+	// 3.  Import the file and ensure the report matches the dry run.
+	report, err := ub.Import("bitwarden", data, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if report.DryRun || report.Items != dry.Items || report.Folders != dry.Folders || len(report.Mapping) != len(dry.Mapping) {
+		t.Fatalf("Expected %+v, received %+v", dry, report)
+	}
+
+	if len(ub.GetItemList()) != 4 || len(ub.GetFolders()) != 2 || strings.Join(ub.GetTags(), ",") != "favorite" {
+		t.Fatalf("Expected 4 items, 2 folders, and a tag, received %+v", ub.GetItemList())
+	}
+
+	if _, err := ub.Import("unknown", data, ImportOptions{}); err == nil {
+		t.Fatal("Expected error for an unknown format, received nil")
+	}
+}
@@ -1,8 +1,12 @@
 package lckbx
 
+import "io"
+
 type crypter interface {
 	Encrypt(plaintext, additionalData []byte) ([]byte, error)
 	Decrypt(ciphertext, additionalData []byte) ([]byte, error)
+	EncryptStream(dst io.Writer, additionalData []byte) (io.WriteCloser, error)
+	DecryptStream(src io.Reader, additionalData []byte) (io.Reader, error)
 	ChangeKey(key []byte) error
 }
 
@@ -14,24 +18,63 @@ type deriver interface {
 	DeriveCryptKey(baseKey BaseKey, info []byte) (CryptKey, error)
 }
 
-type storer interface {
+// recorder reads, writes, and deletes individual records. The records
+// written through a recorder passed to storer.Update are saved together in
+// one transaction.
+type recorder interface {
 	SaveUserId(username string, uid UserToken) error
 	GetUserId(username string) UserToken
 	DeleteUserId(username string) error
 
+	SaveDeriverVersion(uid UserToken, version VersionToken) error
+	GetDeriverVersion(uid UserToken) VersionToken
+	DeleteDeriverVersion(uid UserToken) error
+
 	GetUser(aid AuthToken) ([]byte, error)
 	SaveUser(aid AuthToken, data []byte) error
 	DeleteUser(aid AuthToken) error
 
 	GetKeyset(kid KeysetToken) ([]byte, error)
 	SaveKeyset(kid KeysetToken, data []byte) error
+	DeleteKeyset(kid KeysetToken) error
 
 	GetMetadata(mid MetadataToken) ([]byte, error)
 	SaveMetadata(mid MetadataToken, data []byte) error
+	DeleteMetadata(mid MetadataToken) error
 
 	GetItem(iid ItemToken) ([]byte, error)
 	SaveItem(iid ItemToken, data []byte) error
 	DeleteItem(iid ItemToken) error
+	GetItemIds() ([]ItemToken, error)
+	QuarantineItem(iid ItemToken) error
+
+	GetAttachment(aid AttachmentToken) ([]byte, error)
+	ReadAttachment(aid AttachmentToken) (io.Reader, error)
+	SaveAttachment(aid AttachmentToken, data []byte) error
+	DeleteAttachment(aid AttachmentToken) error
+	QuarantineAttachment(aid AttachmentToken) error
+
+	GetRevision(rid RevisionToken) ([]byte, error)
+	SaveRevision(rid RevisionToken, data []byte) error
+	DeleteRevision(rid RevisionToken) error
+	QuarantineRevision(rid RevisionToken) error
+
+	GetRecovery(rid AuthToken) ([]byte, error)
+	SaveRecovery(rid AuthToken, data []byte) error
+	DeleteRecovery(rid AuthToken) error
+}
+
+// storer is a recorder where each call runs in its own transaction. Update
+// groups several reads and writes into a single transaction, and View
+// groups several reads.
+type storer interface {
+	recorder
+
+	Update(fn func(r recorder) error) error
+	View(fn func(r recorder) error) error
+
+	SaveDefaultDeriverVersion(version VersionToken) error
+	GetDefaultDeriverVersion() VersionToken
 
 	Backup(filename string) error
 	Close() error
@@ -0,0 +1,321 @@
+package lckbx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ItemType identifies the kind of data an Item holds.
+type ItemType string
+
+const (
+	SecureNoteType ItemType = "note"
+	LoginType      ItemType = "login"
+	CardType       ItemType = "card"
+	IdentityType   ItemType = "identity"
+	OTPType        ItemType = "otp"
+)
+
+// ItemTypes lists every ItemType in the order they are shown to the user.
+var ItemTypes = []ItemType{LoginType, CardType, IdentityType, OTPType, SecureNoteType}
+
+// ParseItemType returns the ItemType with the given name.
+func ParseItemType(s string) (ItemType, error) {
+	for _, t := range ItemTypes {
+		if string(t) == strings.ToLower(s) {
+			return t, nil
+		}
+	}
+
+	return "", fmt.Errorf("could not ParseItemType: unknown item type %q", s)
+}
+
+// ItemField is a single named value of a typed Item. Secret fields, such as
+// passwords, should not be displayed unless the user asks for them.
+type ItemField struct {
+	Name   string
+	Value  string
+	Secret bool
+}
+
+// The Item struct is the envelope every kind of item is stored in. Data
+// holds the body of a SecureNote and free-form notes for the other kinds.
+// Exactly one of Login, Card, Identity, or OTP is set, matching the Type,
+// unless the Item is a SecureNote.
+//
+// Items saved before there were types have no Type and are loaded as
+// SecureNotes.
+type Item struct {
+	ItemId   ItemToken
+	Type     ItemType
+	Name     string
+	Data     []byte
+	Login    *LoginItem    `json:",omitempty"`
+	Card     *CardItem     `json:",omitempty"`
+	Identity *IdentityItem `json:",omitempty"`
+	OTP      *OTPItem      `json:",omitempty"`
+}
+
+// Equal determines if two Item objects are the same.
+func (i *Item) Equal(i2 Item) bool {
+	return i.ItemId.String() == i2.ItemId.String() &&
+		i.Type == i2.Type &&
+		i.Name == i2.Name &&
+		bytes.Equal(i.Data, i2.Data) &&
+		equalFields(i.Fields(), i2.Fields())
+}
+
+// equalFields determines if two lists of ItemFields are the same.
+func equalFields(f1, f2 []ItemField) bool {
+	if len(f1) != len(f2) {
+		return false
+	}
+
+	for n := range f1 {
+		if f1[n] != f2[n] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validate ensures the Item has a known Type and that the typed data
+// matches it.
+func (i *Item) validate() error {
+	typed := map[ItemType]bool{
+		SecureNoteType: false,
+		LoginType:      i.Login != nil,
+		CardType:       i.Card != nil,
+		IdentityType:   i.Identity != nil,
+		OTPType:        i.OTP != nil,
+	}
+
+	if _, ok := typed[i.Type]; !ok {
+		return fmt.Errorf("item %s has unknown type %q", i.ItemId, i.Type)
+	}
+
+	for t, set := range typed {
+		if set && t != i.Type {
+			return fmt.Errorf("%s item %s has %s data", i.Type, i.ItemId, t)
+		}
+
+		if !set && t == i.Type && t != SecureNoteType {
+			return fmt.Errorf("%s item %s is missing its data", i.Type, i.ItemId)
+		}
+	}
+
+	return nil
+}
+
+// Fields returns the typed fields of the Item. A SecureNote has no fields.
+func (i *Item) Fields() []ItemField {
+	switch {
+	case i.Login != nil:
+		return i.Login.fields()
+	case i.Card != nil:
+		return i.Card.fields()
+	case i.Identity != nil:
+		return i.Identity.fields()
+	case i.OTP != nil:
+		return i.OTP.fields()
+	}
+
+	return nil
+}
+
+// SetFields replaces the typed fields of the Item with the given fields.
+// The Item is not changed if any of the fields are unknown.
+func (i *Item) SetFields(fields []ItemField) error {
+	updated := NewItem(i.Type)
+
+	set := func(name, value string) error {
+		return fmt.Errorf("%s items have no fields", i.Type)
+	}
+
+	switch {
+	case updated.Login != nil:
+		set = updated.Login.setField
+	case updated.Card != nil:
+		set = updated.Card.setField
+	case updated.Identity != nil:
+		set = updated.Identity.setField
+	case updated.OTP != nil:
+		set = updated.OTP.setField
+	}
+
+	for _, f := range fields {
+		err := set(f.Name, f.Value)
+		if err != nil {
+			return fmt.Errorf("could not Item.SetFields: %v", err)
+		}
+	}
+
+	i.Login = updated.Login
+	i.Card = updated.Card
+	i.Identity = updated.Identity
+	i.OTP = updated.OTP
+
+	return nil
+}
+
+// FormatText returns the Item as text. The typed fields come first, one
+// "name: value" line each, followed by a blank line and the Data. A
+// SecureNote is returned as its Data.
+func (i *Item) FormatText() string {
+	fields := i.Fields()
+	if len(fields) == 0 {
+		return string(i.Data)
+	}
+
+	var sb strings.Builder
+	for _, f := range fields {
+		fmt.Fprintf(&sb, "%s: %s\n", f.Name, f.Value)
+	}
+
+	if len(i.Data) != 0 {
+		sb.WriteString("\n")
+		sb.Write(i.Data)
+	}
+
+	return sb.String()
+}
+
+// ParseText sets the typed fields and Data of the Item from text in the
+// form returned by FormatText. The Item is not changed if the text cannot be
+// parsed.
+func (i *Item) ParseText(text string) error {
+	if i.Type == SecureNoteType {
+		i.Data = []byte(text)
+		return nil
+	}
+
+	var fields []ItemField
+	var data []byte
+
+	lines := strings.SplitAfter(text, "\n")
+	for n, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			if rest := strings.Join(lines[n+1:], ""); rest != "" {
+				data = []byte(rest)
+			}
+			break
+		}
+
+		// Only the line terminator and the space after the colon are
+		// removed, since spaces at either end of a password are part of it.
+		line = strings.TrimRight(line, "\r\n")
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return fmt.Errorf("could not Item.ParseText: expected \"name: value\", received %q", line)
+		}
+
+		fields = append(fields, ItemField{
+			Name:  strings.ToLower(strings.TrimSpace(name)),
+			Value: strings.TrimPrefix(value, " "),
+		})
+	}
+
+	err := i.SetFields(fields)
+	if err != nil {
+		return fmt.Errorf("could not Item.ParseText: %v", err)
+	}
+
+	i.Data = data
+
+	return nil
+}
+
+func (i *Item) bytes(crypt crypter) ([]byte, error) {
+	var encrypted []byte
+
+	bytes, err := json.Marshal(i)
+	if err != nil {
+		return encrypted, fmt.Errorf("could not Item.Bytes: %v", err)
+	}
+
+	encrypted, err = crypt.Encrypt(bytes, []byte(i.ItemId.String()))
+	if err != nil {
+		return encrypted, fmt.Errorf("could not Item.Bytes: %v", err)
+	}
+
+	return encrypted, nil
+}
+
+// Save stores the Item as encrypted bytes in the given recorder.
+func (i *Item) Save(store recorder, crypt crypter) error {
+	bytes, err := i.bytes(crypt)
+	if err != nil {
+		return fmt.Errorf("could not Item.Save: %v", err)
+	}
+
+	err = store.SaveItem(i.ItemId, bytes)
+	if err != nil {
+		return fmt.Errorf("could not Item.Save: %v", err)
+	}
+
+	return nil
+}
+
+// NewItem creates a new, empty Item of the given type.
+func NewItem(t ItemType) Item {
+	item := Item{
+		ItemId: NewItemToken(),
+		Type:   t,
+	}
+
+	switch t {
+	case LoginType:
+		item.Login = &LoginItem{}
+	case CardType:
+		item.Card = &CardItem{}
+	case IdentityType:
+		item.Identity = &IdentityItem{}
+	case OTPType:
+		item.OTP = newOTPItem()
+	}
+
+	return item
+}
+
+// newItemFromBytes creates a new Item object from encrypted bytes.
+func newItemFromBytes(crypt crypter, encrypted []byte, ad []byte) (Item, error) {
+	var item Item
+
+	plaintext, err := crypt.Decrypt(encrypted, ad)
+	if err != nil {
+		return item, err
+	}
+
+	err = json.Unmarshal(plaintext, &item)
+	if err != nil {
+		return item, err
+	}
+
+	if item.Type == "" {
+		item.Type = SecureNoteType
+	}
+
+	return item, nil
+}
+
+// NewItemFromStore retrieves the encrypted Item bytes from the given
+// recorder, decrypts the bytes, and returns an Item.
+func NewItemFromStore(store recorder, crypt crypter, iid ItemToken) (Item, error) {
+	var item Item
+
+	bytes, err := store.GetItem(iid)
+	if err != nil {
+		return item, fmt.Errorf("could not NewItemFromStore: %v", err)
+	}
+
+	item, err = newItemFromBytes(crypt, bytes, []byte(iid.String()))
+	if err != nil {
+		return item, fmt.Errorf("could not NewItemFromStore: %v", err)
+	}
+
+	return item, nil
+}
@@ -0,0 +1,236 @@
+package lckbx
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+var (
+	itemDatabase = "item_test.db"
+	itemUser     = "item_user"
+	itemLogin    = "username: alice\npassword: hunter2hunter2\nurl: https://example.com\nurl: https://example.org\n\nRecovery codes are in the safe.\n"
+)
+
+func TestItem(t *testing.T) {
+	t.Run("Test Item Text", testItemText)
+	t.Run("Test Item Validate", testItemValidate)
+	t.Run("Test Item Storage", testItemStorage)
+	t.Run("Test UnlockedBox Typed Items", testUnlockedBoxTypedItems)
+}
+
+func testItemText(t *testing.T) {
+	fmt.Println(t.Name())
+
+	login := NewItem(LoginType)
+	err := login.ParseText(itemLogin)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if login.Login.Username != "alice" || len(login.Login.URLs) != 2 {
+		t.Fatalf("Expected parsed login, received %+v", login.Login)
+	}
+
+	if string(login.Data) != "Recovery codes are in the safe.\n" {
+		t.Fatalf("Expected notes, received %q", login.Data)
+	}
+
+	if login.FormatText() != itemLogin {
+		t.Fatalf("Expected %q, received %q", itemLogin, login.FormatText())
+	}
+
+	// Unknown fields are rejected without changing the Item.
+	err = login.ParseText("username: bob\nshoe_size: 9\n")
+	if err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	if login.Login.Username != "alice" {
+		t.Fatalf("Expected alice, received %s", login.Login.Username)
+	}
+
+	// Spaces at either end of a value survive a round trip, and Windows
+	// line endings are removed.
+	spaced := NewItem(LoginType)
+	spaced.Login.Username = "alice"
+	spaced.Login.Password = "  hunter2 "
+
+	parsed := NewItem(LoginType)
+	err = parsed.ParseText(spaced.FormatText())
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if parsed.Login.Password != spaced.Login.Password {
+		t.Fatalf("Expected %q, received %q", spaced.Login.Password, parsed.Login.Password)
+	}
+
+	err = parsed.ParseText("username: alice\r\npassword:  hunter2 \r\n")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if parsed.Login.Username != "alice" || parsed.Login.Password != " hunter2 " {
+		t.Fatalf("Expected alice and %q, received %+v", " hunter2 ", parsed.Login)
+	}
+
+	// A SecureNote is only Data.
+	note := NewItem(SecureNoteType)
+	note.ParseText("username: alice\n")
+	if string(note.Data) != "username: alice\n" || note.FormatText() != "username: alice\n" {
+		t.Fatalf("Expected note data, received %q", note.Data)
+	}
+}
+
+func testItemValidate(t *testing.T) {
+	fmt.Println(t.Name())
+
+	for _, it := range ItemTypes {
+		item := NewItem(it)
+		if err := item.validate(); err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+
+	item := NewItem(CardType)
+	item.Login = &LoginItem{}
+	if err := item.validate(); err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	item = NewItem("password")
+	if err := item.validate(); err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	if _, err := ParseItemType("Identity"); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+}
+
+func testItemStorage(t *testing.T) {
+	fmt.Println(t.Name())
+
+	crypterVersion, _ := parseVersionToken(xChaChaCrypterVersion)
+	crypter := NewCrypter(crypterVersion)
+	crypter.ChangeKey(userEncryptionKey)
+
+	storer, _ := NewStore(itemDatabase)
+	defer os.Remove(itemDatabase)
+	defer storer.Close()
+
+	card := NewItem(CardType)
+	card.Name = "Debit"
+	card.Card.Number = "4111111111111111"
+	card.Card.Expiry = "12/2030"
+
+	err := card.Save(&storer, crypter)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	card2, err := NewItemFromStore(&storer, crypter, card.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !card.Equal(card2) {
+		t.Fatalf("Expected equal Items, received \n%+v\n%+v\n", card, card2)
+	}
+
+	// An Item saved before there were types is loaded as a SecureNote.
+	legacy := struct {
+		ItemId ItemToken
+		Name   string
+		Data   []byte
+	}{NewItemToken(), "Legacy", []byte("old note")}
+
+	plaintext, _ := json.Marshal(legacy)
+	encrypted, _ := crypter.Encrypt(plaintext, []byte(legacy.ItemId.String()))
+	storer.SaveItem(legacy.ItemId, encrypted)
+
+	note, err := NewItemFromStore(&storer, crypter, legacy.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if note.Type != SecureNoteType || string(note.Data) != "old note" {
+		t.Fatalf("Expected legacy SecureNote, received %+v", note)
+	}
+}
+
+func testUnlockedBoxTypedItems(t *testing.T) {
+	fmt.Println(t.Name())
+
+	store, err := NewStore(itemDatabase)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(itemDatabase)
+	defer store.Close()
+
+	lb, _ := NewLockedBox(&store)
+
+	err = lb.Register(itemUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.login(itemUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	for _, it := range ItemTypes {
+		item := NewItem(it)
+		item.Name = string(it)
+
+		err = ub.AddItem(item)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+
+	// Invalid Items are not added.
+	bad := NewItem(LoginType)
+	bad.Card = &CardItem{}
+	if err := ub.AddItem(bad); err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+
+	logins := ub.GetItemListByType(LoginType)
+	if len(logins) != 1 || logins[0].Name != string(LoginType) {
+		t.Fatalf("Expected one login, received %+v", logins)
+	}
+
+	// Changing the type of an Item updates the ItemMetadata.
+	item, err := ub.GetItem(logins[0].ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	item.Type = IdentityType
+	item.Login = nil
+	item.Identity = &IdentityItem{FirstName: "Alice"}
+
+	err = ub.UpdateItem(item)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(ub.GetItemListByType(LoginType)) != 0 || len(ub.GetItemListByType(IdentityType)) != 2 {
+		t.Fatalf("Expected the login to be an identity, received %+v", ub.GetItemList())
+	}
+
+	item2, err := ub.GetItem(item.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !item.Equal(item2) {
+		t.Fatalf("Expected equal Items, received \n%+v\n%+v\n", item, item2)
+	}
+}
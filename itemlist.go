@@ -0,0 +1,121 @@
+package lckbx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ItemSort is the order of a list of Items.
+type ItemSort string
+
+const (
+	SortByName     ItemSort = "name"
+	SortByType     ItemSort = "type"
+	SortByCreated  ItemSort = "created"
+	SortByModified ItemSort = "modified"
+	SortByAccessed ItemSort = "accessed"
+)
+
+// ItemSorts is the list of supported orders.
+var ItemSorts = []ItemSort{SortByName, SortByType, SortByCreated, SortByModified, SortByAccessed}
+
+// ParseItemSort returns the ItemSort with the given name.
+func ParseItemSort(s string) (ItemSort, error) {
+	for _, is := range ItemSorts {
+		if string(is) == strings.ToLower(s) {
+			return is, nil
+		}
+	}
+
+	return "", fmt.Errorf("could not ParseItemSort: unknown sort %q", s)
+}
+
+// ItemListOptions filters and sorts the list returned by
+// UnlockedBox.GetItemListWithOptions. The zero value lists every Item sorted
+// by name.
+//
+// Names are sorted A to Z, and types are sorted by name and then by the
+// Item name. The dates are sorted newest first, so the most recently
+// modified Item is at the top. Reverse flips the order. Items that compare
+// equal are sorted by name and then by ItemId, so the order is stable.
+//
+// Type, Folder, and Tag limit the list to the Items of that type, directly in
+// that Folder, or with that tag. A nil Folder lists the Items in every
+// Folder, and the zero FolderToken lists the Items at the top level.
+type ItemListOptions struct {
+	Sort    ItemSort     `json:",omitempty"`
+	Reverse bool         `json:",omitempty"`
+	Type    ItemType     `json:",omitempty"`
+	Folder  *FolderToken `json:",omitempty"`
+	Tag     string       `json:",omitempty"`
+}
+
+// less reports whether a sorts before b, ignoring Reverse.
+func (o ItemListOptions) less(a, b ItemMetadata) bool {
+	switch o.Sort {
+	case SortByType:
+		if a.itemType() != b.itemType() {
+			return a.itemType() < b.itemType()
+		}
+	case SortByCreated:
+		if !a.Created.Equal(b.Created) {
+			return a.Created.After(b.Created)
+		}
+	case SortByModified:
+		if !a.Modified.Equal(b.Modified) {
+			return a.Modified.After(b.Modified)
+		}
+	case SortByAccessed:
+		if !a.Accessed.Equal(b.Accessed) {
+			return a.Accessed.After(b.Accessed)
+		}
+	}
+
+	an, bn := strings.ToLower(a.Name), strings.ToLower(b.Name)
+	if an != bn {
+		return an < bn
+	}
+
+	return a.ItemId.String() < b.ItemId.String()
+}
+
+// match reports whether the Item matches the Type, Folder, and Tag filters
+// in the options.
+func (o ItemListOptions) match(imd ItemMetadata) bool {
+	if o.Type != "" && imd.itemType() != o.Type {
+		return false
+	}
+
+	if o.Folder != nil && imd.Folder != *o.Folder {
+		return false
+	}
+
+	if o.Tag != "" && !imd.HasTag(o.Tag) {
+		return false
+	}
+
+	return true
+}
+
+// apply returns the Items that match the filters in the options, in the
+// order given by the options.
+func (o ItemListOptions) apply(items []ItemMetadata) []ItemMetadata {
+	var matched []ItemMetadata
+
+	for _, imd := range items {
+		if o.match(imd) {
+			matched = append(matched, imd)
+		}
+	}
+
+	sort.Slice(matched, func(i, j int) bool {
+		if o.Reverse {
+			return o.less(matched[j], matched[i])
+		}
+
+		return o.less(matched[i], matched[j])
+	})
+
+	return matched
+}
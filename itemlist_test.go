@@ -0,0 +1,191 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	itemListDB   = "itemlist_test.db"
+	itemListUser = "itemlist_user"
+)
+
+func TestItemList(t *testing.T) {
+	t.Run("Test Item List Options", testItemListOptions)
+
+	store, err := NewStore(itemListDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(itemListDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(itemListUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Item Timestamps", func(t *testing.T) { testItemTimestamps(t, &lb) })
+}
+
+// names returns the names of the Items in order.
+func names(items []ItemMetadata) string {
+	var s string
+	for _, imd := range items {
+		s += imd.Name
+	}
+
+	return s
+}
+
+func testItemListOptions(t *testing.T) {
+	fmt.Println(t.Name())
+
+	now := time.Now()
+	items := []ItemMetadata{
+		{ItemId: NewItemToken(), Name: "b", Type: LoginType, Created: now.Add(-3 * time.Hour), Modified: now.Add(-1 * time.Hour)},
+		{ItemId: NewItemToken(), Name: "C", Type: SecureNoteType, Created: now.Add(-2 * time.Hour), Modified: now.Add(-3 * time.Hour)},
+		{ItemId: NewItemToken(), Name: "a", Created: now.Add(-1 * time.Hour), Modified: now.Add(-2 * time.Hour)},
+	}
+
+	tests := []struct {
+		opts     ItemListOptions
+		expected string
+	}{
+		{ItemListOptions{}, "abC"},
+		{ItemListOptions{Reverse: true}, "Cba"},
+		{ItemListOptions{Sort: SortByType}, "baC"},
+		{ItemListOptions{Sort: SortByCreated}, "aCb"},
+		{ItemListOptions{Sort: SortByModified}, "baC"},
+		{ItemListOptions{Sort: SortByModified, Reverse: true}, "Cab"},
+		{ItemListOptions{Type: SecureNoteType}, "aC"},
+	}
+
+	for _, test := range tests {
+		received := names(test.opts.apply(items))
+		if received != test.expected {
+			t.Fatalf("Expected %s for %+v, received %s", test.expected, test.opts, received)
+		}
+	}
+
+	// Items that compare equal are always in the same order.
+	same := []ItemMetadata{
+		{ItemId: NewItemToken(), Name: "x"},
+		{ItemId: NewItemToken(), Name: "x"},
+		{ItemId: NewItemToken(), Name: "x"},
+	}
+
+	first := ItemListOptions{}.apply(same)
+	for i := 0; i < 10; i++ {
+		same[0], same[2] = same[2], same[0]
+		again := ItemListOptions{}.apply(same)
+
+		for n := range first {
+			if first[n].ItemId != again[n].ItemId {
+				t.Fatalf("Expected a stable order, received %v and %v", first, again)
+			}
+		}
+	}
+
+	if _, err := ParseItemSort("Modified"); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if _, err := ParseItemSort("size"); err == nil {
+		t.Fatal("Expected error for an unknown sort, received nil")
+	}
+}
+
+// End-to-end test for the Item timestamps
+//  1. Add a note and ensure the timestamps are set.
+//  2. Update the note and ensure only Modified and Accessed change.
+//  3. Read the note and ensure only Accessed changes.
+//  4. Ensure the timestamps are saved in the Metadata.
+func testItemTimestamps(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(itemListUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	// 1.  Add a note and ensure the timestamps are set.
+	before := time.Now()
+
+	n := NewNoteItem()
+	n.Name = "Timestamps"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	added, _ := ub.metadata.GetItem(n.ItemId)
+	if added.Created.Before(before) || !added.Modified.Equal(added.Created) || !added.Accessed.Equal(added.Created) {
+		t.Fatalf("Expected the timestamps to be set, received %+v", added)
+	}
+
+	// 2.  Update the note and ensure only Modified and Accessed change.
+	n.Data = []byte("updated")
+
+	err = ub.UpdateItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	updated, _ := ub.metadata.GetItem(n.ItemId)
+	if !updated.Created.Equal(added.Created) || !updated.Modified.After(added.Modified) || !updated.Accessed.Equal(updated.Modified) {
+		t.Fatalf("Expected a new modified time, received %+v", updated)
+	}
+
+	// Saving an unchanged note does not change the modified time.
+	err = ub.UpdateItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	unchanged, _ := ub.metadata.GetItem(n.ItemId)
+	if !unchanged.Modified.Equal(updated.Modified) {
+		t.Fatalf("Expected the same modified time, received %+v", unchanged)
+	}
+
+	// 3.  Read the note and ensure only Accessed changes.
+	old := unchanged
+	old.Accessed = old.Accessed.Add(-2 * accessedResolution)
+	ub.metadata.AddItem(old)
+
+	_, err = ub.GetItem(n.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	read, _ := ub.metadata.GetItem(n.ItemId)
+	if !read.Modified.Equal(old.Modified) || !read.Accessed.After(old.Accessed) {
+		t.Fatalf("Expected a new accessed time, received %+v", read)
+	}
+
+	// 4.  Ensure the timestamps are saved in the Metadata.
+	ub2, err := lb.login(itemListUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub2.Lock()
+
+	saved, _ := ub2.metadata.GetItem(n.ItemId)
+	if !saved.Equal(read) {
+		t.Fatalf("Expected %+v, received %+v", read, saved)
+	}
+
+	items := ub2.GetItemListWithOptions(ItemListOptions{Sort: SortByModified})
+	if len(items) != 1 || items[0].ItemId != n.ItemId {
+		t.Fatalf("Expected the note, received %v", items)
+	}
+}
@@ -0,0 +1,1125 @@
+package lckbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20/salsa"
+	"golang.org/x/crypto/twofish"
+)
+
+// The signatures at the start of every KeePass 2 database. KeePass 1 files
+// use a different second signature and are not supported.
+const (
+	kdbxSignature1 = 0x9AA2D903
+	kdbxSignature2 = 0xB54BFB67
+)
+
+// The most expensive key derivation parameters accepted from a KDBX header.
+// The header is not authenticated until the key has been derived, so a
+// damaged or crafted file could otherwise exhaust memory or never finish.
+// They are far above the defaults KeePass uses.
+const (
+	kdbxMaxAESRounds        = 100000000
+	kdbxMaxArgon2Iterations = 100
+	kdbxMaxArgon2Memory     = 2 << 30
+	kdbxMaxArgon2Lanes      = 64
+)
+
+// The fields of the outer header of a KDBX file.
+const (
+	kdbxEndOfHeader         = 0
+	kdbxCipherID            = 2
+	kdbxCompressionFlags    = 3
+	kdbxMasterSeed          = 4
+	kdbxTransformSeed       = 5
+	kdbxTransformRounds     = 6
+	kdbxEncryptionIV        = 7
+	kdbxProtectedStreamKey  = 8
+	kdbxStreamStartBytes    = 9
+	kdbxInnerRandomStreamID = 10
+	kdbxKdfParameters       = 11
+)
+
+// The fields of the inner header of a KDBX 4 file.
+const (
+	kdbxInnerEndOfHeader = 0
+	kdbxInnerStreamID    = 1
+	kdbxInnerStreamKey   = 2
+	kdbxInnerBinary      = 3
+)
+
+// The ciphers that protect the values marked as protected in the XML.
+const (
+	kdbxStreamNone    = 0
+	kdbxStreamSalsa20 = 2
+	kdbxStreamChaCha  = 3
+)
+
+// The types of the values in a KDBX 4 VariantDictionary.
+const (
+	kdbxVariantEnd    = 0x00
+	kdbxVariantUint32 = 0x04
+	kdbxVariantUint64 = 0x05
+	kdbxVariantBool   = 0x08
+	kdbxVariantInt32  = 0x0C
+	kdbxVariantInt64  = 0x0D
+	kdbxVariantString = 0x18
+	kdbxVariantBytes  = 0x42
+)
+
+// The UUIDs that identify the ciphers and key derivation functions.
+var (
+	kdbxCipherAES      = mustDecodeHex("31c1f2e6bf714350be5805216afc5aff")
+	kdbxCipherChaCha20 = mustDecodeHex("d6038a2b8b6f4cb5a524339a31dbb59a")
+	kdbxCipherTwofish  = mustDecodeHex("ad68f29f576f4bb9a36ad47af965346c")
+	kdbxKdfAES         = mustDecodeHex("c9d9f39a628a4460bf740d08c18a4fea")
+	kdbxKdfArgon2d     = mustDecodeHex("ef636ddf8c29444b91f7a9a403e30a0c")
+	kdbxKdfArgon2id    = mustDecodeHex("9e298b1956db4773b23dfc3ec6f0a1e6")
+	kdbxSalsa20Nonce   = mustDecodeHex("e830094b97205d2a")
+)
+
+// errKDBXCredentials is returned when the password or key file is wrong.
+var errKDBXCredentials = errors.New("wrong password or key file")
+
+// mustDecodeHex decodes a hex constant.
+func mustDecodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return b
+}
+
+// IsKDBX reports whether the data starts with the signature of a KeePass 2
+// database.
+func IsKDBX(data []byte) bool {
+	return len(data) >= 8 &&
+		binary.LittleEndian.Uint32(data) == kdbxSignature1 &&
+		binary.LittleEndian.Uint32(data[4:]) == kdbxSignature2
+}
+
+// kdbxHeader is the unencrypted outer header of a KDBX file.
+type kdbxHeader struct {
+	major           uint16
+	minor           uint16
+	cipher          []byte
+	compressed      bool
+	masterSeed      []byte
+	transformSeed   []byte
+	transformRounds uint64
+	iv              []byte
+	streamKey       []byte
+	streamStart     []byte
+	streamID        uint32
+	kdf             map[string]interface{}
+	raw             []byte
+}
+
+// readKDBXHeader reads the outer header. KDBX 3 fields have a 16 bit
+// length and KDBX 4 fields have a 32 bit length.
+func readKDBXHeader(r *bytes.Reader) (kdbxHeader, error) {
+	var h kdbxHeader
+	var start [12]byte
+
+	_, err := io.ReadFull(r, start[:])
+	if err != nil || !IsKDBX(start[:]) {
+		return h, fmt.Errorf("not a KeePass 2 database")
+	}
+
+	version := binary.LittleEndian.Uint32(start[8:])
+	h.major = uint16(version >> 16)
+	h.minor = uint16(version)
+
+	if h.major != 3 && h.major != 4 {
+		return h, fmt.Errorf("unsupported KDBX version %d.%d", h.major, h.minor)
+	}
+
+	for {
+		id, err := r.ReadByte()
+		if err != nil {
+			return h, fmt.Errorf("header is truncated")
+		}
+
+		var size uint32
+		if h.major == 3 {
+			var size16 uint16
+			err = binary.Read(r, binary.LittleEndian, &size16)
+			size = uint32(size16)
+		} else {
+			err = binary.Read(r, binary.LittleEndian, &size)
+		}
+
+		if err != nil || int64(size) > int64(r.Len()) {
+			return h, fmt.Errorf("header is truncated")
+		}
+
+		data := make([]byte, size)
+		io.ReadFull(r, data)
+
+		switch id {
+		case kdbxEndOfHeader:
+			read := int(r.Size()) - r.Len()
+			r.Seek(0, io.SeekStart)
+			h.raw = make([]byte, read)
+			io.ReadFull(r, h.raw)
+
+			return h, h.validate()
+		case kdbxCipherID:
+			h.cipher = data
+		case kdbxCompressionFlags:
+			if len(data) != 4 {
+				return h, fmt.Errorf("invalid compression flags")
+			}
+			h.compressed = binary.LittleEndian.Uint32(data) == 1
+		case kdbxMasterSeed:
+			h.masterSeed = data
+		case kdbxTransformSeed:
+			h.transformSeed = data
+		case kdbxTransformRounds:
+			if len(data) != 8 {
+				return h, fmt.Errorf("invalid transform rounds")
+			}
+			h.transformRounds = binary.LittleEndian.Uint64(data)
+		case kdbxEncryptionIV:
+			h.iv = data
+		case kdbxProtectedStreamKey:
+			h.streamKey = data
+		case kdbxStreamStartBytes:
+			h.streamStart = data
+		case kdbxInnerRandomStreamID:
+			if len(data) != 4 {
+				return h, fmt.Errorf("invalid inner stream id")
+			}
+			h.streamID = binary.LittleEndian.Uint32(data)
+		case kdbxKdfParameters:
+			h.kdf, err = readVariantDictionary(data)
+			if err != nil {
+				return h, err
+			}
+		}
+	}
+}
+
+// validate ensures the header has every field needed to open the file.
+func (h *kdbxHeader) validate() error {
+	if len(h.masterSeed) != 32 {
+		return fmt.Errorf("invalid master seed")
+	}
+
+	if h.major == 3 && (len(h.transformSeed) != 32 || len(h.streamStart) != 32) {
+		return fmt.Errorf("invalid transform seed or stream start bytes")
+	}
+
+	if h.major == 4 && h.kdf == nil {
+		return fmt.Errorf("missing key derivation parameters")
+	}
+
+	return nil
+}
+
+// readVariantDictionary reads the typed key and value pairs used for the
+// KDBX 4 key derivation parameters.
+func readVariantDictionary(data []byte) (map[string]interface{}, error) {
+	r := bytes.NewReader(data)
+	dict := make(map[string]interface{})
+
+	var version uint16
+	err := binary.Read(r, binary.LittleEndian, &version)
+	if err != nil || version>>8 != 1 {
+		return nil, fmt.Errorf("unsupported variant dictionary")
+	}
+
+	readBytes := func() ([]byte, error) {
+		var size int32
+		err := binary.Read(r, binary.LittleEndian, &size)
+		if err != nil || size < 0 || int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("variant dictionary is truncated")
+		}
+
+		b := make([]byte, size)
+		io.ReadFull(r, b)
+
+		return b, nil
+	}
+
+	for {
+		kind, err := r.ReadByte()
+		if err != nil {
+			return nil, fmt.Errorf("variant dictionary is truncated")
+		}
+
+		if kind == kdbxVariantEnd {
+			return dict, nil
+		}
+
+		key, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := readBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		size := map[byte]int{
+			kdbxVariantUint32: 4, kdbxVariantInt32: 4,
+			kdbxVariantUint64: 8, kdbxVariantInt64: 8,
+			kdbxVariantBool: 1,
+		}
+		if n, ok := size[kind]; ok && len(value) != n {
+			return nil, fmt.Errorf("invalid variant dictionary value %q", key)
+		}
+
+		switch kind {
+		case kdbxVariantUint32, kdbxVariantInt32:
+			dict[string(key)] = uint64(binary.LittleEndian.Uint32(value))
+		case kdbxVariantUint64, kdbxVariantInt64:
+			dict[string(key)] = binary.LittleEndian.Uint64(value)
+		case kdbxVariantBool:
+			dict[string(key)] = value[0] != 0
+		case kdbxVariantString:
+			dict[string(key)] = string(value)
+		case kdbxVariantBytes:
+			dict[string(key)] = value
+		default:
+			return nil, fmt.Errorf("unknown variant dictionary type %#x", kind)
+		}
+	}
+}
+
+// kdbxKeyFileHash returns the 32 byte key held in a KeePass key file. XML
+// key files hold the key in base64 (version 1) or hex (version 2), files of
+// exactly 32 bytes or 64 hex digits are the key itself, and any other file
+// is hashed.
+func kdbxKeyFileHash(data []byte) ([]byte, error) {
+	var keyFile struct {
+		Meta struct {
+			Version string
+		}
+		Key struct {
+			Data struct {
+				Hash string `xml:",attr"`
+				Text string `xml:",chardata"`
+			}
+		}
+	}
+
+	if err := xml.Unmarshal(data, &keyFile); err == nil && keyFile.Key.Data.Text != "" {
+		text := keyFile.Key.Data.Text
+
+		if strings.HasPrefix(keyFile.Meta.Version, "2.") {
+			key, err := hex.DecodeString(strings.Map(func(r rune) rune {
+				if unicode.IsSpace(r) {
+					return -1
+				}
+				return r
+			}, text))
+			if err != nil || len(key) != 32 {
+				return nil, fmt.Errorf("invalid key file")
+			}
+
+			sum := sha256.Sum256(key)
+			if hash, _ := hex.DecodeString(keyFile.Key.Data.Hash); hash != nil && !bytes.Equal(hash, sum[:4]) {
+				return nil, fmt.Errorf("key file is corrupt")
+			}
+
+			return key, nil
+		}
+
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("invalid key file")
+		}
+
+		return key, nil
+	}
+
+	if len(data) == 32 {
+		return data, nil
+	}
+
+	if len(data) == 64 {
+		if key, err := hex.DecodeString(string(data)); err == nil {
+			return key, nil
+		}
+	}
+
+	sum := sha256.Sum256(data)
+
+	return sum[:], nil
+}
+
+// kdbxCompositeKey combines the password and key file into the key that is
+// passed to the key derivation function. The password is left out when only
+// a key file is given.
+func kdbxCompositeKey(password string, keyFile []byte) ([]byte, error) {
+	h := sha256.New()
+
+	if password != "" || keyFile == nil {
+		sum := sha256.Sum256([]byte(password))
+		h.Write(sum[:])
+	}
+
+	if keyFile != nil {
+		key, err := kdbxKeyFileHash(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		h.Write(key)
+	}
+
+	return h.Sum(nil), nil
+}
+
+// transformKey runs the key derivation function named in the header on the
+// composite key.
+func (h *kdbxHeader) transformKey(composite []byte) ([]byte, error) {
+	if h.major == 3 {
+		return kdbxAESKDF(composite, h.transformSeed, h.transformRounds)
+	}
+
+	uuid, _ := h.kdf["$UUID"].([]byte)
+	salt, _ := h.kdf["S"].([]byte)
+
+	switch {
+	case bytes.Equal(uuid, kdbxKdfAES):
+		rounds, _ := h.kdf["R"].(uint64)
+		return kdbxAESKDF(composite, salt, rounds)
+	case bytes.Equal(uuid, kdbxKdfArgon2d), bytes.Equal(uuid, kdbxKdfArgon2id):
+		iterations, _ := h.kdf["I"].(uint64)
+		memory, _ := h.kdf["M"].(uint64)
+		lanes, _ := h.kdf["P"].(uint64)
+		version, _ := h.kdf["V"].(uint64)
+		secret, _ := h.kdf["K"].([]byte)
+		data, _ := h.kdf["A"].([]byte)
+
+		if version != argon2Version {
+			return nil, fmt.Errorf("unsupported Argon2 version %#x", version)
+		}
+
+		if iterations < 1 || iterations > kdbxMaxArgon2Iterations || memory > kdbxMaxArgon2Memory || lanes < 1 || lanes > kdbxMaxArgon2Lanes {
+			return nil, fmt.Errorf("invalid Argon2 parameters")
+		}
+
+		if bytes.Equal(uuid, kdbxKdfArgon2d) {
+			return argon2dKey(composite, salt, secret, data, uint32(iterations), uint32(memory/1024), uint8(lanes), 32)
+		}
+
+		if secret != nil || data != nil {
+			return nil, fmt.Errorf("unsupported Argon2id parameters")
+		}
+
+		return argon2.IDKey(composite, salt, uint32(iterations), uint32(memory/1024), uint8(lanes), 32), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key derivation function %x", uuid)
+}
+
+// kdbxAESKDF encrypts the key with AES-256 using the seed as the key, the
+// given number of times, and hashes the result.
+func kdbxAESKDF(key, seed []byte, rounds uint64) ([]byte, error) {
+	if rounds > kdbxMaxAESRounds {
+		return nil, fmt.Errorf("invalid AES-KDF rounds")
+	}
+
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, fmt.Errorf("invalid AES-KDF seed")
+	}
+
+	out := append([]byte{}, key...)
+	for n := uint64(0); n < rounds; n++ {
+		block.Encrypt(out[:16], out[:16])
+		block.Encrypt(out[16:], out[16:])
+	}
+
+	sum := sha256.Sum256(out)
+
+	return sum[:], nil
+}
+
+// decryptPayload decrypts the database with the cipher named in the header.
+// The block ciphers use CBC mode with PKCS #7 padding, which fails to
+// remove when the key is wrong.
+func (h *kdbxHeader) decryptPayload(key, data []byte) ([]byte, error) {
+	if bytes.Equal(h.cipher, kdbxCipherChaCha20) {
+		stream, err := chacha20.NewUnauthenticatedCipher(key, h.iv)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ChaCha20 parameters")
+		}
+
+		plain := make([]byte, len(data))
+		stream.XORKeyStream(plain, data)
+
+		return plain, nil
+	}
+
+	var block cipher.Block
+	var err error
+
+	switch {
+	case bytes.Equal(h.cipher, kdbxCipherAES):
+		block, err = aes.NewCipher(key)
+	case bytes.Equal(h.cipher, kdbxCipherTwofish):
+		block, err = twofish.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("unsupported cipher %x", h.cipher)
+	}
+
+	if err != nil || len(h.iv) != block.BlockSize() {
+		return nil, fmt.Errorf("invalid cipher parameters")
+	}
+
+	if len(data) == 0 || len(data)%block.BlockSize() != 0 {
+		return nil, fmt.Errorf("payload is truncated")
+	}
+
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, h.iv).CryptBlocks(plain, data)
+
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > block.BlockSize() {
+		return nil, errKDBXCredentials
+	}
+
+	for _, b := range plain[len(plain)-pad:] {
+		if int(b) != pad {
+			return nil, errKDBXCredentials
+		}
+	}
+
+	return plain[:len(plain)-pad], nil
+}
+
+// decompress removes the gzip compression from the payload, if the header
+// says it is compressed.
+func (h *kdbxHeader) decompress(data []byte) ([]byte, error) {
+	if !h.compressed {
+		return data, nil
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress payload: %v", err)
+	}
+
+	plain, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("could not decompress payload: %v", err)
+	}
+
+	return plain, nil
+}
+
+// readKDBX3Blocks reads the hashed blocks of a KDBX 3 payload. Each block
+// holds its index, the SHA-256 hash of its data, and the data, and an empty
+// block ends the payload.
+func readKDBX3Blocks(data []byte) ([]byte, error) {
+	var payload []byte
+	r := bytes.NewReader(data)
+
+	for {
+		var index, size uint32
+		var hash [32]byte
+
+		err := binary.Read(r, binary.LittleEndian, &index)
+		if err == nil {
+			_, err = io.ReadFull(r, hash[:])
+		}
+		if err == nil {
+			err = binary.Read(r, binary.LittleEndian, &size)
+		}
+		if err != nil || int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("payload is truncated")
+		}
+
+		if size == 0 {
+			return payload, nil
+		}
+
+		block := make([]byte, size)
+		io.ReadFull(r, block)
+
+		sum := sha256.Sum256(block)
+		if sum != hash {
+			return nil, fmt.Errorf("payload block %d is corrupt", index)
+		}
+
+		payload = append(payload, block...)
+	}
+}
+
+// kdbxBlockKey returns the HMAC key for a KDBX 4 block. The header uses the
+// largest index.
+func kdbxBlockKey(hmacKey []byte, index uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], index)
+
+	h := sha512.New()
+	h.Write(b[:])
+	h.Write(hmacKey)
+
+	return h.Sum(nil)
+}
+
+// readKDBX4Blocks reads the HMAC blocks of a KDBX 4 payload. Each block
+// holds the HMAC-SHA-256 of its index, size, and data, then its size and
+// data, and an empty block ends the payload.
+func readKDBX4Blocks(data, hmacKey []byte) ([]byte, error) {
+	var payload []byte
+	r := bytes.NewReader(data)
+
+	for index := uint64(0); ; index++ {
+		var mac [32]byte
+		var size int32
+
+		_, err := io.ReadFull(r, mac[:])
+		if err == nil {
+			err = binary.Read(r, binary.LittleEndian, &size)
+		}
+		if err != nil || size < 0 || int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("payload is truncated")
+		}
+
+		block := make([]byte, size)
+		io.ReadFull(r, block)
+
+		var prefix [12]byte
+		binary.LittleEndian.PutUint64(prefix[:], index)
+		binary.LittleEndian.PutUint32(prefix[8:], uint32(size))
+
+		h := hmac.New(sha256.New, kdbxBlockKey(hmacKey, index))
+		h.Write(prefix[:])
+		h.Write(block)
+		if !hmac.Equal(h.Sum(nil), mac[:]) {
+			return nil, fmt.Errorf("payload block %d is corrupt", index)
+		}
+
+		if size == 0 {
+			return payload, nil
+		}
+
+		payload = append(payload, block...)
+	}
+}
+
+// salsa20Stream is the Salsa20 key stream KeePass uses to protect values in
+// KDBX 3 files. It implements cipher.Stream.
+type salsa20Stream struct {
+	key     [32]byte
+	counter [16]byte
+	block   [64]byte
+	used    int
+}
+
+// newSalsa20Stream creates the stream from the protected stream key.
+func newSalsa20Stream(key []byte) *salsa20Stream {
+	s := salsa20Stream{key: sha256.Sum256(key), used: 64}
+	copy(s.counter[:], kdbxSalsa20Nonce)
+
+	return &s
+}
+
+// XORKeyStream XORs each byte in src with the next byte of the key stream.
+func (s *salsa20Stream) XORKeyStream(dst, src []byte) {
+	for n := range src {
+		if s.used == len(s.block) {
+			var zero [64]byte
+			salsa.XORKeyStream(s.block[:], zero[:], &s.counter, &s.key)
+			binary.LittleEndian.PutUint64(s.counter[8:], binary.LittleEndian.Uint64(s.counter[8:])+1)
+			s.used = 0
+		}
+
+		dst[n] = src[n] ^ s.block[s.used]
+		s.used++
+	}
+}
+
+// newKDBXInnerStream returns the stream that protects values in the XML.
+func newKDBXInnerStream(id uint32, key []byte) (cipher.Stream, error) {
+	switch id {
+	case kdbxStreamNone:
+		return nil, nil
+	case kdbxStreamSalsa20:
+		return newSalsa20Stream(key), nil
+	case kdbxStreamChaCha:
+		sum := sha512.Sum512(key)
+		return chacha20.NewUnauthenticatedCipher(sum[:32], sum[32:44])
+	}
+
+	return nil, fmt.Errorf("unsupported inner stream %d", id)
+}
+
+// kdbxFile is a decrypted KeePass database.
+type kdbxFile struct {
+	root     *kdbxNode
+	binaries [][]byte
+}
+
+// openKDBX3 decrypts a KDBX 3 payload. A wrong key is detected by the
+// stream start bytes at the start of the decrypted payload.
+func openKDBX3(h kdbxHeader, data, transformed []byte) (kdbxFile, error) {
+	var f kdbxFile
+
+	key := sha256.Sum256(append(append([]byte{}, h.masterSeed...), transformed...))
+
+	plain, err := h.decryptPayload(key[:], data)
+	if err != nil {
+		return f, err
+	}
+
+	if len(plain) < 32 || subtle.ConstantTimeCompare(plain[:32], h.streamStart) != 1 {
+		return f, errKDBXCredentials
+	}
+
+	payload, err := readKDBX3Blocks(plain[32:])
+	if err != nil {
+		return f, err
+	}
+
+	payload, err = h.decompress(payload)
+	if err != nil {
+		return f, err
+	}
+
+	stream, err := newKDBXInnerStream(h.streamID, h.streamKey)
+	if err != nil {
+		return f, err
+	}
+
+	f.root, err = parseKDBXXML(payload, stream)
+	if err != nil {
+		return f, err
+	}
+
+	// KDBX 3 files keep the attachments in the XML.
+	for _, b := range f.root.child("Meta").child("Binaries").all("Binary") {
+		data, err := base64.StdEncoding.DecodeString(b.text)
+		if err != nil {
+			return f, fmt.Errorf("invalid binary %s", b.attrs["ID"])
+		}
+
+		if b.attrs["Compressed"] == "True" {
+			data, err = (&kdbxHeader{compressed: true}).decompress(data)
+			if err != nil {
+				return f, err
+			}
+		}
+
+		var id int
+		fmt.Sscan(b.attrs["ID"], &id)
+		for len(f.binaries) <= id {
+			f.binaries = append(f.binaries, nil)
+		}
+		f.binaries[id] = data
+	}
+
+	return f, nil
+}
+
+// openKDBX4 decrypts a KDBX 4 payload. The header is followed by its SHA-256
+// hash and HMAC, and a wrong key is detected by the HMAC.
+func openKDBX4(h kdbxHeader, data, transformed []byte) (kdbxFile, error) {
+	var f kdbxFile
+
+	if len(data) < 64 {
+		return f, fmt.Errorf("header is truncated")
+	}
+
+	sum := sha256.Sum256(h.raw)
+	if !bytes.Equal(sum[:], data[:32]) {
+		return f, fmt.Errorf("header is corrupt")
+	}
+
+	seeded := append(append([]byte{}, h.masterSeed...), transformed...)
+	key := sha256.Sum256(seeded)
+	hmacKey := sha512.Sum512(append(seeded, 1))
+
+	mac := hmac.New(sha256.New, kdbxBlockKey(hmacKey[:], ^uint64(0)))
+	mac.Write(h.raw)
+	if !hmac.Equal(mac.Sum(nil), data[32:64]) {
+		return f, errKDBXCredentials
+	}
+
+	payload, err := readKDBX4Blocks(data[64:], hmacKey[:])
+	if err != nil {
+		return f, err
+	}
+
+	payload, err = h.decryptPayload(key[:], payload)
+	if err != nil {
+		return f, err
+	}
+
+	payload, err = h.decompress(payload)
+	if err != nil {
+		return f, err
+	}
+
+	// The inner header holds the inner stream and the attachments.
+	r := bytes.NewReader(payload)
+	var streamID uint32
+	var streamKey []byte
+
+	for done := false; !done; {
+		id, err := r.ReadByte()
+		if err != nil {
+			return f, fmt.Errorf("inner header is truncated")
+		}
+
+		var size int32
+		err = binary.Read(r, binary.LittleEndian, &size)
+		if err != nil || size < 0 || int64(size) > int64(r.Len()) {
+			return f, fmt.Errorf("inner header is truncated")
+		}
+
+		field := make([]byte, size)
+		io.ReadFull(r, field)
+
+		switch id {
+		case kdbxInnerEndOfHeader:
+			done = true
+		case kdbxInnerStreamID:
+			if len(field) != 4 {
+				return f, fmt.Errorf("invalid inner stream id")
+			}
+			streamID = binary.LittleEndian.Uint32(field)
+		case kdbxInnerStreamKey:
+			streamKey = field
+		case kdbxInnerBinary:
+			if len(field) < 1 {
+				return f, fmt.Errorf("invalid binary")
+			}
+			f.binaries = append(f.binaries, field[1:])
+		}
+	}
+
+	stream, err := newKDBXInnerStream(streamID, streamKey)
+	if err != nil {
+		return f, err
+	}
+
+	xmlData, _ := io.ReadAll(r)
+	f.root, err = parseKDBXXML(xmlData, stream)
+
+	return f, err
+}
+
+// openKDBX decrypts a KeePass 2 database with the password and optional key
+// file.
+func openKDBX(data []byte, password string, keyFile []byte) (kdbxFile, error) {
+	r := bytes.NewReader(data)
+
+	h, err := readKDBXHeader(r)
+	if err != nil {
+		return kdbxFile{}, err
+	}
+
+	composite, err := kdbxCompositeKey(password, keyFile)
+	if err != nil {
+		return kdbxFile{}, err
+	}
+
+	transformed, err := h.transformKey(composite)
+	if err != nil {
+		return kdbxFile{}, err
+	}
+
+	payload := data[len(h.raw):]
+	if h.major == 3 {
+		return openKDBX3(h, payload, transformed)
+	}
+
+	return openKDBX4(h, payload, transformed)
+}
+
+// kdbxNode is an element of the KeePass XML.
+type kdbxNode struct {
+	name     string
+	attrs    map[string]string
+	text     string
+	children []*kdbxNode
+}
+
+// child returns the first child element with the given name, or an empty
+// element if there is none.
+func (n *kdbxNode) child(name string) *kdbxNode {
+	for _, c := range n.children {
+		if c.name == name {
+			return c
+		}
+	}
+
+	return &kdbxNode{}
+}
+
+// all returns every child element with the given name.
+func (n *kdbxNode) all(name string) []*kdbxNode {
+	var nodes []*kdbxNode
+	for _, c := range n.children {
+		if c.name == name {
+			nodes = append(nodes, c)
+		}
+	}
+
+	return nodes
+}
+
+// parseKDBXXML reads the XML into a tree of elements. Protected values are
+// XORed with the inner stream in the order they appear in the document,
+// which is the order KeePass protected them in.
+func parseKDBXXML(data []byte, stream cipher.Stream) (*kdbxNode, error) {
+	root := &kdbxNode{}
+	stack := []*kdbxNode{root}
+
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid XML: %v", err)
+		}
+
+		top := stack[len(stack)-1]
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			node := &kdbxNode{name: t.Name.Local, attrs: make(map[string]string)}
+			for _, a := range t.Attr {
+				node.attrs[a.Name.Local] = a.Value
+			}
+
+			top.children = append(top.children, node)
+			stack = append(stack, node)
+		case xml.CharData:
+			top.text += string(t)
+		case xml.EndElement:
+			if top.attrs["Protected"] == "True" && stream != nil {
+				value, err := base64.StdEncoding.DecodeString(strings.TrimSpace(top.text))
+				if err != nil {
+					return nil, fmt.Errorf("invalid protected value")
+				}
+
+				stream.XORKeyStream(value, value)
+				top.text = string(value)
+			}
+
+			stack = stack[:len(stack)-1]
+		}
+	}
+
+	if len(root.children) == 0 || root.children[0].name != "KeePassFile" {
+		return nil, fmt.Errorf("missing KeePassFile element")
+	}
+
+	return root.children[0], nil
+}
+
+// kdbxTime reads a KeePass timestamp. KDBX 3 files hold the time as text and
+// KDBX 4 files hold the seconds since the year 1 in base64.
+func kdbxTime(text string) time.Time {
+	text = strings.TrimSpace(text)
+
+	if t, err := time.Parse(time.RFC3339, text); err == nil {
+		return t
+	}
+
+	b, err := base64.StdEncoding.DecodeString(text)
+	if err != nil || len(b) != 8 {
+		return time.Time{}
+	}
+
+	// The seconds between the year 1 and the Unix epoch.
+	const unixOffset = 62135596800
+
+	return time.Unix(int64(binary.LittleEndian.Uint64(b))-unixOffset, 0)
+}
+
+// kdbxFields maps the standard fields of an entry to the parts of a Login
+// Item.
+var kdbxFields = map[string]string{
+	"Title":    "name",
+	"UserName": "username",
+	"Password": "password",
+	"URL":      "url",
+	"Notes":    "notes",
+}
+
+// entryItem converts an entry to a Login Item. The notes and any custom
+// fields, one "key: value" line each, become the notes of the Item, and tags
+// are split on commas and semicolons. Attachments that are missing from the
+// file are reported.
+func (f kdbxFile) entryItem(e *kdbxNode, path []string) (ImportEntry, []ImportFailure) {
+	var failures []ImportFailure
+	var entry ImportEntry
+
+	fields := make(map[string]string)
+	var custom []string
+
+	for _, s := range e.all("String") {
+		key := s.child("Key").text
+		value := s.child("Value").text
+
+		if to, ok := kdbxFields[key]; ok {
+			fields[key] = value
+			if value != "" {
+				entry.mapField(key, to)
+			}
+			continue
+		}
+
+		if value != "" {
+			custom = append(custom, key+": "+value)
+			entry.mapField(key, "notes")
+		}
+	}
+
+	i := NewItem(LoginType)
+	i.Login.Username = fields["UserName"]
+	i.Login.Password = fields["Password"]
+
+	if url := strings.TrimSpace(fields["URL"]); url != "" {
+		i.Login.URLs = []string{url}
+	}
+
+	i.Name = fields["Title"]
+	if i.Name == "" {
+		i.Name = fields["URL"]
+	}
+
+	i.Data = []byte(importNotes(fields["Notes"], custom))
+
+	entry.Entry = strings.Join(append(append([]string{}, path...), i.Name), "/")
+	entry.Item = i
+	entry.Folder = path
+	entry.Created = kdbxTime(e.child("Times").child("CreationTime").text)
+	entry.Modified = kdbxTime(e.child("Times").child("LastModificationTime").text)
+
+	entry.Tags = strings.FieldsFunc(e.child("Tags").text, func(r rune) bool {
+		return r == ',' || r == ';'
+	})
+	if len(entry.Tags) > 0 {
+		entry.mapField("Tags", "tags")
+	}
+
+	for _, b := range e.all("Binary") {
+		name := b.child("Key").text
+
+		var ref int
+		_, err := fmt.Sscan(b.child("Value").attrs["Ref"], &ref)
+		if err != nil || ref < 0 || ref >= len(f.binaries) || f.binaries[ref] == nil {
+			failures = append(failures, ImportFailure{
+				Entry:  entry.Entry,
+				Reason: fmt.Sprintf("attachment %q is missing", name),
+			})
+			continue
+		}
+
+		entry.Attachments = append(entry.Attachments, ImportAttachment{Name: name, Data: f.binaries[ref]})
+		entry.mapField("Binary", "attachments")
+	}
+
+	return entry, failures
+}
+
+// entries converts every entry in the database. The root group is the top
+// level and the groups inside it become Folders. Entries in the recycle bin
+// are left out and reported.
+func (f kdbxFile) entries() ([]ImportEntry, []ImportFailure) {
+	var entries []ImportEntry
+	var failures []ImportFailure
+
+	meta := f.root.child("Meta")
+
+	recycleBin := ""
+	if meta.child("RecycleBinEnabled").text != "False" {
+		recycleBin = strings.TrimSpace(meta.child("RecycleBinUUID").text)
+	}
+
+	var walk func(g *kdbxNode, path []string, skip string)
+	walk = func(g *kdbxNode, path []string, skip string) {
+		for _, e := range g.all("Entry") {
+			entry, problems := f.entryItem(e, path)
+
+			if skip != "" {
+				failures = append(failures, ImportFailure{Entry: entry.Entry, Reason: skip})
+				continue
+			}
+
+			if len(path) > 0 {
+				entry.mapField("Group", "folder")
+			}
+
+			entries = append(entries, entry)
+			failures = append(failures, problems...)
+		}
+
+		for _, c := range g.all("Group") {
+			reason := skip
+			if recycleBin != "" && strings.TrimSpace(c.child("UUID").text) == recycleBin {
+				reason = "in the recycle bin"
+			}
+
+			walk(c, append(path[:len(path):len(path)], c.child("Name").text), reason)
+		}
+	}
+
+	for _, g := range f.root.child("Root").all("Group") {
+		walk(g, nil, "")
+	}
+
+	return entries, failures
+}
+
+// kdbxImporter reads KeePass databases in the KDBX 3.1 and 4 formats, with
+// the password and optional key file in the ImportOptions. Every entry
+// becomes a Login Item, groups become Folders, notes and custom fields
+// become the notes of the Item, and tags, attachments, and timestamps are
+// kept.
+type kdbxImporter struct{}
+
+// Detect reports whether the data starts with the KDBX signature.
+func (kdbxImporter) Detect(data []byte) bool {
+	return IsKDBX(data)
+}
+
+// Encrypted reports true, since every KeePass database is encrypted.
+func (kdbxImporter) Encrypted(data []byte) bool {
+	return true
+}
+
+// Read decrypts the database and converts its entries.
+func (kdbxImporter) Read(data []byte, opts ImportOptions) ([]ImportEntry, []ImportFailure, error) {
+	f, err := openKDBX(data, opts.Password, opts.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries, failures := f.entries()
+
+	return entries, failures, nil
+}
@@ -0,0 +1,514 @@
+package lckbx
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+	"golang.org/x/crypto/salsa20"
+)
+
+var (
+	kdbxDB       = "kdbx_test.db"
+	kdbxUser     = "kdbx_user"
+	kdbxPassword = "correct horse battery staple"
+	kdbxKeyFile  = []byte(`<?xml version="1.0" encoding="utf-8"?>
+<KeyFile>
+	<Meta><Version>2.0</Version></Meta>
+	<Key>
+		<Data Hash="AE216C2E">
+			0102030405060708 090A0B0C0D0E0F10
+			1112131415161718 191A1B1C1D1E1F20
+		</Data>
+	</Key>
+</KeyFile>`)
+	kdbxCreated  = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	kdbxModified = time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+)
+
+func TestKDBX(t *testing.T) {
+	store, err := NewStore(kdbxDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(kdbxDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(kdbxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test KDBX Key File", testKDBXKeyFile)
+	t.Run("Test KDBX 3 Import", func(t *testing.T) { testKDBXImport(t, &lb, 3) })
+	t.Run("Test KDBX 4 Import", func(t *testing.T) { testKDBXImport(t, &lb, 4) })
+	t.Run("Test KDBX Invalid", func(t *testing.T) { testKDBXInvalid(t, &lb) })
+}
+
+// kdbxTestXML returns the XML of a database with an entry at the top level,
+// an entry with every field in the Work group, and an entry in the recycle
+// bin. Protected values are XORed with the stream in document order.
+func kdbxTestXML(version int, stream cipher.Stream) []byte {
+	protect := func(value string) string {
+		b := []byte(value)
+		stream.XORKeyStream(b, b)
+		return base64.StdEncoding.EncodeToString(b)
+	}
+
+	when := func(t time.Time) string {
+		if version == 3 {
+			return t.Format(time.RFC3339)
+		}
+
+		var b [8]byte
+		binary.LittleEndian.PutUint64(b[:], uint64(t.Unix()+62135596800))
+		return base64.StdEncoding.EncodeToString(b[:])
+	}
+
+	binaries := ""
+	if version == 3 {
+		binaries = `<Binaries><Binary ID="0">` + base64.StdEncoding.EncodeToString([]byte("recovery codes")) + `</Binary></Binaries>`
+	}
+
+	top := `<Entry>
+		<String><Key>Title</Key><Value>Top</Value></String>
+		<String><Key>UserName</Key><Value>top</Value></String>
+		<String><Key>Password</Key><Value Protected="True">` + protect("toppass") + `</Value></String>
+	</Entry>`
+
+	github := `<Entry>
+		<Times>
+			<CreationTime>` + when(kdbxCreated) + `</CreationTime>
+			<LastModificationTime>` + when(kdbxModified) + `</LastModificationTime>
+		</Times>
+		<Tags>dev;2fa</Tags>
+		<String><Key>Title</Key><Value>GitHub</Value></String>
+		<String><Key>UserName</Key><Value>octocat</Value></String>
+		<String><Key>Password</Key><Value Protected="True">` + protect("hunter2") + `</Value></String>
+		<String><Key>URL</Key><Value>https://github.com</Value></String>
+		<String><Key>Notes</Key><Value>Codes are attached.</Value></String>
+		<String><Key>PIN</Key><Value Protected="True">` + protect("1234") + `</Value></String>
+		<Binary><Key>codes.txt</Key><Value Ref="0"/></Binary>
+		<Binary><Key>lost.txt</Key><Value Ref="7"/></Binary>
+	</Entry>`
+
+	old := `<Entry>
+		<String><Key>Title</Key><Value>Old</Value></String>
+		<String><Key>Password</Key><Value Protected="True">` + protect("oldpass") + `</Value></String>
+	</Entry>`
+
+	return []byte(`<?xml version="1.0" encoding="utf-8" standalone="yes"?>
+<KeePassFile>
+	<Meta>
+		<RecycleBinEnabled>True</RecycleBinEnabled>
+		<RecycleBinUUID>cmVjeWNsZWJpbnV1aWQxMg==</RecycleBinUUID>
+		` + binaries + `
+	</Meta>
+	<Root>
+		<Group>
+			<UUID>cm9vdHJvb3Ryb290cm9vdA==</UUID>
+			<Name>Database</Name>
+			` + top + `
+			<Group>
+				<UUID>d29ya3dvcmt3b3Jrd29yaw==</UUID>
+				<Name>Work</Name>
+				` + github + `
+			</Group>
+			<Group>
+				<UUID>cmVjeWNsZWJpbnV1aWQxMg==</UUID>
+				<Name>Recycle Bin</Name>
+				` + old + `
+			</Group>
+		</Group>
+	</Root>
+</KeePassFile>`)
+}
+
+// kdbxTestGzip compresses the data.
+func kdbxTestGzip(data []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(data)
+	gz.Close()
+
+	return buf.Bytes()
+}
+
+// kdbxTestComposite returns the composite key for the password and key
+// file, which holds the bytes 1 to 32.
+func kdbxTestComposite(password string, keyFile bool) []byte {
+	h := sha256.New()
+
+	sum := sha256.Sum256([]byte(password))
+	h.Write(sum[:])
+
+	if keyFile {
+		key, _ := hex.DecodeString("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+		h.Write(key)
+	}
+
+	return h.Sum(nil)
+}
+
+// kdbxTestField writes a header field with a 16 bit length for KDBX 3, or
+// a 32 bit length for KDBX 4.
+func kdbxTestField(buf *bytes.Buffer, version int, id byte, data []byte) {
+	buf.WriteByte(id)
+	if version == 3 {
+		binary.Write(buf, binary.LittleEndian, uint16(len(data)))
+	} else {
+		binary.Write(buf, binary.LittleEndian, uint32(len(data)))
+	}
+	buf.Write(data)
+}
+
+// kdbxTestUint returns the little-endian bytes of a 32 or 64 bit value.
+func kdbxTestUint(v interface{}) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, v)
+
+	return buf.Bytes()
+}
+
+// buildKDBX3 writes a KDBX 3.1 database encrypted with AES-256, with the key
+// derived by AES-KDF and the protected values encrypted with Salsa20.
+func buildKDBX3(password string, keyFile bool) []byte {
+	masterSeed := bytes.Repeat([]byte{0x11}, 32)
+	transformSeed := bytes.Repeat([]byte{0x22}, 32)
+	iv := bytes.Repeat([]byte{0x33}, 16)
+	streamKey := bytes.Repeat([]byte{0x44}, 32)
+	streamStart := bytes.Repeat([]byte{0x55}, 32)
+	rounds := uint64(100)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{kdbxSignature1, kdbxSignature2, 3<<16 | 1})
+	kdbxTestField(&buf, 3, kdbxCipherID, kdbxCipherAES)
+	kdbxTestField(&buf, 3, kdbxCompressionFlags, kdbxTestUint(uint32(1)))
+	kdbxTestField(&buf, 3, kdbxMasterSeed, masterSeed)
+	kdbxTestField(&buf, 3, kdbxTransformSeed, transformSeed)
+	kdbxTestField(&buf, 3, kdbxTransformRounds, kdbxTestUint(rounds))
+	kdbxTestField(&buf, 3, kdbxEncryptionIV, iv)
+	kdbxTestField(&buf, 3, kdbxProtectedStreamKey, streamKey)
+	kdbxTestField(&buf, 3, kdbxStreamStartBytes, streamStart)
+	kdbxTestField(&buf, 3, kdbxInnerRandomStreamID, kdbxTestUint(uint32(kdbxStreamSalsa20)))
+	kdbxTestField(&buf, 3, kdbxEndOfHeader, []byte("\r\n\r\n"))
+
+	// The protected values are encrypted with a single Salsa20 stream.
+	salsaKey := sha256.Sum256(streamKey)
+	keyStream := make([]byte, 4096)
+	salsa20.XORKeyStream(keyStream, keyStream, kdbxSalsa20Nonce, &salsaKey)
+	xml := kdbxTestXML(3, &kdbxTestStream{keyStream: keyStream})
+
+	// The payload is the stream start bytes, then a single hashed block and
+	// the empty block that ends it.
+	compressed := kdbxTestGzip(xml)
+	blockHash := sha256.Sum256(compressed)
+
+	payload := append([]byte{}, streamStart...)
+	payload = append(payload, kdbxTestUint(uint32(0))...)
+	payload = append(payload, blockHash[:]...)
+	payload = append(payload, kdbxTestUint(uint32(len(compressed)))...)
+	payload = append(payload, compressed...)
+	payload = append(payload, kdbxTestUint(uint32(1))...)
+	payload = append(payload, make([]byte, 32)...)
+	payload = append(payload, kdbxTestUint(uint32(0))...)
+
+	pad := aes.BlockSize - len(payload)%aes.BlockSize
+	payload = append(payload, bytes.Repeat([]byte{byte(pad)}, pad)...)
+
+	// AES-KDF encrypts the composite key with the transform seed.
+	transformed := kdbxTestComposite(password, keyFile)
+	block, _ := aes.NewCipher(transformSeed)
+	for n := uint64(0); n < rounds; n++ {
+		block.Encrypt(transformed[:16], transformed[:16])
+		block.Encrypt(transformed[16:], transformed[16:])
+	}
+	transformedKey := sha256.Sum256(transformed)
+
+	key := sha256.Sum256(append(append([]byte{}, masterSeed...), transformedKey[:]...))
+	block, _ = aes.NewCipher(key[:])
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(payload, payload)
+
+	return append(buf.Bytes(), payload...)
+}
+
+// kdbxTestStream XORs data with a precomputed key stream.
+type kdbxTestStream struct {
+	keyStream []byte
+}
+
+func (s *kdbxTestStream) XORKeyStream(dst, src []byte) {
+	for n := range src {
+		dst[n] = src[n] ^ s.keyStream[n]
+	}
+
+	s.keyStream = s.keyStream[len(src):]
+}
+
+// buildKDBX4 writes a KDBX 4 database encrypted with ChaCha20, with the key
+// derived by Argon2id and the protected values encrypted with ChaCha20.
+func buildKDBX4(password string, keyFile bool) []byte {
+	masterSeed := bytes.Repeat([]byte{0x66}, 32)
+	salt := bytes.Repeat([]byte{0x77}, 32)
+	iv := bytes.Repeat([]byte{0x88}, 12)
+	streamKey := bytes.Repeat([]byte{0x99}, 64)
+
+	// The key derivation parameters are a VariantDictionary.
+	var kdf bytes.Buffer
+	kdf.Write(kdbxTestUint(uint16(0x0100)))
+	variant := func(kind byte, key string, value []byte) {
+		kdf.WriteByte(kind)
+		kdf.Write(kdbxTestUint(int32(len(key))))
+		kdf.WriteString(key)
+		kdf.Write(kdbxTestUint(int32(len(value))))
+		kdf.Write(value)
+	}
+	variant(kdbxVariantBytes, "$UUID", kdbxKdfArgon2id)
+	variant(kdbxVariantBytes, "S", salt)
+	variant(kdbxVariantUint64, "I", kdbxTestUint(uint64(2)))
+	variant(kdbxVariantUint64, "M", kdbxTestUint(uint64(1024*1024)))
+	variant(kdbxVariantUint32, "P", kdbxTestUint(uint32(2)))
+	variant(kdbxVariantUint32, "V", kdbxTestUint(uint32(0x13)))
+	kdf.WriteByte(kdbxVariantEnd)
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, []uint32{kdbxSignature1, kdbxSignature2, 4 << 16})
+	kdbxTestField(&buf, 4, kdbxCipherID, kdbxCipherChaCha20)
+	kdbxTestField(&buf, 4, kdbxCompressionFlags, kdbxTestUint(uint32(1)))
+	kdbxTestField(&buf, 4, kdbxMasterSeed, masterSeed)
+	kdbxTestField(&buf, 4, kdbxEncryptionIV, iv)
+	kdbxTestField(&buf, 4, kdbxKdfParameters, kdf.Bytes())
+	kdbxTestField(&buf, 4, kdbxEndOfHeader, []byte("\r\n\r\n"))
+	header := buf.Bytes()
+
+	transformed := argon2.IDKey(kdbxTestComposite(password, keyFile), salt, 2, 1024, 2, 32)
+	seeded := append(append([]byte{}, masterSeed...), transformed...)
+	key := sha256.Sum256(seeded)
+	hmacKey := sha512.Sum512(append(seeded, 1))
+
+	blockKey := func(index uint64) []byte {
+		h := sha512.New()
+		h.Write(kdbxTestUint(index))
+		h.Write(hmacKey[:])
+		return h.Sum(nil)
+	}
+
+	// The inner header holds the stream and the attachment, then the XML.
+	var inner bytes.Buffer
+	kdbxTestField(&inner, 4, kdbxInnerStreamID, kdbxTestUint(uint32(kdbxStreamChaCha)))
+	kdbxTestField(&inner, 4, kdbxInnerStreamKey, streamKey)
+	kdbxTestField(&inner, 4, kdbxInnerBinary, append([]byte{1}, "recovery codes"...))
+	kdbxTestField(&inner, 4, kdbxInnerEndOfHeader, nil)
+
+	streamSum := sha512.Sum512(streamKey)
+	stream, _ := chacha20.NewUnauthenticatedCipher(streamSum[:32], streamSum[32:44])
+	inner.Write(kdbxTestXML(4, stream))
+
+	payload := kdbxTestGzip(inner.Bytes())
+	outer, _ := chacha20.NewUnauthenticatedCipher(key[:], iv)
+	outer.XORKeyStream(payload, payload)
+
+	headerSum := sha256.Sum256(header)
+	headerMAC := hmac.New(sha256.New, blockKey(^uint64(0)))
+	headerMAC.Write(header)
+
+	out := append(append([]byte{}, header...), headerSum[:]...)
+	out = append(out, headerMAC.Sum(nil)...)
+
+	// The payload is a single HMAC block and the empty block that ends it.
+	for index, block := range [][]byte{payload, nil} {
+		mac := hmac.New(sha256.New, blockKey(uint64(index)))
+		mac.Write(kdbxTestUint(uint64(index)))
+		mac.Write(kdbxTestUint(int32(len(block))))
+		mac.Write(block)
+
+		out = append(out, mac.Sum(nil)...)
+		out = append(out, kdbxTestUint(int32(len(block)))...)
+		out = append(out, block...)
+	}
+
+	return out
+}
+
+func testKDBXKeyFile(t *testing.T) {
+	fmt.Println(t.Name())
+
+	expected := kdbxTestComposite(kdbxPassword, true)
+
+	composite, err := kdbxCompositeKey(kdbxPassword, kdbxKeyFile)
+	if err != nil || !bytes.Equal(composite, expected) {
+		t.Fatalf("Expected %x, received %x and %v", expected, composite, err)
+	}
+
+	// A 64 digit hex key file holds the same key.
+	hexKey := []byte("0102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20")
+	composite, err = kdbxCompositeKey(kdbxPassword, hexKey)
+	if err != nil || !bytes.Equal(composite, expected) {
+		t.Fatalf("Expected %x, received %x and %v", expected, composite, err)
+	}
+
+	corrupt := bytes.Replace(kdbxKeyFile, []byte("AE216C2E"), []byte("00000000"), 1)
+	if _, err := kdbxCompositeKey(kdbxPassword, corrupt); err == nil {
+		t.Fatal("Expected error for a corrupt key file, received nil")
+	}
+}
+
+// End-to-end test for importing KDBX files
+//  1. Import the database and ensure the report.
+//  2. Ensure the entry with every field was converted.
+//  3. Ensure the attachment and timestamps were kept.
+//  4. Ensure importing again reuses the Folder.
+func testKDBXImport(t *testing.T, lb *LockedBox, version int) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(kdbxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	data := buildKDBX3(kdbxPassword, false)
+	var keyFile []byte
+	if version == 4 {
+		data = buildKDBX4(kdbxPassword, true)
+		keyFile = kdbxKeyFile
+	}
+
+	if !IsKDBX(data) {
+		t.Fatal("Expected a KDBX file")
+	}
+
+	before := len(ub.GetItemList())
+
+	// 1.  Import the database and ensure the report.
+	report, err := ub.Import("", data, ImportOptions{Password: kdbxPassword, KeyFile: keyFile})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if report.Format != "kdbx" || report.Items != 2 || len(ub.GetItemList()) != before+2 {
+		t.Fatalf("Expected 2 items from kdbx, received %+v", report)
+	}
+
+	var reasons []string
+	for _, f := range report.Failures {
+		reasons = append(reasons, f.Entry+": "+f.Reason)
+	}
+	sort.Strings(reasons)
+
+	expected := `Recycle Bin/Old: in the recycle bin|Work/GitHub: attachment "lost.txt" is missing`
+	if strings.Join(reasons, "|") != expected {
+		t.Fatalf("Expected %s, received %s", expected, strings.Join(reasons, "|"))
+	}
+
+	// 2.  Ensure the entry with every field was converted.
+	var github ItemMetadata
+	for _, imd := range ub.GetItemList() {
+		if imd.Name == "GitHub" && ub.GetFolderPath(imd.Folder) == "Work" && len(imd.Attachments) == 1 {
+			github = imd
+		}
+	}
+
+	if github.Type != LoginType || strings.Join(github.Tags, ",") != "2fa,dev" {
+		t.Fatalf("Expected a tagged login in Work, received %+v", github)
+	}
+
+	item, err := ub.GetItem(github.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	login := item.Login
+	if login.Username != "octocat" || login.Password != "hunter2" || strings.Join(login.URLs, " ") != "https://github.com" {
+		t.Fatalf("Expected the GitHub login, received %+v", login)
+	}
+
+	if string(item.Data) != "Codes are attached.\n\nPIN: 1234" {
+		t.Fatalf("Expected notes with the custom field, received %q", item.Data)
+	}
+
+	// 3.  Ensure the attachment and timestamps were kept.
+	if github.Attachments[0].Name != "codes.txt" || extractAttachment(t, &ub, github.ItemId, github.Attachments[0].AttachmentId) != "recovery codes" {
+		t.Fatalf("Expected codes.txt, received %+v", github.Attachments[0])
+	}
+
+	if !github.Created.Equal(kdbxCreated) || !github.Modified.Equal(kdbxModified) {
+		t.Fatalf("Expected %v and %v, received %v and %v", kdbxCreated, kdbxModified, github.Created, github.Modified)
+	}
+
+	// 4.  Ensure importing again reuses the Folder.
+	report, err = ub.Import("", data, ImportOptions{Password: kdbxPassword, KeyFile: keyFile})
+	if err != nil || report.Items != 2 || report.Folders != 0 {
+		t.Fatalf("Expected 2 items and no folders, received %+v and %v", report, err)
+	}
+}
+
+func testKDBXInvalid(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(kdbxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	before := len(ub.GetItemList())
+
+	_, err = ub.Import("kdbx", buildKDBX3(kdbxPassword, false), ImportOptions{Password: "wrong password"})
+	if err == nil || !strings.Contains(err.Error(), errKDBXCredentials.Error()) {
+		t.Fatalf("Expected %v, received %v", errKDBXCredentials, err)
+	}
+
+	_, err = ub.Import("kdbx", buildKDBX4(kdbxPassword, true), ImportOptions{Password: kdbxPassword})
+	if err == nil || !strings.Contains(err.Error(), errKDBXCredentials.Error()) {
+		t.Fatalf("Expected %v, received %v", errKDBXCredentials, err)
+	}
+
+	if _, err := ub.Import("kdbx", []byte("not a database"), ImportOptions{Password: kdbxPassword}); err == nil {
+		t.Fatal("Expected error for an invalid file, received nil")
+	}
+
+	if len(ub.GetItemList()) != before {
+		t.Fatalf("Expected %d items, received %d", before, len(ub.GetItemList()))
+	}
+	// Key derivation parameters that would exhaust memory or take too long
+	// are rejected before deriving the key.
+	huge := []map[string]interface{}{
+		{"$UUID": kdbxKdfAES, "S": make([]byte, 32), "R": uint64(1 << 40)},
+		{"$UUID": kdbxKdfArgon2id, "S": make([]byte, 32), "V": uint64(0x13), "I": uint64(1 << 20), "M": uint64(1 << 20), "P": uint64(1)},
+		{"$UUID": kdbxKdfArgon2d, "S": make([]byte, 32), "V": uint64(0x13), "I": uint64(1), "M": uint64(1 << 42), "P": uint64(1)},
+		{"$UUID": kdbxKdfArgon2id, "S": make([]byte, 32), "V": uint64(0x13), "I": uint64(1), "M": uint64(1 << 20), "P": uint64(255)},
+	}
+
+	for _, kdf := range huge {
+		h := kdbxHeader{major: 4, kdf: kdf}
+		if _, err := h.transformKey(make([]byte, 32)); err == nil {
+			t.Fatalf("Expected error for %v, received nil", kdf)
+		}
+	}
+
+	h := kdbxHeader{major: 3, transformSeed: make([]byte, 32), transformRounds: 1 << 40}
+	if _, err := h.transformKey(make([]byte, 32)); err == nil {
+		t.Fatal("Expected error for too many AES-KDF rounds, received nil")
+	}
+}
@@ -144,6 +144,68 @@ func (k *Keyset) GetItemKey(v VersionToken, iid ItemToken) (CryptKey, error) {
 	return ck, nil
 }
 
+// GetNewAttachmentKey derives a new CryptKey for an Attachment using the
+// latest BaseKey and an AttachmentToken.
+func (k *Keyset) GetNewAttachmentKey(aid AttachmentToken) (CryptKey, error) {
+	ck, err := k.GetAttachmentKey(k.Latest, aid)
+	if err != nil {
+		return ck, fmt.Errorf("could not Keyset.GetNewAttachmentKey: %v", err)
+	}
+
+	return ck, nil
+}
+
+// GetAttachmentKey derives a CryptKey for an Attachment using the specified
+// BaseKey and AttachmentToken.
+func (k *Keyset) GetAttachmentKey(v VersionToken, aid AttachmentToken) (CryptKey, error) {
+	var ck CryptKey
+
+	ki, err := k.GetKey(v)
+	if err != nil {
+		return ck, fmt.Errorf("could not Keyset.GetAttachmentKey: %v", err)
+	}
+
+	deriver := NewDeriver(ki.DeriverVersion)
+
+	ck, err = deriver.DeriveCryptKey(ki.BaseKey, []byte(aid.String()))
+	if err != nil {
+		return ck, fmt.Errorf("could not Keyset.GetAttachmentKey: %v", err)
+	}
+
+	return ck, nil
+}
+
+// GetNewRevisionKey derives a new CryptKey for a Revision using the
+// latest BaseKey and a RevisionToken.
+func (k *Keyset) GetNewRevisionKey(rid RevisionToken) (CryptKey, error) {
+	ck, err := k.GetRevisionKey(k.Latest, rid)
+	if err != nil {
+		return ck, fmt.Errorf("could not Keyset.GetNewRevisionKey: %v", err)
+	}
+
+	return ck, nil
+}
+
+// GetRevisionKey derives a CryptKey for a Revision using the specified
+// BaseKey and RevisionToken.
+func (k *Keyset) GetRevisionKey(v VersionToken, rid RevisionToken) (CryptKey, error) {
+	var ck CryptKey
+
+	ki, err := k.GetKey(v)
+	if err != nil {
+		return ck, fmt.Errorf("could not Keyset.GetRevisionKey: %v", err)
+	}
+
+	deriver := NewDeriver(ki.DeriverVersion)
+
+	ck, err = deriver.DeriveCryptKey(ki.BaseKey, []byte(rid.String()))
+	if err != nil {
+		return ck, fmt.Errorf("could not Keyset.GetRevisionKey: %v", err)
+	}
+
+	return ck, nil
+}
+
 // GetNewMetadataKey derives a new CryptKey for a Metadata object using the
 // latest BaseKey and a MetadataToken.
 func (k *Keyset) GetNewMetadataKey(mid MetadataToken) (CryptKey, error) {
@@ -249,8 +311,8 @@ func (k *Keyset) bytes(crypt crypter) ([]byte, error) {
 }
 
 // Save encrypts the Keyset using the given crypter and then saves the
-// encrypted bytes in the given storer.
-func (k *Keyset) Save(store storer, crypt crypter) error {
+// encrypted bytes in the given recorder.
+func (k *Keyset) Save(store recorder, crypt crypter) error {
 	bytes, err := k.bytes(crypt)
 	if err != nil {
 		return fmt.Errorf("could not Keyset.Save: %v", err)
@@ -298,8 +360,8 @@ func newKeysetFromBytes(crypt crypter, encrypted []byte, ad []byte) (Keyset, err
 }
 
 // NewKeysetFromStore retrieves the encrypted Keyset bytes from the given
-// storer, decrypts the bytes, and returns a Keyset.
-func NewKeysetFromStore(store storer, crypt crypter, kid KeysetToken) (*Keyset, error) {
+// recorder, decrypts the bytes, and returns a Keyset.
+func NewKeysetFromStore(store recorder, crypt crypter, kid KeysetToken) (*Keyset, error) {
 	var ks Keyset
 
 	bytes, err := store.GetKeyset(kid)
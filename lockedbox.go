@@ -2,30 +2,138 @@ package lckbx
 
 import (
 	"fmt"
+	"log"
 	"strings"
+	"sync"
 
 	"golang.org/x/text/unicode/norm"
 )
 
+// LockedBox registers users and logs them in. New passwords are derived
+// with the deriver of its version, and users whose passwords were derived
+// with a cheaper version are moved to it when they login.
 type LockedBox struct {
-	crypt  crypter
-	derive deriver
-	store  storer
+	crypt   crypter
+	derive  deriver
+	version VersionToken
+	store   storer
+	policy  PasswordPolicy
+}
+
+// NormalizeUserName returns the form of the username that is stored in the
+// database. Usernames are NFKD normalized and lowercased.
+func NormalizeUserName(username string) string {
+	return strings.ToLower(norm.NFKD.String(username))
+}
+
+// SetPasswordPolicy replaces the PasswordPolicy that new passwords are
+// checked with by Register, ChangePassword, and RecoverAccount. A nil policy
+// accepts any password the deriver does.
+func (l *LockedBox) SetPasswordPolicy(p PasswordPolicy) {
+	l.policy = p
+}
+
+// SetDeriverVersion changes the version of the deriver that new passwords
+// are derived with, and saves it in the store so that it is used every time
+// the store is opened. Users whose passwords were derived with a cheaper
+// version are moved to it the next time they login. Use CalibrateDeriver to
+// choose a version for this machine.
+func (l *LockedBox) SetDeriverVersion(version VersionToken) error {
+	if _, ok := deriverRank(version); !ok {
+		return fmt.Errorf("could not LockedBox.SetDeriverVersion: unknown deriver version %s", version)
+	}
+
+	err := l.store.SaveDefaultDeriverVersion(version)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.SetDeriverVersion: %v", err)
+	}
+
+	l.derive = NewDeriver(version)
+	l.version = version
+
+	return nil
+}
+
+// DeriverVersion returns the version of the deriver that new passwords are
+// derived with.
+func (l *LockedBox) DeriverVersion() VersionToken {
+	return l.version
+}
+
+// upgrades reports whether a password derived with the version would be
+// moved to the LockedBox's deriver. Passwords are never moved to a cheaper
+// deriver.
+func (l *LockedBox) upgrades(version VersionToken) bool {
+	current, _ := deriverRank(version)
+	latest, _ := deriverRank(l.version)
+
+	return latest > current
+}
+
+// CheckPassword checks a new password for the user against the
+// PasswordPolicy, without registering or changing anything. A rejected
+// password returns a *PasswordError with the reasons it was rejected.
+func (l *LockedBox) CheckPassword(username, password string) error {
+	if l.policy == nil {
+		return nil
+	}
+
+	return l.policy.Check(NormalizeUserName(username), norm.NFKD.String(password))
 }
 
 // Register
 //  1. Create a new User, Keyset, and Metadata.
 //  2. Derive the user's keys and tokens.
-//  3. Store the User and Keyset encrypted with the user's password.
+//  3. Store the User and Keyset encrypted with the user's password, and
+//     record the version of the deriver used.
 //  4. Store the Metadata encrypted with the Metadata key derived from the
 //     keyset.
 func (l *LockedBox) Register(username, password string) error {
+	ub, err := l.register(username, password)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.Register: %v", err)
+	}
+
+	ub.Lock()
+
+	return nil
+}
+
+// RegisterWithRecovery registers a new user, in the same way as Register, and
+// returns a recovery phrase that can be used with RecoverAccount to reset a
+// forgotten password.
+func (l *LockedBox) RegisterWithRecovery(username, password string) (string, error) {
+	ub, err := l.register(username, password)
+	if err != nil {
+		return "", fmt.Errorf("could not LockedBox.RegisterWithRecovery: %v", err)
+	}
+	defer ub.Lock()
+
+	phrase, err := ub.RotateRecoveryPhrase()
+	if err != nil {
+		return "", fmt.Errorf("could not LockedBox.RegisterWithRecovery: %v", err)
+	}
+
+	return phrase, nil
+}
+
+// register creates the new user's records in the store and returns an
+// UnlockedBox for the user.
+func (l *LockedBox) register(username, password string) (UnlockedBox, error) {
+	var ub UnlockedBox
+
 	// 1.  Create a new User, Keyset, and Metadata.
 	// 1.a Normalize the username and password.
-	username = strings.ToLower(norm.NFKD.String(username))
+	username = NormalizeUserName(username)
 	password = norm.NFKD.String(password)
 
-	// 1.b Create the user, keyset, and metadata objects.
+	// 1.b Check the password against the PasswordPolicy.
+	err := l.CheckPassword(username, password)
+	if err != nil {
+		return ub, fmt.Errorf("could not LockedBox.register: %v", err)
+	}
+
+	// 1.c Create the user, keyset, and metadata objects.
 	user := NewUser(username)
 	keyset := NewKeyset(user.KeysetId)
 	metadata := NewMetadata(user.MetadataId)
@@ -33,96 +141,158 @@ func (l *LockedBox) Register(username, password string) error {
 	// 2.  Derive the user's keys and tokens.
 	baseKey, err := l.derive.DeriveBaseKey(username, password)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.register: %v", err)
 	}
 
 	ak, err := l.derive.DeriveAuthKey(baseKey)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.register: %v", err)
 	}
 
 	at, err := l.derive.DeriveAuthToken(baseKey, user.UserId)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.register: %v", err)
 	}
 
 	ck, err := l.derive.DeriveCryptKey(baseKey, nil)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.register: %v", err)
 	}
 
-	// 3.  Store the User and Keyset encrypted with the user's password.
-	// 3.a Update our crypter to use the derived AuthKey and create the new
-	//     encrypted user account in the database.
-	l.crypt.ChangeKey(ak[:])
-	err = user.Create(l.store, l.crypt, at)
+	// Steps 3 and 4 run in a single transaction so that a failed
+	// registration does not leave a User without a Keyset or Metadata.
+	err = l.store.Update(func(r recorder) error {
+		// 3.  Store the User and Keyset encrypted with the user's password.
+		// 3.a Update our crypter to use the derived AuthKey and create the
+		//     new encrypted user account in the database.
+		l.crypt.ChangeKey(ak[:])
+		err := user.Create(r, l.crypt, at)
+		if err != nil {
+			return err
+		}
+
+		// 3.b Record the version of the deriver the keys were derived with.
+		err = r.SaveDeriverVersion(user.UserId, l.version)
+		if err != nil {
+			return err
+		}
+
+		// 3.c Update our crypter to use the derived CryptKey and save the
+		//     encrypted Keyset to the database.
+		l.crypt.ChangeKey(ck[:])
+		err = keyset.Save(r, l.crypt)
+		if err != nil {
+			return err
+		}
+
+		// 4.  Store the Metadata encrypted with the MetadataKey derived from
+		//     the Keyset.
+		// 4.a Derive a new CryptKey to encrypt the Metadata
+		key, err := keyset.GetNewMetadataKey(user.MetadataId)
+		if err != nil {
+			return err
+		}
+
+		// 4.b Update our crypter with the derived CryptKey and save the
+		//     encrypted Metadata to the database.
+		l.crypt.ChangeKey(key[:])
+		return metadata.Save(r, l.crypt)
+	})
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.register: %v", err)
 	}
 
-	// 3.b Update our crypter to use the derived CryptKey and save the
-	//     encrypted Keyset to the database.
-	l.crypt.ChangeKey(ck[:])
-	err = keyset.Save(l.store, l.crypt)
-	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
-	}
+	ub.derive = newRecoveryDeriver()
+	ub.version = l.version
+	ub.store = l.store
+	ub.crypt = l.crypt
+	ub.mutex = &sync.Mutex{}
+	ub.authToken = at
+	ub.authKey = ak
+	ub.keysetKey = ck
+	ub.user = user
+	ub.keyset = keyset
+	ub.metadata = metadata
+	ub.index = newSearchIndex()
+
+	return ub, nil
+}
 
-	// 4.  Store the Metadata encrypted with the MetadataKey derived from the
-	//     Keyset.
-	// 3.a Derive a new CryptKey to encrypt the Metadata
-	key, err := keyset.GetNewMetadataKey(user.MetadataId)
+// Login
+//  1. Get the UserId and deriver version from the database using the given
+//     username.
+//  2. Derive an AuthToken, AuthKey, and CryptKey for the user.
+//  3. Get the User from the store using the AuthToken and AuthKey
+//  4. Get the Keyset from the store using the user's KeysetId
+//  5. Get the Metadata from the store using the user's MetadataId.
+//  6. Move the user to the LockedBox's deriver, if theirs is cheaper,
+//     logging the error and keeping the old one if that fails.
+//  7. Start the maintenance job and return the UnlockedBox.
+func (l *LockedBox) Login(username, password string) (UnlockedBox, error) {
+	ub, err := l.login(username, password)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
 	}
 
-	// 3.b Update our crypter with the derived CryptKey and save the
-	//     encrypted Metadata to the database.
-	l.crypt.ChangeKey(key[:])
-	err = metadata.Save(l.store, l.crypt)
-	if err != nil {
-		return fmt.Errorf("could not LockedBox.Register: %v", err)
+	// 6.  Move the user to the LockedBox's deriver, if theirs is cheaper.
+	//     The password is needed to derive the new keys, so this can only
+	//     be done at login. The old keys still work if it fails, so the
+	//     user is logged in anyway and it is tried again next time.
+	if l.upgrades(ub.version) {
+		err = l.rekey(&ub, ub.user.UserName, norm.NFKD.String(password))
+		if err != nil {
+			log.Printf("could not LockedBox.Login: upgrading the deriver: %v", err)
+		}
 	}
 
-	return nil
+	// 7.  Start the background job that reencrypts Items with the latest key
+	//     and purges unused keys, then return the UnlockedBox.
+	ub.startMaintenance()
+
+	return ub, nil
 }
 
-// Login
-// 1. Get the UserId from the database using the given username.
-// 2. Derive an AuthToken, AuthKey, and CryptKey for the user.
-// 3. Get the User from the store using the AuthToken and AuthKey
-// 4. Get the Keyset from the store using the user's KeysetId
-// 5. Get the Metadata from the store using the user's MetadataId.
-// 6. Return the UnlockedBox if there are no errors.
-func (l *LockedBox) Login(username, password string) (UnlockedBox, error) {
+// login performs steps 1 through 5 of Login without upgrading the deriver
+// or starting the maintenance job. It is used by LockedBox methods that only
+// need the UnlockedBox briefly.
+func (l *LockedBox) login(username, password string) (UnlockedBox, error) {
 	var ub UnlockedBox
 
-	// 1.  Get the UserId from the database using the given username.
+	// 1.  Get the UserId and deriver version from the database using the
+	//     given username.
 	// Normalize our username and password
-	username = strings.ToLower(norm.NFKD.String(username))
+	username = NormalizeUserName(username)
 	password = norm.NFKD.String(password)
 
 	userId := l.store.GetUserId(username)
 
-	// 2.  Derive an AuthToken, AuthKey, and CryptKey for the user.
-	baseKey, err := l.derive.DeriveBaseKey(username, password)
+	version := l.store.GetDeriverVersion(userId)
+	if _, ok := deriverRank(version); !ok {
+		return ub, fmt.Errorf("could not LockedBox.login: unknown deriver version %s", version)
+	}
+
+	// 2.  Derive an AuthToken, AuthKey, and CryptKey for the user with the
+	//     deriver their password was last set with.
+	derive := NewDeriver(version)
+
+	baseKey, err := derive.DeriveBaseKey(username, password)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
-	ak, err := l.derive.DeriveAuthKey(baseKey)
+	ak, err := derive.DeriveAuthKey(baseKey)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
-	at, err := l.derive.DeriveAuthToken(baseKey, userId)
+	at, err := derive.DeriveAuthToken(baseKey, userId)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
-	ck, err := l.derive.DeriveCryptKey(baseKey, nil)
+	ck, err := derive.DeriveCryptKey(baseKey, nil)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
 	// 3.  Get the User from the store using the AuthToken and AuthKey
@@ -131,7 +301,7 @@ func (l *LockedBox) Login(username, password string) (UnlockedBox, error) {
 	l.crypt.ChangeKey(ak[:])
 	u, err := NewUserFromStore(l.store, l.crypt, at, userId)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
 	// 4.  Get the Keyset from the store using the user's KeysetId.
@@ -140,14 +310,14 @@ func (l *LockedBox) Login(username, password string) (UnlockedBox, error) {
 	l.crypt.ChangeKey(ck[:])
 	ks, err := NewKeysetFromStore(l.store, l.crypt, u.KeysetId)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
 	// 5.  Get the Metadata from the store using the user's MetadataId
 	// 5.a Derive the CryptKey for the Metadata.
 	key, err := ks.GetNewMetadataKey(u.MetadataId)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
 	// 5.b Update our crypter to use the derived CryptKey and load the
@@ -155,115 +325,351 @@ func (l *LockedBox) Login(username, password string) (UnlockedBox, error) {
 	l.crypt.ChangeKey(key[:])
 	md, err := NewMetadataFromStore(l.store, l.crypt, u.MetadataId)
 	if err != nil {
-		return ub, fmt.Errorf("could not LockedBox.Login: %v", err)
+		return ub, fmt.Errorf("could not LockedBox.login: %v", err)
 	}
 
-	ub.derive = l.derive
+	ub.derive = newRecoveryDeriver()
+	ub.version = version
 	ub.store = l.store
 	ub.crypt = l.crypt
+	ub.mutex = &sync.Mutex{}
+	ub.authToken = at
+	ub.authKey = ak
+	ub.keysetKey = ck
 	ub.user = u
 	ub.keyset = ks
 	ub.metadata = md
+	ub.index = newSearchIndex()
 
-	// 6. Return an UnlockedBox if there are no errors.
 	return ub, nil
 }
 
 // Change Password
 //  1. Login to get an UnlockedBox.
-//  2. Derive a new AuthID, AuthKey, and CryptKey from the new password.
-//  3. Add a new BaseKey to the Keyset.
-//  4. Save the User and Keyset to the store encrypted with the new keys.
-//  5. Save the Metadata encrypted with the new Metadata key in the keyset.
+//  2. Set the new password on the UnlockedBox.
 func (l *LockedBox) ChangePassword(username, oldPassword, newPassword string) error {
 	// 1.  Login to get an UnlockedBox
 	// Normalize our username and password
-	username = strings.ToLower(norm.NFKD.String(username))
+	username = NormalizeUserName(username)
 	oldPassword = norm.NFKD.String(oldPassword)
 	newPassword = norm.NFKD.String(newPassword)
 
-	ub, err := l.Login(username, oldPassword)
+	ub, err := l.login(username, oldPassword)
 	if err != nil {
 		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
 	}
+	defer ub.Lock()
 
-	// 2.  Derive a new AuthToken, AuthKey, and CryptKey for the user from the
-	//     newPassword.
-	baseKey, err := l.derive.DeriveBaseKey(username, newPassword)
+	// 2.  Set the new password on the UnlockedBox.
+	err = l.setPassword(&ub, username, newPassword)
 	if err != nil {
 		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
 	}
 
+	return nil
+}
+
+// Set Password
+//  1. Check the new password against the PasswordPolicy.
+//  2. Add a new BaseKey to the Keyset.
+//  3. Rekey the user's records with keys derived from the new password.
+func (l *LockedBox) setPassword(ub *UnlockedBox, username, newPassword string) error {
+	// 1.  Check the new password against the PasswordPolicy.
+	err := l.CheckPassword(username, newPassword)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.setPassword: %v", err)
+	}
+
+	// 2.  Add a new BaseKey to the Keyset
+	// 2.a Parse the deriver version
+	deriverVersion, err := parseVersionToken(argonBlakeDeriverVersion)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.setPassword: %v", err)
+	}
+
+	// 2.b Add a new key with the given deriver version.
+	ub.keyset.AddKey(newBaseKey(), deriverVersion)
+
+	// 3.  Rekey the user's records with keys derived from the new password.
+	err = l.rekey(ub, username, newPassword)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.setPassword: %v", err)
+	}
+
+	return nil
+}
+
+// Rekey
+//  1. Derive a new AuthID, AuthKey, and CryptKey from the password with the
+//     LockedBox's deriver.
+//  2. Save the User and Keyset to the store encrypted with the new keys.
+//  3. Save the Metadata encrypted with the new Metadata key in the keyset.
+//  4. Update the recovery record, if the user has one, with the new keys.
+//  5. Record the version of the deriver the new keys were derived with.
+//
+// rekey is used by setPassword, and by Login to move a user to a more
+// expensive deriver without changing their password.
+func (l *LockedBox) rekey(ub *UnlockedBox, username, password string) error {
+	// 1.  Derive a new AuthToken, AuthKey, and CryptKey for the user from the
+	//     password.
+	baseKey, err := l.derive.DeriveBaseKey(username, password)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.rekey: %v", err)
+	}
+
 	ak, err := l.derive.DeriveAuthKey(baseKey)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		return fmt.Errorf("could not LockedBox.rekey: %v", err)
 	}
 
 	at, err := l.derive.DeriveAuthToken(baseKey, ub.user.UserId)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		return fmt.Errorf("could not LockedBox.rekey: %v", err)
 	}
 
 	ck, err := l.derive.DeriveCryptKey(baseKey, nil)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		return fmt.Errorf("could not LockedBox.rekey: %v", err)
 	}
 
-	// 3.  Add a new BaseKey to the Keyset
-	// 3.a Parse the deriver version
-	deriverVersion, err := parseVersionToken(argonBlakeDeriverVersion)
+	// Steps 2 through 5 run in a single transaction so that the User,
+	// Keyset, Metadata, recovery record, and deriver version always agree
+	// on the password. The UnlockedBox keeps its old keys if it fails.
+	oldToken, oldAuthKey, oldKeysetKey := ub.authToken, ub.authKey, ub.keysetKey
+
+	err = l.store.Update(func(r recorder) error {
+		// 2.  Save the User and Keyset to the store encrypted with the new
+		//     keys.
+		// 2.a Update our crypter to use the new AuthKey and update the
+		//     encrypted User in the database.
+		l.crypt.ChangeKey(ak[:])
+		err := ub.user.Save(r, l.crypt, at)
+		if err != nil {
+			return err
+		}
+
+		// 2.b Remove the User saved under the old AuthToken so that it does
+		//     not outlive the account.
+		if at != ub.authToken {
+			err = r.DeleteUser(ub.authToken)
+			if err != nil {
+				return err
+			}
+		}
+
+		// 2.c Update our crypter to use the new CryptKey and save the
+		//     encrypted Keyset to the database.
+		l.crypt.ChangeKey(ck[:])
+		err = ub.keyset.Save(r, l.crypt)
+		if err != nil {
+			return err
+		}
+
+		// 3.  Store the Metadata encrypted with the MetadataKey derived from
+		//     the Keyset.
+		// 3.a Derive a new CryptKey to encrypt the Metadata
+		key, err := ub.keyset.GetNewMetadataKey(ub.user.MetadataId)
+		if err != nil {
+			return err
+		}
+
+		// 3.b Update our crypter to use the derived CryptKey and save the
+		//     encrypted Metadata to the database.
+		l.crypt.ChangeKey(key[:])
+		err = ub.metadata.Save(r, l.crypt)
+		if err != nil {
+			return err
+		}
+
+		// 4.  Update the recovery record, if the user has one, so that it
+		//     can still unlock the Keyset.
+		ub.authToken = at
+		ub.authKey = ak
+		ub.keysetKey = ck
+
+		err = ub.saveRecovery(r)
+		if err != nil {
+			return err
+		}
+
+		// 5.  Record the version of the deriver the new keys were derived
+		//     with.
+		return r.SaveDeriverVersion(ub.user.UserId, l.version)
+	})
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		ub.authToken, ub.authKey, ub.keysetKey = oldToken, oldAuthKey, oldKeysetKey
+		return fmt.Errorf("could not LockedBox.rekey: %v", err)
 	}
 
-	// 3.b Add a new key with the given deriver version.
-	ub.keyset.AddKey(newBaseKey(), deriverVersion)
+	ub.version = l.version
 
-	// 4.  Save the User and Keyset to the store encrypted with the new keys.
-	// 4.a Update our crypter to use the new AuthKey and update the encrypted
-	//     User in the database.
-	l.crypt.ChangeKey(ak[:])
-	err = ub.user.Save(l.store, l.crypt, at)
+	return nil
+}
+
+// Recover Account
+//  1. Get the UserId from the database using the given username.
+//  2. Derive the recovery AuthKey and RecoveryId from the recovery phrase.
+//  3. Open the recovery record to get the User and the Keyset CryptKey.
+//  4. Get the Keyset and Metadata from the store.
+//  5. Set the new password, the same way ChangePassword does.
+func (l *LockedBox) RecoverAccount(username, phrase, newPassword string) error {
+	var ub UnlockedBox
+
+	// 1.  Get the UserId from the database using the given username.
+	username = NormalizeUserName(username)
+	phrase = normalizeRecoveryPhrase(phrase)
+	newPassword = norm.NFKD.String(newPassword)
+
+	userId := l.store.GetUserId(username)
+
+	// 2.  Derive the recovery AuthKey and RecoveryId from the phrase.
+	derive := newRecoveryDeriver()
+
+	baseKey, err := derive.DeriveBaseKey(username, phrase)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
 	}
 
-	// 4.b Update our crypter to use the new CryptKey and save the encrypted
-	//     Keyset to the database.
-	l.crypt.ChangeKey(ck[:])
-	err = ub.keyset.Save(l.store, l.crypt)
+	rk, err := derive.DeriveAuthKey(baseKey)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
 	}
 
-	// 5.  Store the Metadata encrypted with the MetadataKey derived from the
-	//     Keyset.
-	// 5.a Derive a new CryptKey to encrypt the Metadata
-	key, err := ub.keyset.GetNewMetadataKey(ub.user.MetadataId)
+	rid, err := derive.DeriveAuthToken(baseKey, userId)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
+	}
+
+	// 3.  Open the recovery record to get the User and the Keyset CryptKey.
+	rec, err := NewRecoveryFromStore(l.store, rid)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
+	}
+
+	data, err := rec.open(l.crypt, rk, userId)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
+	}
+
+	// 4.  Get the Keyset and Metadata from the store.
+	// 4.a Update our crypter to use the recovered CryptKey and load the
+	//     encrypted Keyset from the store.
+	l.crypt.ChangeKey(data.KeysetKey[:])
+	ks, err := NewKeysetFromStore(l.store, l.crypt, data.User.KeysetId)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
+	}
+
+	// 4.b Derive the CryptKey for the Metadata and load the encrypted
+	//     Metadata from the store.
+	key, err := ks.GetNewMetadataKey(data.User.MetadataId)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
 	}
 
-	// 5.b Update our crypter to use the derived CryptKey and save the
-	//     encrypted Metadata to the database.
 	l.crypt.ChangeKey(key[:])
-	err = ub.metadata.Save(l.store, l.crypt)
+	md, err := NewMetadataFromStore(l.store, l.crypt, data.User.MetadataId)
 	if err != nil {
-		return fmt.Errorf("could not LockedBox.ChangePassword: %v", err)
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
+	}
+
+	ub.derive = derive
+	ub.version = l.store.GetDeriverVersion(userId)
+	ub.store = l.store
+	ub.crypt = l.crypt
+	ub.mutex = &sync.Mutex{}
+	ub.authToken = data.AuthToken
+	ub.keysetKey = data.KeysetKey
+	ub.user = &data.User
+	ub.keyset = ks
+	ub.metadata = md
+	ub.index = newSearchIndex()
+	defer ub.Lock()
+
+	// 5.  Set the new password, the same way ChangePassword does.
+	err = l.setPassword(&ub, username, newPassword)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.RecoverAccount: %v", err)
+	}
+
+	return nil
+}
+
+// Delete Account
+//  1. Login to get an UnlockedBox.
+//  2. Delete every Item, and its Attachments and Revisions, listed in the
+//     user's Metadata.
+//  3. Delete the Metadata, Keyset, recovery record, User, deriver version,
+//     and username mapping.
+//  4. Lock the UnlockedBox.
+func (l *LockedBox) DeleteAccount(username, password string) error {
+	// 1.  Login to get an UnlockedBox
+	username = NormalizeUserName(username)
+
+	ub, err := l.login(username, password)
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.DeleteAccount: %v", err)
+	}
+	defer ub.Lock()
+
+	// Steps 2 and 3 run in a single transaction so a partially deleted
+	// account is never left behind.
+	err = l.store.Update(func(r recorder) error {
+		// 2.  Delete every Item, and its Attachments and Revisions, listed
+		//     in the user's Metadata.
+		for _, item := range ub.metadata.GetItems() {
+			err := deleteItemRecords(r, item)
+			if err != nil {
+				return err
+			}
+		}
+
+		// 3.  Delete the Metadata, Keyset, recovery record, User, deriver
+		//     version, and username mapping.
+		err := r.DeleteMetadata(ub.user.MetadataId)
+		if err != nil {
+			return err
+		}
+
+		err = r.DeleteKeyset(ub.user.KeysetId)
+		if err != nil {
+			return err
+		}
+
+		err = r.DeleteRecovery(ub.user.RecoveryId)
+		if err != nil {
+			return err
+		}
+
+		err = r.DeleteUser(ub.authToken)
+		if err != nil {
+			return err
+		}
+
+		err = r.DeleteDeriverVersion(ub.user.UserId)
+		if err != nil {
+			return err
+		}
+
+		return r.DeleteUserId(username)
+	})
+	if err != nil {
+		return fmt.Errorf("could not LockedBox.DeleteAccount: %v", err)
 	}
 
 	return nil
 }
 
-// NewLockedBox creates a new LockedBox using the given deriver and crypter version
-// strings and the given storer.
+// NewLockedBox creates a new LockedBox using the given storer. New
+// passwords are derived with the deriver version saved in the store by
+// SetDeriverVersion, or the original argonBlakeDeriverVersion if none was.
 func NewLockedBox(s storer) (LockedBox, error) {
 	var l LockedBox
 
-	// Parse the deriver version and create a new deriver
-	deriverVersion, err := parseVersionToken(argonBlakeDeriverVersion)
-	if err != nil {
-		return l, fmt.Errorf("could not NewLockedBox: %v", err)
+	// Get the deriver version and create a new deriver
+	deriverVersion := s.GetDefaultDeriverVersion()
+	if _, ok := deriverRank(deriverVersion); !ok {
+		return l, fmt.Errorf("could not NewLockedBox: unknown deriver version %s", deriverVersion)
 	}
 
 	// Parse the crypter version token.
@@ -273,8 +679,10 @@ func NewLockedBox(s storer) (LockedBox, error) {
 	}
 
 	l.derive = NewDeriver(deriverVersion)
+	l.version = deriverVersion
 	l.crypt = NewCrypter(crypterVersion)
 	l.store = s
+	l.policy = DefaultPasswordPolicy
 
 	return l, nil
 }
@@ -2,21 +2,27 @@ package lckbx
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"testing"
+
+	"github.com/boltdb/bolt"
 )
 
 var (
 	lockedBoxUser          = "lckbx"
 	lockedBoxShortPassword = "0123456789abcd"
-	lockedBoxGoodPassword  = "0123456789abcdef"
-	lockedBoxBadPassword   = "0123456789abcdee"
+	lockedBoxGoodPassword  = "violin-gravel-usher-ocean"
+	lockedBoxBadPassword   = "violin-gravel-usher-oasis"
 )
 
 func TestLockedBox(t *testing.T) {
 	t.Run("Test Registration", testRegister)
 	t.Run("Test Login", testLogin)
 	t.Run("Test Password Change", testChangePassword)
+	t.Run("Test Delete Account", testDeleteAccount)
+	t.Run("Test Register Rollback", testRegisterRollback)
+	t.Run("Test Deriver Upgrade", testDeriverUpgrade)
 }
 
 func testRegister(t *testing.T) {
@@ -142,8 +148,9 @@ func testChangePassword(t *testing.T) {
 		t.Fatalf("Expected no error, received %v", err)
 	}
 
-	// Login with the updated password.
-	unlocked2, err := lb.Login(lockedBoxUser, lockedBoxBadPassword)
+	// Login with the updated password. The maintenance job is not started
+	// because it would purge the old key before we can check the Keyset.
+	unlocked2, err := lb.login(lockedBoxUser, lockedBoxBadPassword)
 	if err != nil {
 		t.Fatalf("Expected no error, received %v", err)
 	}
@@ -185,7 +192,7 @@ func testChangePassword(t *testing.T) {
 	}
 
 	// Login with the updated password.
-	upper, err := lb.Login(lockedBoxUser, lockedBoxGoodPassword)
+	upper, err := lb.login(lockedBoxUser, lockedBoxGoodPassword)
 	if err != nil {
 		t.Fatalf("Expected no error, received %v", err)
 	}
@@ -219,3 +226,309 @@ func testChangePassword(t *testing.T) {
 		t.Fatalf("Expected metadatas to be equal, received\n%v\n%v", unlocked1.metadata, upper.metadata)
 	}
 }
+
+func testDeleteAccount(t *testing.T) {
+	fmt.Println(t.Name())
+
+	store, err := NewStore("delete_test.db")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// Register a user and add an item.
+	err = lb.Register(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	unlocked, err := lb.Login(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	note := NewNoteItem()
+	err = unlocked.AddNoteItem(note)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	user := *unlocked.user
+	unlocked.Lock()
+
+	// Change the password so that a User has been saved under two AuthTokens.
+	err = lb.ChangePassword(lockedBoxUser, lockedBoxGoodPassword, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// Deleting the account with the wrong password must fail.
+	err = lb.DeleteAccount(lockedBoxUser, lockedBoxGoodPassword)
+	if err == nil {
+		t.Fatal("Expected error with bad password, received nil")
+	}
+
+	err = lb.DeleteAccount(strings.ToUpper(lockedBoxUser), lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// Every record belonging to the user is gone.
+	if _, err := lb.Login(lockedBoxUser, lockedBoxBadPassword); err == nil {
+		t.Fatal("Expected error logging in to a deleted account, received nil")
+	}
+
+	if _, err := store.GetKeyset(user.KeysetId); err == nil {
+		t.Fatal("Expected error for deleted keyset, received nil")
+	}
+
+	if _, err := store.GetMetadata(user.MetadataId); err == nil {
+		t.Fatal("Expected error for deleted metadata, received nil")
+	}
+
+	if _, err := store.GetItem(note.ItemId); err == nil {
+		t.Fatal("Expected error for deleted item, received nil")
+	}
+
+	users := 0
+	store.db.View(func(tx *bolt.Tx) error {
+		users = tx.Bucket([]byte(userBucket)).Stats().KeyN
+		return nil
+	})
+
+	if users != 0 {
+		t.Fatalf("Expected no users in the store, found %d", users)
+	}
+
+	// The username can be registered again.
+	err = lb.Register(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+}
+
+func testRegisterRollback(t *testing.T) {
+	fmt.Println(t.Name())
+
+	store, err := NewStore("rollback_test.db")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer store.Close()
+
+	// Registration fails when its transaction is not committed.
+	lb, err := NewLockedBox(failingStore{&store})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(lockedBoxUser, lockedBoxGoodPassword)
+	if err == nil {
+		t.Fatal("Expected error for failed transaction, received nil")
+	}
+
+	// None of the records were saved, so the username is still available.
+	lb, err = NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// Adding an item fails without leaving the item in the Metadata.
+	ub, err := lb.login(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	ub.store = failingStore{&store}
+
+	n := NewNoteItem()
+	err = ub.AddNoteItem(n)
+	if err == nil {
+		t.Fatal("Expected error for failed transaction, received nil")
+	}
+
+	if len(ub.GetItemList()) != 0 {
+		t.Fatalf("Expected no items, found %d", len(ub.GetItemList()))
+	}
+
+	if _, err := store.GetItem(n.ItemId); err == nil {
+		t.Fatal("Expected error for rolled back item, received nil")
+	}
+}
+
+// End-to-end test for upgrading the deriver of a user at login
+//  1. Register a user with the original deriver.
+//  2. Change the LockedBox's deriver and ensure it is saved in the store.
+//  3. Login and ensure the user is moved to the new deriver and can still
+//     read their items, login again, and use their recovery phrase.
+//  4. Change back to the original deriver and ensure the user is not moved
+//     to it.
+//  5. Delete the account and ensure the deriver version is deleted.
+func testDeriverUpgrade(t *testing.T) {
+	fmt.Println(t.Name())
+
+	store, err := NewStore("upgrade_test.db")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove("upgrade_test.db")
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 1.  Register a user with the original deriver.
+	original, _ := parseVersionToken(argonBlakeDeriverVersion)
+	upgraded, _ := parseVersionToken(argonBlake3x128DeriverVersion)
+
+	if lb.DeriverVersion() != original {
+		t.Fatalf("Expected %s, received %s", original, lb.DeriverVersion())
+	}
+
+	phrase, err := lb.RegisterWithRecovery(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.Login(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	note := NewNoteItem()
+	err = ub.AddNoteItem(note)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	uid := ub.user.UserId
+	authToken := ub.authToken
+	ub.Lock()
+
+	if v := store.GetDeriverVersion(uid); v != original {
+		t.Fatalf("Expected %s, received %s", original, v)
+	}
+
+	// 2.  Change the LockedBox's deriver and ensure it is saved in the store.
+	err = lb.SetDeriverVersion(NewVersionToken())
+	if err == nil {
+		t.Fatal("Expected error for an unknown deriver version, received nil")
+	}
+
+	err = lb.SetDeriverVersion(upgraded)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	lb, err = NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if lb.DeriverVersion() != upgraded {
+		t.Fatalf("Expected %s, received %s", upgraded, lb.DeriverVersion())
+	}
+
+	// 3.  Login and ensure the user is moved to the new deriver.
+	if _, err := lb.Login(lockedBoxUser, lockedBoxBadPassword); err == nil {
+		t.Fatal("Expected error with bad password, received nil")
+	}
+
+	if v := store.GetDeriverVersion(uid); v != original {
+		t.Fatalf("Expected a failed login to keep %s, received %s", original, v)
+	}
+
+	// A failed upgrade still logs the user in with the old deriver.
+	failing, err := NewLockedBox(failingStore{&store})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err = failing.Login(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if v := store.GetDeriverVersion(uid); v != original || ub.version != original || ub.authToken != authToken {
+		t.Fatalf("Expected a failed upgrade to keep %s, received %s and %s", original, v, ub.version)
+	}
+
+	if _, err := ub.GetItem(note.ItemId); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	ub, err = lb.Login(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if v := store.GetDeriverVersion(uid); v != upgraded || ub.version != upgraded {
+		t.Fatalf("Expected %s, received %s and %s", upgraded, v, ub.version)
+	}
+
+	if _, err := store.GetUser(authToken); err == nil {
+		t.Fatal("Expected the User under the old AuthToken to be deleted, received nil")
+	}
+
+	if _, err := ub.GetItem(note.ItemId); err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	ub, err = lb.login(lockedBoxUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	err = lb.RecoverAccount(lockedBoxUser, phrase, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 4.  Change back to the original deriver and ensure the user is not
+	//     moved to it.
+	err = lb.SetDeriverVersion(original)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err = lb.Login(lockedBoxUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	if v := store.GetDeriverVersion(uid); v != upgraded {
+		t.Fatalf("Expected %s, received %s", upgraded, v)
+	}
+
+	// 5.  Delete the account and ensure the deriver version is deleted.
+	err = lb.DeleteAccount(lockedBoxUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	versions := 0
+	store.db.View(func(tx *bolt.Tx) error {
+		versions = tx.Bucket([]byte(deriverBucket)).Stats().KeyN
+		return nil
+	})
+
+	if versions != 1 {
+		t.Fatalf("Expected only the default deriver version in the store, found %d", versions)
+	}
+}
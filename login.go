@@ -0,0 +1,45 @@
+package lckbx
+
+import (
+	"fmt"
+)
+
+// The LoginItem struct holds the credentials for a website or service.
+type LoginItem struct {
+	Username string
+	Password string
+	URLs     []string
+}
+
+// fields returns the LoginItem as a list of ItemFields, with one "url"
+// field for each URL.
+func (l *LoginItem) fields() []ItemField {
+	fields := []ItemField{
+		{Name: "username", Value: l.Username},
+		{Name: "password", Value: l.Password, Secret: true},
+	}
+
+	for _, url := range l.URLs {
+		fields = append(fields, ItemField{Name: "url", Value: url})
+	}
+
+	return fields
+}
+
+// setField sets the named field. Each "url" field adds another URL.
+func (l *LoginItem) setField(name, value string) error {
+	switch name {
+	case "username":
+		l.Username = value
+	case "password":
+		l.Password = value
+	case "url":
+		if value != "" {
+			l.URLs = append(l.URLs, value)
+		}
+	default:
+		return fmt.Errorf("unknown login field %q", name)
+	}
+
+	return nil
+}
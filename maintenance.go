@@ -0,0 +1,165 @@
+package lckbx
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MaintenanceStatus reports the progress of the background job that
+// purges expired Items from the trash, prunes Revisions over the
+// RevisionLimit, reencrypts Items with the latest BaseKey, and purges unused
+// keys from the Keyset.
+type MaintenanceStatus struct {
+	Expired int
+	Pruned  int
+	Total   int
+	Done    int
+	Failed  int
+	Purged  int
+	Running bool
+	Err     error
+}
+
+// maintenance tracks the background job started when a user logs in. The
+// job is shared by every copy of the UnlockedBox and is cancelled when the
+// UnlockedBox is locked.
+type maintenance struct {
+	mutex  *sync.Mutex
+	once   *sync.Once
+	status MaintenanceStatus
+	cancel chan struct{}
+	done   chan struct{}
+}
+
+// update changes the status of the job while holding its mutex.
+func (m *maintenance) update(f func(s *MaintenanceStatus)) {
+	m.mutex.Lock()
+	f(&m.status)
+	m.mutex.Unlock()
+}
+
+// getStatus returns a copy of the current status of the job.
+func (m *maintenance) getStatus() MaintenanceStatus {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.status
+}
+
+// cancelled reports whether the job has been asked to stop.
+func (m *maintenance) cancelled() bool {
+	select {
+	case <-m.cancel:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop asks the job to stop and waits for it to finish the Item it is
+// working on.
+func (m *maintenance) stop() {
+	m.once.Do(func() { close(m.cancel) })
+	<-m.done
+}
+
+// Run Maintenance
+//  1. Purge the Items that have been in the trash longer than the
+//     TrashDays setting.
+//  2. Delete the Revisions that are over the RevisionLimit.
+//  3. Find the Items that are not encrypted with the latest key.
+//  4. Reencrypt each Item, saving the Metadata after each one, until all
+//     are done or the job is cancelled.
+//  5. If every Item was reencrypted, purge the unused keys and save the
+//     Keyset.
+//
+// The UnlockedBox mutex is only held while a single Item is reencrypted, so
+// the user can keep working while the job runs.
+func (m *maintenance) run(u UnlockedBox) {
+	defer close(m.done)
+	defer m.update(func(s *MaintenanceStatus) { s.Running = false })
+
+	// 1.  Purge the expired Items from the trash.
+	u.mutex.Lock()
+	expired, err := u.purgeExpiredTrash(time.Now())
+	u.mutex.Unlock()
+
+	if err != nil {
+		m.update(func(s *MaintenanceStatus) { s.Err = err })
+		return
+	}
+
+	m.update(func(s *MaintenanceStatus) { s.Expired = expired })
+
+	// 2.  Delete the Revisions that are over the RevisionLimit.
+	u.mutex.Lock()
+	pruned, err := u.pruneRevisions(time.Now())
+	u.mutex.Unlock()
+
+	if err != nil {
+		m.update(func(s *MaintenanceStatus) { s.Err = err })
+		return
+	}
+
+	m.update(func(s *MaintenanceStatus) { s.Pruned = pruned })
+
+	// 3.  Find the Items that are not encrypted with the latest key.
+	u.mutex.Lock()
+	stale := u.staleItems()
+	u.mutex.Unlock()
+
+	m.update(func(s *MaintenanceStatus) { s.Total = len(stale) })
+
+	// 4.  Reencrypt each Item, saving the Metadata after each one.
+	failed := make(map[string]string)
+	for _, iid := range stale {
+		if m.cancelled() {
+			return
+		}
+
+		u.mutex.Lock()
+		err := u.reencryptItem(iid)
+		u.mutex.Unlock()
+
+		if err != nil {
+			failed[iid.String()] = err.Error()
+			m.update(func(s *MaintenanceStatus) { s.Failed++ })
+			continue
+		}
+
+		m.update(func(s *MaintenanceStatus) { s.Done++ })
+	}
+
+	if len(failed) != 0 {
+		m.update(func(s *MaintenanceStatus) {
+			s.Err = fmt.Errorf("could not reencrypt items %+v", failed)
+		})
+		return
+	}
+
+	if m.cancelled() {
+		return
+	}
+
+	// 5.  Purge the unused keys and save the Keyset.
+	u.mutex.Lock()
+	purged, err := u.purgeUnusedKeys()
+	u.mutex.Unlock()
+
+	m.update(func(s *MaintenanceStatus) {
+		s.Purged = purged
+		s.Err = err
+	})
+}
+
+// newMaintenance creates a new maintenance job that has not been started.
+func newMaintenance() *maintenance {
+	return &maintenance{
+		mutex:  &sync.Mutex{},
+		once:   &sync.Once{},
+		status: MaintenanceStatus{Running: true},
+		cancel: make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
@@ -0,0 +1,164 @@
+package lckbx
+
+import (
+	"fmt"
+	"testing"
+)
+
+var (
+	maintenanceDB    = "maintenance_test.db"
+	maintenanceUser  = "mt_user"
+	maintenanceItems = 20
+)
+
+func TestMaintenance(t *testing.T) {
+	store, err := NewStore(maintenanceDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(maintenanceUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.login(maintenanceUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for i := 0; i < maintenanceItems; i++ {
+		n := NewNoteItem()
+		n.Name = fmt.Sprintf("Note %d", i)
+		n.Data = []byte(n.Name)
+
+		err = ub.AddNoteItem(n)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+	ub.Lock()
+
+	err = lb.ChangePassword(maintenanceUser, lockedBoxGoodPassword, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Maintenance Cancel", func(t *testing.T) { testMaintenanceCancel(t, &lb) })
+	t.Run("Test Maintenance Resume", func(t *testing.T) { testMaintenanceResume(t, &lb) })
+}
+
+// checkItems ensures every Item can be read and that its name matches its
+// data.
+func checkItems(t *testing.T, ub *UnlockedBox) {
+	for _, imd := range ub.metadata.GetItems() {
+		note, _, err := ub.loadItem(imd)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		if string(note.Data) != imd.Name {
+			t.Fatalf("Expected %s, received %s", imd.Name, note.Data)
+		}
+	}
+}
+
+// Locking the UnlockedBox stops the maintenance job without losing any
+// Items, and the work already done is kept.
+func testMaintenanceCancel(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.Login(maintenanceUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub.Lock()
+
+	status := ub.MaintenanceStatus()
+	if status.Running {
+		t.Fatalf("Expected maintenance to be stopped, received %+v", status)
+	}
+
+	if status.Err != nil {
+		t.Fatalf("Expected no error, received %v", status.Err)
+	}
+
+	ub, err = lb.login(maintenanceUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	stale := len(ub.staleItems())
+	if status.Done+stale != maintenanceItems {
+		t.Fatalf("Expected %d items, %d done and %d stale", maintenanceItems, status.Done, stale)
+	}
+
+	checkItems(t, &ub)
+}
+
+// The maintenance job finishes an Item that was saved with the latest key
+// before the Metadata was updated, as if the process crashed in between.
+func testMaintenanceResume(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(maintenanceUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// Save a stale Item with the latest key without updating the Metadata.
+	stale := ub.staleItems()
+	if len(stale) == 0 {
+		t.Fatal("Expected stale items, received none")
+	}
+
+	imd, _ := ub.metadata.GetItem(stale[0])
+	note, _, err := ub.loadItem(imd)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	key, _ := ub.keyset.GetNewItemKey(note.ItemId)
+	ub.crypt.ChangeKey(key[:])
+	err = note.Save(ub.store, ub.crypt)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// Run the maintenance job to completion.
+	ub.startMaintenance()
+	status := ub.WaitMaintenance()
+	if status.Err != nil {
+		t.Fatalf("Expected no error, received %v", status.Err)
+	}
+
+	if status.Done != len(stale) || status.Purged != 1 {
+		t.Fatalf("Expected %d items done and one key purged, received %+v", len(stale), status)
+	}
+	ub.Lock()
+
+	// Login again and ensure everything was saved.
+	ub, err = lb.login(maintenanceUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	if len(ub.keyset.Keys) != 1 {
+		t.Fatalf("Expected one key in our keyset, found %d", len(ub.keyset.Keys))
+	}
+
+	if len(ub.staleItems()) != 0 {
+		t.Fatalf("Expected no stale items, found %d", len(ub.staleItems()))
+	}
+
+	checkItems(t, &ub)
+}
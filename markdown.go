@@ -0,0 +1,176 @@
+package lckbx
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// archiveFile is a file written by the Markdown export, or stored in an age
+// archive, by its path with / separators.
+type archiveFile struct {
+	Path string
+	Data []byte
+}
+
+// markdownName makes a Folder, Item, or Attachment name usable as a file
+// name on every system.
+func markdownName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '-'
+		}
+
+		return r
+	}, name)
+
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "Untitled"
+	}
+
+	return name
+}
+
+// markdownCode returns the value as inline code, using a run of backticks
+// that does not appear in the value.
+func markdownCode(value string) string {
+	fence := "`"
+	for strings.Contains(value, fence) {
+		fence += "`"
+	}
+
+	if strings.HasPrefix(value, "`") || strings.HasSuffix(value, "`") {
+		value = " " + value + " "
+	}
+
+	return fence + value + fence
+}
+
+// markdownTime formats a timestamp for a Markdown file.
+func markdownTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// markdownItem returns the Markdown file for an Item. The fields are listed
+// as inline code so that passwords are shown exactly, and the notes are
+// written as they are. The Attachments are linked from filesDir.
+func markdownItem(ei exportItem, filesDir string, files []string) []byte {
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "# %s\n\n", ei.Name)
+	fmt.Fprintf(&sb, "- Type: %s\n", ei.Type)
+
+	if ei.Folder != "" {
+		fmt.Fprintf(&sb, "- Folder: %s\n", ei.Folder)
+	}
+
+	if len(ei.Tags) != 0 {
+		fmt.Fprintf(&sb, "- Tags: %s\n", strings.Join(ei.Tags, ", "))
+	}
+
+	fmt.Fprintf(&sb, "- Created: %s\n", markdownTime(ei.Created))
+	fmt.Fprintf(&sb, "- Modified: %s\n", markdownTime(ei.Modified))
+
+	item := ei.item()
+
+	var fields []string
+	for _, f := range item.Fields() {
+		if f.Value != "" {
+			fields = append(fields, fmt.Sprintf("- %s: %s\n", f.Name, markdownCode(f.Value)))
+		}
+	}
+
+	if len(fields) != 0 {
+		sb.WriteString("\n## Fields\n\n")
+		sb.WriteString(strings.Join(fields, ""))
+	}
+
+	if ei.Notes != "" {
+		sb.WriteString("\n## Notes\n\n")
+		sb.WriteString(strings.TrimRight(ei.Notes, "\n"))
+		sb.WriteString("\n")
+	}
+
+	if len(files) != 0 {
+		sb.WriteString("\n## Attachments\n\n")
+
+		for n, a := range ei.Attachments {
+			fmt.Fprintf(&sb, "- [%s](<%s>)\n", a.Name, path.Join(filesDir, files[n]))
+		}
+	}
+
+	return []byte(sb.String())
+}
+
+// markdownFiles returns a Markdown file for each Item that is not in the
+// trash, in a directory for each Folder, sorted the same as the Items. The
+// Attachments of an Item are written to a directory named after its file
+// with a .files suffix. Names that are already used in a directory are
+// numbered.
+func markdownFiles(f exportFile) []archiveFile {
+	var files []archiveFile
+	used := make(map[string]bool)
+
+	dirOf := func(folder string) string {
+		var names []string
+		if folder != "" {
+			for _, name := range strings.Split(folder, "/") {
+				names = append(names, markdownName(name))
+			}
+		}
+
+		return path.Join(names...)
+	}
+
+	// Folder directories are reserved first, so an Item cannot take the
+	// name of a Folder.
+	for _, folder := range f.Folders {
+		used[strings.ToLower(dirOf(folder))] = true
+	}
+
+	unique := func(dir, name string, suffixes ...string) string {
+		for n := 1; ; n++ {
+			candidate := name
+			if n > 1 {
+				candidate = fmt.Sprintf("%s (%d)", name, n)
+			}
+
+			free := true
+			for _, suffix := range suffixes {
+				if used[strings.ToLower(path.Join(dir, candidate+suffix))] {
+					free = false
+				}
+			}
+
+			if free {
+				for _, suffix := range suffixes {
+					used[strings.ToLower(path.Join(dir, candidate+suffix))] = true
+				}
+
+				return candidate
+			}
+		}
+	}
+
+	for _, ei := range f.active() {
+		dir := dirOf(ei.Folder)
+		base := unique(dir, markdownName(ei.Name), ".md", ".files")
+		filesDir := base + ".files"
+
+		var names []string
+		for _, a := range ei.Attachments {
+			name := unique(path.Join(dir, filesDir), markdownName(a.Name), "")
+			names = append(names, name)
+			files = append(files, archiveFile{Path: path.Join(dir, filesDir, name), Data: a.Data})
+		}
+
+		files = append(files, archiveFile{
+			Path: path.Join(dir, base+".md"),
+			Data: markdownItem(ei, filesDir, names),
+		})
+	}
+
+	return files
+}
@@ -4,33 +4,235 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"time"
 )
 
-type ItemMetadata struct {
-	ItemId     ItemToken
-	Name       string
+// AttachmentMetadata describes an Attachment without decrypting it. Stream
+// is set when the Attachment record holds only the file encrypted as a
+// stream. Attachments added before then hold a whole Attachment sealed in
+// one piece.
+type AttachmentMetadata struct {
+	AttachmentId AttachmentToken
+	Name         string
+	Size         int
+	KeyVersion   VersionToken
+	Stream       bool `json:",omitempty"`
+}
+
+// Equal determines if two AttachmentMetadata objects are the same.
+func (a *AttachmentMetadata) Equal(a2 AttachmentMetadata) bool {
+	return a.AttachmentId.String() == a2.AttachmentId.String() &&
+		a.Name == a2.Name &&
+		a.Size == a2.Size &&
+		a.KeyVersion.String() == a2.KeyVersion.String() &&
+		a.Stream == a2.Stream
+}
+
+// newAttachmentMetadata creates the AttachmentMetadata for a file of the
+// given size saved as a stream.
+func newAttachmentMetadata(aid AttachmentToken, name string, size int, kv VersionToken) AttachmentMetadata {
+	return AttachmentMetadata{
+		AttachmentId: aid,
+		Name:         name,
+		Size:         size,
+		KeyVersion:   kv,
+		Stream:       true,
+	}
+}
+
+// RevisionMetadata describes a prior Revision of an Item without decrypting
+// it.
+type RevisionMetadata struct {
+	RevisionId RevisionToken
+	Created    time.Time
 	KeyVersion VersionToken
 }
 
+// Equal determines if two RevisionMetadata objects are the same.
+func (r *RevisionMetadata) Equal(r2 RevisionMetadata) bool {
+	return r.RevisionId.String() == r2.RevisionId.String() &&
+		r.Created.Equal(r2.Created) &&
+		r.KeyVersion.String() == r2.KeyVersion.String()
+}
+
+// ItemMetadata describes an Item without decrypting it. The Type allows
+// the list of Items to be filtered by kind, and the timestamps allow it to be
+// sorted. Items saved before there were timestamps have zero times.
+type ItemMetadata struct {
+	ItemId      ItemToken
+	Name        string
+	Type        ItemType
+	KeyVersion  VersionToken
+	Created     time.Time
+	Modified    time.Time
+	Accessed    time.Time
+	Folder      FolderToken
+	Tags        []string             `json:",omitempty"`
+	Attachments []AttachmentMetadata `json:",omitempty"`
+	Revisions   []RevisionMetadata   `json:",omitempty"`
+	Trashed     *time.Time           `json:",omitempty"`
+}
+
 // Equal determines if two KeysetItem objects are the same.
 func (i *ItemMetadata) Equal(i2 ItemMetadata) bool {
+	if len(i.Attachments) != len(i2.Attachments) {
+		return false
+	}
+
+	for n, amd := range i.Attachments {
+		if !amd.Equal(i2.Attachments[n]) {
+			return false
+		}
+	}
+
+	if len(i.Revisions) != len(i2.Revisions) {
+		return false
+	}
+
+	if !equalStrings(i.Tags, i2.Tags) {
+		return false
+	}
+
+	for n, rmd := range i.Revisions {
+		if !rmd.Equal(i2.Revisions[n]) {
+			return false
+		}
+	}
+
 	return i.ItemId.String() == i2.ItemId.String() &&
 		i.Name == i2.Name &&
-		i.KeyVersion.String() == i2.KeyVersion.String()
+		i.itemType() == i2.itemType() &&
+		i.KeyVersion.String() == i2.KeyVersion.String() &&
+		i.Created.Equal(i2.Created) &&
+		i.Modified.Equal(i2.Modified) &&
+		i.Accessed.Equal(i2.Accessed) &&
+		i.Folder == i2.Folder &&
+		i.IsTrashed() == i2.IsTrashed() &&
+		(!i.IsTrashed() || i.Trashed.Equal(*i2.Trashed))
+}
+
+// IsTrashed reports whether the Item has been moved to the trash.
+func (i *ItemMetadata) IsTrashed() bool {
+	return i.Trashed != nil
+}
+
+// GetAttachment returns the AttachmentMetadata with the given
+// AttachmentToken.
+func (i *ItemMetadata) GetAttachment(aid AttachmentToken) (AttachmentMetadata, error) {
+	for _, amd := range i.Attachments {
+		if amd.AttachmentId == aid {
+			return amd, nil
+		}
+	}
+
+	return AttachmentMetadata{}, fmt.Errorf("could not ItemMetadata.GetAttachment: attachment not found")
+}
+
+// withAttachment returns a copy of the ItemMetadata with the given
+// AttachmentMetadata added, or replaced if it is already listed. The
+// Attachments slice is copied so the original ItemMetadata can be restored
+// if saving fails.
+func (i ItemMetadata) withAttachment(amd AttachmentMetadata) ItemMetadata {
+	attachments := []AttachmentMetadata{}
+	for _, a := range i.Attachments {
+		if a.AttachmentId != amd.AttachmentId {
+			attachments = append(attachments, a)
+		}
+	}
+
+	i.Attachments = append(attachments, amd)
+
+	return i
+}
+
+// withoutAttachment returns a copy of the ItemMetadata without the given
+// Attachment.
+func (i ItemMetadata) withoutAttachment(aid AttachmentToken) ItemMetadata {
+	var attachments []AttachmentMetadata
+	for _, a := range i.Attachments {
+		if a.AttachmentId != aid {
+			attachments = append(attachments, a)
+		}
+	}
+
+	i.Attachments = attachments
+
+	return i
+}
+
+// GetRevision returns the RevisionMetadata with the given RevisionToken.
+func (i *ItemMetadata) GetRevision(rid RevisionToken) (RevisionMetadata, error) {
+	for _, rmd := range i.Revisions {
+		if rmd.RevisionId == rid {
+			return rmd, nil
+		}
+	}
+
+	return RevisionMetadata{}, fmt.Errorf("could not ItemMetadata.GetRevision: revision not found")
+}
+
+// stale reports whether the Item or any of its Attachments or Revisions is
+// not encrypted with the given key version, or any of its Attachments is
+// sealed in one piece instead of as a stream.
+func (i *ItemMetadata) stale(latest VersionToken) bool {
+	if i.KeyVersion.String() != latest.String() {
+		return true
+	}
+
+	for _, amd := range i.Attachments {
+		if amd.KeyVersion.String() != latest.String() || !amd.Stream {
+			return true
+		}
+	}
+
+	for _, rmd := range i.Revisions {
+		if rmd.KeyVersion.String() != latest.String() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// itemType returns the Type of the Item. Items saved before there were
+// types are SecureNotes.
+func (i *ItemMetadata) itemType() ItemType {
+	if i.Type == "" {
+		return SecureNoteType
+	}
+
+	return i.Type
 }
 
 func NewItemMetadata(name string, iid ItemToken, kv VersionToken) ItemMetadata {
 	return ItemMetadata{
 		ItemId:     iid,
 		Name:       name,
+		Type:       SecureNoteType,
 		KeyVersion: kv,
 	}
 }
 
+// newItemMetadataFromItem creates the ItemMetadata for the given Item,
+// created at the given time.
+func newItemMetadataFromItem(i Item, kv VersionToken, created time.Time) ItemMetadata {
+	imd := NewItemMetadata(i.Name, i.ItemId, kv)
+	imd.Type = i.Type
+	imd.Created = created.UTC()
+	imd.Modified = imd.Created
+	imd.Accessed = imd.Created
+
+	return imd
+}
+
 type Metadata struct {
-	MetadataId MetadataToken
-	mutex      *sync.RWMutex
-	Items      map[string]ItemMetadata
+	MetadataId    MetadataToken
+	mutex         *sync.RWMutex
+	Items         map[string]ItemMetadata
+	RevisionLimit *RevisionLimit    `json:",omitempty"`
+	TrashDays     *int              `json:",omitempty"`
+	Folders       map[string]Folder `json:",omitempty"`
+	Tags          []string          `json:",omitempty"`
 }
 
 // Equal determines if two Metadata objects are the same.
@@ -45,6 +247,24 @@ func (m *Metadata) Equal(m2 *Metadata) bool {
 		equal = false
 	}
 
+	if m.GetRevisionLimit() != m2.GetRevisionLimit() {
+		equal = false
+	}
+
+	if m.GetTrashDays() != m2.GetTrashDays() {
+		equal = false
+	}
+
+	if !equalStrings(m.Tags, m2.Tags) || len(m.Folders) != len(m2.Folders) {
+		equal = false
+	}
+
+	for mapKey, f := range m.Folders {
+		if f2, ok := m2.Folders[mapKey]; !ok || f != f2 {
+			equal = false
+		}
+	}
+
 	for mapKey, mdi := range m.Items {
 		mdiId, _ := parseItemToken(mapKey)
 		mdi2, err := m2.GetItem(mdiId)
@@ -98,16 +318,86 @@ func (m *Metadata) GetItems() []ItemMetadata {
 	return items
 }
 
+// GetActiveItems returns the ItemMetadata of every Item that is not in the
+// trash.
+func (m *Metadata) GetActiveItems() []ItemMetadata {
+	var items []ItemMetadata
+
+	for _, val := range m.Items {
+		if !val.IsTrashed() {
+			items = append(items, val)
+		}
+	}
+
+	return items
+}
+
+// GetTrashedItems returns the ItemMetadata of every Item in the trash.
+func (m *Metadata) GetTrashedItems() []ItemMetadata {
+	var items []ItemMetadata
+
+	for _, val := range m.Items {
+		if val.IsTrashed() {
+			items = append(items, val)
+		}
+	}
+
+	return items
+}
+
+// GetItemsByType returns the ItemMetadata of every Item of the given type
+// that is not in the trash.
+func (m *Metadata) GetItemsByType(t ItemType) []ItemMetadata {
+	var items []ItemMetadata
+
+	for _, val := range m.Items {
+		if val.itemType() == t && !val.IsTrashed() {
+			items = append(items, val)
+		}
+	}
+
+	return items
+}
+
 func (m *Metadata) GetInUseKeys() []string {
 	var keys []string
 
 	for _, item := range m.Items {
 		keys = append(keys, item.KeyVersion.String())
+
+		for _, amd := range item.Attachments {
+			keys = append(keys, amd.KeyVersion.String())
+		}
+
+		for _, rmd := range item.Revisions {
+			keys = append(keys, rmd.KeyVersion.String())
+		}
 	}
 
 	return keys
 }
 
+// GetRevisionLimit returns the limits on the number and age of the
+// Revisions kept for each Item.
+func (m *Metadata) GetRevisionLimit() RevisionLimit {
+	if m.RevisionLimit == nil {
+		return DefaultRevisionLimit
+	}
+
+	return *m.RevisionLimit
+}
+
+// GetTrashDays returns the number of days an Item stays in the trash before
+// it is purged. Zero means Items are kept in the trash until they are purged
+// by hand.
+func (m *Metadata) GetTrashDays() int {
+	if m.TrashDays == nil {
+		return DefaultTrashDays
+	}
+
+	return *m.TrashDays
+}
+
 // bytes returns the Metadata as encrypted bytes using the given crypter.
 func (m *Metadata) bytes(crypt crypter) ([]byte, error) {
 	var encrypted []byte
@@ -125,8 +415,8 @@ func (m *Metadata) bytes(crypt crypter) ([]byte, error) {
 	return encrypted, nil
 }
 
-// Save stores the Metadata as encrypted bytes in the given storer.
-func (m *Metadata) Save(store storer, crypt crypter) error {
+// Save stores the Metadata as encrypted bytes in the given recorder.
+func (m *Metadata) Save(store recorder, crypt crypter) error {
 	bytes, err := m.bytes(crypt)
 	if err != nil {
 		return fmt.Errorf("could not Metadata.Save: %v", err)
@@ -165,10 +455,15 @@ func newMetadataFromBytes(crypt crypter, encrypted []byte, ad []byte) (Metadata,
 
 	md.mutex = &sync.RWMutex{}
 
+	for key, imd := range md.Items {
+		imd.Type = imd.itemType()
+		md.Items[key] = imd
+	}
+
 	return md, nil
 }
 
-func NewMetadataFromStore(store storer, crypt crypter, mid MetadataToken) (*Metadata, error) {
+func NewMetadataFromStore(store recorder, crypt crypter, mid MetadataToken) (*Metadata, error) {
 	var md Metadata
 
 	bytes, err := store.GetMetadata(mid)
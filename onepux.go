@@ -0,0 +1,411 @@
+package lckbx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// The categories of 1Password items that have a matching Item type. Every
+// other category becomes a SecureNote.
+const (
+	onePuxLogin    = "001"
+	onePuxCard     = "002"
+	onePuxIdentity = "004"
+	onePuxPassword = "005"
+)
+
+// onePuxExport is the export.data file in a 1Password .1pux archive.
+type onePuxExport struct {
+	Accounts []struct {
+		Attrs struct {
+			Name string
+		}
+		Vaults []struct {
+			Attrs struct {
+				Name string
+			}
+			Items []onePuxItem
+		}
+	}
+}
+
+// onePuxFile is an attached file, stored in the archive as
+// files/<documentId>__<fileName>.
+type onePuxFile struct {
+	FileName   string
+	DocumentId string
+}
+
+// onePuxItem is a single item in a 1Password export.
+type onePuxItem struct {
+	State        string
+	CategoryUuid string
+	CreatedAt    int64
+	UpdatedAt    int64
+	Details      struct {
+		LoginFields []struct {
+			Value       string
+			Name        string
+			Designation string
+		}
+		NotesPlain string
+		Password   string
+		Sections   []struct {
+			Title  string
+			Fields []struct {
+				Title string
+				Id    string
+				Value map[string]json.RawMessage
+			}
+		}
+		DocumentAttributes *onePuxFile
+	}
+	Overview struct {
+		Title string
+		Url   string
+		Urls  []struct {
+			Url string
+		}
+		Tags []string
+	}
+}
+
+// onePuxCardFields and onePuxIdentityFields map the ids of section fields
+// to the fields of a CardItem or IdentityItem.
+var (
+	onePuxCardFields = map[string]string{
+		"cardholder": "cardholder",
+		"type":       "brand",
+		"ccnum":      "number",
+		"cvv":        "code",
+		"expiry":     "expiry",
+		"pin":        "pin",
+	}
+	onePuxIdentityFields = map[string]string{
+		"firstname": "first_name",
+		"initial":   "middle_name",
+		"lastname":  "last_name",
+		"company":   "company",
+		"email":     "email",
+		"defphone":  "phone",
+	}
+)
+
+// onePuxValue returns a section field's value as text. The value is an
+// object with a single key naming its type. Months are stored as YYYYMM,
+// dates as Unix time, and addresses as objects.
+func onePuxValue(value map[string]json.RawMessage) (string, string) {
+	for kind, raw := range value {
+		switch kind {
+		case "monthYear":
+			var n int
+			json.Unmarshal(raw, &n)
+			if n == 0 {
+				return kind, ""
+			}
+			return kind, fmt.Sprintf("%02d/%04d", n%100, n/100)
+		case "date":
+			var n int64
+			json.Unmarshal(raw, &n)
+			if n == 0 {
+				return kind, ""
+			}
+			return kind, time.Unix(n, 0).UTC().Format("2006-01-02")
+		case "address":
+			var a struct {
+				Street, City, State, Zip, Country string
+			}
+			json.Unmarshal(raw, &a)
+			return kind, strings.Join([]string{a.Street, a.City, a.State, a.Zip, a.Country}, "\x00")
+		case "email":
+			var e struct {
+				Address string `json:"email_address"`
+			}
+			if json.Unmarshal(raw, &e) == nil {
+				return kind, e.Address
+			}
+		case "file":
+			return kind, string(raw)
+		}
+
+		var s string
+		if json.Unmarshal(raw, &s) == nil {
+			return kind, s
+		}
+
+		return kind, strings.Trim(string(raw), `"`)
+	}
+
+	return "", ""
+}
+
+// entry converts a 1Password item to an ImportEntry in the vault's Folder.
+// Section fields that have no place in the Item are added to its notes as
+// "title: value" lines, and attached files are read from the archive.
+func (o onePuxItem) entry(vault string, files map[string][]byte) (ImportEntry, []ImportFailure) {
+	var e ImportEntry
+	var failures []ImportFailure
+	var extra []string
+
+	e.Folder = []string{vault}
+	e.Entry = vault + "/" + o.Overview.Title
+	e.mapField("vault", "folder")
+
+	attach := func(f onePuxFile) {
+		data, ok := files[f.DocumentId+"__"+f.FileName]
+		if !ok {
+			failures = append(failures, ImportFailure{
+				Entry:  e.Entry,
+				Reason: fmt.Sprintf("attachment %q is missing", f.FileName),
+			})
+			return
+		}
+
+		e.Attachments = append(e.Attachments, ImportAttachment{Name: f.FileName, Data: data})
+		e.mapField("files", "attachments")
+	}
+
+	switch o.CategoryUuid {
+	case onePuxLogin, onePuxPassword:
+		e.Item = NewItem(LoginType)
+	case onePuxCard:
+		e.Item = NewItem(CardType)
+	case onePuxIdentity:
+		e.Item = NewItem(IdentityType)
+	default:
+		e.Item = NewItem(SecureNoteType)
+	}
+
+	e.Item.Name = o.Overview.Title
+	e.mapField("overview.title", "name")
+
+	if l := e.Item.Login; l != nil {
+		for _, f := range o.Details.LoginFields {
+			switch {
+			case f.Value == "":
+			case f.Designation == "username" && l.Username == "":
+				l.Username = f.Value
+				e.mapField("loginFields.username", "username")
+			case f.Designation == "password" && l.Password == "":
+				l.Password = f.Value
+				e.mapField("loginFields.password", "password")
+			case f.Name != "":
+				extra = append(extra, f.Name+": "+f.Value)
+				e.mapField("loginFields", "notes")
+			}
+		}
+
+		if l.Password == "" && o.Details.Password != "" {
+			l.Password = o.Details.Password
+			e.mapField("password", "password")
+		}
+
+		for _, u := range o.Overview.Urls {
+			if u.Url != "" {
+				l.URLs = append(l.URLs, u.Url)
+				e.mapField("overview.urls", "url")
+			}
+		}
+
+		if len(l.URLs) == 0 && o.Overview.Url != "" {
+			l.URLs = []string{o.Overview.Url}
+			e.mapField("overview.url", "url")
+		}
+	}
+
+	for _, s := range o.Details.Sections {
+		for _, f := range s.Fields {
+			kind, value := onePuxValue(f.Value)
+			if value == "" {
+				continue
+			}
+
+			if kind == "file" {
+				var file onePuxFile
+				json.Unmarshal([]byte(value), &file)
+				attach(file)
+				continue
+			}
+
+			from := "sections." + f.Id
+			if f.Id == "" {
+				from = "sections." + f.Title
+			}
+
+			if kind == "address" {
+				parts := strings.Split(value, "\x00")
+
+				if i := e.Item.Identity; i != nil && i.Address == "" {
+					i.Address, i.City, i.State, i.PostalCode, i.Country = parts[0], parts[1], parts[2], parts[3], parts[4]
+					e.mapField(from, "address")
+					continue
+				}
+
+				var lines []string
+				for _, part := range parts {
+					if part != "" {
+						lines = append(lines, part)
+					}
+				}
+				value = strings.Join(lines, ", ")
+			}
+
+			var name string
+			switch {
+			case e.Item.Card != nil:
+				name = onePuxCardFields[f.Id]
+			case e.Item.Identity != nil:
+				name = onePuxIdentityFields[f.Id]
+			}
+
+			if name != "" && e.Item.SetFields(append(e.Item.Fields(), ItemField{Name: name, Value: value})) == nil {
+				e.mapField(from, name)
+				continue
+			}
+
+			title := f.Title
+			if title == "" {
+				title = f.Id
+			}
+
+			extra = append(extra, title+": "+value)
+			e.mapField(from, "notes")
+		}
+	}
+
+	if o.Details.DocumentAttributes != nil {
+		attach(*o.Details.DocumentAttributes)
+	}
+
+	if o.Details.NotesPlain != "" {
+		e.mapField("notesPlain", "notes")
+	}
+	e.Item.Data = []byte(importNotes(o.Details.NotesPlain, extra))
+
+	if len(o.Overview.Tags) > 0 {
+		e.Tags = o.Overview.Tags
+		e.mapField("overview.tags", "tags")
+	}
+
+	if o.CreatedAt > 0 {
+		e.Created = time.Unix(o.CreatedAt, 0)
+	}
+
+	if o.UpdatedAt > 0 {
+		e.Modified = time.Unix(o.UpdatedAt, 0)
+	}
+
+	return e, failures
+}
+
+// onePuxImporter reads 1Password .1pux archives. Each vault becomes a
+// Folder, logins and passwords become Login Items, credit cards and
+// identities become Items of the same type, and every other category
+// becomes a SecureNote. Archived items are left out and reported.
+type onePuxImporter struct{}
+
+// readOnePux opens the archive and returns its export.data and the files
+// attached to its items.
+func readOnePux(data []byte) ([]byte, map[string][]byte, error) {
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("not a 1Password export")
+	}
+
+	var export []byte
+	files := make(map[string][]byte)
+
+	for _, f := range z.File {
+		if f.Name != "export.data" && !strings.HasPrefix(f.Name, "files/") {
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read %s: %v", f.Name, err)
+		}
+
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read %s: %v", f.Name, err)
+		}
+
+		if f.Name == "export.data" {
+			export = content
+		} else {
+			files[strings.TrimPrefix(f.Name, "files/")] = content
+		}
+	}
+
+	if export == nil {
+		return nil, nil, fmt.Errorf("not a 1Password export")
+	}
+
+	return export, files, nil
+}
+
+// Detect reports whether the data is a zip archive holding export.data.
+func (onePuxImporter) Detect(data []byte) bool {
+	if !bytes.HasPrefix(data, []byte("PK\x03\x04")) {
+		return false
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return false
+	}
+
+	for _, f := range z.File {
+		if f.Name == "export.data" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encrypted reports false, since .1pux archives are not encrypted.
+func (onePuxImporter) Encrypted(data []byte) bool {
+	return false
+}
+
+// Read converts the items of every vault in the archive.
+func (onePuxImporter) Read(data []byte, opts ImportOptions) ([]ImportEntry, []ImportFailure, error) {
+	exportData, files, err := readOnePux(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var export onePuxExport
+	err = json.Unmarshal(exportData, &export)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid 1Password export: %v", err)
+	}
+
+	var entries []ImportEntry
+	var failures []ImportFailure
+
+	for _, account := range export.Accounts {
+		for _, vault := range account.Vaults {
+			for _, o := range vault.Items {
+				e, problems := o.entry(vault.Attrs.Name, files)
+
+				if o.State == "archived" {
+					failures = append(failures, ImportFailure{Entry: e.Entry, Reason: "archived"})
+					continue
+				}
+
+				entries = append(entries, e)
+				failures = append(failures, problems...)
+			}
+		}
+	}
+
+	return entries, failures, nil
+}
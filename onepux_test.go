@@ -0,0 +1,153 @@
+package lckbx
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var onePuxExportData = `{
+	"accounts": [{
+		"attrs": {"name": "Alice"},
+		"vaults": [{
+			"attrs": {"name": "Personal"},
+			"items": [
+				{
+					"uuid": "a", "state": "active", "categoryUuid": "001",
+					"createdAt": 1614298956, "updatedAt": 1635346445,
+					"details": {
+						"loginFields": [
+							{"value": "alice", "name": "username", "designation": "username"},
+							{"value": "hunter2", "name": "password", "designation": "password"}
+						],
+						"notesPlain": "Work account.",
+						"sections": [{"title": "", "fields": [
+							{"title": "one-time password", "id": "TOTP_1", "value": {"totp": "otpauth://totp/x?secret=JBSWY3DPEHPK3PXP"}},
+							{"title": "recovery.txt", "id": "f1", "value": {"file": {"fileName": "recovery.txt", "documentId": "doc1"}}}
+						]}]
+					},
+					"overview": {"title": "Mail", "urls": [{"label": "", "url": "https://mail.example.com"}], "tags": ["work"]}
+				},
+				{
+					"uuid": "b", "state": "active", "categoryUuid": "002",
+					"details": {"sections": [{"title": "", "fields": [
+						{"title": "cardholder name", "id": "cardholder", "value": {"string": "Alice Smith"}},
+						{"title": "number", "id": "ccnum", "value": {"creditCardNumber": "4111111111111111"}},
+						{"title": "verification number", "id": "cvv", "value": {"concealed": "123"}},
+						{"title": "expiry date", "id": "expiry", "value": {"monthYear": 203003}}
+					]}]},
+					"overview": {"title": "Visa"}
+				},
+				{
+					"uuid": "c", "state": "active", "categoryUuid": "004",
+					"details": {"sections": [{"title": "", "fields": [
+						{"title": "first name", "id": "firstname", "value": {"string": "Alice"}},
+						{"title": "address", "id": "address", "value": {"address": {"street": "1 Main St", "city": "Springfield", "country": "us", "zip": "12345", "state": "IL"}}},
+						{"title": "email", "id": "email", "value": {"email": {"email_address": "alice@example.com", "provider": null}}}
+					]}]},
+					"overview": {"title": "Me"}
+				},
+				{
+					"uuid": "d", "state": "active", "categoryUuid": "101",
+					"details": {"sections": [{"title": "", "fields": [
+						{"title": "routing number", "id": "routingNo", "value": {"string": "021000021"}}
+					]}]},
+					"overview": {"title": "Bank"}
+				},
+				{
+					"uuid": "e", "state": "active", "categoryUuid": "006",
+					"details": {"documentAttributes": {"fileName": "lost.pdf", "documentId": "doc2"}},
+					"overview": {"title": "Scan"}
+				},
+				{
+					"uuid": "f", "state": "archived", "categoryUuid": "001",
+					"details": {}, "overview": {"title": "Old"}
+				}
+			]
+		}]
+	}]
+}`
+
+// buildOnePux returns a .1pux archive holding the export data and one
+// attached file.
+func buildOnePux(exportData string) []byte {
+	var buf bytes.Buffer
+	z := zip.NewWriter(&buf)
+
+	for name, content := range map[string]string{
+		"export.attributes":        `{"version": 3}`,
+		"export.data":              exportData,
+		"files/doc1__recovery.txt": "recovery codes",
+	} {
+		w, _ := z.Create(name)
+		w.Write([]byte(content))
+	}
+	z.Close()
+
+	return buf.Bytes()
+}
+
+func TestOnePux(t *testing.T) {
+	fmt.Println(t.Name())
+
+	imp := onePuxImporter{}
+	data := buildOnePux(onePuxExportData)
+
+	if !imp.Detect(data) || imp.Encrypted(data) {
+		t.Fatal("Expected an unencrypted 1Password export")
+	}
+
+	entries, failures, err := imp.Read(data, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var reasons []string
+	for _, f := range failures {
+		reasons = append(reasons, f.Entry+": "+f.Reason)
+	}
+
+	expected := `Personal/Scan: attachment "lost.pdf" is missing|Personal/Old: archived`
+	if len(entries) != 5 || strings.Join(reasons, "|") != expected {
+		t.Fatalf("Expected 5 entries and %s, received %d and %s", expected, len(entries), strings.Join(reasons, "|"))
+	}
+
+	mail := entries[0]
+	l := mail.Item.Login
+	if l == nil || l.Username != "alice" || l.Password != "hunter2" || strings.Join(l.URLs, " ") != "https://mail.example.com" {
+		t.Fatalf("Expected the Mail login, received %+v", mail.Item)
+	}
+
+	if string(mail.Item.Data) != "Work account.\n\none-time password: otpauth://totp/x?secret=JBSWY3DPEHPK3PXP" {
+		t.Fatalf("Expected notes with the TOTP, received %q", mail.Item.Data)
+	}
+
+	if len(mail.Attachments) != 1 || string(mail.Attachments[0].Data) != "recovery codes" {
+		t.Fatalf("Expected the recovery codes, received %+v", mail.Attachments)
+	}
+
+	if strings.Join(mail.Folder, "/") != "Personal" || strings.Join(mail.Tags, ",") != "work" || mail.Created.Unix() != 1614298956 {
+		t.Fatalf("Expected the folder, tags, and timestamps, received %+v", mail)
+	}
+
+	card := entries[1].Item.Card
+	if card == nil || card.Cardholder != "Alice Smith" || card.Number != "4111111111111111" || card.Code != "123" || card.Expiry != "03/2030" {
+		t.Fatalf("Expected the Visa card, received %+v", entries[1].Item)
+	}
+
+	identity := entries[2].Item.Identity
+	if identity == nil || identity.FirstName != "Alice" || identity.City != "Springfield" || identity.Email != "alice@example.com" {
+		t.Fatalf("Expected the identity, received %+v", entries[2].Item)
+	}
+
+	bank := entries[3].Item
+	if bank.Type != SecureNoteType || string(bank.Data) != "routing number: 021000021" {
+		t.Fatalf("Expected the bank account as a note, received %+v", bank)
+	}
+
+	if _, _, err := imp.Read([]byte("PK\x03\x04 not a zip"), ImportOptions{}); err == nil {
+		t.Fatal("Expected error for an invalid archive, received nil")
+	}
+}
@@ -0,0 +1,281 @@
+package lckbx
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The kinds of one-time code an OTPItem can generate.
+const (
+	TOTPKind = "totp"
+	HOTPKind = "hotp"
+)
+
+const (
+	otpDefaultAlgorithm = "SHA1"
+	otpDefaultDigits    = 6
+	otpDefaultPeriod    = 30
+)
+
+// The OTPItem struct holds the seed for generating one-time codes. Kind is
+// either "totp" for time-based codes (RFC 6238) or "hotp" for counter-based
+// codes (RFC 4226). The Secret is base32 encoded, as it is in otpauth://
+// URIs.
+type OTPItem struct {
+	Kind      string
+	Issuer    string
+	Account   string
+	Secret    string
+	Algorithm string
+	Digits    int
+	Period    int
+	Counter   uint64
+}
+
+// newOTPItem creates a TOTP OTPItem with the default settings.
+func newOTPItem() *OTPItem {
+	return &OTPItem{
+		Kind:      TOTPKind,
+		Algorithm: otpDefaultAlgorithm,
+		Digits:    otpDefaultDigits,
+		Period:    otpDefaultPeriod,
+	}
+}
+
+// fields returns the OTPItem as a list of ItemFields.
+func (o *OTPItem) fields() []ItemField {
+	fields := []ItemField{
+		{Name: "kind", Value: o.Kind},
+		{Name: "issuer", Value: o.Issuer},
+		{Name: "account", Value: o.Account},
+		{Name: "secret", Value: o.Secret, Secret: true},
+		{Name: "algorithm", Value: o.Algorithm},
+		{Name: "digits", Value: strconv.Itoa(o.Digits)},
+	}
+
+	if o.Kind == HOTPKind {
+		return append(fields, ItemField{Name: "counter", Value: strconv.FormatUint(o.Counter, 10)})
+	}
+
+	return append(fields, ItemField{Name: "period", Value: strconv.Itoa(o.Period)})
+}
+
+// setField sets the named field. A "uri" field sets every field from an
+// otpauth:// URI.
+func (o *OTPItem) setField(name, value string) error {
+	var err error
+
+	switch name {
+	case "uri":
+		var parsed OTPItem
+
+		parsed, err = ParseOTPURI(value)
+		if err == nil {
+			*o = parsed
+		}
+	case "kind":
+		value = strings.ToLower(value)
+		if value != TOTPKind && value != HOTPKind {
+			return fmt.Errorf("unknown otp kind %q", value)
+		}
+		o.Kind = value
+	case "issuer":
+		o.Issuer = value
+	case "account":
+		o.Account = value
+	case "secret":
+		o.Secret = normalizeOTPSecret(value)
+		_, err = o.key()
+	case "algorithm":
+		value = strings.ToUpper(value)
+		if otpHash(value) == nil {
+			return fmt.Errorf("unknown otp algorithm %q", value)
+		}
+		o.Algorithm = value
+	case "digits":
+		o.Digits, err = strconv.Atoi(value)
+		if err == nil && (o.Digits < 6 || o.Digits > 10) {
+			err = fmt.Errorf("digits must be between 6 and 10")
+		}
+	case "period":
+		o.Period, err = strconv.Atoi(value)
+		if err == nil && o.Period <= 0 {
+			err = fmt.Errorf("period must be positive")
+		}
+	case "counter":
+		o.Counter, err = strconv.ParseUint(value, 10, 64)
+	default:
+		return fmt.Errorf("unknown otp field %q", name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid otp %s: %v", name, err)
+	}
+
+	return nil
+}
+
+// normalizeOTPSecret removes the spaces and padding often found in base32
+// secrets and uppercases them.
+func normalizeOTPSecret(secret string) string {
+	secret = strings.ToUpper(strings.ReplaceAll(secret, " ", ""))
+	return strings.TrimRight(secret, "=")
+}
+
+// key returns the decoded Secret.
+func (o *OTPItem) key() ([]byte, error) {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(normalizeOTPSecret(o.Secret))
+}
+
+// otpHash returns the hash function for the named algorithm, or nil if the
+// algorithm is not supported.
+func otpHash(algorithm string) func() hash.Hash {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New
+	case "SHA256":
+		return sha256.New
+	case "SHA512":
+		return sha512.New
+	}
+
+	return nil
+}
+
+// hotp computes the RFC 4226 code for the key and counter.
+func hotp(h func() hash.Hash, key []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(h, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint64(1)
+	for i := 0; i < digits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", digits, uint64(value)%mod)
+}
+
+// Code returns the code at the given time and the number of seconds it
+// remains valid. HOTP codes are computed from the Counter and do not
+// expire, so zero seconds are returned for them.
+func (o *OTPItem) Code(t time.Time) (string, int, error) {
+	h := otpHash(o.Algorithm)
+	if h == nil {
+		return "", 0, fmt.Errorf("could not OTPItem.Code: unknown algorithm %q", o.Algorithm)
+	}
+
+	key, err := o.key()
+	if err != nil || len(key) == 0 {
+		return "", 0, fmt.Errorf("could not OTPItem.Code: invalid secret")
+	}
+
+	if o.Kind == HOTPKind {
+		return hotp(h, key, o.Counter, o.Digits), 0, nil
+	}
+
+	if o.Period <= 0 {
+		return "", 0, fmt.Errorf("could not OTPItem.Code: invalid period %d", o.Period)
+	}
+
+	now := t.Unix()
+	period := int64(o.Period)
+	remaining := int(period - now%period)
+
+	return hotp(h, key, uint64(now/period), o.Digits), remaining, nil
+}
+
+// URI returns the OTPItem as an otpauth:// URI.
+func (o *OTPItem) URI() string {
+	label := o.Account
+	if o.Issuer != "" {
+		label = o.Issuer + ":" + o.Account
+	}
+
+	query := url.Values{}
+	query.Set("secret", o.Secret)
+	query.Set("algorithm", o.Algorithm)
+	query.Set("digits", strconv.Itoa(o.Digits))
+
+	if o.Issuer != "" {
+		query.Set("issuer", o.Issuer)
+	}
+
+	if o.Kind == HOTPKind {
+		query.Set("counter", strconv.FormatUint(o.Counter, 10))
+	} else {
+		query.Set("period", strconv.Itoa(o.Period))
+	}
+
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     o.Kind,
+		Path:     "/" + label,
+		RawQuery: query.Encode(),
+	}
+
+	return u.String()
+}
+
+// ParseOTPURI parses an otpauth:// URI, as used in 2FA QR codes, into an
+// OTPItem. Settings missing from the URI use their defaults.
+func ParseOTPURI(uri string) (OTPItem, error) {
+	o := *newOTPItem()
+
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil {
+		return o, fmt.Errorf("could not ParseOTPURI: %v", err)
+	}
+
+	if u.Scheme != "otpauth" {
+		return o, fmt.Errorf("could not ParseOTPURI: expected otpauth scheme, received %q", u.Scheme)
+	}
+
+	err = o.setField("kind", u.Host)
+	if err != nil {
+		return o, fmt.Errorf("could not ParseOTPURI: %v", err)
+	}
+
+	// The label is either "account" or "issuer:account".
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		o.Issuer = strings.TrimSpace(issuer)
+		o.Account = strings.TrimSpace(account)
+	} else {
+		o.Account = label
+	}
+
+	query := u.Query()
+	if query.Get("secret") == "" {
+		return o, fmt.Errorf("could not ParseOTPURI: missing secret")
+	}
+
+	for _, name := range []string{"issuer", "secret", "algorithm", "digits", "period", "counter"} {
+		if !query.Has(name) {
+			continue
+		}
+
+		err = o.setField(name, query.Get(name))
+		if err != nil {
+			return o, fmt.Errorf("could not ParseOTPURI: %v", err)
+		}
+	}
+
+	return o, nil
+}
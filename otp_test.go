@@ -0,0 +1,246 @@
+package lckbx
+
+import (
+	"encoding/base32"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	otpDatabase = "otp_test.db"
+	otpUser     = "otp_user"
+
+	// The seeds from RFC 6238 Appendix B, one for each algorithm.
+	otpSeeds = map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+
+	// The test vectors from RFC 6238 Appendix B.
+	totpVectors = []struct {
+		time      int64
+		algorithm string
+		code      string
+	}{
+		{59, "SHA1", "94287082"},
+		{59, "SHA256", "46119246"},
+		{59, "SHA512", "90693936"},
+		{1111111109, "SHA1", "07081804"},
+		{1111111109, "SHA256", "68084774"},
+		{1111111109, "SHA512", "25091201"},
+		{1111111111, "SHA1", "14050471"},
+		{1111111111, "SHA256", "67062674"},
+		{1111111111, "SHA512", "99943326"},
+		{1234567890, "SHA1", "89005924"},
+		{1234567890, "SHA256", "91819424"},
+		{1234567890, "SHA512", "93441116"},
+		{2000000000, "SHA1", "69279037"},
+		{2000000000, "SHA256", "90698825"},
+		{2000000000, "SHA512", "38618901"},
+		{20000000000, "SHA1", "65353130"},
+		{20000000000, "SHA256", "77737706"},
+		{20000000000, "SHA512", "47863826"},
+	}
+
+	// The test vectors from RFC 4226 Appendix D.
+	hotpVectors = []string{
+		"755224", "287082", "359152", "969429", "338314",
+		"254676", "287922", "162583", "399871", "520489",
+	}
+)
+
+func TestOTP(t *testing.T) {
+	t.Run("Test TOTP Vectors", testTOTPVectors)
+	t.Run("Test HOTP Vectors", testHOTPVectors)
+	t.Run("Test Parse OTP URI", testParseOTPURI)
+	t.Run("Test UnlockedBox OTP Code", testUnlockedBoxOTPCode)
+}
+
+func otpSecret(seed string) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(seed))
+}
+
+func testTOTPVectors(t *testing.T) {
+	fmt.Println(t.Name())
+
+	for _, v := range totpVectors {
+		o := newOTPItem()
+		o.Secret = otpSecret(otpSeeds[v.algorithm])
+		o.Algorithm = v.algorithm
+		o.Digits = 8
+
+		code, remaining, err := o.Code(time.Unix(v.time, 0))
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		if code != v.code {
+			t.Fatalf("Expected %s at %d with %s, received %s", v.code, v.time, v.algorithm, code)
+		}
+
+		if remaining != 30-int(v.time%30) {
+			t.Fatalf("Expected %d seconds remaining, received %d", 30-v.time%30, remaining)
+		}
+	}
+}
+
+func testHOTPVectors(t *testing.T) {
+	fmt.Println(t.Name())
+
+	o := newOTPItem()
+	o.Kind = HOTPKind
+	o.Secret = otpSecret(otpSeeds["SHA1"])
+
+	for counter, expected := range hotpVectors {
+		o.Counter = uint64(counter)
+
+		code, _, err := o.Code(time.Now())
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		if code != expected {
+			t.Fatalf("Expected %s at counter %d, received %s", expected, counter, code)
+		}
+	}
+}
+
+func testParseOTPURI(t *testing.T) {
+	fmt.Println(t.Name())
+
+	o, err := ParseOTPURI("otpauth://totp/Example:alice@example.com?secret=JBSWY3DPEHPK3PXP&issuer=Example&algorithm=sha256&digits=8&period=60")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	expected := OTPItem{
+		Kind:      TOTPKind,
+		Issuer:    "Example",
+		Account:   "alice@example.com",
+		Secret:    "JBSWY3DPEHPK3PXP",
+		Algorithm: "SHA256",
+		Digits:    8,
+		Period:    60,
+	}
+
+	if o != expected {
+		t.Fatalf("Expected %+v, received %+v", expected, o)
+	}
+
+	// The URI parses back to the same OTPItem.
+	o2, err := ParseOTPURI(o.URI())
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if o2 != o {
+		t.Fatalf("Expected %+v, received %+v", o, o2)
+	}
+
+	// HOTP URIs use the defaults for missing settings.
+	o, err = ParseOTPURI("otpauth://hotp/bob?secret=jbsw y3dp ehpk 3pxp&counter=5")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if o.Kind != HOTPKind || o.Counter != 5 || o.Digits != 6 || o.Secret != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("Expected HOTP item, received %+v", o)
+	}
+
+	bad := []string{
+		"https://totp/alice?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://motp/alice?secret=JBSWY3DPEHPK3PXP",
+		"otpauth://totp/alice",
+		"otpauth://totp/alice?secret=not-base32!",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&algorithm=MD5",
+		"otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP&digits=4",
+	}
+
+	for _, uri := range bad {
+		if _, err := ParseOTPURI(uri); err == nil {
+			t.Fatalf("Expected error for %s, received nil", uri)
+		}
+	}
+}
+
+func testUnlockedBoxOTPCode(t *testing.T) {
+	fmt.Println(t.Name())
+
+	store, err := NewStore(otpDatabase)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(otpDatabase)
+	defer store.Close()
+
+	lb, _ := NewLockedBox(&store)
+
+	err = lb.Register(otpUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.login(otpUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	totp := NewItem(OTPType)
+	totp.Name = "TOTP"
+	err = totp.ParseText("uri: otpauth://totp/Example:alice?secret=" + otpSecret(otpSeeds["SHA1"]) + "\n")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	hotp := NewItem(OTPType)
+	hotp.Name = "HOTP"
+	hotp.OTP.Kind = HOTPKind
+	hotp.OTP.Secret = otpSecret(otpSeeds["SHA1"])
+
+	note := NewNoteItem()
+
+	for _, item := range []Item{totp, hotp, note} {
+		err = ub.AddItem(item)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+
+	code, remaining, err := ub.GetOTPCode(totp.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(code) != 6 || remaining < 1 || remaining > 30 {
+		t.Fatalf("Expected a six digit code, received %s with %d seconds", code, remaining)
+	}
+
+	// Each HOTP code advances the saved counter.
+	for counter := 0; counter < 3; counter++ {
+		code, _, err = ub.GetOTPCode(hotp.ItemId)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		if code != hotpVectors[counter] {
+			t.Fatalf("Expected %s, received %s", hotpVectors[counter], code)
+		}
+	}
+
+	item, err := ub.GetItem(hotp.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if item.OTP.Counter != 3 {
+		t.Fatalf("Expected counter 3, received %d", item.OTP.Counter)
+	}
+
+	if _, _, err := ub.GetOTPCode(note.ItemId); err == nil {
+		t.Fatal("Expected error, received nil")
+	}
+}
@@ -0,0 +1,282 @@
+package lckbx
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// minPasswordBits is the fewest bits a new password can be estimated to
+// take to guess. It is about the strength of 16 random lowercase letters
+// and digits, or four words of the diceware list.
+const minPasswordBits = 50
+
+// PasswordProblemCode identifies why a password was rejected.
+type PasswordProblemCode string
+
+const (
+	PasswordTooShort PasswordProblemCode = "too short"
+	PasswordTooWeak  PasswordProblemCode = "too weak"
+	PasswordBreached PasswordProblemCode = "breached"
+)
+
+// PasswordProblem is a single reason a password was rejected, with a
+// message that can be shown to the user.
+type PasswordProblem struct {
+	Code    PasswordProblemCode
+	Message string
+}
+
+// PasswordError is returned by a PasswordPolicy that rejects a password. It
+// lists every problem with the password, and its estimated Strength, so
+// they can all be shown at once.
+type PasswordError struct {
+	Problems []PasswordProblem
+	Strength Strength
+}
+
+func (e *PasswordError) Error() string {
+	var messages []string
+	for _, p := range e.Problems {
+		messages = append(messages, p.Message)
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+// Has reports whether the password was rejected for the given reason.
+func (e *PasswordError) Has(code PasswordProblemCode) bool {
+	for _, p := range e.Problems {
+		if p.Code == code {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PasswordPolicy decides whether a new password can be used. Check is
+// given the normalized username and password, and returns a *PasswordError
+// if the password is rejected, or another error if it could not be checked.
+type PasswordPolicy interface {
+	Check(username, password string) error
+}
+
+// StrengthPolicy is the PasswordPolicy used unless another one is set. It
+// rejects passwords with fewer than MinLength characters, passwords that
+// are estimated to take fewer than MinBits to guess, and, if there is a
+// Breaches list, passwords that have been found in a data breach.
+type StrengthPolicy struct {
+	MinLength int
+	MinBits   float64
+	Breaches  *BreachList
+}
+
+// DefaultPasswordPolicy requires 16 characters and 50 bits.
+var DefaultPasswordPolicy = StrengthPolicy{
+	MinLength: minPassphraseLength,
+	MinBits:   minPasswordBits,
+}
+
+// strengthHints are suggestions for avoiding each pattern that makes a
+// password easy to guess.
+var strengthHints = map[StrengthPattern]string{
+	CommonPattern:    "avoid common passwords",
+	UserInputPattern: "avoid the username",
+	RepeatPattern:    "avoid repeated characters and words",
+	SequencePattern:  "avoid sequences like abc or 6543",
+	KeyboardPattern:  "avoid rows of keys like qwerty",
+	YearPattern:      "avoid years",
+}
+
+// Hints returns a suggestion for each kind of pattern that made the
+// password easier to guess, in the order they appear.
+func (s Strength) Hints() []string {
+	var hints []string
+	seen := make(map[StrengthPattern]bool)
+
+	for _, m := range s.Matches {
+		hint, ok := strengthHints[m.Pattern]
+		if ok && !seen[m.Pattern] {
+			hints = append(hints, hint)
+			seen[m.Pattern] = true
+		}
+	}
+
+	return hints
+}
+
+// passwordLength returns the number of characters in a password. Passwords
+// are NFKD normalized, which splits accented letters into a letter and
+// combining marks, so the marks are not counted.
+func passwordLength(password string) int {
+	n := 0
+	for _, r := range password {
+		if !unicode.Is(unicode.Mn, r) {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Check returns a *PasswordError listing every rule the password breaks.
+func (p StrengthPolicy) Check(username, password string) error {
+	var problems []PasswordProblem
+
+	if n := passwordLength(password); n < p.MinLength {
+		problems = append(problems, PasswordProblem{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("password has %d characters, at least %d are needed", n, p.MinLength),
+		})
+	}
+
+	strength := EstimateStrength(password, username)
+	if strength.Bits < p.MinBits {
+		message := fmt.Sprintf("password is too easy to guess, about %.0f of the %.0f bits needed", strength.Bits, p.MinBits)
+		if hints := strength.Hints(); len(hints) != 0 {
+			message += ": " + strings.Join(hints, ", ")
+		}
+
+		problems = append(problems, PasswordProblem{Code: PasswordTooWeak, Message: message})
+	}
+
+	if p.Breaches != nil {
+		count, err := p.Breaches.Count(password)
+		if err != nil {
+			return fmt.Errorf("could not StrengthPolicy.Check: %v", err)
+		}
+
+		if count != 0 {
+			problems = append(problems, PasswordProblem{
+				Code:    PasswordBreached,
+				Message: fmt.Sprintf("password has appeared in a data breach %d time(s)", count),
+			})
+		}
+	}
+
+	if len(problems) != 0 {
+		return &PasswordError{Problems: problems, Strength: strength}
+	}
+
+	return nil
+}
+
+// BreachList looks up passwords in a file of the SHA-1 hashes of breached
+// passwords, such as the Pwned Passwords list. Each line holds a hash in
+// hex, optionally followed by a colon and the number of times it was seen,
+// and the lines are sorted by hash. The file is searched where it is, so it
+// can be far larger than memory.
+type BreachList struct {
+	file *os.File
+	size int64
+}
+
+// OpenBreachList opens a sorted file of SHA-1 hashes.
+func OpenBreachList(filename string) (*BreachList, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("could not OpenBreachList: %v", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("could not OpenBreachList: %v", err)
+	}
+
+	return &BreachList{file: f, size: info.Size()}, nil
+}
+
+// Close closes the file.
+func (b *BreachList) Close() error {
+	return b.file.Close()
+}
+
+// lineAfter returns the first line that starts at or after offset, and the
+// offset just past it. It returns an empty line at the end of the file.
+func (b *BreachList) lineAfter(offset int64) (string, int64, error) {
+	start := offset
+	if offset > 0 {
+		start--
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(b.file, start, b.size-start))
+
+	// Skip the rest of the line the offset is in. Starting one byte early
+	// means a line that starts exactly at the offset is not skipped.
+	if offset > 0 {
+		skipped, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			return "", b.size, nil
+		}
+		if err != nil {
+			return "", 0, err
+		}
+
+		start += int64(len(skipped))
+	}
+
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", 0, err
+	}
+
+	return strings.TrimSpace(line), start + int64(len(line)), nil
+}
+
+// Count returns the number of times the password was seen in a breach, or
+// zero if it is not in the list. A hash listed without a count was seen
+// once. The lists hash passwords as they were typed, so the password is
+// composed to NFC before it is hashed rather than hashed in the NFKD form
+// used for key derivation.
+func (b *BreachList) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(norm.NFC.String(password)))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	lo, hi := int64(0), b.size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		line, end, err := b.lineAfter(mid)
+		if err != nil {
+			return 0, fmt.Errorf("could not BreachList.Count: %v", err)
+		}
+
+		if line == "" {
+			if end >= b.size {
+				hi = mid
+				continue
+			}
+
+			lo = end
+			continue
+		}
+
+		found, count, _ := strings.Cut(line, ":")
+
+		switch c := strings.Compare(strings.ToUpper(found), hash); {
+		case c < 0:
+			lo = end
+		case c > 0:
+			hi = mid
+		default:
+			n, err := strconv.Atoi(strings.TrimSpace(count))
+			if err != nil || n < 1 {
+				n = 1
+			}
+
+			return n, nil
+		}
+	}
+
+	return 0, nil
+}
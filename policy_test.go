@@ -0,0 +1,225 @@
+package lckbx
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	policyDB       = "policy_test.db"
+	policyUser     = "policy_user"
+	policyBreaches = "policy_test_breaches.txt"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	t.Run("Test Password Policy Check", testPasswordPolicyCheck)
+	t.Run("Test Breach List", testBreachList)
+	t.Run("Test LockedBox Password Policy", testLockedBoxPasswordPolicy)
+}
+
+// passwordProblems returns the codes of the problems in a *PasswordError.
+func passwordProblems(t *testing.T, err error) []PasswordProblemCode {
+	if err == nil {
+		return nil
+	}
+
+	var pe *PasswordError
+	if !errors.As(err, &pe) {
+		t.Fatalf("Expected a PasswordError, received %v", err)
+	}
+
+	var codes []PasswordProblemCode
+	for _, p := range pe.Problems {
+		codes = append(codes, p.Code)
+	}
+
+	return codes
+}
+
+func testPasswordPolicyCheck(t *testing.T) {
+	fmt.Println(t.Name())
+
+	p := DefaultPasswordPolicy
+
+	tests := []struct {
+		password string
+		expected []PasswordProblemCode
+	}{
+		{"violin-gravel-usher-ocean", nil},
+		{"aaaaaaaaaaaaaaaa", []PasswordProblemCode{PasswordTooWeak}},
+		{"0123456789abcdef", []PasswordProblemCode{PasswordTooWeak}},
+		{"password", []PasswordProblemCode{PasswordTooShort, PasswordTooWeak}},
+		{policyUser + "-2024", []PasswordProblemCode{PasswordTooWeak}},
+		// 16 bytes, but only 7 characters.
+		{"ü鹿🦊Ωжé!", []PasswordProblemCode{PasswordTooShort, PasswordTooWeak}},
+		// Combining marks are not counted as characters.
+		{norm.NFKD.String("éééééééééééééé"), []PasswordProblemCode{PasswordTooShort, PasswordTooWeak}},
+	}
+
+	for _, test := range tests {
+		codes := passwordProblems(t, p.Check(policyUser, test.password))
+		if fmt.Sprint(codes) != fmt.Sprint(test.expected) {
+			t.Fatalf("Expected %v for %q, received %v", test.expected, test.password, codes)
+		}
+	}
+
+	err := p.Check(policyUser, "0123456789abcdef")
+	if !strings.Contains(err.Error(), "avoid sequences") {
+		t.Fatalf("Expected a hint about sequences, received %v", err)
+	}
+}
+
+// writeBreachList writes a sorted list of the SHA-1 hashes of the passwords
+// with the number of times each was seen, with Windows line endings like
+// the Pwned Passwords downloads. A count of zero is written without one.
+func writeBreachList(t *testing.T, filename string, passwords map[string]int) {
+	var lines []string
+	for p, n := range passwords {
+		sum := sha1.Sum([]byte(p))
+		line := strings.ToUpper(hex.EncodeToString(sum[:]))
+		if n != 0 {
+			line = fmt.Sprintf("%s:%d", line, n)
+		}
+
+		lines = append(lines, line)
+	}
+
+	sort.Strings(lines)
+
+	err := os.WriteFile(filename, []byte(strings.Join(lines, "\r\n")+"\r\n"), 0600)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+}
+
+func testBreachList(t *testing.T) {
+	fmt.Println(t.Name())
+
+	breached := map[string]int{"violin-gravel-usher-ocean": 3, "uncounted-password": 0, "crème-brûlée-café-naïve": 2}
+	for n := 0; n < 500; n++ {
+		breached[fmt.Sprintf("breached-%d", n)] = n + 1
+	}
+
+	writeBreachList(t, policyBreaches, breached)
+	defer os.Remove(policyBreaches)
+
+	list, err := OpenBreachList(policyBreaches)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer list.Close()
+
+	for p, n := range breached {
+		if n == 0 {
+			n = 1
+		}
+
+		count, err := list.Count(p)
+		if err != nil || count != n {
+			t.Fatalf("Expected %q to be seen %d times, received %d and %v", p, n, count, err)
+		}
+	}
+
+	// Passwords are normalized to NFKD before they are checked, which must
+	// not hide them from a list of passwords hashed as typed.
+	count, err := list.Count(norm.NFKD.String("crème-brûlée-café-naïve"))
+	if err != nil || count != 2 {
+		t.Fatalf("Expected the NFKD password to be seen 2 times, received %d and %v", count, err)
+	}
+
+	for _, p := range []string{"", "breached-500", "violin-gravel-usher-oasis"} {
+		count, err := list.Count(p)
+		if err != nil || count != 0 {
+			t.Fatalf("Expected %q to not be found, received %d and %v", p, count, err)
+		}
+	}
+
+	p := StrengthPolicy{MinLength: minPassphraseLength, MinBits: minPasswordBits, Breaches: list}
+	codes := passwordProblems(t, p.Check(policyUser, "violin-gravel-usher-ocean"))
+	if fmt.Sprint(codes) != fmt.Sprint([]PasswordProblemCode{PasswordBreached}) {
+		t.Fatalf("Expected the password to be breached, received %v", codes)
+	}
+
+	if _, err := OpenBreachList("missing_breaches.txt"); err == nil {
+		t.Fatal("Expected error for a missing file, received nil")
+	}
+}
+
+// acceptPolicy is a PasswordPolicy that accepts every password.
+type acceptPolicy struct{}
+
+func (acceptPolicy) Check(username, password string) error {
+	return nil
+}
+
+// End-to-end test for the PasswordPolicy of a LockedBox
+//  1. Register with a weak password and ensure it is rejected.
+//  2. Change to a weak password and ensure it is rejected.
+//  3. Set a policy that accepts every password and change to a weak one.
+func testLockedBoxPasswordPolicy(t *testing.T) {
+	fmt.Println(t.Name())
+
+	store, err := NewStore(policyDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(policyDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 1.  Register with a weak password and ensure it is rejected.
+	weak := "aaaaaaaaaaaaaaaa"
+
+	codes := passwordProblems(t, lb.CheckPassword(policyUser, weak))
+	if fmt.Sprint(codes) != fmt.Sprint([]PasswordProblemCode{PasswordTooWeak}) {
+		t.Fatalf("Expected the password to be too weak, received %v", codes)
+	}
+
+	err = lb.Register(policyUser, weak)
+	if err == nil || !strings.Contains(err.Error(), "too easy to guess") {
+		t.Fatalf("Expected error for a weak password, received %v", err)
+	}
+
+	err = lb.Register(policyUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 2.  Change to a weak password and ensure it is rejected.
+	err = lb.ChangePassword(policyUser, lockedBoxGoodPassword, weak)
+	if err == nil || !strings.Contains(err.Error(), "too easy to guess") {
+		t.Fatalf("Expected error for a weak password, received %v", err)
+	}
+
+	ub, err := lb.login(policyUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected the old password to still work, received %v", err)
+	}
+	ub.Lock()
+
+	// 3.  Set a policy that accepts every password and change to a weak one.
+	lb.SetPasswordPolicy(acceptPolicy{})
+
+	err = lb.ChangePassword(policyUser, lockedBoxGoodPassword, weak)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err = lb.login(policyUser, weak)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"encoding/base32"
 	"fmt"
+	"math/big"
 )
 
 // newKeyBytes returns a byte slice with keySize random bytes.
@@ -56,3 +57,13 @@ func newRecoveryPhrase() string {
 
 	return phrase[:minPassphraseLength]
 }
+
+// randomIndex returns a uniformly random integer in [0, n).
+func randomIndex(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		panic(fmt.Errorf("Could not randomIndex: %v", err))
+	}
+
+	return int(i.Int64())
+}
@@ -0,0 +1,169 @@
+package lckbx
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// The Recovery struct holds the data needed to reset a forgotten password
+// with a recovery phrase. The RecoveryKey is stored in Key, encrypted with an
+// AuthKey derived from the recovery phrase. The User and the CryptKey that
+// protects the Keyset are stored in Data, encrypted with the RecoveryKey.
+// Since the RecoveryKey is also stored in the User, Data can be updated after
+// a password change without knowing the recovery phrase.
+type Recovery struct {
+	RecoveryId AuthToken
+	Key        []byte
+	Data       []byte
+}
+
+// recoveryData is the plaintext stored in Recovery.Data.
+type recoveryData struct {
+	AuthToken AuthToken
+	KeysetKey CryptKey
+	User      User
+}
+
+// seal encrypts the recoveryData with the RecoveryKey and stores it in Data.
+func (r *Recovery) seal(crypt crypter, key CryptKey, data recoveryData) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("could not Recovery.seal: %v", err)
+	}
+
+	crypt.ChangeKey(key[:])
+	encrypted, err := crypt.Encrypt(bytes, []byte(r.RecoveryId.String()))
+	if err != nil {
+		return fmt.Errorf("could not Recovery.seal: %v", err)
+	}
+
+	r.Data = encrypted
+
+	return nil
+}
+
+// open uses the AuthKey derived from the recovery phrase to decrypt the
+// RecoveryKey, then uses the RecoveryKey to decrypt and return the
+// recoveryData.
+func (r *Recovery) open(crypt crypter, rk AuthKey, uid UserToken) (recoveryData, error) {
+	var data recoveryData
+	var key CryptKey
+
+	crypt.ChangeKey(rk[:])
+	plaintext, err := crypt.Decrypt(r.Key, []byte(uid.String()))
+	if err != nil {
+		return data, fmt.Errorf("could not Recovery.open: %v", err)
+	}
+
+	key, err = parseCryptKey(string(plaintext))
+	if err != nil {
+		return data, fmt.Errorf("could not Recovery.open: %v", err)
+	}
+
+	crypt.ChangeKey(key[:])
+	plaintext, err = crypt.Decrypt(r.Data, []byte(r.RecoveryId.String()))
+	if err != nil {
+		return data, fmt.Errorf("could not Recovery.open: %v", err)
+	}
+
+	err = json.Unmarshal(plaintext, &data)
+	if err != nil {
+		return data, fmt.Errorf("could not Recovery.open: %v", err)
+	}
+
+	return data, nil
+}
+
+// Save stores the Recovery in the given recorder. The Key and Data fields are
+// already encrypted.
+func (r *Recovery) Save(store recorder) error {
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return fmt.Errorf("could not Recovery.Save: %v", err)
+	}
+
+	err = store.SaveRecovery(r.RecoveryId, bytes)
+	if err != nil {
+		return fmt.Errorf("could not Recovery.Save: %v", err)
+	}
+
+	return nil
+}
+
+// newRecovery creates a new Recovery with the RecoveryKey encrypted using the
+// AuthKey derived from the recovery phrase. The UserToken is used as
+// associated data.
+func newRecovery(crypt crypter, rid AuthToken, rk AuthKey, uid UserToken, key CryptKey) (*Recovery, error) {
+	crypt.ChangeKey(rk[:])
+	encrypted, err := crypt.Encrypt([]byte(key.String()), []byte(uid.String()))
+	if err != nil {
+		return nil, fmt.Errorf("could not newRecovery: %v", err)
+	}
+
+	r := Recovery{
+		RecoveryId: rid,
+		Key:        encrypted,
+	}
+
+	return &r, nil
+}
+
+// NewRecoveryFromStore retrieves the Recovery with the given RecoveryId from
+// the recorder.
+func NewRecoveryFromStore(store recorder, rid AuthToken) (*Recovery, error) {
+	var r Recovery
+
+	bytes, err := store.GetRecovery(rid)
+	if err != nil {
+		return &r, fmt.Errorf("could not NewRecoveryFromStore: %v", err)
+	}
+
+	err = json.Unmarshal(bytes, &r)
+	if err != nil {
+		return &r, fmt.Errorf("could not NewRecoveryFromStore: %v", err)
+	}
+
+	return &r, nil
+}
+
+// formatRecoveryPhrase splits a recovery phrase into groups of four
+// characters to make it easier to write down.
+func formatRecoveryPhrase(phrase string) string {
+	var groups []string
+
+	for len(phrase) > 4 {
+		groups = append(groups, phrase[:4])
+		phrase = phrase[4:]
+	}
+
+	groups = append(groups, phrase)
+
+	return strings.Join(groups, "-")
+}
+
+// normalizeRecoveryPhrase uppercases a recovery phrase and removes anything
+// that is not part of the phrase, such as the dashes added by
+// formatRecoveryPhrase and any whitespace.
+func normalizeRecoveryPhrase(phrase string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToUpper(phrase) {
+		if (r >= 'A' && r <= 'Z') || (r >= '2' && r <= '7') {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// newRecoveryDeriver returns the deriver recovery phrases are derived with.
+// A user's deriver is upgraded when they login, when the recovery phrase is
+// not known, so recovery phrases always use the original argonBlake
+// parameters. A recovery phrase holds 80 random bits, so it does not need
+// a slower deriver to be hard to guess.
+func newRecoveryDeriver() deriver {
+	version, _ := parseVersionToken(argonBlakeDeriverVersion)
+
+	return NewDeriver(version)
+}
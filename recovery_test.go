@@ -0,0 +1,172 @@
+package lckbx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var (
+	recoveryDB       = "recovery_test.db"
+	recoveryUser     = "recovery_user"
+	recoveryPassword = "staple-battery-correct-mango"
+	recoveryNoteName = "Recovered Note"
+)
+
+func TestRecovery(t *testing.T) {
+	t.Run("Test Recovery Phrase Format", testRecoveryPhraseFormat)
+	t.Run("Test Recover Account", testRecoverAccount)
+}
+
+func testRecoveryPhraseFormat(t *testing.T) {
+	fmt.Println(t.Name())
+
+	phrase := newRecoveryPhrase()
+	formatted := formatRecoveryPhrase(phrase)
+
+	if strings.Count(formatted, "-") != (len(phrase)-1)/4 {
+		t.Fatalf("Expected a dash every four characters, received %s", formatted)
+	}
+
+	normalized := normalizeRecoveryPhrase(" " + strings.ToLower(formatted) + "\n")
+	if normalized != phrase {
+		t.Fatalf("Expected %s, received %s", phrase, normalized)
+	}
+}
+
+// End-to-end test for a recovery phrase
+//  1. Register a user with a recovery phrase and add an item.
+//  2. Recover the account with the phrase and login with the new password.
+//  3. Change the password and recover the account again.
+//  4. Rotate the phrase and ensure only the new phrase works.
+//  5. Revoke the phrase and ensure it no longer works.
+func testRecoverAccount(t *testing.T) {
+	fmt.Println(t.Name())
+
+	store, err := NewStore(recoveryDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 1.  Register a user with a recovery phrase and add an item.
+	phrase, err := lb.RegisterWithRecovery(recoveryUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err := lb.Login(recoveryUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if !ub.HasRecoveryPhrase() {
+		t.Fatal("Expected user to have a recovery phrase")
+	}
+
+	n := NewNoteItem()
+	n.Name = recoveryNoteName
+	n.Data = []byte("data")
+
+	err = ub.AddNoteItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	// 2.  Recover the account with the phrase, written in lowercase, and
+	//     login with the new password.
+	err = lb.RecoverAccount(recoveryUser, lockedBoxBadPassword, recoveryPassword)
+	if err == nil {
+		t.Fatal("Expected error for bad recovery phrase, received nil")
+	}
+
+	err = lb.RecoverAccount(recoveryUser, strings.ToLower(phrase), recoveryPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	_, err = lb.Login(recoveryUser, lockedBoxGoodPassword)
+	if err == nil {
+		t.Fatal("Expected error for old password, received nil")
+	}
+
+	ub, err = lb.Login(recoveryUser, recoveryPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	items := ub.GetItemList()
+	if len(items) != 1 || items[0].Name != recoveryNoteName {
+		t.Fatalf("Expected one item named %s, received %v", recoveryNoteName, items)
+	}
+	ub.Lock()
+
+	// 3.  Change the password and recover the account again.
+	err = lb.ChangePassword(recoveryUser, recoveryPassword, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.RecoverAccount(recoveryUser, phrase, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err = lb.Login(recoveryUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 4.  Rotate the phrase and ensure only the new phrase works.
+	newPhrase, err := ub.RotateRecoveryPhrase()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	ub.Lock()
+
+	if newPhrase == phrase {
+		t.Fatal("Expected a new recovery phrase")
+	}
+
+	err = lb.RecoverAccount(recoveryUser, phrase, recoveryPassword)
+	if err == nil {
+		t.Fatal("Expected error for rotated recovery phrase, received nil")
+	}
+
+	err = lb.RecoverAccount(recoveryUser, newPhrase, recoveryPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 5.  Revoke the phrase and ensure it no longer works.
+	ub, err = lb.Login(recoveryUser, recoveryPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = ub.RevokeRecoveryPhrase()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if ub.HasRecoveryPhrase() {
+		t.Fatal("Expected user to have no recovery phrase")
+	}
+	ub.Lock()
+
+	err = lb.RecoverAccount(recoveryUser, newPhrase, lockedBoxGoodPassword)
+	if err == nil {
+		t.Fatal("Expected error for revoked recovery phrase, received nil")
+	}
+
+	_, err = lb.Login(recoveryUser, recoveryPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+}
@@ -0,0 +1,426 @@
+package lckbx
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RevisionLimit controls how many prior Revisions are kept for each Item.
+// Count is the most Revisions kept, and zero turns off the history. Age is
+// how long a Revision is kept, and zero keeps Revisions until Count is
+// reached.
+type RevisionLimit struct {
+	Count int
+	Age   time.Duration
+}
+
+// DefaultRevisionLimit keeps the last ten Revisions of each Item.
+var DefaultRevisionLimit = RevisionLimit{Count: 10}
+
+// validate ensures the limits are not negative.
+func (l RevisionLimit) validate() error {
+	if l.Count < 0 || l.Age < 0 {
+		return fmt.Errorf("revision limits cannot be negative")
+	}
+
+	return nil
+}
+
+// prune sorts the Revisions newest first and splits them into the ones to
+// keep and the ones that are over the limits at the given time.
+func (l RevisionLimit) prune(revisions []RevisionMetadata, now time.Time) ([]RevisionMetadata, []RevisionMetadata) {
+	var keep, drop []RevisionMetadata
+
+	sorted := append([]RevisionMetadata{}, revisions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Created.After(sorted[j].Created)
+	})
+
+	for _, rmd := range sorted {
+		tooMany := len(keep) >= l.Count
+		tooOld := l.Age != 0 && now.Sub(rmd.Created) > l.Age
+
+		if tooMany || tooOld {
+			drop = append(drop, rmd)
+			continue
+		}
+
+		keep = append(keep, rmd)
+	}
+
+	return keep, drop
+}
+
+// Revision is a copy of an Item as it was before it was updated. Revisions
+// are kept in their own bucket and encrypted with a key derived from the
+// Keyset BaseKey and the RevisionToken. The ItemToken is part of the
+// authenticated data so a Revision cannot be moved to another Item.
+type Revision struct {
+	RevisionId RevisionToken
+	ItemId     ItemToken
+	Created    time.Time
+	Item       Item
+}
+
+// ad returns the authenticated data used to encrypt the Revision.
+func (r *Revision) ad() []byte {
+	return []byte(r.RevisionId.String() + r.ItemId.String())
+}
+
+// bytes returns the Revision as encrypted bytes using the given crypter.
+func (r *Revision) bytes(crypt crypter) ([]byte, error) {
+	var encrypted []byte
+
+	bytes, err := json.Marshal(r)
+	if err != nil {
+		return encrypted, fmt.Errorf("could not Revision.Bytes: %v", err)
+	}
+
+	encrypted, err = crypt.Encrypt(bytes, r.ad())
+	if err != nil {
+		return encrypted, fmt.Errorf("could not Revision.Bytes: %v", err)
+	}
+
+	return encrypted, nil
+}
+
+// Save stores the Revision as encrypted bytes in the given recorder.
+func (r *Revision) Save(store recorder, crypt crypter) error {
+	bytes, err := r.bytes(crypt)
+	if err != nil {
+		return fmt.Errorf("could not Revision.Save: %v", err)
+	}
+
+	err = store.SaveRevision(r.RevisionId, bytes)
+	if err != nil {
+		return fmt.Errorf("could not Revision.Save: %v", err)
+	}
+
+	return nil
+}
+
+// NewRevision creates a new Revision holding a copy of the given Item.
+func NewRevision(i Item, created time.Time) Revision {
+	return Revision{
+		RevisionId: NewRevisionToken(),
+		ItemId:     i.ItemId,
+		Created:    created.UTC(),
+		Item:       i,
+	}
+}
+
+// newRevisionFromBytes creates a new Revision from encrypted bytes.
+func newRevisionFromBytes(crypt crypter, encrypted []byte, ad []byte) (Revision, error) {
+	var rev Revision
+
+	plaintext, err := crypt.Decrypt(encrypted, ad)
+	if err != nil {
+		return rev, err
+	}
+
+	err = json.Unmarshal(plaintext, &rev)
+	if err != nil {
+		return rev, err
+	}
+
+	if rev.Item.Type == "" {
+		rev.Item.Type = SecureNoteType
+	}
+
+	return rev, nil
+}
+
+// NewRevisionFromStore retrieves the encrypted Revision bytes from the given
+// recorder, decrypts the bytes, and returns a Revision.
+func NewRevisionFromStore(store recorder, crypt crypter, iid ItemToken, rid RevisionToken) (Revision, error) {
+	var rev Revision
+
+	bytes, err := store.GetRevision(rid)
+	if err != nil {
+		return rev, fmt.Errorf("could not NewRevisionFromStore: %v", err)
+	}
+
+	rev, err = newRevisionFromBytes(crypt, bytes, []byte(rid.String()+iid.String()))
+	if err != nil {
+		return rev, fmt.Errorf("could not NewRevisionFromStore: %v", err)
+	}
+
+	return rev, nil
+}
+
+// revisionText returns the text used to compare two versions of an Item.
+func revisionText(i Item) string {
+	return fmt.Sprintf("name: %s\n%s", i.Name, i.FormatText())
+}
+
+// loadRevision decrypts the Revision described by the RevisionMetadata. Like
+// loadItem, every key in the Keyset is tried if the recorded key version
+// does not work, and the key version that decrypted the Revision is
+// returned.
+func (u *UnlockedBox) loadRevision(r recorder, iid ItemToken, rmd RevisionMetadata) (Revision, VersionToken, error) {
+	versions := []VersionToken{rmd.KeyVersion, u.keyset.Latest}
+	for keyId := range u.keyset.Keys {
+		kv, _ := parseVersionToken(keyId)
+		versions = append(versions, kv)
+	}
+
+	var err error
+	for _, kv := range versions {
+		var key CryptKey
+		var rev Revision
+
+		key, err = u.keyset.GetRevisionKey(kv, rmd.RevisionId)
+		if err != nil {
+			continue
+		}
+
+		u.crypt.ChangeKey(key[:])
+		rev, err = NewRevisionFromStore(r, u.crypt, iid, rmd.RevisionId)
+		if err == nil {
+			return rev, kv, nil
+		}
+	}
+
+	return Revision{}, VersionToken{}, fmt.Errorf("could not UnlockedBox.loadRevision: %v", err)
+}
+
+// Save Revision
+// The saveRevision function keeps a copy of an Item before it is updated.
+//  1. Encrypt a Revision of the Item with a new key and save it.
+//  2. Add the RevisionMetadata to the ItemMetadata.
+//  3. Delete the Revisions that are over the RevisionLimit.
+//
+// The caller saves the returned ItemMetadata, in the same transaction, once
+// the Item itself has been updated.
+func (u *UnlockedBox) saveRevision(r recorder, imd ItemMetadata, previous Item, now time.Time) (ItemMetadata, error) {
+	limit := u.metadata.GetRevisionLimit()
+
+	revisions := append([]RevisionMetadata{}, imd.Revisions...)
+
+	// 1.  Encrypt a Revision of the Item with a new key and save it.
+	if limit.Count > 0 {
+		rev := NewRevision(previous, now)
+
+		key, err := u.keyset.GetNewRevisionKey(rev.RevisionId)
+		if err != nil {
+			return imd, fmt.Errorf("could not UnlockedBox.saveRevision: %v", err)
+		}
+
+		u.crypt.ChangeKey(key[:])
+		err = rev.Save(r, u.crypt)
+		if err != nil {
+			return imd, fmt.Errorf("could not UnlockedBox.saveRevision: %v", err)
+		}
+
+		// 2.  Add the RevisionMetadata to the ItemMetadata.
+		revisions = append(revisions, RevisionMetadata{
+			RevisionId: rev.RevisionId,
+			Created:    rev.Created,
+			KeyVersion: u.keyset.Latest,
+		})
+	}
+
+	// 3.  Delete the Revisions that are over the RevisionLimit.
+	keep, drop := limit.prune(revisions, now)
+	for _, rmd := range drop {
+		err := r.DeleteRevision(rmd.RevisionId)
+		if err != nil {
+			return imd, fmt.Errorf("could not UnlockedBox.saveRevision: %v", err)
+		}
+	}
+
+	imd.Revisions = keep
+
+	return imd, nil
+}
+
+// pruneRevisions deletes the Revisions of every Item that are over the
+// RevisionLimit at the given time, so Revisions older than the age limit do
+// not outlive it when their Item is never updated again. It is run by the
+// maintenance job and returns the number of Revisions deleted.
+func (u *UnlockedBox) pruneRevisions(now time.Time) (int, error) {
+	limit := u.metadata.GetRevisionLimit()
+
+	var old, pruned []ItemMetadata
+	var drop []RevisionMetadata
+	for _, imd := range u.metadata.GetItems() {
+		keep, d := limit.prune(imd.Revisions, now)
+		if len(d) == 0 {
+			continue
+		}
+
+		old = append(old, imd)
+		imd.Revisions = keep
+		pruned = append(pruned, imd)
+		drop = append(drop, d...)
+	}
+
+	if len(drop) == 0 {
+		return 0, nil
+	}
+
+	err := u.store.Update(func(r recorder) error {
+		for _, rmd := range drop {
+			err := r.DeleteRevision(rmd.RevisionId)
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, imd := range pruned {
+			u.metadata.AddItem(imd)
+		}
+
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		for _, imd := range old {
+			u.metadata.AddItem(imd)
+		}
+		return 0, fmt.Errorf("could not UnlockedBox.pruneRevisions: %v", err)
+	}
+
+	return len(drop), nil
+}
+
+// GetRevisionLimit returns the limits on the number and age of the
+// Revisions kept for each Item.
+func (u *UnlockedBox) GetRevisionLimit() RevisionLimit {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.metadata.GetRevisionLimit()
+}
+
+// SetRevisionLimit changes the limits on the Revisions kept for each Item
+// and saves them in the Metadata. Existing Revisions are pruned to the new
+// limits the next time their Item is updated or the maintenance job runs.
+func (u *UnlockedBox) SetRevisionLimit(limit RevisionLimit) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := limit.validate()
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.SetRevisionLimit: %v", err)
+	}
+
+	old := u.metadata.RevisionLimit
+	u.metadata.RevisionLimit = &limit
+
+	err = u.store.Update(u.saveMetadata)
+	if err != nil {
+		u.metadata.RevisionLimit = old
+		return fmt.Errorf("could not UnlockedBox.SetRevisionLimit: %v", err)
+	}
+
+	return nil
+}
+
+// GetRevisionList returns the RevisionMetadata of every Revision of the
+// given Item, newest first, without decrypting the Revisions.
+func (u *UnlockedBox) GetRevisionList(iid ItemToken) ([]RevisionMetadata, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return nil, fmt.Errorf("could not UnlockedBox.GetRevisionList: %v", err)
+	}
+
+	revisions := append([]RevisionMetadata{}, imd.Revisions...)
+	sort.SliceStable(revisions, func(i, j int) bool {
+		return revisions[i].Created.After(revisions[j].Created)
+	})
+
+	return revisions, nil
+}
+
+// getRevision loads a Revision of an Item while the caller holds the mutex.
+func (u *UnlockedBox) getRevision(iid ItemToken, rid RevisionToken) (Revision, error) {
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rmd, err := imd.GetRevision(rid)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	rev, _, err := u.loadRevision(u.store, iid, rmd)
+	if err != nil {
+		return Revision{}, err
+	}
+
+	return rev, nil
+}
+
+// GetRevision decrypts and returns a Revision of the given Item.
+func (u *UnlockedBox) GetRevision(iid ItemToken, rid RevisionToken) (Revision, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	rev, err := u.getRevision(iid, rid)
+	if err != nil {
+		return rev, fmt.Errorf("could not UnlockedBox.GetRevision: %v", err)
+	}
+
+	return rev, nil
+}
+
+// DiffRevisions compares two versions of an Item line by line. The zero
+// RevisionToken refers to the current Item, so a Revision can be compared
+// with the Item as it is now.
+func (u *UnlockedBox) DiffRevisions(iid ItemToken, from, to RevisionToken) (Diff, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	load := func(rid RevisionToken) (Item, error) {
+		if rid == (RevisionToken{}) {
+			imd, err := u.getItemMetadata(iid)
+			if err != nil {
+				return Item{}, err
+			}
+
+			item, _, err := u.loadItem(imd)
+			return item, err
+		}
+
+		rev, err := u.getRevision(iid, rid)
+		return rev.Item, err
+	}
+
+	a, err := load(from)
+	if err != nil {
+		return nil, fmt.Errorf("could not UnlockedBox.DiffRevisions: %v", err)
+	}
+
+	b, err := load(to)
+	if err != nil {
+		return nil, fmt.Errorf("could not UnlockedBox.DiffRevisions: %v", err)
+	}
+
+	return diffText(revisionText(a), revisionText(b)), nil
+}
+
+// RestoreRevision replaces an Item with one of its Revisions. The Item is
+// updated the same way as UpdateItem, so the version being replaced is
+// kept as a new Revision and the restore can be undone.
+func (u *UnlockedBox) RestoreRevision(iid ItemToken, rid RevisionToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	rev, err := u.getRevision(iid, rid)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.RestoreRevision: %v", err)
+	}
+
+	err = u.updateItem(rev.Item, true)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.RestoreRevision: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,430 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	revisionDB   = "revision_test.db"
+	revisionUser = "revision_user"
+)
+
+func TestRevision(t *testing.T) {
+	t.Run("Test RevisionLimit Prune", testRevisionLimitPrune)
+	t.Run("Test Diff Text", testDiffText)
+
+	store, err := NewStore(revisionDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(revisionDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(revisionUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Revision History", func(t *testing.T) { testRevisionHistory(t, &lb) })
+	t.Run("Test Revision Limit", func(t *testing.T) { testRevisionLimit(t, &lb) })
+	t.Run("Test Revision Expired", func(t *testing.T) { testRevisionExpired(t, &lb) })
+	t.Run("Test Revision Reencrypt", func(t *testing.T) { testRevisionReencrypt(t, &lb) })
+}
+
+func testRevisionLimitPrune(t *testing.T) {
+	fmt.Println(t.Name())
+
+	now := time.Now()
+
+	var revisions []RevisionMetadata
+	for i := 0; i < 5; i++ {
+		revisions = append(revisions, RevisionMetadata{
+			RevisionId: NewRevisionToken(),
+			Created:    now.Add(-time.Duration(i) * time.Hour),
+		})
+	}
+
+	keep, drop := RevisionLimit{Count: 3}.prune(revisions, now)
+	if len(keep) != 3 || len(drop) != 2 || keep[0].RevisionId != revisions[0].RevisionId {
+		t.Fatalf("Expected the newest three revisions, received %v and %v", keep, drop)
+	}
+
+	keep, drop = RevisionLimit{Count: 10, Age: 90 * time.Minute}.prune(revisions, now)
+	if len(keep) != 2 || len(drop) != 3 {
+		t.Fatalf("Expected two revisions newer than 90 minutes, received %v and %v", keep, drop)
+	}
+
+	keep, _ = RevisionLimit{}.prune(revisions, now)
+	if len(keep) != 0 {
+		t.Fatalf("Expected no revisions, received %v", keep)
+	}
+
+	if (RevisionLimit{Count: -1}).validate() == nil {
+		t.Fatal("Expected error for a negative count, received nil")
+	}
+}
+
+func testDiffText(t *testing.T) {
+	fmt.Println(t.Name())
+
+	diff := diffText("a\nb\nc\n", "a\nc\nd\n")
+	expected := " a\n-b\n c\n+d\n"
+
+	if diff.String() != expected {
+		t.Fatalf("Expected %q, received %q", expected, diff.String())
+	}
+
+	if !diff.Changed() {
+		t.Fatal("Expected the diff to have changes")
+	}
+
+	if diffText("a\nb", "a\nb\n").Changed() {
+		t.Fatal("Expected no changes")
+	}
+}
+
+// updateNote saves new data for the note.
+func updateNote(t *testing.T, ub *UnlockedBox, n NoteItem, data string) NoteItem {
+	n.Data = []byte(data)
+
+	err := ub.UpdateItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return n
+}
+
+// End-to-end test for the revision history
+//  1. Add a note and update it twice.
+//  2. Ensure the revisions are listed newest first and hold the old data.
+//  3. Diff a revision with the current note.
+//  4. Restore the oldest revision and ensure it can be undone.
+//  5. Purge the note and ensure the revisions are deleted.
+func testRevisionHistory(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(revisionUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	// 1.  Add a note and update it twice.
+	n := NewNoteItem()
+	n.Name = "History"
+	n.Data = []byte("one\n")
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	n = updateNote(t, &ub, n, "one\ntwo\n")
+	n = updateNote(t, &ub, n, "one\ntwo\nthree\n")
+
+	// Saving an unchanged note does not add a revision.
+	n = updateNote(t, &ub, n, "one\ntwo\nthree\n")
+
+	// 2.  Ensure the revisions are listed newest first and hold the old
+	//     data.
+	revisions, err := ub.GetRevisionList(n.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(revisions) != 2 {
+		t.Fatalf("Expected two revisions, received %v", revisions)
+	}
+
+	newest, err := ub.GetRevision(n.ItemId, revisions[0].RevisionId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	oldest, err := ub.GetRevision(n.ItemId, revisions[1].RevisionId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if string(newest.Item.Data) != "one\ntwo\n" || string(oldest.Item.Data) != "one\n" {
+		t.Fatalf("Expected the old data, received %q and %q", newest.Item.Data, oldest.Item.Data)
+	}
+
+	// 3.  Diff a revision with the current note.
+	diff, err := ub.DiffRevisions(n.ItemId, oldest.RevisionId, RevisionToken{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	expected := " name: History\n one\n+two\n+three\n"
+	if diff.String() != expected {
+		t.Fatalf("Expected %q, received %q", expected, diff.String())
+	}
+
+	// 4.  Restore the oldest revision and ensure it can be undone.
+	err = ub.RestoreRevision(n.ItemId, oldest.RevisionId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	restored, _ := ub.GetItem(n.ItemId)
+	if string(restored.Data) != "one\n" {
+		t.Fatalf("Expected the restored data, received %q", restored.Data)
+	}
+
+	revisions, _ = ub.GetRevisionList(n.ItemId)
+	if len(revisions) != 3 {
+		t.Fatalf("Expected three revisions, received %v", revisions)
+	}
+
+	undo, _ := ub.GetRevision(n.ItemId, revisions[0].RevisionId)
+	if string(undo.Item.Data) != "one\ntwo\nthree\n" {
+		t.Fatalf("Expected the replaced data, received %q", undo.Item.Data)
+	}
+
+	// 5.  Purge the note and ensure the revisions are deleted.
+	err = ub.DeleteItem(n.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = ub.PurgeItem(n.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, rmd := range revisions {
+		if _, err := ub.store.GetRevision(rmd.RevisionId); err == nil {
+			t.Fatal("Expected the revision to be deleted with the item")
+		}
+	}
+}
+
+func testRevisionLimit(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(revisionUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	err = ub.SetRevisionLimit(RevisionLimit{Count: 2})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.SetRevisionLimit(DefaultRevisionLimit)
+
+	n := NewNoteItem()
+	n.Name = "Limit"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var all []RevisionMetadata
+	for i := 0; i < 4; i++ {
+		n = updateNote(t, &ub, n, fmt.Sprintf("update %d", i))
+
+		revisions, _ := ub.GetRevisionList(n.ItemId)
+		all = append(all, revisions[0])
+	}
+
+	revisions, _ := ub.GetRevisionList(n.ItemId)
+	if len(revisions) != 2 {
+		t.Fatalf("Expected two revisions, received %v", revisions)
+	}
+
+	if _, err := ub.store.GetRevision(all[0].RevisionId); err == nil {
+		t.Fatal("Expected the pruned revision to be deleted")
+	}
+
+	// The limit is saved in the Metadata.
+	ub2, err := lb.login(revisionUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if ub2.GetRevisionLimit().Count != 2 {
+		t.Fatalf("Expected a limit of two, received %+v", ub2.GetRevisionLimit())
+	}
+	ub2.Lock()
+
+	// A count of zero turns off the history.
+	err = ub.SetRevisionLimit(RevisionLimit{})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	updateNote(t, &ub, n, "no history")
+
+	revisions, _ = ub.GetRevisionList(n.ItemId)
+	if len(revisions) != 0 {
+		t.Fatalf("Expected no revisions, received %v", revisions)
+	}
+
+	// Advancing an HOTP counter does not add a revision.
+	err = ub.SetRevisionLimit(DefaultRevisionLimit)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	otp := NewItem(OTPType)
+	otp.Name = "HOTP"
+	otp.OTP.Kind = HOTPKind
+	otp.OTP.Secret = "JBSWY3DPEHPK3PXP"
+
+	err = ub.AddItem(otp)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	_, _, err = ub.GetOTPCode(otp.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	revisions, _ = ub.GetRevisionList(otp.ItemId)
+	if len(revisions) != 0 {
+		t.Fatalf("Expected no revisions, received %v", revisions)
+	}
+}
+
+// Changing the password rotates the keys. The maintenance job reencrypts
+// the revisions with the Items and the old key is purged.
+// Revisions older than the age limit are deleted by the maintenance job,
+// even if their Item is never updated again.
+func testRevisionExpired(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(revisionUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	n := NewNoteItem()
+	n.Name = "Expired"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	n = updateNote(t, &ub, n, "old")
+	n = updateNote(t, &ub, n, "recent")
+
+	revisions, _ := ub.GetRevisionList(n.ItemId)
+	if len(revisions) != 2 {
+		t.Fatalf("Expected two revisions, received %v", revisions)
+	}
+	recent, old := revisions[0], revisions[1]
+
+	imd, _ := ub.metadata.GetItem(n.ItemId)
+	for i, rmd := range imd.Revisions {
+		if rmd.RevisionId == old.RevisionId {
+			imd.Revisions[i].Created = time.Now().Add(-48 * time.Hour)
+		}
+	}
+	ub.metadata.AddItem(imd)
+
+	err = ub.SetRevisionLimit(RevisionLimit{Count: 10, Age: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.SetRevisionLimit(DefaultRevisionLimit)
+
+	ub.startMaintenance()
+	status := ub.WaitMaintenance()
+	if status.Err != nil || status.Pruned != 1 {
+		t.Fatalf("Expected one revision pruned, received %+v", status)
+	}
+
+	revisions, _ = ub.GetRevisionList(n.ItemId)
+	if len(revisions) != 1 || revisions[0].RevisionId != recent.RevisionId {
+		t.Fatalf("Expected only the recent revision, received %v", revisions)
+	}
+
+	if _, err := ub.store.GetRevision(old.RevisionId); err == nil {
+		t.Fatal("Expected the expired revision to be deleted")
+	}
+
+	// The pruned Metadata is saved.
+	ub2, err := lb.login(revisionUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub2.Lock()
+
+	revisions, _ = ub2.GetRevisionList(n.ItemId)
+	if len(revisions) != 1 {
+		t.Fatalf("Expected one revision after login, received %v", revisions)
+	}
+
+	// Nothing is left to prune.
+	pruned, err := ub.pruneRevisions(time.Now())
+	if err != nil || pruned != 0 {
+		t.Fatalf("Expected nothing pruned, received %d and %v", pruned, err)
+	}
+}
+
+func testRevisionReencrypt(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(revisionUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	n := NewNoteItem()
+	n.Name = "Reencrypt"
+
+	err = ub.AddItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	updateNote(t, &ub, n, "updated")
+	ub.Lock()
+
+	err = lb.ChangePassword(revisionUser, lockedBoxGoodPassword, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub, err = lb.login(revisionUser, lockedBoxBadPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	ub.startMaintenance()
+	status := ub.WaitMaintenance()
+	if status.Err != nil || status.Purged != 1 {
+		t.Fatalf("Expected one key purged, received %+v", status)
+	}
+
+	revisions, _ := ub.GetRevisionList(n.ItemId)
+	if len(revisions) != 1 || revisions[0].KeyVersion.String() != ub.keyset.Latest.String() {
+		t.Fatalf("Expected one revision with the latest key, received %v", revisions)
+	}
+
+	rev, err := ub.GetRevision(n.ItemId, revisions[0].RevisionId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if rev.Item.Name != "Reencrypt" {
+		t.Fatalf("Expected Reencrypt, received %s", rev.Item.Name)
+	}
+}
@@ -0,0 +1,429 @@
+package lckbx
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// The search constants tune how Items are ranked. Words in the name of an
+// Item count nameWeight times as much as words in its fields and notes.
+// bm25K1 and bm25B are the usual BM25 parameters, which limit how much a
+// word repeated many times adds to the score and how much long Items are
+// penalized.
+const (
+	nameWeight = 3.0
+	bm25K1     = 1.2
+	bm25B      = 0.75
+)
+
+// The weight of each kind of match between a word in the query and a word
+// in the index. Exact matches count the most, then words that start with
+// the query word, then words that are a typo or two away from it.
+const (
+	exactMatch  = 1.0
+	prefixMatch = 0.7
+	fuzzyMatch  = 0.5
+)
+
+// SearchResult is an Item that matched a search, with its score and the
+// indexed words that matched the query. Results with higher scores are
+// better matches.
+type SearchResult struct {
+	Item    ItemMetadata
+	Score   float64
+	Matches []string
+}
+
+// searchDocument holds the words of a single Item and how often each
+// appears, weighted by where it appears.
+type searchDocument struct {
+	terms  map[string]float64
+	length float64
+}
+
+// searchIndex is an inverted index of the words in every Item that is not in
+// the trash. The index is only held in memory. It is built the first time the
+// UnlockedBox is searched, by decrypting every Item, and is then kept up to
+// date as Items are added, updated, deleted, and restored. Secret fields,
+// such as passwords, are never indexed.
+type searchIndex struct {
+	built    bool
+	docs     map[string]searchDocument
+	postings map[string]map[string]float64
+	length   float64
+}
+
+// newSearchIndex returns an empty index that has not been built.
+func newSearchIndex() *searchIndex {
+	var s searchIndex
+	s.clear()
+
+	return &s
+}
+
+// clear removes every Item from the index and marks it as not built.
+func (s *searchIndex) clear() {
+	s.built = false
+	s.docs = make(map[string]searchDocument)
+	s.postings = make(map[string]map[string]float64)
+	s.length = 0
+}
+
+// searchTerms splits text into lower case words. Anything that is not a
+// letter or a number separates words.
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// newSearchDocument collects the words of the Item's name, its fields that
+// are not secret, and its notes.
+func newSearchDocument(i Item) searchDocument {
+	doc := searchDocument{terms: make(map[string]float64)}
+
+	add := func(text string, weight float64) {
+		for _, term := range searchTerms(text) {
+			doc.terms[term] += weight
+			doc.length += weight
+		}
+	}
+
+	add(i.Name, nameWeight)
+
+	for _, f := range i.Fields() {
+		if !f.Secret {
+			add(f.Value, 1)
+		}
+	}
+
+	add(string(i.Data), 1)
+
+	return doc
+}
+
+// update adds the Item to the index, replacing the words it had before.
+func (s *searchIndex) update(i Item) {
+	s.remove(i.ItemId)
+
+	iid := i.ItemId.String()
+	doc := newSearchDocument(i)
+
+	for term, weight := range doc.terms {
+		if s.postings[term] == nil {
+			s.postings[term] = make(map[string]float64)
+		}
+
+		s.postings[term][iid] = weight
+	}
+
+	s.docs[iid] = doc
+	s.length += doc.length
+}
+
+// remove deletes the Item from the index.
+func (s *searchIndex) remove(iid ItemToken) {
+	doc, ok := s.docs[iid.String()]
+	if !ok {
+		return
+	}
+
+	for term := range doc.terms {
+		delete(s.postings[term], iid.String())
+		if len(s.postings[term]) == 0 {
+			delete(s.postings, term)
+		}
+	}
+
+	delete(s.docs, iid.String())
+	s.length -= doc.length
+}
+
+// maxEdits returns how many typos are allowed in a query word, so short
+// words must be spelled correctly and long words can have two typos.
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// editDistance returns the number of letters that must be inserted,
+// deleted, replaced, or swapped with the next letter to turn one word into
+// the other, or limit+1 if it is more than limit.
+func editDistance(a, b string, limit int) int {
+	ar, br := []rune(a), []rune(b)
+
+	if diff := len(ar) - len(br); diff > limit || -diff > limit {
+		return limit + 1
+	}
+
+	// Only the last two rows of the table are needed.
+	before := make([]int, len(br)+1)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		best := curr[0]
+
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+
+			if i > 1 && j > 1 && ar[i-1] == br[j-2] && ar[i-2] == br[j-1] && before[j-2]+1 < curr[j] {
+				curr[j] = before[j-2] + 1
+			}
+
+			if curr[j] < best {
+				best = curr[j]
+			}
+		}
+
+		// A swap reaches back two rows, so a row can only be abandoned once
+		// it and the row before it are both over the limit.
+		if best > limit && minInts(prev) > limit {
+			return limit + 1
+		}
+
+		before, prev, curr = prev, curr, before
+	}
+
+	if prev[len(br)] > limit {
+		return limit + 1
+	}
+
+	return prev[len(br)]
+}
+
+// minInts returns the smallest int in a list that is not empty.
+func minInts(list []int) int {
+	m := list[0]
+	for _, n := range list[1:] {
+		if n < m {
+			m = n
+		}
+	}
+
+	return m
+}
+
+// containsString reports whether the list holds the string.
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// min3 returns the smallest of three ints.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+
+	if c < a {
+		a = c
+	}
+
+	return a
+}
+
+// matchTerm returns the weight of the match between a word in the query and
+// a word in the index, or zero if they do not match.
+func matchTerm(query, term string) float64 {
+	if query == term {
+		return exactMatch
+	}
+
+	if strings.HasPrefix(term, query) {
+		return prefixMatch
+	}
+
+	limit := maxEdits(query)
+	if limit == 0 {
+		return 0
+	}
+
+	d := editDistance(query, term, limit)
+	if d > limit {
+		return 0
+	}
+
+	return fuzzyMatch / float64(d)
+}
+
+// search returns the score of every Item that matches all of the words in
+// the query, and the indexed words that matched. Each query word is scored
+// with BM25 using the best matching word in the Item, weighted by how close
+// the match is.
+func (s *searchIndex) search(query []string) (map[string]float64, map[string][]string) {
+	scores := make(map[string]float64)
+	matches := make(map[string][]string)
+
+	if len(s.docs) == 0 {
+		return scores, matches
+	}
+
+	n := float64(len(s.docs))
+	average := s.length / n
+
+	for q, word := range query {
+		best := make(map[string]float64)
+		bestTerm := make(map[string]string)
+
+		for term, posting := range s.postings {
+			weight := matchTerm(word, term)
+			if weight == 0 {
+				continue
+			}
+
+			df := float64(len(posting))
+			idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+
+			for iid, tf := range posting {
+				length := s.docs[iid].length / average
+				score := weight * idf * tf * (bm25K1 + 1) / (tf + bm25K1*(1-bm25B+bm25B*length))
+
+				if score > best[iid] {
+					best[iid] = score
+					bestTerm[iid] = term
+				}
+			}
+		}
+
+		// An Item must match every word in the query.
+		for iid := range scores {
+			if _, ok := best[iid]; !ok {
+				delete(scores, iid)
+				delete(matches, iid)
+			}
+		}
+
+		for iid, score := range best {
+			if _, ok := scores[iid]; !ok && q > 0 {
+				continue
+			}
+
+			scores[iid] += score
+			if !containsString(matches[iid], bestTerm[iid]) {
+				matches[iid] = append(matches[iid], bestTerm[iid])
+			}
+		}
+	}
+
+	return scores, matches
+}
+
+// buildIndex decrypts every Item that is not in the trash and adds it to the
+// search index. Items that cannot be decrypted are left out of the index;
+// they are reported by UnlockedBox.Check.
+func (u *UnlockedBox) buildIndex() {
+	u.index.clear()
+
+	for _, imd := range u.metadata.GetActiveItems() {
+		item, _, err := u.loadItem(imd)
+		if err != nil {
+			continue
+		}
+
+		u.index.update(item)
+	}
+
+	u.index.built = true
+}
+
+// indexItem updates the Item in the search index, if the index has been
+// built. It is called with the mutex held after an Item is changed.
+func (u *UnlockedBox) indexItem(i Item) {
+	if u.index != nil && u.index.built {
+		u.index.update(i)
+	}
+}
+
+// reindexItem decrypts the Item and updates it in the search index, if the
+// index has been built. An Item that cannot be decrypted is left out of the
+// index, the same as when the index is built.
+func (u *UnlockedBox) reindexItem(imd ItemMetadata) {
+	if u.index == nil || !u.index.built {
+		return
+	}
+
+	item, _, err := u.loadItem(imd)
+	if err != nil {
+		u.index.remove(imd.ItemId)
+		return
+	}
+
+	u.index.update(item)
+}
+
+// unindexItem removes the Item from the search index.
+func (u *UnlockedBox) unindexItem(iid ItemToken) {
+	if u.index != nil {
+		u.index.remove(iid)
+	}
+}
+
+// Search returns the Items whose name, notes, or fields that are not secret
+// match every word in the query, best match first. Words match exactly, as
+// the start of a longer word, or with a typo in words of four or more
+// letters. The Type, Folder, and Tag in the options limit the results the
+// same way as GetItemListWithOptions; the Sort and Reverse options are not
+// used. Items in the trash are never returned.
+func (u *UnlockedBox) Search(query string, opts ItemListOptions) ([]SearchResult, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	words := searchTerms(query)
+	if len(words) == 0 {
+		return nil, fmt.Errorf("could not UnlockedBox.Search: query has no words")
+	}
+
+	if !u.index.built {
+		u.buildIndex()
+	}
+
+	scores, matches := u.index.search(words)
+
+	var results []SearchResult
+	for iid, score := range scores {
+		imd, ok := u.metadata.Items[iid]
+		if !ok || imd.IsTrashed() || !opts.match(imd) {
+			continue
+		}
+
+		results = append(results, SearchResult{
+			Item:    imd,
+			Score:   score,
+			Matches: matches[iid],
+		})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+
+		return ItemListOptions{}.less(results[i].Item, results[j].Item)
+	})
+
+	return results, nil
+}
@@ -0,0 +1,237 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+var (
+	searchDB   = "search_test.db"
+	searchUser = "search_user"
+)
+
+func TestSearch(t *testing.T) {
+	t.Run("Test Search Terms", testSearchTerms)
+	t.Run("Test Edit Distance", testEditDistance)
+	t.Run("Test Match Term", testMatchTerm)
+
+	store, err := NewStore(searchDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(searchDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(searchUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Search Items", func(t *testing.T) { testSearchItems(t, &lb) })
+}
+
+func testSearchTerms(t *testing.T) {
+	fmt.Println(t.Name())
+
+	terms := searchTerms("Hello, World! e-mail: Ünïcode 42")
+	expected := []string{"hello", "world", "e", "mail", "ünïcode", "42"}
+
+	if !equalStrings(terms, expected) {
+		t.Fatalf("Expected %v, received %v", expected, terms)
+	}
+}
+
+func testEditDistance(t *testing.T) {
+	fmt.Println(t.Name())
+
+	tests := []struct {
+		a, b     string
+		limit    int
+		expected int
+	}{
+		{"kitten", "sitting", 3, 3},
+		{"kitten", "sitting", 2, 3},
+		{"flaw", "lawn", 2, 2},
+		{"same", "same", 1, 0},
+		{"ab", "abcdef", 2, 3},
+		{"héllo", "hello", 1, 1},
+		{"agnet", "agent", 1, 1},
+		{"ca", "abc", 3, 3},
+	}
+
+	for _, test := range tests {
+		d := editDistance(test.a, test.b, test.limit)
+		if d != test.expected {
+			t.Fatalf("Expected %d for %q and %q, received %d", test.expected, test.a, test.b, d)
+		}
+	}
+}
+
+func testMatchTerm(t *testing.T) {
+	fmt.Println(t.Name())
+
+	if matchTerm("bank", "bank") != exactMatch {
+		t.Fatal("Expected an exact match")
+	}
+
+	if matchTerm("ban", "bank") != prefixMatch {
+		t.Fatal("Expected a prefix match")
+	}
+
+	if matchTerm("bamk", "bank") != fuzzyMatch {
+		t.Fatal("Expected a fuzzy match")
+	}
+
+	// Short words must be spelled correctly.
+	if matchTerm("bnk", "bak") != 0 {
+		t.Fatal("Expected no match")
+	}
+}
+
+// addSearchItem adds an Item with the given name and notes.
+func addSearchItem(t *testing.T, ub *UnlockedBox, i Item, name, data string) Item {
+	i.Name = name
+	i.Data = []byte(data)
+
+	err := ub.AddItem(i)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return i
+}
+
+// searchNames returns the names of the Items that match the query, best
+// match first.
+func searchNames(t *testing.T, ub *UnlockedBox, query string, opts ItemListOptions) []string {
+	results, err := ub.Search(query, opts)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	var names []string
+	for _, r := range results {
+		names = append(names, r.Item.Name)
+	}
+
+	return names
+}
+
+// End-to-end test for search
+//  1. Add Items and search their names and notes.
+//  2. Ensure the results are ranked and that fuzzy matches are found.
+//  3. Ensure secret fields are not searched.
+//  4. Ensure the index follows updates, deletes, and restores.
+//  5. Ensure the filters in the options are applied.
+func testSearchItems(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(searchUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	// 1.  Add Items and search their names and notes.
+	recipe := addSearchItem(t, &ub, NewNoteItem(), "Recipes", "Grandma's apple pie\nbake at 180 degrees")
+	addSearchItem(t, &ub, NewNoteItem(), "Garden", "plant the apple tree in spring")
+	addSearchItem(t, &ub, NewNoteItem(), "Apple Support", "case number 1234")
+
+	login := NewItem(LoginType)
+	login.Login.Username = "gardener"
+	login.Login.Password = "tomato-secret"
+	login = addSearchItem(t, &ub, login, "Seed Shop", "")
+
+	if _, err := ub.Search(" ,. ", ItemListOptions{}); err == nil {
+		t.Fatal("Expected error for a query without words, received nil")
+	}
+
+	names := searchNames(t, &ub, "pie", ItemListOptions{})
+	if !equalStrings(names, []string{"Recipes"}) {
+		t.Fatalf("Expected Recipes, received %v", names)
+	}
+
+	// 2.  Ensure the results are ranked and that fuzzy matches are found.
+	// Words in the name count more than words in the notes.
+	names = searchNames(t, &ub, "apple", ItemListOptions{})
+	if len(names) != 3 || names[0] != "Apple Support" {
+		t.Fatalf("Expected Apple Support first, received %v", names)
+	}
+
+	names = searchNames(t, &ub, "aple tre", ItemListOptions{})
+	if !equalStrings(names, []string{"Garden"}) {
+		t.Fatalf("Expected Garden, received %v", names)
+	}
+
+	names = searchNames(t, &ub, "garden", ItemListOptions{})
+	if len(names) != 2 || names[0] != "Garden" || names[1] != "Seed Shop" {
+		t.Fatalf("Expected Garden then Seed Shop, received %v", names)
+	}
+
+	// Every word must match.
+	names = searchNames(t, &ub, "apple spring bake", ItemListOptions{})
+	if len(names) != 0 {
+		t.Fatalf("Expected no results, received %v", names)
+	}
+
+	// 3.  Ensure secret fields are not searched.
+	names = searchNames(t, &ub, "tomato", ItemListOptions{})
+	if len(names) != 0 {
+		t.Fatalf("Expected no results, received %v", names)
+	}
+
+	// 4.  Ensure the index follows updates, deletes, and restores.
+	recipe.Data = []byte("lemon tart")
+	err = ub.UpdateItem(recipe)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if names := searchNames(t, &ub, "pie", ItemListOptions{}); len(names) != 0 {
+		t.Fatalf("Expected no results, received %v", names)
+	}
+
+	if names := searchNames(t, &ub, "lemon", ItemListOptions{}); !equalStrings(names, []string{"Recipes"}) {
+		t.Fatalf("Expected Recipes, received %v", names)
+	}
+
+	err = ub.DeleteItem(recipe.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if names := searchNames(t, &ub, "lemon", ItemListOptions{}); len(names) != 0 {
+		t.Fatalf("Expected no results, received %v", names)
+	}
+
+	err = ub.RestoreItem(recipe.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if names := searchNames(t, &ub, "lemon", ItemListOptions{}); !equalStrings(names, []string{"Recipes"}) {
+		t.Fatalf("Expected Recipes, received %v", names)
+	}
+
+	// 5.  Ensure the filters in the options are applied.
+	names = searchNames(t, &ub, "garden", ItemListOptions{Type: LoginType})
+	if !equalStrings(names, []string{"Seed Shop"}) {
+		t.Fatalf("Expected Seed Shop, received %v", names)
+	}
+
+	err = ub.TagItem(login.ItemId, "shopping")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	names = searchNames(t, &ub, "garden", ItemListOptions{Tag: "shopping"})
+	if !equalStrings(names, []string{"Seed Shop"}) {
+		t.Fatalf("Expected Seed Shop, received %v", names)
+	}
+}
@@ -51,6 +51,20 @@ func getLockedBox() *lckbx.LockedBox {
 		log.Fatalf("Could not getLockedBox: %v", err)
 	}
 
+	// Check new passwords against the breach list in the .lckbx directory,
+	// if there is one.
+	breaches := fmt.Sprintf("%s/.lckbx/breached.txt", home)
+	if _, err := os.Stat(breaches); err == nil {
+		list, err := lckbx.OpenBreachList(breaches)
+		if err != nil {
+			log.Fatalf("Could not getLockedBox: %v", err)
+		}
+
+		policy := lckbx.DefaultPasswordPolicy
+		policy.Breaches = list
+		locked.SetPasswordPolicy(policy)
+	}
+
 	return &locked
 }
 
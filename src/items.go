@@ -1,25 +1,212 @@
 package main
 
 import (
+	"fmt"
 	"log"
+	"strings"
+	"sync"
 
 	"lckbx"
 )
 
 // ItemList is an intermediate struct that translates between the list type
 // needed by Fyne and the actual list of items in the database.
+//
+// The UI thread is the only one that changes an ItemList. The OTP ticker
+// reads current and ub from its own goroutine, so they are only changed
+// while holding the mutex, and done is closed when the ItemList is closed.
 type ItemList struct {
-	current *lckbx.NoteItem
+	current *lckbx.Item
 	ub      *lckbx.UnlockedBox
 	items   []lckbx.ItemMetadata
+	filter  lckbx.ItemType
+	sort    lckbx.ItemSort
+	folder  *lckbx.FolderToken
+	tag     string
+	query   string
+	mutex   sync.Mutex
+	done    chan struct{}
 }
 
 func (i *ItemList) Length() int {
 	return len(i.items)
 }
 
+// refresh reloads the list of items, keeping only the items of the type,
+// folder, and tag being filtered on, if any. The items are always returned
+// in the same order, so the list does not move around when it is redrawn.
+// While searching, the list holds the matching items, best match first.
+func (i *ItemList) refresh() {
+	opts := lckbx.ItemListOptions{
+		Sort:   i.sort,
+		Type:   i.filter,
+		Folder: i.folder,
+		Tag:    i.tag,
+	}
+
+	if strings.TrimSpace(i.query) == "" {
+		i.items = i.ub.GetItemListWithOptions(opts)
+		return
+	}
+
+	results, err := i.ub.Search(i.query, opts)
+	if err != nil {
+		log.Printf("Could not ItemList.refresh: %v", err)
+	}
+
+	i.items = nil
+	for _, r := range results {
+		i.items = append(i.items, r.Item)
+	}
+}
+
+// SetQuery limits the list to the items that match the search query. An
+// empty query lists every item in the order set by SetSort.
+func (i *ItemList) SetQuery(query string) {
+	i.query = query
+	i.refresh()
+}
+
+// SetFilter limits the list to items of the given type. An empty type shows
+// every item.
+func (i *ItemList) SetFilter(t lckbx.ItemType) {
+	i.filter = t
+	i.refresh()
+}
+
+// SetSort changes the order of the list.
+func (i *ItemList) SetSort(s lckbx.ItemSort) {
+	i.sort = s
+	i.refresh()
+}
+
+// SetFolder limits the list to the items directly in the given folder. A
+// nil folder shows the items in every folder.
+func (i *ItemList) SetFolder(fid *lckbx.FolderToken) {
+	i.folder = fid
+	i.refresh()
+}
+
+// SetTag limits the list to items with the given tag. An empty tag shows
+// every item.
+func (i *ItemList) SetTag(tag string) {
+	i.tag = tag
+	i.refresh()
+}
+
+// Folders returns the folders, sorted by their path.
+func (i *ItemList) Folders() []lckbx.Folder {
+	return i.ub.GetFolders()
+}
+
+// FolderPath returns the path of a folder, without a leading slash.
+func (i *ItemList) FolderPath(fid lckbx.FolderToken) string {
+	return i.ub.GetFolderPath(fid)
+}
+
+// Tags returns every tag, sorted.
+func (i *ItemList) Tags() []string {
+	return i.ub.GetTags()
+}
+
+// CreateFolder adds a new folder inside the given parent.
+func (i *ItemList) CreateFolder(name string, parent lckbx.FolderToken) {
+	log.Printf("Creating Folder: %s", name)
+
+	_, err := i.ub.CreateFolder(name, parent)
+	if err != nil {
+		log.Printf("Could not ItemList.CreateFolder: %v", err)
+	}
+}
+
+// DeleteFolder removes a folder, moving its contents to its parent, and
+// shows every folder again if it was being filtered on.
+func (i *ItemList) DeleteFolder(fid lckbx.FolderToken) {
+	log.Printf("Deleting Folder: %s", fid)
+
+	err := i.ub.DeleteFolder(fid)
+	if err != nil {
+		log.Printf("Could not ItemList.DeleteFolder: %v", err)
+		return
+	}
+
+	if i.folder != nil && *i.folder == fid {
+		i.folder = nil
+	}
+
+	i.refresh()
+}
+
+// CurrentMetadata returns the ItemMetadata of the current item, which holds
+// its folder and tags.
+func (i *ItemList) CurrentMetadata() (lckbx.ItemMetadata, bool) {
+	if i.current == nil {
+		return lckbx.ItemMetadata{}, false
+	}
+
+	for _, imd := range i.ub.GetItemList() {
+		if imd.ItemId == i.current.ItemId {
+			return imd, true
+		}
+	}
+
+	return lckbx.ItemMetadata{}, false
+}
+
+// Organize moves the current item into a folder and replaces its tags.
+func (i *ItemList) Organize(fid lckbx.FolderToken, tags []string) {
+	if i.current == nil {
+		return
+	}
+
+	iid := i.current.ItemId
+	log.Printf("Organizing Item: %s", iid)
+
+	imd, ok := i.CurrentMetadata()
+	if !ok {
+		return
+	}
+
+	var err error
+	if imd.Folder != fid {
+		err = i.ub.MoveItem(iid, fid)
+		if err != nil {
+			log.Printf("Could not ItemList.Organize: %v", err)
+		}
+	}
+
+	keep := make(map[string]bool)
+	for _, tag := range tags {
+		keep[tag] = true
+		if !imd.HasTag(tag) {
+			err = i.ub.TagItem(iid, tag)
+			if err != nil {
+				log.Printf("Could not ItemList.Organize: %v", err)
+			}
+		}
+	}
+
+	for _, tag := range imd.Tags {
+		if !keep[tag] {
+			err = i.ub.UntagItem(iid, tag)
+			if err != nil {
+				log.Printf("Could not ItemList.Organize: %v", err)
+			}
+		}
+	}
+
+	i.refresh()
+}
+
+// setCurrent changes the current item while holding the mutex.
+func (i *ItemList) setCurrent(item *lckbx.Item) {
+	i.mutex.Lock()
+	i.current = item
+	i.mutex.Unlock()
+}
+
 func (i *ItemList) loadItem(id int) {
-	var item lckbx.NoteItem
+	var item lckbx.Item
 
 	iid := i.items[id].ItemId
 	item, err := i.ub.GetItem(iid)
@@ -27,20 +214,20 @@ func (i *ItemList) loadItem(id int) {
 		log.Printf("Could not ItemList.loadItem: %v", err)
 	}
 
-	i.current = &item
+	i.setCurrent(&item)
 }
 
-func (i *ItemList) AddItem() {
-	n := lckbx.NewNoteItem()
-	log.Printf("Adding NoteItem: %s", n.ItemId)
+func (i *ItemList) AddItem(t lckbx.ItemType) {
+	n := lckbx.NewItem(t)
+	log.Printf("Adding %s Item: %s", t, n.ItemId)
 
-	err := i.ub.AddNoteItem(n)
+	err := i.ub.AddItem(n)
 	if err != nil {
 		log.Printf("Could not ItemList.AddItem: %v", err)
 		return
 	}
 
-	i.items = i.ub.GetItemList()
+	i.refresh()
 
 	for id := range i.items {
 		if i.items[id].ItemId.String() == n.ItemId.String() {
@@ -55,7 +242,7 @@ func (i *ItemList) DeleteItem() {
 		return
 	}
 
-	log.Printf("Deleting NoteItem: %s", i.current.ItemId)
+	log.Printf("Deleting Item: %s", i.current.ItemId)
 
 	err := i.ub.DeleteItem(i.current.ItemId)
 	if err != nil {
@@ -63,27 +250,159 @@ func (i *ItemList) DeleteItem() {
 		return
 	}
 
-	i.items = i.ub.GetItemList()
+	i.refresh()
 
 	if len(i.items) == 0 {
-		i.current = nil
+		i.setCurrent(nil)
 	} else {
 		i.loadItem(0)
 	}
 }
 
+// TrashList returns the items in the trash, most recently deleted first.
+func (i *ItemList) TrashList() []lckbx.ItemMetadata {
+	return i.ub.GetTrashList()
+}
+
+// RestoreItem moves an item out of the trash and reloads the list.
+func (i *ItemList) RestoreItem(iid lckbx.ItemToken) {
+	log.Printf("Restoring Item: %s", iid)
+
+	err := i.ub.RestoreItem(iid)
+	if err != nil {
+		log.Printf("Could not ItemList.RestoreItem: %v", err)
+		return
+	}
+
+	i.refresh()
+}
+
+// PurgeItem permanently deletes an item in the trash.
+func (i *ItemList) PurgeItem(iid lckbx.ItemToken) {
+	log.Printf("Purging Item: %s", iid)
+
+	err := i.ub.PurgeItem(iid)
+	if err != nil {
+		log.Printf("Could not ItemList.PurgeItem: %v", err)
+	}
+}
+
 func (i *ItemList) SaveItem() {
-	log.Printf("Saving NoteItem: %s", i.current.ItemId)
+	log.Printf("Saving Item: %s", i.current.ItemId)
 
-	err := i.ub.UpdateNoteItem(*i.current)
+	err := i.ub.UpdateItem(*i.current)
 	if err != nil {
 		log.Printf("Could not ItemList.SaveItem: %v", err)
 	}
 
-	i.items = i.ub.GetItemList()
+	i.refresh()
+}
+
+// GeneratePassword replaces the password in the text of the current Login
+// item with a random one, and returns the new text and the strength of the
+// password in bits. The item itself is not changed until it is saved.
+func (i *ItemList) GeneratePassword(text string) (string, float64) {
+	if i.current == nil || i.current.Type != lckbx.LoginType {
+		return text, 0
+	}
+
+	item := *i.current
+	err := item.ParseText(text)
+	if err != nil {
+		log.Printf("Could not ItemList.GeneratePassword: %v", err)
+		return text, 0
+	}
+
+	password, err := lckbx.GeneratePassword(lckbx.DefaultPasswordRules)
+	if err != nil {
+		log.Printf("Could not ItemList.GeneratePassword: %v", err)
+		return text, 0
+	}
+
+	item.Login.Password = password
+
+	return item.FormatText(), lckbx.DefaultPasswordRules.Entropy()
+}
+
+// Revisions returns the revisions of the current item, newest first.
+func (i *ItemList) Revisions() []lckbx.RevisionMetadata {
+	if i.current == nil {
+		return nil
+	}
+
+	revisions, err := i.ub.GetRevisionList(i.current.ItemId)
+	if err != nil {
+		log.Printf("Could not ItemList.Revisions: %v", err)
+	}
+
+	return revisions
 }
 
+// RevisionDiff returns the changes between a revision and the current
+// item.
+func (i *ItemList) RevisionDiff(rid lckbx.RevisionToken) string {
+	diff, err := i.ub.DiffRevisions(i.current.ItemId, rid, lckbx.RevisionToken{})
+	if err != nil {
+		log.Printf("Could not ItemList.RevisionDiff: %v", err)
+		return ""
+	}
+
+	return diff.String()
+}
+
+// RestoreRevision replaces the current item with one of its revisions and
+// reloads it.
+func (i *ItemList) RestoreRevision(rid lckbx.RevisionToken) {
+	log.Printf("Restoring Item %s to Revision %s", i.current.ItemId, rid)
+
+	err := i.ub.RestoreRevision(i.current.ItemId, rid)
+	if err != nil {
+		log.Printf("Could not ItemList.RestoreRevision: %v", err)
+		return
+	}
+
+	item, err := i.ub.GetItem(i.current.ItemId)
+	if err != nil {
+		log.Printf("Could not ItemList.RestoreRevision: %v", err)
+		return
+	}
+
+	i.setCurrent(&item)
+	i.refresh()
+}
+
+// OTPCode returns the current one-time code and the seconds it remains
+// valid if the current item is a TOTP item, otherwise it returns an empty
+// string. HOTP codes are not shown because showing one uses it up. It is
+// called by the OTP ticker, so it holds the mutex while it reads the item.
+func (i *ItemList) OTPCode() string {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.ub == nil || i.current == nil || i.current.OTP == nil || i.current.OTP.Kind != lckbx.TOTPKind {
+		return ""
+	}
+
+	code, remaining, err := i.ub.GetOTPCode(i.current.ItemId)
+	if err != nil {
+		log.Printf("Could not ItemList.OTPCode: %v", err)
+		return ""
+	}
+
+	return fmt.Sprintf("%s (%ds)", code, remaining)
+}
+
+// Close stops the OTP ticker and locks the UnlockedBox. Closing an ItemList
+// that is already closed does nothing.
 func (i *ItemList) Close() {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	if i.ub == nil {
+		return
+	}
+
+	close(i.done)
 	i.ub.Lock()
 
 	i.current = nil
@@ -96,6 +415,7 @@ func NewItemList(ub *lckbx.UnlockedBox) *ItemList {
 
 	il.ub = ub
 	il.items = ub.GetItemList()
+	il.done = make(chan struct{})
 
 	if len(il.items) > 0 {
 		il.loadItem(0)
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"lckbx"
 
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/canvas"
 	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
 	"fyne.io/fyne/v2/layout"
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
@@ -93,6 +97,53 @@ func homeShowAction() {
 func buildUnlockedScreen() fyne.CanvasObject {
 	name := widget.NewEntry()
 	data := widget.NewMultiLineEntry()
+	otp := widget.NewLabel("")
+
+	// generate replaces the password of the current Login item with a
+	// random one, which is kept once the item is saved, and shows its
+	// strength.
+	strength := widget.NewLabel("")
+	generate := widget.NewButtonWithIcon("Generate Password", theme.ViewRefreshIcon(), func() {
+		text, bits := il.GeneratePassword(data.Text)
+		data.SetText(text)
+		strength.SetText(fmt.Sprintf("%.0f bits", bits))
+	})
+
+	// showGenerate only enables the generate button for Login items.
+	showGenerate := func() {
+		strength.SetText("")
+		if il.current != nil && il.current.Type == lckbx.LoginType {
+			generate.Enable()
+		} else {
+			generate.Disable()
+		}
+	}
+	showGenerate()
+
+	// Refresh the one-time code of the current item every second until
+	// this ItemList is closed.
+	go func(items *ItemList) {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-items.done:
+				return
+			case <-ticker.C:
+				otp.SetText(items.OTPCode())
+			}
+		}
+	}(il)
+
+	var types []string
+	for _, t := range lckbx.ItemTypes {
+		types = append(types, string(t))
+	}
+
+	// newType is the type of item created by the add button.
+	newType := widget.NewSelect(types, nil)
+	newType.SetSelected(string(lckbx.SecureNoteType))
 
 	// time.Sleep(time.Millisecond * 100)
 
@@ -112,46 +163,421 @@ func buildUnlockedScreen() fyne.CanvasObject {
 		il.loadItem(i)
 
 		name.SetText(il.current.Name)
-		data.SetText(string(il.current.Data))
+		data.SetText(il.current.FormatText())
+		otp.SetText(il.OTPCode())
+		showGenerate()
+	}
+
+	// search lists the items that match the query, best match first.
+	search := widget.NewEntry()
+	search.SetPlaceHolder("Search...")
+	search.OnChanged = func(s string) {
+		il.SetQuery(s)
+		list.UnselectAll()
+		list.Refresh()
+	}
+
+	// filter limits the list to a single type of item.
+	filter := widget.NewSelect(append([]string{"all"}, types...), func(s string) {
+		if s == "all" {
+			s = ""
+		}
+
+		il.SetFilter(lckbx.ItemType(s))
+		list.UnselectAll()
+		list.Refresh()
+	})
+	filter.SetSelected("all")
+
+	// order sorts the list. Items that sort the same are ordered by name, so
+	// the list keeps a stable order.
+	var sorts []string
+	for _, s := range lckbx.ItemSorts {
+		sorts = append(sorts, string(s))
+	}
+
+	order := widget.NewSelect(sorts, func(s string) {
+		il.SetSort(lckbx.ItemSort(s))
+		list.UnselectAll()
+		list.Refresh()
+	})
+	order.SetSelected(string(lckbx.SortByName))
+
+	// tags limits the list to items with a single tag.
+	tags := widget.NewSelect(nil, func(s string) {
+		if s == "all tags" {
+			s = ""
+		}
+
+		il.SetTag(s)
+		list.UnselectAll()
+		list.Refresh()
+	})
+
+	loadTags := func() {
+		tags.Options = append([]string{"all tags"}, il.Tags()...)
+		tags.Refresh()
+	}
+	loadTags()
+	tags.SetSelected("all tags")
+
+	// folders shows the folder tree. Selecting a folder lists the items
+	// directly in it, and selecting the first node lists every item.
+	const allNode, topNode = "all", "/"
+
+	var children map[widget.TreeNodeID][]widget.TreeNodeID
+	var labels map[widget.TreeNodeID]string
+	var tokens map[widget.TreeNodeID]lckbx.FolderToken
+
+	loadFolders := func() {
+		children = map[widget.TreeNodeID][]widget.TreeNodeID{"": {allNode, topNode}}
+		labels = map[widget.TreeNodeID]string{allNode: "All items", topNode: "/"}
+		tokens = map[widget.TreeNodeID]lckbx.FolderToken{topNode: {}}
+
+		// The folders are sorted by path, so the children of each folder
+		// are sorted by name.
+		for _, f := range il.Folders() {
+			parent := topNode
+			if f.Parent != (lckbx.FolderToken{}) {
+				parent = f.Parent.String()
+			}
+
+			uid := f.FolderId.String()
+			children[parent] = append(children[parent], uid)
+			labels[uid] = f.Name
+			tokens[uid] = f.FolderId
+		}
 	}
+	loadFolders()
+
+	folders := widget.NewTree(
+		func(uid widget.TreeNodeID) []widget.TreeNodeID {
+			return children[uid]
+		},
+		func(uid widget.TreeNodeID) bool {
+			return len(children[uid]) > 0
+		},
+		func(branch bool) fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(uid widget.TreeNodeID, branch bool, o fyne.CanvasObject) {
+			o.(*widget.Label).SetText(labels[uid])
+		},
+	)
+
+	selectedFolder := widget.TreeNodeID(allNode)
+	folders.OnSelected = func(uid widget.TreeNodeID) {
+		selectedFolder = uid
+
+		if uid == allNode {
+			il.SetFolder(nil)
+		} else {
+			fid := tokens[uid]
+			il.SetFolder(&fid)
+		}
+
+		list.UnselectAll()
+		list.Refresh()
+	}
+	folders.OpenBranch(topNode)
+	folders.Select(allNode)
+
+	foldersToolbar := widget.NewToolbar(
+		widget.NewToolbarAction(theme.FolderNewIcon(), func() {
+			folderName := widget.NewEntry()
+			items := []*widget.FormItem{widget.NewFormItem("Name", folderName)}
+
+			dialog.ShowForm("New Folder", "Create", "Cancel", items, func(ok bool) {
+				if !ok {
+					return
+				}
 
-	itemUi := container.NewBorder(name, nil, nil, nil, data)
+				// New folders go inside the selected folder.
+				il.CreateFolder(folderName.Text, tokens[selectedFolder])
+				loadFolders()
+				folders.OpenBranch(selectedFolder)
+				folders.Refresh()
+			}, w)
+		}),
+		widget.NewToolbarAction(theme.DeleteIcon(), func() {
+			if selectedFolder == allNode || selectedFolder == topNode {
+				return
+			}
+
+			message := fmt.Sprintf("Delete the folder %q? Its contents are moved to its parent.", labels[selectedFolder])
+			dialog.ShowConfirm("Delete Folder", message, func(ok bool) {
+				if !ok {
+					return
+				}
+
+				il.DeleteFolder(tokens[selectedFolder])
+				loadFolders()
+				folders.Select(allNode)
+				folders.Refresh()
+				list.Refresh()
+			}, w)
+		}),
+	)
+
+	itemUi := container.NewBorder(container.NewVBox(name, otp, container.NewHBox(generate, strength)), nil, nil, nil, data)
 	itemListUi := container.NewVScroll(list)
 
 	itemsToolbar := widget.NewToolbar(
 		widget.NewToolbarAction(theme.ContentAddIcon(), func() {
-			il.AddItem()
+			il.AddItem(lckbx.ItemType(newType.Selected))
 			list.Refresh()
+			showGenerate()
 		}),
 		widget.NewToolbarAction(theme.DeleteIcon(), func() {
 			if il.current == nil {
+				return
+			}
+
+			message := fmt.Sprintf("Move %q to the trash?", il.current.Name)
+			dialog.ShowConfirm("Delete", message, func(ok bool) {
+				if !ok {
+					return
+				}
+
+				il.DeleteItem()
+				list.UnselectAll()
+				list.Refresh()
+
 				name.SetText("")
 				data.SetText("")
+				otp.SetText("")
+				if il.current != nil {
+					name.SetText(il.current.Name)
+					data.SetText(il.current.FormatText())
+				}
+				showGenerate()
 				itemUi.Refresh()
-			}
-
-			il.DeleteItem()
-			list.Refresh()
+			}, w)
 		}),
 		widget.NewToolbarAction(theme.DocumentSaveIcon(), func() {
 			if il.current == nil {
-				il.AddItem()
+				il.AddItem(lckbx.ItemType(newType.Selected))
 			}
 
 			il.current.Name = name.Text
-			il.current.Data = []byte(data.Text)
+			err := il.current.ParseText(data.Text)
+			if err != nil {
+				log.Printf("Could not save item: %v", err)
+				return
+			}
 
 			il.SaveItem()
 			list.Refresh()
 		}),
+		widget.NewToolbarAction(theme.HistoryIcon(), func() {
+			showHistoryDialog(func() {
+				name.SetText(il.current.Name)
+				data.SetText(il.current.FormatText())
+				list.Refresh()
+			})
+		}),
+		widget.NewToolbarAction(theme.FolderIcon(), func() {
+			showOrganizeDialog(func() {
+				loadTags()
+				list.Refresh()
+			})
+		}),
+		widget.NewToolbarAction(theme.ContentUndoIcon(), func() {
+			showTrashDialog(list.Refresh)
+		}),
 	)
 
-	left := container.NewBorder(itemsToolbar, nil, nil, nil, itemListUi)
-	screen := container.NewBorder(nil, nil, left, nil, itemUi)
+	folderUi := container.NewBorder(foldersToolbar, nil, nil, nil, folders)
+	left := container.NewBorder(container.NewVBox(itemsToolbar, search, newType, filter, tags, order), nil, nil, nil, itemListUi)
+
+	lists := container.NewHSplit(folderUi, left)
+	screen := container.NewHSplit(lists, itemUi)
+	screen.SetOffset(0.45)
 
 	return screen
 }
 
+// showHistoryDialog lists the revisions of the current item and shows how
+// each differs from the item as it is now. Restoring a revision calls
+// restored so the item can be redisplayed.
+func showHistoryDialog(restored func()) {
+	revisions := il.Revisions()
+	if len(revisions) == 0 {
+		dialog.ShowInformation("History", "This item has no earlier revisions.", w)
+		return
+	}
+
+	var times []string
+	for _, rev := range revisions {
+		times = append(times, rev.Created.Local().Format("2006-01-02 15:04:05"))
+	}
+
+	diff := widget.NewMultiLineEntry()
+	diff.Disable()
+
+	selected := -1
+	choose := widget.NewSelect(times, func(s string) {
+		for n := range times {
+			if times[n] == s {
+				selected = n
+				diff.SetText(il.RevisionDiff(revisions[n].RevisionId))
+			}
+		}
+	})
+	choose.SetSelectedIndex(0)
+
+	content := container.NewBorder(choose, nil, nil, nil, diff)
+
+	d := dialog.NewCustomConfirm("History", "Restore", "Close", content, func(restore bool) {
+		if !restore || selected < 0 {
+			return
+		}
+
+		il.RestoreRevision(revisions[selected].RevisionId)
+		restored()
+	}, w)
+
+	d.Resize(fyne.NewSize(width*0.75, height*0.75))
+	d.Show()
+}
+
+// showOrganizeDialog moves the current item into a folder and sets its
+// tags, which are entered separated by commas. Saving the changes calls
+// organized so the item list and the tag filter can be redisplayed.
+func showOrganizeDialog(organized func()) {
+	imd, ok := il.CurrentMetadata()
+	if !ok {
+		return
+	}
+
+	paths := []string{"/"}
+	tokens := []lckbx.FolderToken{{}}
+	for _, f := range il.Folders() {
+		paths = append(paths, "/"+il.FolderPath(f.FolderId))
+		tokens = append(tokens, f.FolderId)
+	}
+
+	folder := widget.NewSelect(paths, nil)
+	folder.SetSelected("/" + il.FolderPath(imd.Folder))
+
+	tags := widget.NewEntry()
+	tags.SetPlaceHolder("tag, another tag")
+	tags.SetText(strings.Join(imd.Tags, ", "))
+
+	items := []*widget.FormItem{
+		widget.NewFormItem("Folder", folder),
+		widget.NewFormItem("Tags", tags),
+	}
+
+	title := fmt.Sprintf("Organize %q", imd.Name)
+	dialog.ShowForm(title, "Save", "Cancel", items, func(ok bool) {
+		if !ok {
+			return
+		}
+
+		var list []string
+		for _, tag := range strings.Split(tags.Text, ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				list = append(list, tag)
+			}
+		}
+
+		il.Organize(tokens[folder.SelectedIndex()], list)
+		organized()
+	}, w)
+}
+
+// showTrashDialog lists the items in the trash so one can be restored or
+// permanently deleted. Restoring an item calls restored so the item list
+// can be redisplayed.
+func showTrashDialog(restored func()) {
+	trash := il.TrashList()
+	if len(trash) == 0 {
+		dialog.ShowInformation("Trash", "The trash is empty.", w)
+		return
+	}
+
+	var names []string
+	for _, imd := range trash {
+		names = append(names, fmt.Sprintf("%s (%s)", imd.Name, imd.Trashed.Local().Format("2006-01-02 15:04")))
+	}
+
+	selected := 0
+	choose := widget.NewSelect(names, func(s string) {
+		for n := range names {
+			if names[n] == s {
+				selected = n
+			}
+		}
+	})
+	choose.SetSelectedIndex(0)
+
+	var d dialog.Dialog
+
+	purge := widget.NewButtonWithIcon("Purge", theme.DeleteIcon(), func() {
+		message := fmt.Sprintf("Permanently delete %q? This cannot be undone.", trash[selected].Name)
+		dialog.ShowConfirm("Purge", message, func(ok bool) {
+			if !ok {
+				return
+			}
+
+			il.PurgeItem(trash[selected].ItemId)
+			d.Hide()
+		}, w)
+	})
+
+	content := container.NewVBox(choose, purge)
+
+	d = dialog.NewCustomConfirm("Trash", "Restore", "Close", content, func(restore bool) {
+		if !restore {
+			return
+		}
+
+		il.RestoreItem(trash[selected].ItemId)
+		restored()
+	}, w)
+
+	d.Show()
+}
+
+// checkNewPassword checks a new password against the password policy. If
+// it is rejected, every reason is shown in a dialog and it returns false.
+func checkNewPassword(username, password string) bool {
+	err := lb.CheckPassword(username, password)
+	if err == nil {
+		return true
+	}
+
+	var pe *lckbx.PasswordError
+	if !errors.As(err, &pe) {
+		log.Printf("Could not CheckPassword: %v", err)
+		dialog.ShowError(err, w)
+		return false
+	}
+
+	var reasons []string
+	for _, p := range pe.Problems {
+		reasons = append(reasons, fmt.Sprintf("- %s", p.Message))
+	}
+
+	dialog.ShowInformation("Choose Another Password", strings.Join(reasons, "\n"), w)
+
+	return false
+}
+
+// showStrength updates the label with the estimated strength of a new
+// password as it is typed.
+func showStrength(label *widget.Label, username *widget.Entry) func(string) {
+	return func(password string) {
+		if password == "" {
+			label.SetText("")
+			return
+		}
+
+		label.SetText(fmt.Sprintf("%.0f bits", lckbx.EstimateStrength(password, username.Text).Bits))
+	}
+}
+
 func buildLoginScreen() fyne.CanvasObject {
 	username := widget.NewEntry()
 	username.SetPlaceHolder("Enter username...")
@@ -198,10 +624,27 @@ func buildRegisterScreen() fyne.CanvasObject {
 	password := widget.NewPasswordEntry()
 	password.SetPlaceHolder("Enter password...")
 
+	// generate fills in a diceware passphrase and reveals it, so that it
+	// can be written down before registering.
+	strength := widget.NewLabel("")
+	password.OnChanged = showStrength(strength, username)
+	generate := widget.NewButtonWithIcon("Generate", theme.ViewRefreshIcon(), func() {
+		passphrase, err := lckbx.GeneratePassphrase(lckbx.DefaultPassphraseRules)
+		if err != nil {
+			log.Printf("Could not GeneratePassphrase: %v", err)
+			return
+		}
+
+		password.SetText(passphrase)
+		password.Password = false
+		password.Refresh()
+		strength.SetText(fmt.Sprintf("%.0f bits", lckbx.DefaultPassphraseRules.Entropy()))
+	})
+
 	form := container.New(
 		layout.NewFormLayout(),
 		widget.NewLabel("Username"), username,
-		widget.NewLabel("Password"), password,
+		widget.NewLabel("Password"), container.NewBorder(nil, nil, nil, container.NewHBox(strength, generate), password),
 	)
 
 	screen := container.New(
@@ -210,6 +653,10 @@ func buildRegisterScreen() fyne.CanvasObject {
 			layout.NewSpacer(),
 			form,
 			widget.NewButton("Register", func() {
+				if !checkNewPassword(username.Text, password.Text) {
+					return
+				}
+
 				err := lb.Register(username.Text, password.Text)
 				if err != nil {
 					log.Printf("Could not Register: %v", err)
@@ -238,11 +685,14 @@ func buildChangePasswordScreen() fyne.CanvasObject {
 	newPwd := widget.NewPasswordEntry()
 	newPwd.SetPlaceHolder("Enter new password...")
 
+	strength := widget.NewLabel("")
+	newPwd.OnChanged = showStrength(strength, username)
+
 	form := container.New(
 		layout.NewFormLayout(),
 		widget.NewLabel("Username"), username,
 		widget.NewLabel("Old Password"), oldPwd,
-		widget.NewLabel("New Password"), newPwd,
+		widget.NewLabel("New Password"), container.NewBorder(nil, nil, nil, strength, newPwd),
 	)
 
 	screen := container.New(
@@ -251,6 +701,10 @@ func buildChangePasswordScreen() fyne.CanvasObject {
 			layout.NewSpacer(),
 			form,
 			widget.NewButton("Change Password", func() {
+				if !checkNewPassword(username.Text, newPwd.Text) {
+					return
+				}
+
 				err := lb.ChangePassword(username.Text, oldPwd.Text, newPwd.Text)
 				if err != nil {
 					log.Printf("Could not Change Password: %v", err)
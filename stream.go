@@ -0,0 +1,272 @@
+package lckbx
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The stream constants describe the chunked format written by
+// xChaCha.EncryptStream. A stream starts with a random nonce prefix and is
+// followed by the sealed chunks. Every chunk except the last holds exactly
+// streamChunkSize bytes of plaintext.
+const (
+	streamChunkSize   = 64 * 1024
+	streamPrefixSize  = nonceSize - 5
+	streamTagSize     = 16
+	streamSealedChunk = streamChunkSize + streamTagSize
+	streamLastChunk   = 1
+)
+
+var errStreamClosed = errors.New("stream is closed")
+
+// streamNonce builds the nonce for a chunk using the STREAM construction.
+// The nonce is the random prefix, the big-endian chunk counter, and a flag
+// that is only set on the final chunk. Changing the order of the chunks
+// changes their counters, and removing chunks from the end leaves a last
+// chunk without the flag, so both are detected when the chunk is opened.
+func streamNonce(prefix []byte, counter uint32, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[streamPrefixSize:], counter)
+
+	if last {
+		nonce[nonceSize-1] = streamLastChunk
+	}
+
+	return nonce
+}
+
+// checkStreamAD ensures the associated data meets the same requirements as
+// xChaCha.Encrypt.
+func checkStreamAD(ad []byte) error {
+	if len(ad) == 0 {
+		return fmt.Errorf("missing associated data")
+	}
+
+	if len(ad) < tokenSize {
+		return fmt.Errorf("associated data is too short")
+	}
+
+	return nil
+}
+
+// streamWriter encrypts the data written to it in chunks. The last chunk is
+// held until Close so it can be sealed with the final flag.
+type streamWriter struct {
+	aead    cipher.AEAD
+	dst     io.Writer
+	ad      []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	sealed  []byte
+	closed  bool
+}
+
+// Write buffers the plaintext and writes each full chunk once more data
+// follows it.
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, fmt.Errorf("could not streamWriter.Write: %v", errStreamClosed)
+	}
+
+	written := 0
+	for len(p) > 0 {
+		if len(s.buf) == streamChunkSize {
+			err := s.flush(false)
+			if err != nil {
+				return written, fmt.Errorf("could not streamWriter.Write: %v", err)
+			}
+		}
+
+		n := copy(s.buf[len(s.buf):streamChunkSize], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+	}
+
+	return written, nil
+}
+
+// Close seals and writes the final chunk. It does not close the underlying
+// io.Writer.
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+
+	err := s.flush(true)
+	if err != nil {
+		return fmt.Errorf("could not streamWriter.Close: %v", err)
+	}
+
+	s.closed = true
+
+	return nil
+}
+
+// flush seals the buffered plaintext as the next chunk and writes it.
+func (s *streamWriter) flush(last bool) error {
+	nonce := streamNonce(s.prefix, s.counter, last)
+	s.sealed = s.aead.Seal(s.sealed[:0], nonce, s.buf, s.ad)
+
+	_, err := s.dst.Write(s.sealed)
+	if err != nil {
+		return err
+	}
+
+	if !last && s.counter == ^uint32(0) {
+		return fmt.Errorf("stream is too long")
+	}
+
+	s.counter++
+	s.buf = s.buf[:0]
+
+	return nil
+}
+
+// streamReader decrypts a stream written by a streamWriter one chunk at a
+// time. A sealed chunk and one extra byte are read ahead so the final chunk
+// can be recognized before it is opened.
+type streamReader struct {
+	aead    cipher.AEAD
+	src     io.Reader
+	ad      []byte
+	prefix  []byte
+	counter uint32
+	buf     []byte
+	carry   int
+	plain   []byte
+	unread  []byte
+	last    bool
+	err     error
+}
+
+// Read returns the decrypted plaintext. An error is returned if any chunk
+// was modified, reordered, or removed.
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.unread) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+
+		if s.last {
+			return 0, io.EOF
+		}
+
+		s.err = s.readChunk()
+	}
+
+	n := copy(p, s.unread)
+	s.unread = s.unread[n:]
+
+	return n, nil
+}
+
+// readChunk reads and opens the next chunk.
+func (s *streamReader) readChunk() error {
+	n, err := io.ReadFull(s.src, s.buf[s.carry:])
+	n += s.carry
+	s.carry = 0
+
+	chunk := s.buf[:n]
+	switch err {
+	case nil:
+		chunk = s.buf[:streamSealedChunk]
+	case io.EOF, io.ErrUnexpectedEOF:
+		s.last = true
+	default:
+		return fmt.Errorf("could not streamReader.Read: %v", err)
+	}
+
+	if len(chunk) < streamTagSize {
+		return fmt.Errorf("could not streamReader.Read: stream is truncated")
+	}
+
+	nonce := streamNonce(s.prefix, s.counter, s.last)
+	s.plain, err = s.aead.Open(s.plain[:0], nonce, chunk, s.ad)
+	if err != nil {
+		return fmt.Errorf("could not streamReader.Read: stream is truncated or modified")
+	}
+
+	if !s.last {
+		if s.counter == ^uint32(0) {
+			return fmt.Errorf("could not streamReader.Read: stream is too long")
+		}
+
+		s.counter++
+
+		// Keep the byte read past the chunk as the start of the next one.
+		s.buf[0] = s.buf[streamSealedChunk]
+		s.carry = 1
+	}
+
+	s.unread = s.plain
+
+	return nil
+}
+
+// EncryptStream returns an io.WriteCloser that encrypts everything written
+// to it and writes the result to dst. The plaintext is sealed in chunks of
+// streamChunkSize bytes, so memory use does not depend on the size of the
+// plaintext. Close must be called to write the final chunk.
+func (x *xChaCha) EncryptStream(dst io.Writer, ad []byte) (io.WriteCloser, error) {
+	if x.aead == nil {
+		return nil, fmt.Errorf("could not XChaCha.EncryptStream: aead is nil")
+	}
+
+	err := checkStreamAD(ad)
+	if err != nil {
+		return nil, fmt.Errorf("could not XChaCha.EncryptStream: %v", err)
+	}
+
+	prefix := newNonceBytes()[:streamPrefixSize]
+
+	_, err = dst.Write(prefix)
+	if err != nil {
+		return nil, fmt.Errorf("could not XChaCha.EncryptStream: %v", err)
+	}
+
+	return &streamWriter{
+		aead:   x.aead,
+		dst:    dst,
+		ad:     append([]byte{}, ad...),
+		prefix: prefix,
+		buf:    make([]byte, 0, streamChunkSize),
+		sealed: make([]byte, 0, streamSealedChunk),
+	}, nil
+}
+
+// DecryptStream returns an io.Reader that decrypts a stream written by
+// EncryptStream with the same key and associated data. Plaintext is only
+// returned after the chunk it came from has been authenticated, and reading
+// past the end of a truncated stream returns an error instead of io.EOF.
+func (x *xChaCha) DecryptStream(src io.Reader, ad []byte) (io.Reader, error) {
+	if x.aead == nil {
+		return nil, fmt.Errorf("could not XChaCha.DecryptStream: aead is nil")
+	}
+
+	err := checkStreamAD(ad)
+	if err != nil {
+		return nil, fmt.Errorf("could not XChaCha.DecryptStream: %v", err)
+	}
+
+	prefix := make([]byte, streamPrefixSize)
+
+	_, err = io.ReadFull(src, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("could not XChaCha.DecryptStream: stream is too short")
+	}
+
+	return &streamReader{
+		aead:   x.aead,
+		src:    src,
+		ad:     append([]byte{}, ad...),
+		prefix: prefix,
+		buf:    make([]byte, streamSealedChunk+1),
+		plain:  make([]byte, 0, streamChunkSize),
+	}, nil
+}
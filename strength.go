@@ -0,0 +1,690 @@
+package lckbx
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// StrengthPattern names the kind of guessable pattern that part of a
+// password matches.
+type StrengthPattern string
+
+const (
+	BruteforcePattern StrengthPattern = "bruteforce"
+	CommonPattern     StrengthPattern = "common password"
+	WordPattern       StrengthPattern = "word"
+	UserInputPattern  StrengthPattern = "user input"
+	RepeatPattern     StrengthPattern = "repeat"
+	SequencePattern   StrengthPattern = "sequence"
+	KeyboardPattern   StrengthPattern = "keyboard"
+	YearPattern       StrengthPattern = "year"
+)
+
+// StrengthMatch is one part of a password and the number of guesses, in
+// bits, it would take to find it on its own.
+type StrengthMatch struct {
+	Pattern StrengthPattern
+	Token   string
+	Bits    float64
+}
+
+// Strength estimates how hard a password is to guess. Bits is the base 2
+// logarithm of the number of guesses an attacker who knows common passwords,
+// English words, and keyboard patterns would need. Score is the same on a
+// scale of 0 to 4, and the Matches are the parts of the password the
+// estimate is made of, in order.
+type Strength struct {
+	Bits    float64
+	Score   int
+	Matches []StrengthMatch
+}
+
+// The estimate follows zxcvbn: each part of the password that does not
+// match a pattern is guessed as if every character had 10 possibilities,
+// and a password made of several parts costs the factorial of the number of
+// parts more, since the attacker does not know how it is split.
+const (
+	maxStrengthLength       = 100
+	minDictionaryLength     = 3
+	bruteforceCardinality   = 10
+	minSubmatchGuessesChar  = 10
+	minSubmatchGuessesMulti = 50
+	minGuessesBeforeGrowing = 10000
+	minYearSpace            = 20
+)
+
+//go:embed wordlist/common_passwords.txt
+var commonPasswordList []byte
+
+var (
+	commonPasswords     map[string]int
+	commonPasswordsOnce sync.Once
+)
+
+// getCommonPasswords returns the rank of each of the most common passwords,
+// starting at 1 for the most common.
+func getCommonPasswords() map[string]int {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = make(map[string]int)
+
+		s := bufio.NewScanner(bytes.NewReader(commonPasswordList))
+		for s.Scan() {
+			word := strings.TrimSpace(s.Text())
+			if _, ok := commonPasswords[word]; word != "" && !ok {
+				commonPasswords[word] = len(commonPasswords) + 1
+			}
+		}
+	})
+
+	return commonPasswords
+}
+
+// l33tTable maps the characters that are commonly substituted for letters
+// back to the letter.
+var l33tTable = map[rune]rune{
+	'4': 'a', '@': 'a', '8': 'b', '(': 'c', '3': 'e', '6': 'g', '9': 'g',
+	'1': 'i', '!': 'i', '|': 'l', '0': 'o', '$': 's', '5': 's', '7': 't',
+	'+': 't', '2': 'z', '%': 'x',
+}
+
+// keyboardRows are the rows of a US QWERTY keyboard, unshifted and shifted,
+// with the position of the first key of the row, measured in keys from the
+// left of the keyboard.
+var keyboardRows = []struct {
+	keys    string
+	shifted string
+	offset  float64
+}{
+	{"`1234567890-=", "~!@#$%^&*()_+", 0},
+	{"qwertyuiop[]\\", "QWERTYUIOP{}|", 1.5},
+	{"asdfghjkl;'", "ASDFGHJKL:\"", 1.75},
+	{"zxcvbnm,./", "ZXCVBNM<>?", 2.25},
+}
+
+// keyPosition is where a character is typed on the keyboard.
+type keyPosition struct {
+	row     int
+	x       float64
+	shifted bool
+}
+
+var (
+	keyboard       map[rune]keyPosition
+	keyboardKeys   float64
+	keyboardDegree float64
+	keyboardOnce   sync.Once
+)
+
+// adjacentKeys reports whether two keys are next to each other on the same
+// row or touch on neighbouring rows.
+func adjacentKeys(a, b keyPosition) bool {
+	dx := math.Abs(a.x - b.x)
+
+	switch a.row - b.row {
+	case 0:
+		return dx == 1
+	case 1, -1:
+		return dx <= 0.75
+	}
+
+	return false
+}
+
+// getKeyboard returns the position of every character on the keyboard, the
+// number of keys, and the average number of neighbours of a key.
+func getKeyboard() (map[rune]keyPosition, float64, float64) {
+	keyboardOnce.Do(func() {
+		keyboard = make(map[rune]keyPosition)
+
+		var positions []keyPosition
+		for row, r := range keyboardRows {
+			shifted := []rune(r.shifted)
+			for n, key := range []rune(r.keys) {
+				pos := keyPosition{row: row, x: r.offset + float64(n)}
+				positions = append(positions, pos)
+
+				keyboard[key] = pos
+				pos.shifted = true
+				keyboard[shifted[n]] = pos
+			}
+		}
+
+		neighbours := 0
+		for _, a := range positions {
+			for _, b := range positions {
+				if adjacentKeys(a, b) {
+					neighbours++
+				}
+			}
+		}
+
+		keyboardKeys = float64(len(positions))
+		keyboardDegree = float64(neighbours) / keyboardKeys
+	})
+
+	return keyboard, keyboardKeys, keyboardDegree
+}
+
+// strengthMatch is a pattern found in the runes [i, j) of a password.
+type strengthMatch struct {
+	i, j    int
+	pattern StrengthPattern
+	bits    float64
+}
+
+// strengthEstimator finds the patterns in a password and the cheapest way
+// to guess it with them.
+type strengthEstimator struct {
+	userInputs map[string]int
+	words      map[string]bool
+	maxWord    int
+	units      map[string]float64
+}
+
+// addWord records the length of a dictionary word, so that no longer part
+// of the password is looked up.
+func (e *strengthEstimator) addWord(word string) {
+	if n := len([]rune(word)); n > e.maxWord {
+		e.maxWord = n
+	}
+}
+
+// choose returns the binomial coefficient of n and k.
+func choose(n, k int) float64 {
+	if k < 0 || k > n {
+		return 0
+	}
+
+	lgn, _ := math.Lgamma(float64(n + 1))
+	lgk, _ := math.Lgamma(float64(k + 1))
+	lgnk, _ := math.Lgamma(float64(n - k + 1))
+
+	return math.Round(math.Exp(lgn - lgk - lgnk))
+}
+
+// variations returns the number of ways a token with a of one kind of
+// character and b of another could have been changed, such as by
+// capitalizing some of its letters.
+func variations(a, b int) float64 {
+	if a == 0 || b == 0 {
+		return 2
+	}
+
+	sum := 0.0
+	for i := 1; i <= a && i <= b; i++ {
+		sum += choose(a+b, i)
+	}
+
+	return sum
+}
+
+// upperVariations returns the number of ways the letters of a word could
+// have been capitalized. Capitalizing the first or last letter, or every
+// letter, is common enough to only double the guesses.
+func upperVariations(token []rune) float64 {
+	upper, lower := 0, 0
+	for _, r := range token {
+		if unicode.IsUpper(r) {
+			upper++
+		} else if unicode.IsLower(r) {
+			lower++
+		}
+	}
+
+	switch {
+	case upper == 0:
+		return 1
+	case lower == 0:
+		return 2
+	case upper == 1 && (unicode.IsUpper(token[0]) || unicode.IsUpper(token[len(token)-1])):
+		return 2
+	}
+
+	return variations(upper, lower)
+}
+
+// l33tVariations returns the number of ways the letters of a word could
+// have been substituted with the characters in the l33tTable.
+func l33tVariations(token []rune) float64 {
+	subs := make(map[rune]bool)
+	for _, r := range token {
+		if _, ok := l33tTable[r]; ok {
+			subs[r] = true
+		}
+	}
+
+	total := 1.0
+	for sub := range subs {
+		subbed, unsubbed := 0, 0
+		for _, r := range token {
+			if r == sub {
+				subbed++
+			} else if unicode.ToLower(r) == l33tTable[sub] {
+				unsubbed++
+			}
+		}
+
+		total *= variations(subbed, unsubbed)
+	}
+
+	return total
+}
+
+// dictionaryMatches finds the common passwords, words of the diceware list,
+// and user inputs in the password, written forwards or backwards, in any
+// case, and with l33t substitutions.
+func (e *strengthEstimator) dictionaryMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+
+	common := getCommonPasswords()
+	wordRank := len(e.words)
+
+	lower := make([]rune, len(password))
+	unleet := make([]rune, len(password))
+	for n, r := range password {
+		lower[n] = unicode.ToLower(r)
+		unleet[n] = lower[n]
+		if l, ok := l33tTable[r]; ok {
+			unleet[n] = l
+		}
+	}
+
+	// lookup returns the pattern and rank of a word, preferring the one
+	// that is easiest to guess.
+	lookup := func(word string) (StrengthPattern, int, bool) {
+		pattern, rank := StrengthPattern(""), 0
+
+		try := func(p StrengthPattern, r int, ok bool) {
+			if ok && (rank == 0 || r < rank) {
+				pattern, rank = p, r
+			}
+		}
+
+		r, ok := e.userInputs[word]
+		try(UserInputPattern, r, ok)
+		r, ok = common[word]
+		try(CommonPattern, r, ok)
+		try(WordPattern, wordRank, e.words[word])
+
+		return pattern, rank, rank != 0
+	}
+
+	for i := range password {
+		for j := i + minDictionaryLength; j <= len(password) && j-i <= e.maxWord; j++ {
+			token := password[i:j]
+			upper := math.Log2(upperVariations(token))
+
+			if p, rank, ok := lookup(string(lower[i:j])); ok {
+				matches = append(matches, strengthMatch{i, j, p, math.Log2(float64(rank)) + upper})
+				continue
+			}
+
+			if p, rank, ok := lookup(string(unleet[i:j])); ok {
+				bits := math.Log2(float64(rank)) + upper + math.Log2(l33tVariations(token))
+				matches = append(matches, strengthMatch{i, j, p, bits})
+				continue
+			}
+
+			reversed := make([]rune, len(token))
+			for n := range token {
+				reversed[len(token)-1-n] = lower[i+n]
+			}
+
+			if p, rank, ok := lookup(string(reversed)); ok {
+				matches = append(matches, strengthMatch{i, j, p, math.Log2(float64(rank)) + upper + 1})
+			}
+		}
+	}
+
+	return matches
+}
+
+// repeatMatches finds runs of the same character, and of the same group of
+// characters, repeated. Guessing a repeat costs guessing what is repeated
+// and the number of times it is.
+func (e *strengthEstimator) repeatMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+
+	for i := range password {
+		for unit := 1; i+2*unit <= len(password); unit++ {
+			count := 1
+			for i+(count+1)*unit <= len(password) && string(password[i+count*unit:i+(count+1)*unit]) == string(password[i:i+unit]) {
+				count++
+			}
+
+			// A single character must be repeated three times to be
+			// more than a coincidence.
+			if count < 2 || (unit == 1 && count < 3) {
+				continue
+			}
+
+			token := string(password[i : i+unit])
+			base, ok := e.units[token]
+			if !ok {
+				base, _ = e.estimate(password[i : i+unit])
+				e.units[token] = base
+			}
+
+			matches = append(matches, strengthMatch{i, i + count*unit, RepeatPattern, base + math.Log2(float64(count))})
+		}
+	}
+
+	return matches
+}
+
+// sequenceClass returns the class of characters a sequence stays within.
+func sequenceClass(r rune) CharClass {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return LowerClass
+	case r >= 'A' && r <= 'Z':
+		return UpperClass
+	case r >= '0' && r <= '9':
+		return DigitClass
+	}
+
+	return 0
+}
+
+// sequenceMatches finds runs of letters or digits that go up or down by the
+// same step of at most 5, such as abcd, 7531, or ZYX.
+func (e *strengthEstimator) sequenceMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+
+	for i := 0; i+2 < len(password); i++ {
+		class := sequenceClass(password[i])
+		delta := password[i+1] - password[i]
+		if class == 0 || delta == 0 || delta > 5 || delta < -5 {
+			continue
+		}
+
+		j := i + 1
+		for j < len(password) && sequenceClass(password[j]) == class && password[j]-password[j-1] == delta {
+			j++
+		}
+
+		if j-i < 3 {
+			continue
+		}
+
+		base := 26.0
+		switch {
+		case strings.ContainsRune("aAzZ019", password[i]):
+			base = 4
+		case class == DigitClass:
+			base = 10
+		}
+
+		if delta < 0 {
+			base *= 2
+		}
+
+		matches = append(matches, strengthMatch{i, j, SequencePattern, math.Log2(base * float64(j-i))})
+	}
+
+	return matches
+}
+
+// keyboardMatches finds runs of three or more keys that are next to each
+// other on the keyboard, such as qwerty or zaq1. Guessing one costs the
+// number of places it could start and the turns it takes.
+func (e *strengthEstimator) keyboardMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+
+	keys, starts, degree := getKeyboard()
+
+	for i := range password {
+		prev, ok := keys[password[i]]
+		if !ok {
+			continue
+		}
+
+		turns, shifted := 0, 0
+		if prev.shifted {
+			shifted++
+		}
+
+		var direction [2]float64
+		j := i + 1
+		for ; j < len(password); j++ {
+			pos, ok := keys[password[j]]
+			if !ok || !adjacentKeys(prev, pos) {
+				break
+			}
+
+			d := [2]float64{float64(pos.row - prev.row), math.Copysign(1, pos.x-prev.x)}
+			if d != direction {
+				turns++
+				direction = d
+			}
+
+			if pos.shifted {
+				shifted++
+			}
+
+			prev = pos
+		}
+
+		length := j - i
+		if length < 3 {
+			continue
+		}
+
+		guesses := 0.0
+		for l := 2; l <= length; l++ {
+			for t := 1; t <= turns && t <= l-1; t++ {
+				guesses += choose(l-1, t-1) * starts * math.Pow(degree, float64(t))
+			}
+		}
+
+		if shifted != 0 {
+			guesses *= variations(shifted, length-shifted)
+		}
+
+		matches = append(matches, strengthMatch{i, j, KeyboardPattern, math.Log2(guesses)})
+	}
+
+	return matches
+}
+
+// yearMatches finds years from 1900 to 2099. Years close to now are the
+// easiest to guess.
+func (e *strengthEstimator) yearMatches(password []rune) []strengthMatch {
+	var matches []strengthMatch
+
+	now := time.Now().Year()
+
+	for i := 0; i+4 <= len(password); i++ {
+		year := 0
+		for _, r := range password[i : i+4] {
+			if r < '0' || r > '9' {
+				year = -1
+				break
+			}
+
+			year = year*10 + int(r-'0')
+		}
+
+		if year < 1900 || year > 2099 {
+			continue
+		}
+
+		space := math.Max(math.Abs(float64(year-now)), minYearSpace)
+		matches = append(matches, strengthMatch{i, i + 4, YearPattern, math.Log2(space)})
+	}
+
+	return matches
+}
+
+// estimate returns the bits of the cheapest way to guess the password, and
+// the matches it is made of. Every part of the password can be guessed by
+// bruteforce, so the estimate always covers the whole password.
+//  1. Find every match of every pattern.
+//  2. Find the cheapest sequence of matches for each number of matches.
+//  3. Choose the number of matches with the fewest guesses.
+func (e *strengthEstimator) estimate(password []rune) (float64, []strengthMatch) {
+	n := len(password)
+	if n == 0 {
+		return 0, nil
+	}
+
+	// 1.  Find every match of every pattern.
+	var found []strengthMatch
+	found = append(found, e.dictionaryMatches(password)...)
+	found = append(found, e.repeatMatches(password)...)
+	found = append(found, e.sequenceMatches(password)...)
+	found = append(found, e.keyboardMatches(password)...)
+	found = append(found, e.yearMatches(password)...)
+
+	// 1.a A match shorter than the password takes a minimum number of
+	//     guesses, since it has to be guessed along with the rest.
+	for m := range found {
+		if found[m].j-found[m].i == n {
+			continue
+		}
+
+		min := float64(minSubmatchGuessesMulti)
+		if found[m].j-found[m].i == 1 {
+			min = minSubmatchGuessesChar
+		}
+
+		found[m].bits = math.Max(found[m].bits, math.Log2(min))
+	}
+
+	// 1.b Every part of the password can be guessed by bruteforce.
+	for i := 0; i < n; i++ {
+		for j := i + 1; j <= n; j++ {
+			bits := float64(j-i) * math.Log2(bruteforceCardinality)
+			if j-i == 1 && j-i != n {
+				bits = math.Log2(minSubmatchGuessesChar + 1)
+			}
+
+			found = append(found, strengthMatch{i, j, BruteforcePattern, bits})
+		}
+	}
+
+	byEnd := make([][]int, n+1)
+	for m, match := range found {
+		byEnd[match.j] = append(byEnd[match.j], m)
+	}
+
+	// 2.  Find the cheapest sequence of matches for each number of matches.
+	//     best[j][l] is the fewest bits to guess the first j runes with l
+	//     matches, and last[j][l] is the last of those matches.
+	best := make([][]float64, n+1)
+	last := make([][]int, n+1)
+	for j := range best {
+		best[j] = make([]float64, n+1)
+		last[j] = make([]int, n+1)
+		for l := range best[j] {
+			best[j][l] = math.Inf(1)
+		}
+	}
+	best[0][0] = 0
+
+	for j := 1; j <= n; j++ {
+		for _, m := range byEnd[j] {
+			match := found[m]
+			for l := 1; l <= match.i+1; l++ {
+				bits := best[match.i][l-1] + match.bits
+				if bits < best[j][l] {
+					best[j][l] = bits
+					last[j][l] = m
+				}
+			}
+		}
+	}
+
+	// 3.  Choose the number of matches with the fewest guesses. The order
+	//     of the matches is unknown, so l matches cost l! more guesses, and
+	//     a long sequence of matches costs at least a growing minimum.
+	bits, count := math.Inf(1), 0
+	for l := 1; l <= n; l++ {
+		if math.IsInf(best[n][l], 1) {
+			continue
+		}
+
+		lf, _ := math.Lgamma(float64(l + 1))
+		product := lf/math.Ln2 + best[n][l]
+		growing := float64(l-1) * math.Log2(minGuessesBeforeGrowing)
+
+		total := math.Max(product, growing) + math.Log2(1+math.Exp2(-math.Abs(product-growing)))
+		if total < bits {
+			bits, count = total, l
+		}
+	}
+
+	matches := make([]strengthMatch, count)
+	for j, l := n, count; l > 0; l-- {
+		matches[l-1] = found[last[j][l]]
+		j = matches[l-1].i
+	}
+
+	return bits, matches
+}
+
+// strengthScore converts bits into a score from 0 to 4, using the same
+// thresholds as zxcvbn: 10^3, 10^6, 10^8, and 10^10 guesses.
+func strengthScore(bits float64) int {
+	score := 0
+	for _, guesses := range []float64{1e3 + 5, 1e6 + 5, 1e8 + 5, 1e10 + 5} {
+		if bits >= math.Log2(guesses) {
+			score++
+		}
+	}
+
+	return score
+}
+
+// EstimateStrength estimates how many guesses it would take to find the
+// password. The userInputs are words an attacker could know about the
+// user, such as their username, and are guessed first. Only the first 100
+// characters are considered.
+func EstimateStrength(password string, userInputs ...string) Strength {
+	runes := []rune(password)
+	if len(runes) > maxStrengthLength {
+		runes = runes[:maxStrengthLength]
+	}
+
+	e := strengthEstimator{
+		userInputs: make(map[string]int),
+		words:      make(map[string]bool),
+		units:      make(map[string]float64),
+	}
+
+	for _, w := range getDicewareWords() {
+		e.words[w] = true
+		e.addWord(w)
+	}
+
+	for w := range getCommonPasswords() {
+		e.addWord(w)
+	}
+
+	for n, input := range userInputs {
+		input = strings.ToLower(input)
+		if _, ok := e.userInputs[input]; input != "" && !ok {
+			e.userInputs[input] = n + 1
+			e.addWord(input)
+		}
+	}
+
+	bits, found := e.estimate(runes)
+
+	s := Strength{Bits: bits, Score: strengthScore(bits)}
+	for _, m := range found {
+		s.Matches = append(s.Matches, StrengthMatch{
+			Pattern: m.pattern,
+			Token:   string(runes[m.i:m.j]),
+			Bits:    m.bits,
+		})
+	}
+
+	return s
+}
@@ -0,0 +1,126 @@
+package lckbx
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStrength(t *testing.T) {
+	t.Run("Test Strength Patterns", testStrengthPatterns)
+	t.Run("Test Strength Order", testStrengthOrder)
+	t.Run("Test Strength Long Password", testStrengthLongPassword)
+}
+
+// hasPattern reports whether the password was estimated with a match of the
+// pattern for the token.
+func hasPattern(s Strength, pattern StrengthPattern, token string) bool {
+	for _, m := range s.Matches {
+		if m.Pattern == pattern && m.Token == token {
+			return true
+		}
+	}
+
+	return false
+}
+
+func testStrengthPatterns(t *testing.T) {
+	fmt.Println(t.Name())
+
+	tests := []struct {
+		password string
+		pattern  StrengthPattern
+		token    string
+	}{
+		{"password", CommonPattern, "password"},
+		{"P@ssw0rd", CommonPattern, "P@ssw0rd"},
+		{"drowssap", CommonPattern, "drowssap"},
+		{"violin-gravel", WordPattern, "gravel"},
+		{"Violin", WordPattern, "Violin"},
+		{"strength_user2024", UserInputPattern, "strength_user"},
+		{"aaaaaaaaaaaaaaaa", RepeatPattern, "aaaaaaaaaaaaaaaa"},
+		{"xk9qxk9qxk9q", RepeatPattern, "xk9qxk9qxk9q"},
+		{"0123456789abcdef", SequencePattern, "0123456789"},
+		{"ZYXWV", SequencePattern, "ZYXWV"},
+		{"tmp zxcvfdsa", KeyboardPattern, "zxcvfdsa"},
+		{"born in 1987", YearPattern, "1987"},
+		{"Q7#vR2!m", BruteforcePattern, "Q7#vR2!m"},
+	}
+
+	for _, test := range tests {
+		s := EstimateStrength(test.password, "strength_user")
+		if !hasPattern(s, test.pattern, test.token) {
+			t.Fatalf("Expected %s %q in %q, received %+v", test.pattern, test.token, test.password, s.Matches)
+		}
+
+		var tokens []string
+		for _, m := range s.Matches {
+			tokens = append(tokens, m.Token)
+		}
+
+		if strings.Join(tokens, "") != test.password {
+			t.Fatalf("Expected the matches to cover %q, received %+v", test.password, s.Matches)
+		}
+	}
+}
+
+func testStrengthOrder(t *testing.T) {
+	fmt.Println(t.Name())
+
+	// Each password is easier to guess than the next.
+	passwords := []string{
+		"",
+		"password",
+		"aaaaaaaaaaaaaaaa",
+		"0123456789abcdef",
+		"qwertyuiopasdfgh",
+		"Tr0ub4dor&3",
+		"QDK~Tzp[!)27+]Tgrc.n",
+		"violin-gravel-usher-ocean",
+	}
+
+	var last Strength
+	for n, p := range passwords {
+		s := EstimateStrength(p)
+		if n > 0 && s.Bits <= last.Bits {
+			t.Fatalf("Expected %q to be stronger than %q, received %f and %f", p, passwords[n-1], s.Bits, last.Bits)
+		}
+
+		last = s
+	}
+
+	if s := EstimateStrength("password"); s.Score != 0 {
+		t.Fatalf("Expected a score of 0, received %d", s.Score)
+	}
+
+	if s := EstimateStrength("violin-gravel-usher-ocean"); s.Score != 4 || s.Bits < minPasswordBits {
+		t.Fatalf("Expected a score of 4 and %d bits, received %d and %f", minPasswordBits, s.Score, s.Bits)
+	}
+
+	// The username makes a password much easier to guess.
+	without := EstimateStrength("correctstaple")
+	with := EstimateStrength("correctstaple", "CorrectStaple")
+	if with.Bits >= without.Bits-10 {
+		t.Fatalf("Expected the username to be guessed first, received %f and %f", with.Bits, without.Bits)
+	}
+}
+
+func testStrengthLongPassword(t *testing.T) {
+	fmt.Println(t.Name())
+
+	start := time.Now()
+	s := EstimateStrength(strings.Repeat("violin-gravel-", 200))
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("Expected a quick estimate, received %v", time.Since(start))
+	}
+
+	length := 0
+	for _, m := range s.Matches {
+		length += len(m.Token)
+	}
+
+	if length != maxStrengthLength || !hasPattern(s, RepeatPattern, strings.Repeat("violin-gravel-", 7)) {
+		t.Fatalf("Expected the first %d characters to be repeats, received %+v", maxStrengthLength, s.Matches)
+	}
+}
@@ -0,0 +1,231 @@
+package lckbx
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// equalStrings reports whether two lists hold the same strings in the same
+// order.
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validateTag ensures a tag can be shown in a list separated by commas.
+func validateTag(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+
+	if tag == "" {
+		return tag, fmt.Errorf("tag is empty")
+	}
+
+	if strings.ContainsAny(tag, ",\n") {
+		return tag, fmt.Errorf("tag cannot contain a comma or newline")
+	}
+
+	return tag, nil
+}
+
+// withTag returns a sorted copy of the tags with the given tag added.
+func withTag(tags []string, tag string) []string {
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+
+	added := append(append([]string{}, tags...), tag)
+	sort.Strings(added)
+
+	return added
+}
+
+// withoutTag returns a copy of the tags without the given tag.
+func withoutTag(tags []string, tag string) []string {
+	var removed []string
+
+	for _, t := range tags {
+		if t != tag {
+			removed = append(removed, t)
+		}
+	}
+
+	return removed
+}
+
+// HasTag reports whether the Item has the given tag.
+func (i *ItemMetadata) HasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetTags returns every tag, sorted by name.
+func (u *UnlockedBox) GetTags() []string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return append([]string{}, u.metadata.Tags...)
+}
+
+// CreateTag adds a tag that can be given to Items.
+func (u *UnlockedBox) CreateTag(tag string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		var err error
+
+		tag, err = validateTag(tag)
+		if err != nil {
+			return err
+		}
+
+		u.metadata.Tags = withTag(u.metadata.Tags, tag)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.CreateTag: %v", err)
+	}
+
+	return nil
+}
+
+// RenameTag changes the name of a tag on every Item that has it. If the new
+// name is already a tag, the two tags are merged.
+func (u *UnlockedBox) RenameTag(tag, name string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		var err error
+
+		name, err = validateTag(name)
+		if err != nil {
+			return err
+		}
+
+		tags := withoutTag(u.metadata.Tags, tag)
+		if len(tags) == len(u.metadata.Tags) {
+			return fmt.Errorf("tag not found")
+		}
+		u.metadata.Tags = withTag(tags, name)
+
+		for _, imd := range u.metadata.GetItems() {
+			if imd.HasTag(tag) {
+				imd.Tags = withTag(withoutTag(imd.Tags, tag), name)
+				u.metadata.AddItem(imd)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.RenameTag: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteTag removes a tag from every Item that has it, including Items in
+// the trash. The Items themselves are not changed.
+func (u *UnlockedBox) DeleteTag(tag string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		tags := withoutTag(u.metadata.Tags, tag)
+		if len(tags) == len(u.metadata.Tags) {
+			return fmt.Errorf("tag not found")
+		}
+		u.metadata.Tags = tags
+
+		for _, imd := range u.metadata.GetItems() {
+			if imd.HasTag(tag) {
+				imd.Tags = withoutTag(imd.Tags, tag)
+				u.metadata.AddItem(imd)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.DeleteTag: %v", err)
+	}
+
+	return nil
+}
+
+// TagItem gives an Item a tag. The tag is created if it does not exist.
+func (u *UnlockedBox) TagItem(iid ItemToken, tag string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		imd, err := u.getItemMetadata(iid)
+		if err != nil {
+			return err
+		}
+
+		tag, err = validateTag(tag)
+		if err != nil {
+			return err
+		}
+
+		u.metadata.Tags = withTag(u.metadata.Tags, tag)
+
+		imd.Tags = withTag(imd.Tags, tag)
+		u.metadata.AddItem(imd)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.TagItem: %v", err)
+	}
+
+	return nil
+}
+
+// UntagItem removes a tag from an Item. The tag is kept so it can be given
+// to other Items.
+func (u *UnlockedBox) UntagItem(iid ItemToken, tag string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.organize(func() error {
+		imd, err := u.getItemMetadata(iid)
+		if err != nil {
+			return err
+		}
+
+		if !imd.HasTag(tag) {
+			return fmt.Errorf("item does not have tag %q", tag)
+		}
+
+		imd.Tags = withoutTag(imd.Tags, tag)
+		u.metadata.AddItem(imd)
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.UntagItem: %v", err)
+	}
+
+	return nil
+}
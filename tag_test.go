@@ -0,0 +1,142 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+var (
+	tagDB   = "tag_test.db"
+	tagUser = "tag_user"
+)
+
+func TestTag(t *testing.T) {
+	store, err := NewStore(tagDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(tagDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(tagUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Tags", func(t *testing.T) { testTags(t, &lb) })
+}
+
+// End-to-end test for tags
+//  1. Tag two notes and list the notes by tag.
+//  2. Rename a tag and ensure every note is updated.
+//  3. Delete a tag and ensure it is removed from every note.
+//  4. Ensure the tags are saved in the Metadata.
+func testTags(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(tagUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	var iids []ItemToken
+	for _, name := range []string{"One", "Two"} {
+		n := NewNoteItem()
+		n.Name = name
+
+		err = ub.AddItem(n)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		iids = append(iids, n.ItemId)
+	}
+
+	// 1.  Tag two notes and list the notes by tag.
+	err = ub.CreateTag("unused")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, iid := range iids {
+		err = ub.TagItem(iid, " work ")
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+	}
+
+	err = ub.TagItem(iids[0], "urgent")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if fmt.Sprint(ub.GetTags()) != "[unused urgent work]" {
+		t.Fatalf("Expected [unused urgent work], received %v", ub.GetTags())
+	}
+
+	items := ub.GetItemListWithOptions(ItemListOptions{Tag: "urgent"})
+	if len(items) != 1 || items[0].ItemId != iids[0] {
+		t.Fatalf("Expected one urgent note, received %v", items)
+	}
+
+	if err := ub.TagItem(iids[0], "a,b"); err == nil {
+		t.Fatal("Expected error for a tag with a comma, received nil")
+	}
+
+	// 2.  Rename a tag and ensure every note is updated.
+	err = ub.RenameTag("work", "job")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(ub.GetItemListWithOptions(ItemListOptions{Tag: "job"})) != 2 {
+		t.Fatal("Expected two notes tagged job")
+	}
+
+	if len(ub.GetItemListWithOptions(ItemListOptions{Tag: "work"})) != 0 {
+		t.Fatal("Expected no notes tagged work")
+	}
+
+	if err := ub.RenameTag("missing", "other"); err == nil {
+		t.Fatal("Expected error for a missing tag, received nil")
+	}
+
+	// 3.  Delete a tag and ensure it is removed from every note.
+	err = ub.UntagItem(iids[0], "urgent")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if err := ub.UntagItem(iids[0], "urgent"); err == nil {
+		t.Fatal("Expected error for a tag the note does not have, received nil")
+	}
+
+	err = ub.DeleteTag("job")
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	for _, iid := range iids {
+		if imd, _ := ub.metadata.GetItem(iid); len(imd.Tags) != 0 {
+			t.Fatalf("Expected no tags, received %v", imd.Tags)
+		}
+	}
+
+	// 4.  Ensure the tags are saved in the Metadata.
+	ub2, err := lb.login(tagUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub2.Lock()
+
+	if fmt.Sprint(ub2.GetTags()) != "[unused urgent]" {
+		t.Fatalf("Expected [unused urgent], received %v", ub2.GetTags())
+	}
+}
@@ -18,6 +18,13 @@ const (
 	metadataTokenPrefix = "mt_"
 	versionTokenPrefix  = "vt_"
 	authTokenPrefix     = "at_"
+
+	// Attachments use ft_, for file, since at_ is used by AuthTokens.
+	attachmentTokenPrefix = "ft_"
+	revisionTokenPrefix   = "rt_"
+
+	// Folders use dt_, for directory, since ft_ is used by Attachments.
+	folderTokenPrefix = "dt_"
 )
 
 // tokenEncoder is used to encoded and decode our tokens using a standard
@@ -293,3 +300,139 @@ func parseAuthToken(s string) (AuthToken, error) {
 
 	return at, nil
 }
+
+// AttachmentToken represents an attachment token.
+type AttachmentToken [tokenSize]byte
+
+// String converts an AttachmentToken object to a string.
+func (a AttachmentToken) String() string {
+	token := tokenEncoder.EncodeToString(a[:])
+
+	return fmt.Sprintf("%s%s", attachmentTokenPrefix, token)
+}
+
+// NewAttachmentToken generates a random AttachmentToken.
+func NewAttachmentToken() AttachmentToken {
+	var ft AttachmentToken
+
+	bytes := newTokenBytes()
+	copy(ft[:], bytes[:])
+
+	return ft
+}
+
+// parseAttachmentToken takes a string in the form of ft_base32 and parses
+// it into an AttachmentToken
+func parseAttachmentToken(s string) (AttachmentToken, error) {
+	var ft AttachmentToken
+
+	if !strings.HasPrefix(s, attachmentTokenPrefix) {
+		return ft, fmt.Errorf("could not parseAttachmentToken: invalid prefix")
+	}
+
+	s = strings.TrimPrefix(s, attachmentTokenPrefix)
+
+	data, err := tokenEncoder.DecodeString(s)
+	if err != nil {
+		return ft, fmt.Errorf("could not parseAttachmentToken: %v", err)
+	}
+
+	if len(data) != tokenSize {
+		return ft, fmt.Errorf("could not parseAttachmentToken: invalid length")
+	}
+
+	copy(ft[:], data)
+
+	return ft, nil
+}
+
+// RevisionToken represents a revision token.
+type RevisionToken [tokenSize]byte
+
+// String converts a RevisionToken object to a string.
+func (r RevisionToken) String() string {
+	token := tokenEncoder.EncodeToString(r[:])
+
+	return fmt.Sprintf("%s%s", revisionTokenPrefix, token)
+}
+
+// NewRevisionToken generates a random RevisionToken.
+func NewRevisionToken() RevisionToken {
+	var rt RevisionToken
+
+	bytes := newTokenBytes()
+	copy(rt[:], bytes[:])
+
+	return rt
+}
+
+// parseRevisionToken takes a string in the form of rt_base32 and parses
+// it into a RevisionToken
+func parseRevisionToken(s string) (RevisionToken, error) {
+	var rt RevisionToken
+
+	if !strings.HasPrefix(s, revisionTokenPrefix) {
+		return rt, fmt.Errorf("could not parseRevisionToken: invalid prefix")
+	}
+
+	s = strings.TrimPrefix(s, revisionTokenPrefix)
+
+	data, err := tokenEncoder.DecodeString(s)
+	if err != nil {
+		return rt, fmt.Errorf("could not parseRevisionToken: %v", err)
+	}
+
+	if len(data) != tokenSize {
+		return rt, fmt.Errorf("could not parseRevisionToken: invalid length")
+	}
+
+	copy(rt[:], data)
+
+	return rt, nil
+}
+
+// FolderToken represents a folder token. The zero FolderToken is the top
+// level, which holds every Item and Folder that is not in another Folder.
+type FolderToken [tokenSize]byte
+
+// String converts a FolderToken object to a string.
+func (f FolderToken) String() string {
+	token := tokenEncoder.EncodeToString(f[:])
+
+	return fmt.Sprintf("%s%s", folderTokenPrefix, token)
+}
+
+// NewFolderToken generates a random FolderToken.
+func NewFolderToken() FolderToken {
+	var dt FolderToken
+
+	bytes := newTokenBytes()
+	copy(dt[:], bytes[:])
+
+	return dt
+}
+
+// parseFolderToken takes a string in the form of dt_base32 and parses it
+// into a FolderToken
+func parseFolderToken(s string) (FolderToken, error) {
+	var dt FolderToken
+
+	if !strings.HasPrefix(s, folderTokenPrefix) {
+		return dt, fmt.Errorf("could not parseFolderToken: invalid prefix")
+	}
+
+	s = strings.TrimPrefix(s, folderTokenPrefix)
+
+	data, err := tokenEncoder.DecodeString(s)
+	if err != nil {
+		return dt, fmt.Errorf("could not parseFolderToken: %v", err)
+	}
+
+	if len(data) != tokenSize {
+		return dt, fmt.Errorf("could not parseFolderToken: invalid length")
+	}
+
+	copy(dt[:], data)
+
+	return dt, nil
+}
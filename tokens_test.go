@@ -17,6 +17,9 @@ func TestTokens(t *testing.T) {
 	t.Run("Test MetadataToken", testMetadataToken)
 	t.Run("Test VersionToken", testVersionToken)
 	t.Run("Test AuthToken", testAuthToken)
+	t.Run("Test AttachmentToken", testAttachmentToken)
+	t.Run("Test RevisionToken", testRevisionToken)
+	t.Run("Test FolderToken", testFolderToken)
 }
 
 func testTokenBytes(t *testing.T, s string) {
@@ -185,3 +188,81 @@ func testAuthToken(t *testing.T) {
 
 	testTokenBytes(t, token)
 }
+
+func testAttachmentToken(t *testing.T) {
+	fmt.Println(t.Name())
+
+	token := NewAttachmentToken().String()
+
+	if !strings.HasPrefix(token, attachmentTokenPrefix) {
+		t.Fatal("AttachmentToken has incorrect prefix.")
+	}
+
+	parsed, err := parseAttachmentToken(token)
+	if err != nil {
+		t.Fatal("Expected no error, recieved", err)
+	}
+
+	if parsed.String() != token {
+		t.Fatal("Expected", token, ", received", parsed.String())
+	}
+
+	token = strings.TrimPrefix(token, attachmentTokenPrefix)
+	if len(token) != tokenBase32Size {
+		t.Fatal("Expected", tokenBase32Size, "base32 characters, received", len(token))
+	}
+
+	testTokenBytes(t, token)
+}
+
+func testRevisionToken(t *testing.T) {
+	fmt.Println(t.Name())
+
+	token := NewRevisionToken().String()
+
+	if !strings.HasPrefix(token, revisionTokenPrefix) {
+		t.Fatal("RevisionToken has incorrect prefix.")
+	}
+
+	parsed, err := parseRevisionToken(token)
+	if err != nil {
+		t.Fatal("Expected no error, recieved", err)
+	}
+
+	if parsed.String() != token {
+		t.Fatal("Expected", token, ", received", parsed.String())
+	}
+
+	token = strings.TrimPrefix(token, revisionTokenPrefix)
+	if len(token) != tokenBase32Size {
+		t.Fatal("Expected", tokenBase32Size, "base32 characters, received", len(token))
+	}
+
+	testTokenBytes(t, token)
+}
+
+func testFolderToken(t *testing.T) {
+	fmt.Println(t.Name())
+
+	token := NewFolderToken().String()
+
+	if !strings.HasPrefix(token, folderTokenPrefix) {
+		t.Fatal("FolderToken has incorrect prefix.")
+	}
+
+	parsed, err := parseFolderToken(token)
+	if err != nil {
+		t.Fatal("Expected no error, recieved", err)
+	}
+
+	if parsed.String() != token {
+		t.Fatal("Expected", token, ", received", parsed.String())
+	}
+
+	token = strings.TrimPrefix(token, folderTokenPrefix)
+	if len(token) != tokenBase32Size {
+		t.Fatal("Expected", tokenBase32Size, "base32 characters, received", len(token))
+	}
+
+	testTokenBytes(t, token)
+}
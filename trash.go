@@ -0,0 +1,192 @@
+package lckbx
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultTrashDays is the number of days an Item stays in the trash before
+// the maintenance job purges it.
+const DefaultTrashDays = 30
+
+// expired reports whether the Item has been in the trash for longer than the
+// given number of days. Items never expire when days is zero.
+func (i *ItemMetadata) expired(days int, now time.Time) bool {
+	if !i.IsTrashed() || days == 0 {
+		return false
+	}
+
+	return now.Sub(*i.Trashed) > time.Duration(days)*24*time.Hour
+}
+
+// getTrashedItem returns the ItemMetadata of an Item in the trash.
+func (u *UnlockedBox) getTrashedItem(iid ItemToken) (ItemMetadata, error) {
+	imd, err := u.metadata.GetItem(iid)
+	if err != nil {
+		return imd, err
+	}
+
+	if !imd.IsTrashed() {
+		return imd, fmt.Errorf("item is not in the trash")
+	}
+
+	return imd, nil
+}
+
+// purgeItems deletes the Items, with their Attachments and Revisions, from
+// the database and removes them from the Metadata in a single transaction.
+func (u *UnlockedBox) purgeItems(items []ItemMetadata) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	err := u.store.Update(func(r recorder) error {
+		for _, imd := range items {
+			err := deleteItemRecords(r, imd)
+			if err != nil {
+				return err
+			}
+
+			u.metadata.DeleteItem(imd.ItemId)
+		}
+
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		for _, imd := range items {
+			u.metadata.AddItem(imd)
+		}
+		return fmt.Errorf("could not UnlockedBox.purgeItems: %v", err)
+	}
+
+	return nil
+}
+
+// purgeExpiredTrash purges the Items that have been in the trash longer
+// than the TrashDays setting. It is run by the maintenance job and returns
+// the number of Items purged.
+func (u *UnlockedBox) purgeExpiredTrash(now time.Time) (int, error) {
+	days := u.metadata.GetTrashDays()
+
+	var expired []ItemMetadata
+	for _, imd := range u.metadata.GetTrashedItems() {
+		if imd.expired(days, now) {
+			expired = append(expired, imd)
+		}
+	}
+
+	err := u.purgeItems(expired)
+	if err != nil {
+		return 0, fmt.Errorf("could not UnlockedBox.purgeExpiredTrash: %v", err)
+	}
+
+	return len(expired), nil
+}
+
+// GetTrashList returns the ItemMetadata of every Item in the trash, most
+// recently deleted first, without decrypting the Items.
+func (u *UnlockedBox) GetTrashList() []ItemMetadata {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	items := u.metadata.GetTrashedItems()
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Trashed.After(*items[j].Trashed)
+	})
+
+	return items
+}
+
+// RestoreItem moves an Item out of the trash so it can be used again.
+func (u *UnlockedBox) RestoreItem(iid ItemToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getTrashedItem(iid)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.RestoreItem: %v", err)
+	}
+
+	restored := imd
+	restored.Trashed = nil
+	u.metadata.AddItem(restored)
+
+	err = u.store.Update(u.saveMetadata)
+	if err != nil {
+		u.metadata.AddItem(imd)
+		return fmt.Errorf("could not UnlockedBox.RestoreItem: %v", err)
+	}
+
+	u.reindexItem(restored)
+
+	return nil
+}
+
+// PurgeItem permanently deletes an Item in the trash, along with its
+// Attachments and Revisions.
+func (u *UnlockedBox) PurgeItem(iid ItemToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getTrashedItem(iid)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.PurgeItem: %v", err)
+	}
+
+	err = u.purgeItems([]ItemMetadata{imd})
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.PurgeItem: %v", err)
+	}
+
+	return nil
+}
+
+// EmptyTrash permanently deletes every Item in the trash and returns the
+// number of Items deleted.
+func (u *UnlockedBox) EmptyTrash() (int, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	items := u.metadata.GetTrashedItems()
+
+	err := u.purgeItems(items)
+	if err != nil {
+		return 0, fmt.Errorf("could not UnlockedBox.EmptyTrash: %v", err)
+	}
+
+	return len(items), nil
+}
+
+// GetTrashDays returns the number of days an Item stays in the trash before
+// the maintenance job purges it. Zero means Items are never purged
+// automatically.
+func (u *UnlockedBox) GetTrashDays() int {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.metadata.GetTrashDays()
+}
+
+// SetTrashDays changes the number of days an Item stays in the trash and
+// saves it in the Metadata. The new setting is applied by the maintenance
+// job at the next login.
+func (u *UnlockedBox) SetTrashDays(days int) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if days < 0 {
+		return fmt.Errorf("could not UnlockedBox.SetTrashDays: days cannot be negative")
+	}
+
+	old := u.metadata.TrashDays
+	u.metadata.TrashDays = &days
+
+	err := u.store.Update(u.saveMetadata)
+	if err != nil {
+		u.metadata.TrashDays = old
+		return fmt.Errorf("could not UnlockedBox.SetTrashDays: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,229 @@
+package lckbx
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	trashDB   = "trash_test.db"
+	trashUser = "trash_user"
+)
+
+func TestTrash(t *testing.T) {
+	store, err := NewStore(trashDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(trashDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(trashUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	t.Run("Test Trash Restore", func(t *testing.T) { testTrashRestore(t, &lb) })
+	t.Run("Test Trash Purge", func(t *testing.T) { testTrashPurge(t, &lb) })
+	t.Run("Test Trash Expired", func(t *testing.T) { testTrashExpired(t, &lb) })
+}
+
+// addTrashNote adds a note and moves it to the trash.
+func addTrashNote(t *testing.T, ub *UnlockedBox, name string) ItemToken {
+	n := NewNoteItem()
+	n.Name = name
+	n.Data = []byte(name)
+
+	err := ub.AddNoteItem(n)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = ub.DeleteItem(n.ItemId)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	return n.ItemId
+}
+
+// End-to-end test for the trash
+//  1. Delete a note and ensure it is only listed in the trash.
+//  2. Ensure the note cannot be read or changed while it is in the trash.
+//  3. Restore the note and ensure it can be read again.
+func testTrashRestore(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(trashUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	// 1.  Delete a note and ensure it is only listed in the trash.
+	iid := addTrashNote(t, &ub, "Restore")
+
+	if len(ub.GetItemList()) != 0 || len(ub.GetItemListByType(SecureNoteType)) != 0 {
+		t.Fatalf("Expected no items, received %v", ub.GetItemList())
+	}
+
+	trash := ub.GetTrashList()
+	if len(trash) != 1 || trash[0].ItemId != iid || !trash[0].IsTrashed() {
+		t.Fatalf("Expected the note in the trash, received %v", trash)
+	}
+
+	// The trash is saved in the Metadata.
+	ub2, err := lb.login(trashUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(ub2.GetTrashList()) != 1 {
+		t.Fatalf("Expected one item in the trash, received %v", ub2.GetTrashList())
+	}
+	ub2.Lock()
+
+	// 2.  Ensure the note cannot be read or changed while it is in the
+	//     trash.
+	if _, err := ub.GetItem(iid); err == nil {
+		t.Fatal("Expected error for an item in the trash, received nil")
+	}
+
+	if err := ub.DeleteItem(iid); err == nil {
+		t.Fatal("Expected error for deleting an item twice, received nil")
+	}
+
+	// 3.  Restore the note and ensure it can be read again.
+	err = ub.RestoreItem(iid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	item, err := ub.GetItem(iid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if string(item.Data) != "Restore" {
+		t.Fatalf("Expected Restore, received %s", item.Data)
+	}
+
+	if len(ub.GetTrashList()) != 0 {
+		t.Fatalf("Expected an empty trash, received %v", ub.GetTrashList())
+	}
+
+	if err := ub.RestoreItem(iid); err == nil {
+		t.Fatal("Expected error for an item not in the trash, received nil")
+	}
+
+	if err := ub.PurgeItem(iid); err == nil {
+		t.Fatal("Expected error for purging an item not in the trash, received nil")
+	}
+}
+
+func testTrashPurge(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(trashUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	iid := addTrashNote(t, &ub, "Purge")
+
+	err = ub.PurgeItem(iid)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if _, err := ub.store.GetItem(iid); err == nil {
+		t.Fatal("Expected the item to be deleted")
+	}
+
+	if _, err := ub.metadata.GetItem(iid); err == nil {
+		t.Fatal("Expected the item to be removed from the metadata")
+	}
+
+	addTrashNote(t, &ub, "Empty 1")
+	addTrashNote(t, &ub, "Empty 2")
+
+	count, err := ub.EmptyTrash()
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if count != 2 || len(ub.GetTrashList()) != 0 {
+		t.Fatalf("Expected two items purged, received %d and %v", count, ub.GetTrashList())
+	}
+}
+
+// Items that have been in the trash longer than the TrashDays setting are
+// purged by the maintenance job.
+func testTrashExpired(t *testing.T, lb *LockedBox) {
+	fmt.Println(t.Name())
+
+	ub, err := lb.login(trashUser, lockedBoxGoodPassword)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	old := addTrashNote(t, &ub, "Old")
+	recent := addTrashNote(t, &ub, "Recent")
+
+	imd, _ := ub.metadata.GetItem(old)
+	trashed := time.Now().Add(-8 * 24 * time.Hour)
+	imd.Trashed = &trashed
+	ub.metadata.AddItem(imd)
+
+	err = ub.SetTrashDays(7)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	ub.startMaintenance()
+	status := ub.WaitMaintenance()
+	if status.Err != nil || status.Expired != 1 {
+		t.Fatalf("Expected one item expired, received %+v", status)
+	}
+
+	trash := ub.GetTrashList()
+	if len(trash) != 1 || trash[0].ItemId != recent {
+		t.Fatalf("Expected only the recent item in the trash, received %v", trash)
+	}
+
+	if _, err := ub.store.GetItem(old); err == nil {
+		t.Fatal("Expected the expired item to be deleted")
+	}
+
+	// A setting of zero keeps Items in the trash.
+	err = ub.SetTrashDays(0)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	imd, _ = ub.metadata.GetItem(recent)
+	imd.Trashed = &trashed
+	ub.metadata.AddItem(imd)
+
+	expired, err := ub.purgeExpiredTrash(time.Now())
+	if err != nil || expired != 0 {
+		t.Fatalf("Expected nothing expired, received %d and %v", expired, err)
+	}
+
+	if ub.GetTrashDays() != 0 {
+		t.Fatalf("Expected zero days, received %d", ub.GetTrashDays())
+	}
+
+	if err := ub.SetTrashDays(-1); err == nil {
+		t.Fatal("Expected error for negative days, received nil")
+	}
+}
@@ -1,26 +1,40 @@
 package lckbx
 
 import (
+	"bytes"
 	"fmt"
+	"sync"
+	"time"
 )
 
 type UnlockedBox struct {
-	derive   deriver
-	store    storer
-	crypt    crypter
-	user     *User
-	keyset   *Keyset
-	metadata *Metadata
+	derive      deriver
+	version     VersionToken
+	store       storer
+	crypt       crypter
+	mutex       *sync.Mutex
+	maintenance *maintenance
+	authToken   AuthToken
+	authKey     AuthKey
+	keysetKey   CryptKey
+	user        *User
+	keyset      *Keyset
+	metadata    *Metadata
+	index       *searchIndex
 }
 
 // Purge Keys
 // the purgeUnusedKeys function removes keys from the keyset if they are no
-// longer in use. It is started after login and runs in the background.
+// longer in use. It is run by the maintenance job after all of the Items
+// have been reencrypted with the latest key.
 //  1. Read through all MetadataItems to get a list of active keys.
 //  2. Read through all of the Keyset keys and if any of them are not in use,
 //     set Key.Inuse to false.
 //  3. Purge unused keys.
-func (u *UnlockedBox) purgeUnusedKeys() {
+//  4. Save the Keyset if any keys were purged.
+func (u *UnlockedBox) purgeUnusedKeys() (int, error) {
+	before := len(u.keyset.Keys)
+
 	// 1. Read through all MetadataItems to get a list of active keys.
 	inUseKeys := u.metadata.GetInUseKeys()
 
@@ -45,217 +59,653 @@ func (u *UnlockedBox) purgeUnusedKeys() {
 
 	// 3. Purge unused keys.
 	u.keyset.PurgeKeys()
+
+	// 4. Save the Keyset, encrypted with the user's CryptKey, if any keys
+	//    were purged.
+	purged := before - len(u.keyset.Keys)
+	if purged == 0 {
+		return 0, nil
+	}
+
+	u.crypt.ChangeKey(u.keysetKey[:])
+	err := u.keyset.Save(u.store, u.crypt)
+	if err != nil {
+		return 0, fmt.Errorf("could not UnlockedBox.purgeUnusedKeys: %v", err)
+	}
+
+	return purged, nil
 }
 
-// Update Encryption
-// The updateEncryption function ensures each item is encrypted with the most
-// recent key in the keyset. It is started after login and runs in the
-// background.
-//  1. Read through all of the MetadataItems to determine which Items are not
-//     encrypted using the latest key.
-//  2. When an item is found, reencrypt the item with the latest key and save
-//     the reencrypted item to the database.
-func (u *UnlockedBox) updateEncryption() error {
-	failed := make(map[string]string)
-
-	// Get a list of map keys for the metadata Items
-	var mapKeys []string
-	for k := range u.metadata.Items {
-		mapKeys = append(mapKeys, k)
-	}
-
-	// 1.  Read through all of the MetadataItems to determine which Items are
-	//     not encrypted using the latest key.
-	for _, mk := range mapKeys {
-		item := u.metadata.Items[mk]
-
-		if item.KeyVersion.String() != u.keyset.Latest.String() {
-			// 2.  When an item is found, reencrypt the item with the latest
-			//     key.
-			// 2.a Get the key used to encrypt the item.
-			oldKey, err := u.keyset.GetItemKey(item.KeyVersion, item.ItemId)
-			if err != nil {
-				failed[item.ItemId.String()] = err.Error()
-				break
-			}
+// staleItems returns the ItemIds of the Items that are not encrypted using
+// the latest key, or that have Attachments that are not.
+func (u *UnlockedBox) staleItems() []ItemToken {
+	var stale []ItemToken
 
-			// 2.b Create a new crypter with the old key.
-			err = u.crypt.ChangeKey(oldKey[:])
-			if err != nil {
-				failed[item.ItemId.String()] = err.Error()
-				break
-			}
+	for _, item := range u.metadata.GetItems() {
+		if item.stale(u.keyset.Latest) {
+			stale = append(stale, item.ItemId)
+		}
+	}
+
+	return stale
+}
+
+// getItemMetadata returns the ItemMetadata of an Item that is not in the
+// trash. Items in the trash cannot be read or changed until they are
+// restored.
+func (u *UnlockedBox) getItemMetadata(iid ItemToken) (ItemMetadata, error) {
+	imd, err := u.metadata.GetItem(iid)
+	if err != nil {
+		return imd, err
+	}
+
+	if imd.IsTrashed() {
+		return imd, fmt.Errorf("item is in the trash")
+	}
+
+	return imd, nil
+}
+
+// loadItem decrypts the Item described by the ItemMetadata. If the Item
+// cannot be decrypted with the key version recorded in the Metadata, every
+// other key in the Keyset is tried, starting with the latest. This happens
+// when an interrupted maintenance job saved the reencrypted Item but not the
+// Metadata. The key version that decrypted the Item is returned.
+func (u *UnlockedBox) loadItem(imd ItemMetadata) (Item, VersionToken, error) {
+	versions := []VersionToken{imd.KeyVersion, u.keyset.Latest}
+	for keyId := range u.keyset.Keys {
+		kv, _ := parseVersionToken(keyId)
+		versions = append(versions, kv)
+	}
 
-			// 2.c Load the encrypted item from the database.
-			note, err := NewNoteItemFromStore(u.store, u.crypt, item.ItemId)
+	var err error
+	for _, kv := range versions {
+		var key CryptKey
+		var item Item
+
+		key, err = u.keyset.GetItemKey(kv, imd.ItemId)
+		if err != nil {
+			continue
+		}
+
+		u.crypt.ChangeKey(key[:])
+		item, err = NewItemFromStore(u.store, u.crypt, imd.ItemId)
+		if err == nil {
+			return item, kv, nil
+		}
+	}
+
+	return Item{}, VersionToken{}, fmt.Errorf("could not UnlockedBox.loadItem: %v", err)
+}
+
+// Reencrypt Item
+// The reencryptItem function ensures an Item, and each of its Attachments
+// and Revisions, is encrypted with the most recent key in the Keyset, and
+// that each Attachment is encrypted as a stream.
+//  1. Load the Item with the key it is currently encrypted with.
+//  2. Save the Item encrypted with the latest key.
+//  3. Load and save each stale Attachment and Revision with the latest key.
+//  4. Update the KeyVersions in the ItemMetadata and save the Metadata.
+//
+// Steps 2 through 4 are saved together. If an earlier run saved the Item
+// without its Metadata, loadItem falls back to the latest key and only the
+// Metadata is saved.
+func (u *UnlockedBox) reencryptItem(iid ItemToken) error {
+	// The Item may have been deleted or updated since the maintenance job
+	// made its list.
+	imd, err := u.metadata.GetItem(iid)
+	if err != nil {
+		return nil
+	}
+
+	if !imd.stale(u.keyset.Latest) {
+		return nil
+	}
+
+	// 1.  Load the Item with the key it is currently encrypted with.
+	item, kv, err := u.loadItem(imd)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.reencryptItem: %v", err)
+	}
+
+	// Steps 2 through 4 are saved in a single transaction.
+	err = u.store.Update(func(r recorder) error {
+		updated := imd
+		updated.KeyVersion = u.keyset.Latest
+		updated.Attachments = nil
+		updated.Revisions = nil
+
+		// 2.  Save the Item encrypted with the latest key, unless an
+		//     interrupted run already did.
+		if kv.String() != u.keyset.Latest.String() {
+			newKey, err := u.keyset.GetNewItemKey(iid)
 			if err != nil {
-				failed[item.ItemId.String()] = err.Error()
-				break
+				return err
 			}
 
-			// 2.d Update the crypter with the latest key.
-			newKey, err := u.keyset.GetNewItemKey(item.ItemId)
+			u.crypt.ChangeKey(newKey[:])
+			err = item.Save(r, u.crypt)
 			if err != nil {
-				failed[item.ItemId.String()] = err.Error()
-				break
+				return err
 			}
+		}
 
-			err = u.crypt.ChangeKey(newKey[:])
-			if err != nil {
-				failed[item.ItemId.String()] = err.Error()
-				break
+		// 3.  Load and save each stale Attachment and Revision with the
+		//     latest key. Attachments sealed in one piece are saved as a
+		//     stream.
+		for _, amd := range imd.Attachments {
+			if amd.KeyVersion.String() != u.keyset.Latest.String() || !amd.Stream {
+				newKey, err := u.keyset.GetNewAttachmentKey(amd.AttachmentId)
+				if err != nil {
+					return err
+				}
+
+				// The stream keeps the new key, so the crypter can be
+				// changed to the old one to decrypt the Attachment into it.
+				var encrypted bytes.Buffer
+
+				u.crypt.ChangeKey(newKey[:])
+				w, err := u.crypt.EncryptStream(&encrypted, attachmentAD(amd.AttachmentId, iid))
+				if err != nil {
+					return err
+				}
+
+				akv, err := u.writeAttachment(r, iid, amd, w)
+				if err != nil {
+					return err
+				}
+
+				if akv.String() != u.keyset.Latest.String() || !amd.Stream {
+					err = w.Close()
+					if err != nil {
+						return err
+					}
+
+					err = r.SaveAttachment(amd.AttachmentId, encrypted.Bytes())
+					if err != nil {
+						return err
+					}
+
+					amd.Stream = true
+				}
+
+				amd.KeyVersion = u.keyset.Latest
 			}
 
-			// 2.e Update the item KeyVersion
-			u.metadata.Items[mk] = NewItemMetadata(item.Name, item.ItemId, u.keyset.Latest)
+			updated.Attachments = append(updated.Attachments, amd)
+		}
 
-			// 2.f Save the reencrypted item to the database.
-			err = note.Save(u.store, u.crypt)
-			if err != nil {
-				failed[item.ItemId.String()] = err.Error()
-				break
+		for _, rmd := range imd.Revisions {
+			if rmd.KeyVersion.String() != u.keyset.Latest.String() {
+				rev, rkv, err := u.loadRevision(r, iid, rmd)
+				if err != nil {
+					return err
+				}
+
+				if rkv.String() != u.keyset.Latest.String() {
+					newKey, err := u.keyset.GetNewRevisionKey(rmd.RevisionId)
+					if err != nil {
+						return err
+					}
+
+					u.crypt.ChangeKey(newKey[:])
+					err = rev.Save(r, u.crypt)
+					if err != nil {
+						return err
+					}
+				}
+
+				rmd.KeyVersion = u.keyset.Latest
 			}
+
+			updated.Revisions = append(updated.Revisions, rmd)
 		}
+
+		// 4.  Update the KeyVersions in the ItemMetadata and save the
+		//     Metadata.
+		u.metadata.AddItem(updated)
+
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		u.metadata.AddItem(imd)
+		return fmt.Errorf("could not UnlockedBox.reencryptItem: %v", err)
 	}
 
-	err := u.metadata.Save(u.store, u.crypt)
+	return nil
+}
+
+// saveMetadata encrypts the Metadata with the CryptKey derived from the
+// latest key in the Keyset and saves it with the given recorder.
+func (u *UnlockedBox) saveMetadata(r recorder) error {
+	key, err := u.keyset.GetNewMetadataKey(u.user.MetadataId)
 	if err != nil {
-		return fmt.Errorf("failed to UnlockedBox.updateEncryption %v", err)
+		return fmt.Errorf("could not UnlockedBox.saveMetadata: %v", err)
 	}
 
-	if len(failed) != 0 {
-		return fmt.Errorf("failed to UnlockedBox.updateEncryption for %+v", failed)
+	u.crypt.ChangeKey(key[:])
+	err = u.metadata.Save(r, u.crypt)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.saveMetadata: %v", err)
 	}
 
 	return nil
 }
 
-// Add NoteItem
+// startMaintenance starts the background job that reencrypts stale Items
+// and purges unused keys. It is called by LockedBox.Login.
+func (u *UnlockedBox) startMaintenance() {
+	u.maintenance = newMaintenance()
+
+	go u.maintenance.run(*u)
+}
+
+// MaintenanceStatus returns the progress of the background job that
+// reencrypts Items with the latest key and purges unused keys.
+func (u *UnlockedBox) MaintenanceStatus() MaintenanceStatus {
+	if u.maintenance == nil {
+		return MaintenanceStatus{}
+	}
+
+	return u.maintenance.getStatus()
+}
+
+// WaitMaintenance waits for the background job to finish, or to be
+// cancelled by Lock, and returns its final status.
+func (u *UnlockedBox) WaitMaintenance() MaintenanceStatus {
+	if u.maintenance == nil {
+		return MaintenanceStatus{}
+	}
+
+	<-u.maintenance.done
+
+	return u.maintenance.getStatus()
+}
+
+// Add Item
 //  1. Add Item to database
 //  2. Create ItemMetadata and add it to Metadata
 //  3. Save the Metadata to the database.
+//
+// The Item and Metadata are saved in a single transaction so that a failure
+// does not leave an Item that is not listed in the Metadata.
+func (u *UnlockedBox) AddItem(i Item) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := i.validate()
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.AddItem: %v", err)
+	}
+
+	imd := newItemMetadataFromItem(i, u.keyset.Latest, time.Now())
+
+	err = u.store.Update(func(r recorder) error {
+		// 1.  Add Item to database
+		// 1.a Derive a new key for encrypting this item.
+		newKey, err := u.keyset.GetNewItemKey(i.ItemId)
+		if err != nil {
+			return err
+		}
+
+		// 1.b Update the crypter with the new key
+		err = u.crypt.ChangeKey(newKey[:])
+		if err != nil {
+			return err
+		}
+
+		// 1.c Save the item to the database
+		err = i.Save(r, u.crypt)
+		if err != nil {
+			return err
+		}
+
+		// 2.  Create ItemMetadata and add it to Metadata
+		u.metadata.AddItem(imd)
+
+		// 3.  Save the Metadata to the database
+		return u.saveMetadata(r)
+	})
+	if err != nil {
+		u.metadata.DeleteItem(i.ItemId)
+		return fmt.Errorf("could not UnlockedBox.AddItem: %v", err)
+	}
+
+	u.indexItem(i)
+
+	return nil
+}
+
+// AddNoteItem adds a NoteItem to the box. It is the same as AddItem.
 func (u *UnlockedBox) AddNoteItem(n NoteItem) error {
-	// 1.  Add Item to database
-	// 1.a Derive a new key for encrypting this item.
-	newKey, err := u.keyset.GetNewItemKey(n.ItemId)
+	return u.AddItem(n)
+}
+
+// Update Item
+//  1. Get the ItemMetadata for the Item
+//  2. Generate the encryption key for the Item
+//  3. Keep the current Item as a Revision, if it changed
+//  4. Save the updated Item
+//  5. Update the ItemMetadata Name, Type, and timestamps to match the Item
+//  6. Save the Metadata.
+//
+// Steps 3 through 6 run in a single transaction.
+func (u *UnlockedBox) UpdateItem(i Item) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	err := u.updateItem(i, true)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.AddNoteItem: %v", err)
+		return fmt.Errorf("could not UnlockedBox.UpdateItem: %v", err)
 	}
 
-	// 1.b Update the crypter with the new key
-	err = u.crypt.ChangeKey(newKey[:])
+	return nil
+}
+
+// updateItem performs UpdateItem while the caller holds the mutex. A
+// Revision is only kept if revise is true, so that bookkeeping changes, such
+// as advancing an HOTP counter, do not fill the history.
+func (u *UnlockedBox) updateItem(i Item, revise bool) error {
+	err := i.validate()
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.AddNoteItem: %v", err)
+		return fmt.Errorf("could not UnlockedBox.updateItem: %v", err)
 	}
 
-	// 1.c Save the item to the database
-	err = n.Save(u.store, u.crypt)
+	// 1.  Get the ItemMetadata for the Item
+	imd, err := u.getItemMetadata(i.ItemId)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.AddNoteItem: %v", err)
+		return fmt.Errorf("could not UnlockedBox.updateItem: %v", err)
 	}
 
-	imd := NewItemMetadata(n.Name, n.ItemId, u.keyset.Latest)
-	u.metadata.AddItem(imd)
+	var previous Item
+	if revise {
+		previous, _, err = u.loadItem(imd)
+		if err != nil {
+			return fmt.Errorf("could not UnlockedBox.updateItem: %v", err)
+		}
 
-	// 3.  Save the Metadata to the database
-	// 3.a Derive the CryptKey used to encrypt the Metadata
-	key, err := u.keyset.GetNewMetadataKey(u.user.MetadataId)
+		revise = !previous.Equal(i)
+	}
+
+	// 2.  Derive the key for encrypting this item.
+	key, err := u.keyset.GetItemKey(imd.KeyVersion, i.ItemId)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.AddNoteItem: %v", err)
+		return fmt.Errorf("could not UnlockedBox.updateItem: %v", err)
 	}
 
-	// 3.b Update our crypter with the derived CryptKey and save the
-	//     encrypted Metadata to the database.
-	u.crypt.ChangeKey(key[:])
-	err = u.metadata.Save(u.store, u.crypt)
+	now := time.Now().UTC()
+
+	err = u.store.Update(func(r recorder) error {
+		updated := imd
+
+		// 3.  Keep the current Item as a Revision, if it changed
+		if revise {
+			var err error
+			updated, err = u.saveRevision(r, imd, previous, now)
+			if err != nil {
+				return err
+			}
+
+			updated.Modified = now
+		}
+
+		// 4.  Save the updated Item
+		// 4.a Update the crypter with the new key
+		err := u.crypt.ChangeKey(key[:])
+		if err != nil {
+			return err
+		}
+
+		// 4.b Save the item to the database
+		err = i.Save(r, u.crypt)
+		if err != nil {
+			return err
+		}
+
+		// 5.  Update the ItemMetadata Name, Type, and timestamps to match the
+		//     Item
+		updated.Name = i.Name
+		updated.Type = i.Type
+		updated.Accessed = now
+		u.metadata.AddItem(updated)
+
+		// 6.  Save the Metadata
+		return u.saveMetadata(r)
+	})
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.AddNoteItem: %v", err)
+		u.metadata.AddItem(imd)
+		return fmt.Errorf("could not UnlockedBox.updateItem: %v", err)
 	}
 
+	u.indexItem(i)
+
 	return nil
 }
 
-// Update NoteItem
-//  1. Get the ItemMetadata for the NoteItem
-//  2. Generate the encryption key for the NoteItem
-//  3. Save the updated NoteItem
-//  4. Update the ItemMetadata Name to match the NoteItem name
-//  5. Save the Metadata.
+// UpdateNoteItem saves changes to a NoteItem. It is the same as
+// UpdateItem.
 func (u *UnlockedBox) UpdateNoteItem(n NoteItem) error {
-	// 1.  Get the ItemMetadata for the NoteItem
-	imd, err := u.metadata.GetItem(n.ItemId)
+	return u.UpdateItem(n)
+}
+
+// Delete Item
+// The DeleteItem function moves an Item to the trash. The Item, its
+// Attachments, and its Revisions stay encrypted in the database until the
+// Item is purged with PurgeItem, or by the maintenance job once it has been
+// in the trash longer than the TrashDays setting.
+//  1. Mark the ItemMetadata as trashed.
+//  2. Save the Metadata to the database.
+func (u *UnlockedBox) DeleteItem(iid ItemToken) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getItemMetadata(iid)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.UpdateNoteItem: %v", err)
+		return fmt.Errorf("could not UnlockedBox.DeleteItem: %v", err)
 	}
 
-	// 2.  Derive the key for encrypting this item.
-	key, err := u.keyset.GetItemKey(imd.KeyVersion, n.ItemId)
+	// 1.  Mark the ItemMetadata as trashed.
+	trashed := imd
+	now := time.Now().UTC()
+	trashed.Trashed = &now
+	u.metadata.AddItem(trashed)
+
+	// 2.  Save the Metadata to the database.
+	err = u.store.Update(u.saveMetadata)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.UpdateNoteItem: %v", err)
+		u.metadata.AddItem(imd)
+		return fmt.Errorf("could not UnlockedBox.DeleteItem: %v", err)
 	}
 
-	// 3.  Save the updated NoteItem
-	// 3.a Update the crypter with the new key
-	err = u.crypt.ChangeKey(key[:])
+	u.unindexItem(iid)
+
+	return nil
+}
+
+// deleteItemRecords deletes an Item and its Attachments and Revisions with
+// the given recorder.
+func deleteItemRecords(r recorder, imd ItemMetadata) error {
+	err := r.DeleteItem(imd.ItemId)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.UpdateNoteItem: %v", err)
+		return err
 	}
 
-	// 3.b Save the item to the database
-	err = n.Save(u.store, u.crypt)
-	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.UpdateNoteItem: %v", err)
+	for _, amd := range imd.Attachments {
+		err = r.DeleteAttachment(amd.AttachmentId)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, rmd := range imd.Revisions {
+		err = r.DeleteRevision(rmd.RevisionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveUser encrypts the User with the AuthKey and saves it under the
+// AuthToken with the given recorder.
+func (u *UnlockedBox) saveUser(r recorder) error {
+	u.crypt.ChangeKey(u.authKey[:])
+
+	return u.user.Save(r, u.crypt, u.authToken)
+}
+
+// saveRecovery updates the recovery record, if the user has one, with the
+// current AuthToken, Keyset CryptKey, and User.
+func (u *UnlockedBox) saveRecovery(r recorder) error {
+	if u.user.RecoveryId == (AuthToken{}) {
+		return nil
 	}
 
-	// 4.  Update the ItemMetadata Name to match the NoteItem Name
-	imd.Name = n.Name
-	u.metadata.AddItem(imd)
+	rec, err := NewRecoveryFromStore(r, u.user.RecoveryId)
+	if err != nil {
+		return fmt.Errorf("could not UnlockedBox.saveRecovery: %v", err)
+	}
 
-	// 5.  Save the Metadata
-	// 5.a Derive the CryptKey used to encrypt the Metadata
-	key, err = u.keyset.GetNewMetadataKey(u.user.MetadataId)
+	err = rec.seal(u.crypt, u.user.RecoveryKey, u.recoveryData())
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.UpdateNoteItem: %v", err)
+		return fmt.Errorf("could not UnlockedBox.saveRecovery: %v", err)
 	}
 
-	// 5.b Update our crypter with the derived CryptKey and save the
-	//     encrypted Metadata to the database.
-	u.crypt.ChangeKey(key[:])
-	err = u.metadata.Save(u.store, u.crypt)
+	err = rec.Save(r)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.UpdateNoteItem: %v", err)
+		return fmt.Errorf("could not UnlockedBox.saveRecovery: %v", err)
 	}
 
 	return nil
 }
 
-// Delete NoteItem
-//  1. Delete Item from the database.
-//  2. Delete ItemMetadata from Metadata
-//  3. Save the Metadata to the database.
-func (u *UnlockedBox) DeleteItem(iid ItemToken) error {
-	// 1.  Delete Item from database
-	err := u.store.DeleteItem(iid)
+// recoveryData returns the data needed to recover this account.
+func (u *UnlockedBox) recoveryData() recoveryData {
+	return recoveryData{
+		AuthToken: u.authToken,
+		KeysetKey: u.keysetKey,
+		User:      *u.user,
+	}
+}
+
+// HasRecoveryPhrase reports whether the user has a recovery phrase.
+func (u *UnlockedBox) HasRecoveryPhrase() bool {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return u.user.RecoveryId != (AuthToken{})
+}
+
+// Rotate Recovery Phrase
+//  1. Generate a new recovery phrase and derive its AuthKey and RecoveryId.
+//  2. Save a new recovery record encrypted with a new RecoveryKey.
+//  3. Save the User with the new RecoveryId and RecoveryKey.
+//  4. Delete the old recovery record, if there is one, so the old phrase can
+//     no longer be used.
+//
+// Steps 2 through 4 run in a single transaction.
+func (u *UnlockedBox) RotateRecoveryPhrase() (string, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	// 1.  Generate a new recovery phrase and derive its AuthKey and
+	//     RecoveryId.
+	phrase := newRecoveryPhrase()
+
+	baseKey, err := u.derive.DeriveBaseKey(u.user.UserName, phrase)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.DeleteNoteItem: %v", err)
+		return "", fmt.Errorf("could not UnlockedBox.RotateRecoveryPhrase: %v", err)
 	}
 
-	// 2.  Delete ItemMetadata from Metadata
-	u.metadata.DeleteItem(iid)
+	rk, err := u.derive.DeriveAuthKey(baseKey)
+	if err != nil {
+		return "", fmt.Errorf("could not UnlockedBox.RotateRecoveryPhrase: %v", err)
+	}
 
-	// 3. Save Metadata to the database
-	// 3.a Derive the CryptKey used to encrypt the Metadata
-	key, err := u.keyset.GetNewMetadataKey(u.user.MetadataId)
+	rid, err := u.derive.DeriveAuthToken(baseKey, u.user.UserId)
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.AddNoteItem: %v", err)
+		return "", fmt.Errorf("could not UnlockedBox.RotateRecoveryPhrase: %v", err)
 	}
 
-	// 3.b Update our crypter with the derived CryptKey and save the
-	//     encrypted Metadata to the database.
-	u.crypt.ChangeKey(key[:])
-	err = u.metadata.Save(u.store, u.crypt)
+	oldId := u.user.RecoveryId
+	oldKey := u.user.RecoveryKey
+
+	err = u.store.Update(func(r recorder) error {
+		// 2.  Save a new recovery record encrypted with a new RecoveryKey.
+		u.user.RecoveryId = rid
+		u.user.RecoveryKey = NewCryptKey()
+
+		rec, err := newRecovery(u.crypt, rid, rk, u.user.UserId, u.user.RecoveryKey)
+		if err != nil {
+			return err
+		}
+
+		err = rec.seal(u.crypt, u.user.RecoveryKey, u.recoveryData())
+		if err != nil {
+			return err
+		}
+
+		err = rec.Save(r)
+		if err != nil {
+			return err
+		}
+
+		// 3.  Save the User with the new RecoveryId and RecoveryKey.
+		err = u.saveUser(r)
+		if err != nil {
+			return err
+		}
+
+		// 4.  Delete the old recovery record.
+		if oldId != (AuthToken{}) {
+			return r.DeleteRecovery(oldId)
+		}
+
+		return nil
+	})
+	if err != nil {
+		u.user.RecoveryId = oldId
+		u.user.RecoveryKey = oldKey
+		return "", fmt.Errorf("could not UnlockedBox.RotateRecoveryPhrase: %v", err)
+	}
+
+	return formatRecoveryPhrase(phrase), nil
+}
+
+// Revoke Recovery Phrase
+//  1. Remove the RecoveryId and RecoveryKey from the User and save it.
+//  2. Delete the recovery record.
+//
+// Both steps run in a single transaction.
+func (u *UnlockedBox) RevokeRecoveryPhrase() error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	rid := u.user.RecoveryId
+	key := u.user.RecoveryKey
+	if rid == (AuthToken{}) {
+		return nil
+	}
+
+	err := u.store.Update(func(r recorder) error {
+		// 1.  Remove the RecoveryId and RecoveryKey from the User and save
+		//     it.
+		u.user.RecoveryId = AuthToken{}
+		u.user.RecoveryKey = CryptKey{}
+
+		err := u.saveUser(r)
+		if err != nil {
+			return err
+		}
+
+		// 2.  Delete the recovery record.
+		return r.DeleteRecovery(rid)
+	})
 	if err != nil {
-		return fmt.Errorf("could not UnlockedBox.AddNoteItem: %v", err)
+		u.user.RecoveryId = rid
+		u.user.RecoveryKey = key
+		return fmt.Errorf("could not UnlockedBox.RevokeRecoveryPhrase: %v", err)
 	}
 
 	return nil
@@ -263,39 +713,147 @@ func (u *UnlockedBox) DeleteItem(iid ItemToken) error {
 
 // GetUserName returns the username associated with the unlocked box.
 func (u *UnlockedBox) GetUserName() string {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
 	return u.user.UserName
 }
 
-// GetItemList returns a mapping of item Names and ItemIds.
+// GetItemList returns a mapping of item Names and ItemIds, sorted by name.
+// Items in the trash are not listed.
 func (u *UnlockedBox) GetItemList() []ItemMetadata {
-	return u.metadata.GetItems()
+	return u.GetItemListWithOptions(ItemListOptions{})
 }
 
-// GetItem returns the NoteItem associated with the given ItemId.
-func (u *UnlockedBox) GetItem(iid ItemToken) (NoteItem, error) {
-	var ni NoteItem
+// GetItemListByType returns the ItemMetadata of every Item of the given
+// type, sorted by name, without decrypting the Items.
+func (u *UnlockedBox) GetItemListByType(t ItemType) []ItemMetadata {
+	return u.GetItemListWithOptions(ItemListOptions{Type: t})
+}
+
+// GetItemListWithOptions returns the ItemMetadata of the Items that match
+// the filters in the options, in the order given by the options, without
+// decrypting the Items. Items in the trash are not listed.
+func (u *UnlockedBox) GetItemListWithOptions(opts ItemListOptions) []ItemMetadata {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	return opts.apply(u.metadata.GetActiveItems())
+}
+
+// accessedResolution is how often the time an Item was read is saved. Items
+// that are read repeatedly, such as a TOTP Item shown in the GUI, do not
+// save the Metadata on every read.
+const accessedResolution = time.Minute
+
+// touchItem records that an Item was read. Failing to save the time is not
+// an error because the Item was read successfully, so the Metadata is only
+// rolled back.
+func (u *UnlockedBox) touchItem(imd ItemMetadata) {
+	now := time.Now().UTC()
+	if now.Sub(imd.Accessed) < accessedResolution {
+		return
+	}
+
+	touched := imd
+	touched.Accessed = now
+	u.metadata.AddItem(touched)
 
-	key, err := u.keyset.GetNewItemKey(iid)
+	err := u.store.Update(u.saveMetadata)
 	if err != nil {
-		return ni, fmt.Errorf("could not UnlockedBox.GetItem: %v", err)
+		u.metadata.AddItem(imd)
 	}
+}
 
-	u.crypt.ChangeKey(key[:])
+// GetItem returns the Item associated with the given ItemId. The Item is
+// decrypted with the key version recorded in its ItemMetadata, so Items that
+// have not been reencrypted since a password change can still be read. The
+// time the Item was read is saved in its ItemMetadata.
+func (u *UnlockedBox) GetItem(iid ItemToken) (Item, error) {
+	var ni Item
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return ni, fmt.Errorf("could not UnlockedBox.GetItem %s: %v", iid, err)
+	}
 
-	ni, err = NewNoteItemFromStore(u.store, u.crypt, iid)
+	ni, _, err = u.loadItem(imd)
 	if err != nil {
 		return ni, fmt.Errorf("could not UnlockedBox.GetItem %s: %v", iid, err)
 	}
 
+	u.touchItem(imd)
+
 	return ni, nil
 }
 
-// Lock will set a random key on the crypter and set the User, Keyset, and
-// Metadata to nil to make this UnlockedBox useless.
+// GetOTPCode returns the current one-time code for an OTP Item and the
+// number of seconds it remains valid. HOTP codes do not expire; each call
+// returns the code for the Item's counter, then advances and saves the
+// counter so the next call returns the next code.
+func (u *UnlockedBox) GetOTPCode(iid ItemToken) (string, int, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	imd, err := u.getItemMetadata(iid)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not UnlockedBox.GetOTPCode %s: %v", iid, err)
+	}
+
+	item, _, err := u.loadItem(imd)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not UnlockedBox.GetOTPCode %s: %v", iid, err)
+	}
+
+	if item.OTP == nil {
+		return "", 0, fmt.Errorf("could not UnlockedBox.GetOTPCode %s: not an otp item", iid)
+	}
+
+	code, remaining, err := item.OTP.Code(time.Now())
+	if err != nil {
+		return "", 0, fmt.Errorf("could not UnlockedBox.GetOTPCode %s: %v", iid, err)
+	}
+
+	// Saving the HOTP counter also records the access time.
+	if item.OTP.Kind != HOTPKind {
+		u.touchItem(imd)
+		return code, remaining, nil
+	}
+
+	item.OTP.Counter++
+
+	err = u.updateItem(item, false)
+	if err != nil {
+		return "", 0, fmt.Errorf("could not UnlockedBox.GetOTPCode %s: %v", iid, err)
+	}
+
+	return code, remaining, nil
+}
+
+// Lock will stop the maintenance job, set a random key on the crypter, set
+// the User, Keyset, and Metadata to nil, and clear the search index to make
+// this UnlockedBox useless.
 func (u *UnlockedBox) Lock() {
+	if u.maintenance != nil {
+		u.maintenance.stop()
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
 	key := NewCryptKey()
 	u.crypt.ChangeKey(key[:])
+	u.authToken = AuthToken{}
+	u.authKey = AuthKey{}
+	u.keysetKey = CryptKey{}
 	u.user = nil
 	u.keyset = nil
 	u.metadata = nil
+
+	if u.index != nil {
+		u.index.clear()
+	}
 }
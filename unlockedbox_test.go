@@ -2,6 +2,7 @@ package lckbx
 
 import (
 	"fmt"
+	"os"
 	"testing"
 )
 
@@ -139,8 +140,9 @@ func TestUnlockedBox(t *testing.T) {
 		t.Fatalf("Expected no error, received %v", err)
 	}
 
-	// 5.a Login as the user
-	ub, err = lb.Login(unlockedBoxUser, lockedBoxBadPassword)
+	// 5.a Login as the user without starting the maintenance job, so that we
+	//     can check the Keyset before the old key is purged.
+	ub, err = lb.login(unlockedBoxUser, lockedBoxBadPassword)
 	if err != nil {
 		t.Fatalf("Expected no error, received %v", err)
 	}
@@ -169,12 +171,15 @@ func TestUnlockedBox(t *testing.T) {
 	}
 
 	// 6. Run reencryption and key purge routines.
-	err = ub.updateEncryption()
-	if err != nil {
-		t.Fatalf("Expected no error, received %v", err)
+	ub.startMaintenance()
+	status := ub.WaitMaintenance()
+	if status.Err != nil {
+		t.Fatalf("Expected no error, received %v", status.Err)
 	}
 
-	ub.purgeUnusedKeys()
+	if status.Total != 1 || status.Done != 1 || status.Purged != 1 {
+		t.Fatalf("Expected one item reencrypted and one key purged, received %+v", status)
+	}
 
 	// 7. Verify key purge and ensure we can still read item.
 	// 7.a Ensure we have only one key in our keyset now.
@@ -197,3 +202,135 @@ func TestUnlockedBox(t *testing.T) {
 		t.Fatalf("Expected NoteItems to be equal, received: \n%+v\n%+v\n", n4, n5)
 	}
 }
+
+var (
+	rotationDB        = "rotation_test.db"
+	rotationUser      = "rotation_user"
+	rotationPasswords = []string{lockedBoxGoodPassword, lockedBoxBadPassword, recoveryPassword}
+)
+
+// readAllItems reads every Item in the UnlockedBox with GetItem and ensures
+// it matches the NoteItem that was saved.
+func readAllItems(t *testing.T, ub *UnlockedBox, notes map[ItemToken]NoteItem) {
+	items := ub.GetItemList()
+	if len(items) != len(notes) {
+		t.Fatalf("Expected %d items, found %d", len(notes), len(items))
+	}
+
+	for iid, n := range notes {
+		n2, err := ub.GetItem(iid)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		if !n2.Equal(n) {
+			t.Fatalf("Expected NoteItems to be equal, received: \n%+v\n%+v\n", n, n2)
+		}
+	}
+}
+
+// Regression test for reading Items after a password change
+// 1. Register a user and add items.
+// 2. Change the password twice, adding items in between.
+// 3. Read all items, which are encrypted with three different keys.
+// 4. Rotate the items to the latest key and purge the old keys.
+// 5. Login again and read all items.
+func TestKeyRotation(t *testing.T) {
+	fmt.Println(t.Name())
+
+	notes := make(map[ItemToken]NoteItem)
+
+	// 1.  Register a user and add items.
+	store, err := NewStore(rotationDB)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer os.Remove(rotationDB)
+	defer store.Close()
+
+	lb, err := NewLockedBox(&store)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	err = lb.Register(rotationUser, rotationPasswords[0])
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	// 2.  Change the password twice, adding items with each password.
+	for i, password := range rotationPasswords {
+		if i > 0 {
+			err = lb.ChangePassword(rotationUser, rotationPasswords[i-1], password)
+			if err != nil {
+				t.Fatalf("Expected no error, received %v", err)
+			}
+		}
+
+		ub, err := lb.login(rotationUser, password)
+		if err != nil {
+			t.Fatalf("Expected no error, received %v", err)
+		}
+
+		for j := 0; j < 3; j++ {
+			n := NewNoteItem()
+			n.Name = fmt.Sprintf("Note %d.%d", i, j)
+			n.Data = []byte(n.Name)
+
+			err = ub.AddNoteItem(n)
+			if err != nil {
+				t.Fatalf("Expected no error, received %v", err)
+			}
+
+			notes[n.ItemId] = n
+		}
+
+		ub.Lock()
+	}
+
+	// 3.  Read all items, which are encrypted with three different keys.
+	password := rotationPasswords[len(rotationPasswords)-1]
+
+	ub, err := lb.login(rotationUser, password)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+
+	if len(ub.keyset.Keys) != len(rotationPasswords) {
+		t.Fatalf("Expected %d keys in our keyset, found %d", len(rotationPasswords), len(ub.keyset.Keys))
+	}
+
+	readAllItems(t, &ub, notes)
+
+	// 4.  Rotate the items to the latest key and purge the old keys.
+	ub.startMaintenance()
+	status := ub.WaitMaintenance()
+	if status.Err != nil {
+		t.Fatalf("Expected no error, received %v", status.Err)
+	}
+
+	if status.Purged != len(rotationPasswords)-1 {
+		t.Fatalf("Expected %d keys purged, received %+v", len(rotationPasswords)-1, status)
+	}
+
+	readAllItems(t, &ub, notes)
+	ub.Lock()
+
+	// 5.  Login again and read all items.
+	ub, err = lb.Login(rotationUser, password)
+	if err != nil {
+		t.Fatalf("Expected no error, received %v", err)
+	}
+	defer ub.Lock()
+
+	readAllItems(t, &ub, notes)
+
+	status = ub.WaitMaintenance()
+	if status.Total != 0 || status.Purged != 0 {
+		t.Fatalf("Expected nothing left to rotate, received %+v", status)
+	}
+
+	if len(ub.keyset.Keys) != 1 {
+		t.Fatalf("Expected one key in our keyset, found %d", len(ub.keyset.Keys))
+	}
+}
@@ -7,18 +7,26 @@ import (
 
 // The User struct holds the minimum data we need to identify our user. It is
 // stored in the database encrypted with the derived AuthKey.
+//
+// If the user has a recovery phrase, the RecoveryId identifies the recovery
+// record and the RecoveryKey encrypts it. Both are zero when there is no
+// recovery phrase.
 type User struct {
-	UserId     UserToken
-	UserName   string
-	KeysetId   KeysetToken
-	MetadataId MetadataToken
+	UserId      UserToken
+	UserName    string
+	KeysetId    KeysetToken
+	MetadataId  MetadataToken
+	RecoveryId  AuthToken
+	RecoveryKey CryptKey
 }
 
 func (u *User) Equal(u2 *User) bool {
 	return u.UserId.String() == u2.UserId.String() &&
 		u.UserName == u2.UserName &&
 		u.KeysetId.String() == u2.KeysetId.String() &&
-		u.MetadataId.String() == u2.MetadataId.String()
+		u.MetadataId.String() == u2.MetadataId.String() &&
+		u.RecoveryId.String() == u2.RecoveryId.String() &&
+		u.RecoveryKey.String() == u2.RecoveryKey.String()
 }
 
 func (u *User) bytes(crypt crypter) ([]byte, error) {
@@ -37,8 +45,8 @@ func (u *User) bytes(crypt crypter) ([]byte, error) {
 	return encrypted, nil
 }
 
-// Create adds a new User, as encrypted bytes, to the given storer.
-func (u *User) Create(store storer, crypt crypter, aid AuthToken) error {
+// Create adds a new User, as encrypted bytes, to the given recorder.
+func (u *User) Create(store recorder, crypt crypter, aid AuthToken) error {
 	userId := store.GetUserId(u.UserName)
 
 	if userId.String() != "ut_AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA" {
@@ -64,8 +72,8 @@ func (u *User) Create(store storer, crypt crypter, aid AuthToken) error {
 	return nil
 }
 
-// Save stores the User as encrypted bytes in the given storer.
-func (u *User) Save(store storer, crypt crypter, aid AuthToken) error {
+// Save stores the User as encrypted bytes in the given recorder.
+func (u *User) Save(store recorder, crypt crypter, aid AuthToken) error {
 	bytes, err := u.bytes(crypt)
 	if err != nil {
 		return fmt.Errorf("could not User.Save: %v", err)
@@ -106,7 +114,7 @@ func newUserFromBytes(crypt crypter, encrypted []byte, ad []byte) (User, error)
 	return user, nil
 }
 
-func NewUserFromStore(store storer, crypt crypter, aid AuthToken, uid UserToken) (*User, error) {
+func NewUserFromStore(store recorder, crypt crypter, aid AuthToken, uid UserToken) (*User, error) {
 	var user User
 
 	bytes, err := store.GetUser(aid)